@@ -54,6 +54,9 @@ func main() {
 
 	repos := repository.NewRepositories(db)
 	services := service.NewServices(repos, redisClient)
+	if cfg.UCP.PaymentEnvironment == "test" {
+		services.PaymentProvider.Register(service.SandboxProviderName, service.NewSandboxPaymentProvider())
+	}
 
 	gin.SetMode(cfg.Server.Mode)
 	r := gin.Default()
@@ -62,20 +65,55 @@ func main() {
 	r.Use(middleware.RequestLogger())
 
 	authMiddleware := middleware.NewAuthMiddleware(cfg.JWT.Secret)
+	authMiddleware.SetSessions(services.UserSession)
+	oauthBearer := middleware.NewOAuthBearerMiddleware(cfg.JWT.Secret, services.OAuthTokenRepo, services.OAuthClientRepo)
+	tokenKeys := loadTokenKeys(cfg.JWT, repos.JWTSigningKey, services.AuditLog)
+	if tokenKeys != nil {
+		api.SetTokenSigner(tokenKeys)
+		authMiddleware.SetTokenKeys(tokenKeys, cfg.JWT.AcceptHS256)
+		oauthBearer.SetTokenKeys(tokenKeys, cfg.JWT.AcceptHS256)
+	}
+	var tokenJWKS ucpapi.SigningKeySource
+	if tokenKeys != nil {
+		tokenJWKS = tokenKeys
+	}
+	oauthJWKSHandler := ucpapi.NewJWKSHandler(tokenJWKS)
+	checkoutWrite := oauthBearer.RequireScopes(service.OAuthScopeCheckoutSession)
+	checkoutRead := oauthBearer.RequireScopes(service.OAuthScopeCheckoutSessionRead)
+	webhookSigner, signingKeyStore, err := service.LoadWebhookKeys(cfg.UCP.Webhook, repos.SigningKey, services.AuditLog, true)
+	if err != nil {
+		log.Fatalf("Failed to load webhook signing keys: %v", err)
+	}
+	if signingKeyStore == nil {
+		log.Println("Webhook signing uses the key file; set ucp.webhook.signing_key_encryption_key to manage keys in the database")
+	}
+	services.WebhookQueue.SetSigner(webhookSigner)
+	var adminSigningKeyService api.AdminSigningKeyService
+	if signingKeyStore != nil {
+		adminSigningKeyService = signingKeyStore
+	}
+	adminSigningKeyHandler := api.NewAdminSigningKeyHandler(adminSigningKeyService)
 	ucpProfileHandler := ucpapi.NewProfileHandler(services)
+	ucpProfileHandler.SetSigningKeys(webhookSigner)
+	ucpJWKSHandler := ucpapi.NewJWKSHandler(webhookSigner)
 	ucpCheckoutHandler := ucpapi.NewCheckoutHandlerWithConfig(services, ucpapi.CheckoutHandlerConfig{
 		Links:           buildUCPLinks(cfg.UCP.Links),
 		ContinueURLBase: cfg.UCP.ContinueURLBase,
+		ReservationTTL:  time.Duration(cfg.UCP.ReservationTTLMinutes) * time.Minute,
 	})
 	ucpVerifier := security.NewJWKVerifier(cfg.UCP.Webhook.JWKSetURL, cfg.UCP.Webhook.ClockSkewSeconds)
 	ucpVerifier.SetSkipVerify(cfg.UCP.Webhook.SkipSignatureVerify)
 	ucpVerifier.SetNonceStore(ucpapi.NewWebhookReplayNonceStore(services.WebhookReplay))
+	ucpVerifier.SetSenderResolver(ucpapi.NewWebhookSenderResolver(services.OAuthToken, cfg.UCP.Webhook.TrustedProfileHosts))
 	ucpOrderWebhookHandler := ucpapi.NewOrderWebhookHandlerWithVerifier(services, ucpVerifier)
-	paymentCallbackHandler := api.NewPaymentCallbackHandler(services.Payment, services.Order)
+	paymentCallbackHandler := api.NewPaymentCallbackHandler(services.Payment)
 	paymentRefundHandler := api.NewPaymentRefundHandler(services.Payment)
 	oauthMetadataHandler := api.NewOAuthMetadataHandler()
 	oauthTokenHandler := api.NewOAuthTokenHandlerWithRepos(services.OAuthClientRepo, services.OAuthTokenRepo)
-	oauthAuthorizeHandler := api.NewOAuthAuthorizeHandler()
+	oauthTokenHandler.SetAuthorizationFlow(services.OAuthAuthorization)
+	oauthTokenHandler.SetRefreshTokens(services.OAuthToken)
+	oauthAuthorizeHandler := api.NewOAuthAuthorizeHandler(services.OAuthAuthorization)
+	oauthAuthorizeHandler.SetConsentURL(cfg.UCP.OAuthConsentURL)
 	oauthRevokeHandler := api.NewOAuthRevokeHandler(services.OAuthToken)
 	adminOrderWebhookHandler := api.NewAdminOrderWebhookHandler(services.Order, services.WebhookQueue, api.AdminOrderWebhookConfig{
 		DeliveryURL: cfg.UCP.Webhook.DeliveryURL,
@@ -87,6 +125,7 @@ func main() {
 	addressValidationHandler := api.NewAddressValidationHandler()
 	couponHandler := api.NewCouponHandler(services.Promotion)
 	metricsHandler := api.NewMetricsHandler(cfg.Server.MetricsToken)
+	userSessionHandler := api.NewUserSessionHandler(services.UserSession, services.User)
 
 	apiGroup := r.Group("/api/v1")
 	{
@@ -98,8 +137,12 @@ func main() {
 			})
 			public.POST("/login", func(c *gin.Context) {
 				userHandler := api.NewUserHandler(services.User)
+				userHandler.SetSessions(services.UserSession)
 				userHandler.Login(c)
 			})
+			public.POST("/token/refresh", func(c *gin.Context) {
+				userSessionHandler.Refresh(c)
+			})
 		}
 
 		user := apiGroup.Group("/user")
@@ -113,6 +156,46 @@ func main() {
 				userHandler := api.NewUserHandler(services.User)
 				userHandler.UpdateCurrentUser(c)
 			})
+			user.GET("/sessions", func(c *gin.Context) {
+				userSessionHandler.List(c)
+			})
+			user.DELETE("/sessions/:session_id", func(c *gin.Context) {
+				userSessionHandler.Revoke(c)
+			})
+			user.POST("/logout", func(c *gin.Context) {
+				userSessionHandler.Logout(c)
+			})
+			user.POST("/logout-all", func(c *gin.Context) {
+				userSessionHandler.LogoutAll(c)
+			})
+			user.POST("/oauth/consent", func(c *gin.Context) {
+				oauthAuthorizeHandler.Consent(c)
+			})
+
+			cartHandler := api.NewCartHandler(services.Cart)
+			user.GET("/cart", func(c *gin.Context) {
+				cartHandler.Get(c)
+			})
+			user.POST("/cart/items", func(c *gin.Context) {
+				cartHandler.AddItem(c)
+			})
+			user.PUT("/cart/items/:product_id", func(c *gin.Context) {
+				cartHandler.UpdateItem(c)
+			})
+			user.DELETE("/cart/items/:product_id", func(c *gin.Context) {
+				cartHandler.RemoveItem(c)
+			})
+			user.DELETE("/cart", func(c *gin.Context) {
+				cartHandler.Clear(c)
+			})
+
+			userOrderHandler := api.NewUserOrderHandler(services.Order)
+			user.GET("/orders", func(c *gin.Context) {
+				userOrderHandler.List(c)
+			})
+			user.GET("/orders/:id", func(c *gin.Context) {
+				userOrderHandler.Get(c)
+			})
 		}
 
 		productHandler := api.NewProductHandler(services.Product, services.Localization)
@@ -131,14 +214,14 @@ func main() {
 		})
 
 		orderHandler := api.NewOrderHandler(services.Order)
-		apiGroup.POST("/orders", func(c *gin.Context) {
+		apiGroup.POST("/orders", authMiddleware.Auth(), func(c *gin.Context) {
 			orderHandler.Create(c)
 		})
 		apiGroup.POST("/payment/callback", func(c *gin.Context) {
 			paymentCallbackHandler.Handle(c)
 		})
-		apiGroup.POST("/payments/:id/refund", func(c *gin.Context) {
-			paymentRefundHandler.Create(c)
+		apiGroup.POST("/payment/callback/:handler", func(c *gin.Context) {
+			paymentCallbackHandler.Handle(c)
 		})
 		apiGroup.GET("/shipping/rates", func(c *gin.Context) {
 			shippingRateHandler.List(c)
@@ -157,6 +240,9 @@ func main() {
 				userHandler := api.NewUserHandler(services.User)
 				userHandler.ListUsers(c)
 			})
+			admin.DELETE("/users/:id/sessions", func(c *gin.Context) {
+				userSessionHandler.AdminRevokeAll(c)
+			})
 			admin.GET("/ucp/webhook-audits", func(c *gin.Context) {
 				webhookAuditHandler := api.NewWebhookAuditHandler(services.WebhookAudit)
 				webhookAuditHandler.List(c)
@@ -165,6 +251,10 @@ func main() {
 				webhookAlertHandler := api.NewWebhookAlertHandler(services.WebhookAlert)
 				webhookAlertHandler.List(c)
 			})
+			admin.GET("/ucp/webhook-breakers", func(c *gin.Context) {
+				webhookBreakerHandler := api.NewWebhookBreakerHandler(services.WebhookBreaker)
+				webhookBreakerHandler.List(c)
+			})
 			admin.GET("/ucp/webhook-jobs", func(c *gin.Context) {
 				webhookJobHandler := api.NewWebhookJobHandler(services.WebhookQueue)
 				webhookJobHandler.List(c)
@@ -173,6 +263,31 @@ func main() {
 				webhookJobHandler := api.NewWebhookJobHandler(services.WebhookQueue)
 				webhookJobHandler.Retry(c)
 			})
+			adminWebhookSubscriptionHandler := api.NewAdminWebhookSubscriptionHandler(services.WebhookSubscription)
+			admin.GET("/ucp/webhook-subscriptions", func(c *gin.Context) {
+				adminWebhookSubscriptionHandler.List(c)
+			})
+			admin.POST("/ucp/webhook-subscriptions", func(c *gin.Context) {
+				adminWebhookSubscriptionHandler.Create(c)
+			})
+			admin.GET("/ucp/webhook-subscriptions/:id", func(c *gin.Context) {
+				adminWebhookSubscriptionHandler.Get(c)
+			})
+			admin.PUT("/ucp/webhook-subscriptions/:id", func(c *gin.Context) {
+				adminWebhookSubscriptionHandler.Update(c)
+			})
+			admin.DELETE("/ucp/webhook-subscriptions/:id", func(c *gin.Context) {
+				adminWebhookSubscriptionHandler.Delete(c)
+			})
+			admin.GET("/ucp/signing-keys", func(c *gin.Context) {
+				adminSigningKeyHandler.List(c)
+			})
+			admin.POST("/ucp/signing-keys/rotate", func(c *gin.Context) {
+				adminSigningKeyHandler.Rotate(c)
+			})
+			admin.POST("/ucp/signing-keys/:kid/retire", func(c *gin.Context) {
+				adminSigningKeyHandler.Retire(c)
+			})
 
 			adminProductHandler := api.NewAdminProductHandler(services.Product)
 			admin.GET("/products", func(c *gin.Context) {
@@ -232,18 +347,38 @@ func main() {
 			admin.POST("/orders/:id/refund", func(c *gin.Context) {
 				adminOrderHandler.Refund(c)
 			})
+			admin.POST("/payments/:id/refund", func(c *gin.Context) {
+				paymentRefundHandler.Create(c)
+			})
+
+			adminRefundHandler := api.NewAdminRefundHandler(services.Payment)
+			admin.GET("/orders/:id/refunds", func(c *gin.Context) {
+				adminRefundHandler.List(c)
+			})
+			admin.POST("/refunds/:id/confirm", func(c *gin.Context) {
+				adminRefundHandler.Confirm(c)
+			})
 			admin.POST("/webhooks/dlq/:id/replay", func(c *gin.Context) {
 				adminWebhookDLQHandler.Replay(c)
 			})
 			admin.GET("/webhooks/dlq", func(c *gin.Context) {
 				adminWebhookDLQHandler.List(c)
 			})
+			admin.POST("/webhooks/dlq/replay", func(c *gin.Context) {
+				adminWebhookDLQHandler.ReplayBulk(c)
+			})
+			admin.DELETE("/webhooks/dlq", func(c *gin.Context) {
+				adminWebhookDLQHandler.Purge(c)
+			})
 			admin.POST("/oauth/clients", func(c *gin.Context) {
 				adminOAuthClientHandler.Create(c)
 			})
 			admin.GET("/oauth/clients", func(c *gin.Context) {
 				adminOAuthClientHandler.List(c)
 			})
+			admin.PUT("/oauth/clients/:client_id/jwks", func(c *gin.Context) {
+				adminOAuthClientHandler.SetJWKS(c)
+			})
 
 			adminAuditHandler := api.NewAdminAuditHandler(services.AuditLog)
 			admin.GET("/audit-logs", func(c *gin.Context) {
@@ -260,6 +395,9 @@ func main() {
 	r.GET("/.well-known/ucp", func(c *gin.Context) {
 		ucpProfileHandler.GetProfile(c)
 	})
+	r.GET("/.well-known/jwks.json", func(c *gin.Context) {
+		ucpJWKSHandler.Serve(c)
+	})
 	r.GET("/.well-known/oauth-authorization-server", func(c *gin.Context) {
 		oauthMetadataHandler.WellKnown(c)
 	})
@@ -272,14 +410,11 @@ func main() {
 	r.POST("/oauth2/revoke", func(c *gin.Context) {
 		oauthRevokeHandler.Revoke(c)
 	})
-	r.GET("/oauth2/authorize", func(c *gin.Context) {
-		oauthAuthorizeHandler.Authorize(c)
-	})
-	r.GET("/.well-known/oauth-authorization-server", func(c *gin.Context) {
-		oauthMetadataHandler.WellKnown(c)
+	r.POST("/oauth2/introspect", func(c *gin.Context) {
+		oauthTokenHandler.Introspect(c)
 	})
-	r.POST("/oauth2/token", func(c *gin.Context) {
-		oauthTokenHandler.Token(c)
+	r.GET("/oauth2/jwks", func(c *gin.Context) {
+		oauthJWKSHandler.Serve(c)
 	})
 	r.GET("/oauth2/authorize", func(c *gin.Context) {
 		oauthAuthorizeHandler.Authorize(c)
@@ -287,19 +422,19 @@ func main() {
 
 	ucpGroup := r.Group("/ucp/v1")
 	{
-		ucpGroup.POST("/checkout-sessions", func(c *gin.Context) {
+		ucpGroup.POST("/checkout-sessions", checkoutWrite, func(c *gin.Context) {
 			ucpCheckoutHandler.Create(c)
 		})
-		ucpGroup.GET("/checkout-sessions/:id", func(c *gin.Context) {
+		ucpGroup.GET("/checkout-sessions/:id", checkoutRead, func(c *gin.Context) {
 			ucpCheckoutHandler.Get(c)
 		})
-		ucpGroup.PUT("/checkout-sessions/:id", func(c *gin.Context) {
+		ucpGroup.PUT("/checkout-sessions/:id", checkoutWrite, func(c *gin.Context) {
 			ucpCheckoutHandler.Update(c)
 		})
-		ucpGroup.POST("/checkout-sessions/:id/complete", func(c *gin.Context) {
+		ucpGroup.POST("/checkout-sessions/:id/complete", checkoutWrite, func(c *gin.Context) {
 			ucpCheckoutHandler.Complete(c)
 		})
-		ucpGroup.DELETE("/checkout-sessions/:id", func(c *gin.Context) {
+		ucpGroup.DELETE("/checkout-sessions/:id", checkoutWrite, func(c *gin.Context) {
 			ucpCheckoutHandler.Cancel(c)
 		})
 		ucpGroup.POST("/order-webhooks", func(c *gin.Context) {
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/meowucp/internal/repository"
+	"github.com/meowucp/internal/service"
+	"github.com/meowucp/pkg/config"
+)
+
+// loadTokenKeys opens the access token key store when an asymmetric signing
+// algorithm is configured. It returns nil when tokens stay on the shared
+// HS256 secret.
+func loadTokenKeys(cfg config.JWTConfig, repo repository.JWTSigningKeyRepository, auditLog *service.AuditLogService) *service.TokenSigningKeyService {
+	if cfg.SigningAlgorithm == "" || cfg.SigningAlgorithm == "HS256" {
+		return nil
+	}
+	encryptionKey, err := service.ParseSigningKeyEncryptionKey(cfg.SigningKeyEncryptionKey)
+	if err != nil {
+		log.Fatalf("Invalid JWT signing key encryption key: %v", err)
+	}
+	store, err := service.NewTokenSigningKeyService(repo, encryptionKey, cfg.SigningAlgorithm,
+		time.Duration(cfg.KeyRotationHours)*time.Hour, time.Duration(cfg.KeyOverlapHours)*time.Hour)
+	if err != nil {
+		log.Fatalf("Failed to open JWT signing key store: %v", err)
+	}
+	store.SetAuditLog(auditLog)
+	if err := store.EnsureActiveKey("system"); err != nil {
+		log.Fatalf("Failed to create JWT signing key: %v", err)
+	}
+	return store
+}
@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/meowucp/internal/domain"
 	"github.com/meowucp/internal/repository"
+	"github.com/meowucp/internal/service"
 	"github.com/meowucp/internal/ucp/worker"
 	"github.com/meowucp/pkg/config"
 	"github.com/meowucp/pkg/database"
@@ -35,28 +41,108 @@ func main() {
 
 	queueRepo := repository.NewUCPWebhookQueueRepository(db)
 	alertRepo := repository.NewUCPWebhookAlertRepository(db)
+	hostname, _ := os.Hostname()
 	processor := worker.NewProcessor(queueRepo, worker.ProcessorConfig{
-		BatchSize:   10,
-		MaxAttempts: 5,
-		BaseDelay:   time.Minute,
+		BatchSize:     10,
+		MaxAttempts:   5,
+		BaseDelay:     time.Minute,
+		Owner:         fmt.Sprintf("%s:%d", hostname, os.Getpid()),
+		LeaseDuration: time.Duration(cfg.UCP.Webhook.WorkerLeaseSeconds) * time.Second,
 	})
+	breakers := worker.NewCircuitBreakers(worker.BreakerConfig{
+		FailureThreshold: cfg.UCP.Webhook.BreakerFailureThreshold,
+		OpenDuration:     time.Duration(cfg.UCP.Webhook.BreakerOpenSeconds) * time.Second,
+	})
+	breakers.SetStore(repository.NewUCPWebhookBreakerRepository(db))
+	processor.SetCircuitBreakers(breakers)
+	processor.SetRateLimiter(worker.NewRateLimiter(worker.RateLimit{
+		PerSecond: cfg.UCP.Webhook.RateLimitPerSecond,
+		Burst:     cfg.UCP.Webhook.RateLimitBurst,
+	}))
 	processor.SetAlertSink(worker.NewAlertPolicySink(alertRepo, worker.AlertPolicy{
 		MinAttempts:  cfg.UCP.Webhook.AlertMinAttempts,
 		DedupeWindow: time.Duration(cfg.UCP.Webhook.AlertDedupeSeconds) * time.Second,
 	}))
 
 	sender := worker.NewDeliverySender(cfg.UCP.Webhook.DeliveryURL, time.Duration(cfg.UCP.Webhook.DeliveryTimeoutSec)*time.Second)
+	subscriptionRepo := repository.NewUCPWebhookSubscriptionRepository(db)
+	sender.SetSubscriptions(subscriptionRepo)
+	// The worker never creates the key file: it must sign with the key the
+	// API publishes, so start the API first or share the database key store.
+	signer, _, err := service.LoadWebhookKeys(cfg.UCP.Webhook, repository.NewUCPSigningKeyRepository(db), service.NewAuditLogService(repository.NewAuditLogRepository(db)), false)
+	if err != nil {
+		log.Fatalf("Failed to load webhook signing keys: %v", err)
+	}
+	sender.SetSigner(signer)
 
-	log.Println("Webhook worker started")
-	for {
-		processed, err := processor.ProcessOnce(func(job *domain.UCPWebhookJob) error {
-			return sender.Send(job)
-		})
-		if err != nil {
-			log.Printf("Worker error: %v", err)
-		}
-		if processed == 0 {
-			time.Sleep(2 * time.Second)
+	productRepo := repository.NewProductRepository(db)
+	inventoryRepo := repository.NewInventoryRepository(db)
+	inventory := service.NewInventoryService(productRepo, inventoryRepo)
+	inventory.SetReservationRepo(repository.NewStockReservationRepository(db))
+
+	orders := service.NewOrderService(repository.NewOrderRepository(db), repository.NewCartRepository(db), productRepo, inventoryRepo, repository.NewOrderIdempotencyRepository(db))
+	orders.SetStatusLogRepo(repository.NewOrderStatusLogRepository(db))
+	shipmentRepo := repository.NewShipmentRepository(db)
+	orders.SetShipmentRepo(shipmentRepo)
+	webhookQueue := service.NewWebhookQueueService(queueRepo)
+	webhookQueue.SetSubscriptions(subscriptionRepo)
+	checkoutRepo := repository.NewCheckoutSessionRepository(db)
+	webhookQueue.SetCheckoutSessions(checkoutRepo)
+	webhookQueue.SetDLQ(repository.NewWebhookDLQRepository(db), repository.NewWebhookReplayLogRepository(db))
+	webhookQueue.SetShipments(shipmentRepo)
+	processor.SetDeadLetterSink(webhookQueue)
+	orders.SetWebhookQueue(webhookQueue)
+	eventRepo := repository.NewUCPWebhookEventRepository(db)
+	inbound := service.NewInboundOrderWebhookService(orders, service.NewWebhookEventService(eventRepo), service.NewWebhookAlertService(alertRepo, eventRepo))
+	inbound.SetCheckoutSessions(checkoutRepo)
+	inbound.SetPayments(repository.NewPaymentRepository(db))
+	paymentWindow := time.Duration(cfg.Order.PaymentWindowMinutes) * time.Minute
+	cancelBatch := cfg.Order.CancelBatchSize
+	if cancelBatch <= 0 {
+		cancelBatch = 100
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			released, err := inventory.ReleaseExpiredReservations()
+			if err != nil {
+				log.Printf("Reservation sweep error: %v", err)
+			} else if released > 0 {
+				log.Printf("Released %d expired stock reservations", released)
+			}
+			if paymentWindow > 0 {
+				cancelled, err := orders.CancelUnpaidOrders(paymentWindow, cancelBatch)
+				if err != nil {
+					log.Printf("Unpaid order sweep error: %v", err)
+				} else if cancelled > 0 {
+					log.Printf("Cancelled %d unpaid orders", cancelled)
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
 		}
+	}()
+
+	concurrency := cfg.UCP.Webhook.WorkerConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
 	}
+	log.Printf("Webhook worker started with %d goroutines", concurrency)
+	processor.Run(ctx, concurrency, 2*time.Second, func(job *domain.UCPWebhookJob) error {
+		if job.Kind == worker.JobKindInbound {
+			return inbound.Apply(job)
+		}
+		return sender.Send(job)
+	}, func(err error) {
+		log.Printf("Worker error: %v", err)
+	})
+	log.Println("Webhook worker drained in-flight jobs, exiting")
 }
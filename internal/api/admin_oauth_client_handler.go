@@ -1,15 +1,18 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/service"
 )
 
 type AdminOAuthClientService interface {
-	Create(clientID, secret, scopes string) (*domain.OAuthClient, error)
+	Create(clientID, secret, scopes string, redirectURIs []string) (*domain.OAuthClient, error)
 	List(offset, limit int) ([]*domain.OAuthClient, int64, error)
+	SetJWKS(clientID, jwkSetURL string, cacheSeconds int) (*domain.OAuthClient, error)
 }
 
 type AdminOAuthClientHandler struct {
@@ -24,6 +27,13 @@ type adminOAuthClientRequest struct {
 	ClientID string `json:"client_id"`
 	Secret   string `json:"secret"`
 	Scopes   string `json:"scopes"`
+
+	RedirectURIs []string `json:"redirect_uris"`
+}
+
+type adminOAuthClientJWKSRequest struct {
+	JWKSetURL        string `json:"jwk_set_url"`
+	JWKSCacheSeconds int    `json:"jwks_cache_seconds"`
 }
 
 func (h *AdminOAuthClientHandler) Create(c *gin.Context) {
@@ -36,8 +46,12 @@ func (h *AdminOAuthClientHandler) Create(c *gin.Context) {
 		respondError(c, http.StatusBadRequest, "invalid_request", "Invalid request body")
 		return
 	}
-	client, err := h.service.Create(req.ClientID, req.Secret, req.Scopes)
+	client, err := h.service.Create(req.ClientID, req.Secret, req.Scopes, req.RedirectURIs)
 	if err != nil {
+		if errors.Is(err, service.ErrOAuthClientInvalidRedirectURI) {
+			respondError(c, http.StatusBadRequest, "invalid_redirect_uri", "redirect_uris must be absolute URIs without a fragment")
+			return
+		}
 		respondError(c, http.StatusInternalServerError, "create_failed", "Failed to create client")
 		return
 	}
@@ -72,3 +86,29 @@ func (h *AdminOAuthClientHandler) List(c *gin.Context) {
 		},
 	})
 }
+
+// SetJWKS registers the JWKS URL the client signs order webhooks with.
+func (h *AdminOAuthClientHandler) SetJWKS(c *gin.Context) {
+	if h.service == nil {
+		respondError(c, http.StatusInternalServerError, "service_unavailable", "OAuth client service unavailable")
+		return
+	}
+	var req adminOAuthClientJWKSRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_request", "Invalid request body")
+		return
+	}
+	client, err := h.service.SetJWKS(c.Param("client_id"), req.JWKSetURL, req.JWKSCacheSeconds)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrOAuthClientNotFound):
+			respondError(c, http.StatusNotFound, "not_found", "Client not found")
+		case errors.Is(err, service.ErrOAuthClientInvalidURL):
+			respondError(c, http.StatusBadRequest, "invalid_jwk_set_url", "jwk_set_url must be an http(s) URL")
+		default:
+			respondError(c, http.StatusInternalServerError, "update_failed", "Failed to update client")
+		}
+		return
+	}
+	c.JSON(http.StatusOK, client)
+}
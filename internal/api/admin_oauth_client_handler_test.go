@@ -8,6 +8,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/service"
 )
 
 type fakeOAuthClientService struct {
@@ -21,13 +22,24 @@ func (f *fakeOAuthClientService) CreateClient(client *domain.OAuthClient) error
 	return nil
 }
 
-func (f *fakeOAuthClientService) Create(clientID, secret, scopes string) (*domain.OAuthClient, error) {
-	client := &domain.OAuthClient{ClientID: clientID, SecretHash: secret, Scopes: scopes, Status: "active"}
+func (f *fakeOAuthClientService) Create(clientID, secret, scopes string, redirectURIs []string) (*domain.OAuthClient, error) {
+	client := &domain.OAuthClient{ClientID: clientID, SecretHash: secret, Scopes: scopes, Status: "active", RedirectURIs: strings.Join(redirectURIs, " ")}
 	f.created = client
 	f.items = append(f.items, client)
 	return client, nil
 }
 
+func (f *fakeOAuthClientService) SetJWKS(clientID, jwkSetURL string, cacheSeconds int) (*domain.OAuthClient, error) {
+	for _, client := range f.items {
+		if client.ClientID == clientID {
+			client.JWKSetURL = jwkSetURL
+			client.JWKSCacheSeconds = cacheSeconds
+			return client, nil
+		}
+	}
+	return nil, service.ErrOAuthClientNotFound
+}
+
 func (f *fakeOAuthClientService) ListClients(offset, limit int) ([]*domain.OAuthClient, int64, error) {
 	return f.items, int64(len(f.items)), nil
 }
@@ -1,12 +1,15 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/service"
+	"github.com/meowucp/pkg/money"
 )
 
 type AdminOrderService interface {
@@ -50,10 +53,11 @@ func (h *AdminOrderHandler) List(c *gin.Context) {
 	if userID := c.Query("user_id"); userID != "" {
 		filters["user_id = ?"] = userID
 	}
-	if minAmount := parseFloat(c.Query("amount_min")); minAmount != nil {
+	currency := c.Query("currency")
+	if minAmount := parseAmount(c.Query("amount_min"), currency); minAmount != nil {
 		filters["total >= ?"] = *minAmount
 	}
-	if maxAmount := parseFloat(c.Query("amount_max")); maxAmount != nil {
+	if maxAmount := parseAmount(c.Query("amount_max"), currency); maxAmount != nil {
 		filters["total <= ?"] = *maxAmount
 	}
 	if sku := c.Query("sku"); sku != "" {
@@ -95,11 +99,16 @@ func parseOrderTime(value string) *time.Time {
 	return nil
 }
 
-func parseFloat(value string) *float64 {
+// parseAmount reads a major-unit query value such as "12.50" as minor units
+// of the currency, rounding half to even.
+func parseAmount(value, currency string) *money.Amount {
 	if value == "" {
 		return nil
 	}
-	parsed, err := strconv.ParseFloat(value, 64)
+	if currency == "" {
+		currency = money.DefaultCurrency
+	}
+	parsed, err := money.Parse(value, currency)
 	if err != nil {
 		return nil
 	}
@@ -132,7 +141,7 @@ func (h *AdminOrderHandler) Ship(c *gin.Context) {
 	carrier := c.DefaultQuery("carrier", "")
 	tracking := c.DefaultQuery("tracking_no", "")
 	if _, err := h.service.ShipOrder(order.ID, carrier, tracking); err != nil {
-		respondError(c, http.StatusInternalServerError, "update_failed", "Failed to ship order")
+		respondOrderUpdateError(c, err, "Failed to ship order")
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"status": "shipped"})
@@ -148,7 +157,7 @@ func (h *AdminOrderHandler) Cancel(c *gin.Context) {
 		return
 	}
 	if err := h.service.CancelOrder(id, "admin_cancel"); err != nil {
-		respondError(c, http.StatusInternalServerError, "update_failed", "Failed to cancel order")
+		respondOrderUpdateError(c, err, "Failed to cancel order")
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"status": "cancelled"})
@@ -164,7 +173,7 @@ func (h *AdminOrderHandler) Receive(c *gin.Context) {
 		return
 	}
 	if err := h.service.ReceiveOrder(id); err != nil {
-		respondError(c, http.StatusInternalServerError, "update_failed", "Failed to receive order")
+		respondOrderUpdateError(c, err, "Failed to receive order")
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"status": "delivered"})
@@ -184,7 +193,7 @@ func (h *AdminOrderHandler) updateStatus(c *gin.Context, status string) {
 		return
 	}
 	if err := h.service.UpdateOrderStatus(id, status); err != nil {
-		respondError(c, http.StatusInternalServerError, "update_failed", "Failed to update order status")
+		respondOrderUpdateError(c, err, "Failed to update order status")
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"status": status})
@@ -205,24 +214,17 @@ func (h *AdminOrderHandler) ensureTransitionAllowed(c *gin.Context, id int64, st
 		respondError(c, http.StatusNotFound, "order_not_found", "Order not found")
 		return nil, false
 	}
-	if !canTransition(order.Status, status) {
-		respondError(c, http.StatusBadRequest, "invalid_status_transition", "Invalid order status transition")
+	if !service.CanTransitionOrderStatus(order.Status, status) {
+		respondError(c, http.StatusConflict, "invalid_status_transition", "Invalid order status transition")
 		return nil, false
 	}
 	return order, true
 }
 
-func canTransition(current, next string) bool {
-	switch next {
-	case "shipped":
-		return current == "paid"
-	case "cancelled":
-		return current == "pending" || current == "paid"
-	case "refunded":
-		return current == "paid"
-	case "delivered":
-		return current == "shipped"
-	default:
-		return false
+func respondOrderUpdateError(c *gin.Context, err error, message string) {
+	if errors.Is(err, service.ErrInvalidOrderTransition) {
+		respondError(c, http.StatusConflict, "invalid_status_transition", err.Error())
+		return
 	}
+	respondError(c, http.StatusInternalServerError, "update_failed", message)
 }
@@ -9,6 +9,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/service"
 )
 
 type fakeOrderService struct {
@@ -17,6 +18,7 @@ type fakeOrderService struct {
 	statusUpdates map[int64]string
 	lastFilters   map[string]interface{}
 	shipments     map[int64]*domain.Shipment
+	shipErr       error
 }
 
 func newFakeOrderService() *fakeOrderService {
@@ -57,6 +59,9 @@ func (f *fakeOrderService) CancelOrder(id int64, reason string) error {
 }
 
 func (f *fakeOrderService) ShipOrder(id int64, carrier, tracking string) (*domain.Shipment, error) {
+	if f.shipErr != nil {
+		return nil, f.shipErr
+	}
 	shipment := &domain.Shipment{OrderID: id, Carrier: carrier, TrackingNo: tracking, Status: "shipped"}
 	f.shipments[id] = shipment
 	f.statusUpdates[id] = "shipped"
@@ -232,8 +237,8 @@ func TestAdminOrderShipRejectsInvalidState(t *testing.T) {
 	resp := httptest.NewRecorder()
 	r.ServeHTTP(resp, req)
 
-	if resp.Code != http.StatusBadRequest {
-		t.Fatalf("expected status 400, got %d", resp.Code)
+	if resp.Code != http.StatusConflict {
+		t.Fatalf("expected status 409, got %d", resp.Code)
 	}
 }
 
@@ -260,6 +265,30 @@ func TestAdminOrderCancel(t *testing.T) {
 	}
 }
 
+func TestAdminOrderShipReturnsConflictOnServiceTransitionError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	svc := newFakeOrderService()
+	svc.orders[1] = &domain.Order{ID: 1, Status: "paid"}
+	svc.shipErr = &service.OrderTransitionError{From: "cancelled", To: "shipped"}
+
+	handler := NewAdminOrderHandler(svc)
+
+	r := gin.New()
+	r.POST("/api/v1/admin/orders/:id/ship", handler.Ship)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/orders/1/ship", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusConflict {
+		t.Fatalf("expected status 409, got %d", resp.Code)
+	}
+	if !strings.Contains(resp.Body.String(), "invalid_status_transition") {
+		t.Fatalf("expected invalid_status_transition error code")
+	}
+}
+
 func TestAdminOrderReceive(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -298,8 +327,8 @@ func TestAdminOrderReceiveRejectsInvalidState(t *testing.T) {
 	resp := httptest.NewRecorder()
 	r.ServeHTTP(resp, req)
 
-	if resp.Code != http.StatusBadRequest {
-		t.Fatalf("expected status 400, got %d", resp.Code)
+	if resp.Code != http.StatusConflict {
+		t.Fatalf("expected status 409, got %d", resp.Code)
 	}
 }
 
@@ -318,8 +347,8 @@ func TestAdminOrderCancelRejectsInvalidState(t *testing.T) {
 	resp := httptest.NewRecorder()
 	r.ServeHTTP(resp, req)
 
-	if resp.Code != http.StatusBadRequest {
-		t.Fatalf("expected status 400, got %d", resp.Code)
+	if resp.Code != http.StatusConflict {
+		t.Fatalf("expected status 409, got %d", resp.Code)
 	}
 }
 
@@ -361,7 +390,7 @@ func TestAdminOrderRefundRejectsInvalidState(t *testing.T) {
 	resp := httptest.NewRecorder()
 	r.ServeHTTP(resp, req)
 
-	if resp.Code != http.StatusBadRequest {
-		t.Fatalf("expected status 400, got %d", resp.Code)
+	if resp.Code != http.StatusConflict {
+		t.Fatalf("expected status 409, got %d", resp.Code)
 	}
 }
@@ -1,7 +1,6 @@
 package api
 
 import (
-	"math"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -50,13 +49,14 @@ func (h *AdminPaymentHandler) List(c *gin.Context) {
 	if userID := c.Query("user_id"); userID != "" {
 		filters["user_id = ?"] = userID
 	}
-	if currency := c.Query("currency"); currency != "" {
+	currency := c.Query("currency")
+	if currency != "" {
 		filters["currency = ?"] = currency
 	}
-	if minAmount := parseAmountFloat(c.Query("amount_min")); minAmount != nil {
+	if minAmount := parseAmount(c.Query("amount_min"), currency); minAmount != nil {
 		filters["amount >= ?"] = *minAmount
 	}
-	if maxAmount := parseAmountFloat(c.Query("amount_max")); maxAmount != nil {
+	if maxAmount := parseAmount(c.Query("amount_max"), currency); maxAmount != nil {
 		filters["amount <= ?"] = *maxAmount
 	}
 	if from := parseOrderTime(c.Query("from")); from != nil {
@@ -80,16 +80,3 @@ func (h *AdminPaymentHandler) List(c *gin.Context) {
 		},
 	})
 }
-
-func parseAmountFloat(value string) *float64 {
-	parsed := parseFloat(value)
-	if parsed == nil {
-		return nil
-	}
-	rounded := roundToTwoDecimals(*parsed)
-	return &rounded
-}
-
-func roundToTwoDecimals(value float64) float64 {
-	return math.Round(value*100+1e-9) / 100
-}
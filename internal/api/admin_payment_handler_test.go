@@ -9,6 +9,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/pkg/money"
 )
 
 type fakePaymentService struct {
@@ -165,10 +166,10 @@ func TestAdminPaymentListFiltersCurrencyAndAmountPrecision(t *testing.T) {
 	if _, ok := svc.lastFilters["currency = ?"]; !ok {
 		t.Fatalf("expected currency filter")
 	}
-	if value, ok := svc.lastFilters["amount >= ?"].(float64); !ok || value != 1.01 {
-		t.Fatalf("expected amount_min rounded to 1.01")
+	if value, ok := svc.lastFilters["amount >= ?"].(money.Amount); !ok || value != 100 {
+		t.Fatalf("expected amount_min rounded half to even to 100, got %v", svc.lastFilters["amount >= ?"])
 	}
-	if value, ok := svc.lastFilters["amount <= ?"].(float64); !ok || value != 2.0 {
-		t.Fatalf("expected amount_max rounded to 2.0")
+	if value, ok := svc.lastFilters["amount <= ?"].(money.Amount); !ok || value != 200 {
+		t.Fatalf("expected amount_max rounded to 200, got %v", svc.lastFilters["amount <= ?"])
 	}
 }
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/service"
+)
+
+type AdminRefundService interface {
+	ListOrderRefunds(orderID int64) ([]*domain.PaymentRefund, error)
+	ConfirmRefund(refundID int64, succeeded bool, externalRef, failureReason string) (*domain.PaymentRefund, error)
+}
+
+type AdminRefundHandler struct {
+	service AdminRefundService
+}
+
+func NewAdminRefundHandler(service AdminRefundService) *AdminRefundHandler {
+	return &AdminRefundHandler{service: service}
+}
+
+type AdminRefundConfirmRequest struct {
+	Status        string `json:"status"`
+	ExternalRef   string `json:"external_ref"`
+	FailureReason string `json:"failure_reason"`
+}
+
+// List returns every refund recorded against the order, oldest first.
+func (h *AdminRefundHandler) List(c *gin.Context) {
+	if h.service == nil {
+		respondError(c, http.StatusInternalServerError, "service_unavailable", "Refund service unavailable")
+		return
+	}
+	orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || orderID <= 0 {
+		respondError(c, http.StatusBadRequest, "invalid_order_id", "Invalid order id")
+		return
+	}
+	refunds, err := h.service.ListOrderRefunds(orderID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "refund_list_failed", "Failed to list refunds")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": refunds, "total": len(refunds)})
+}
+
+// Confirm settles a pending refund as succeeded or failed.
+func (h *AdminRefundHandler) Confirm(c *gin.Context) {
+	if h.service == nil {
+		respondError(c, http.StatusInternalServerError, "service_unavailable", "Refund service unavailable")
+		return
+	}
+	refundID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || refundID <= 0 {
+		respondError(c, http.StatusBadRequest, "invalid_refund_id", "Invalid refund id")
+		return
+	}
+	var req AdminRefundConfirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_request", "Invalid request body")
+		return
+	}
+	status := strings.TrimSpace(req.Status)
+	if status != service.RefundStatusSucceeded && status != service.RefundStatusFailed {
+		respondError(c, http.StatusBadRequest, "invalid_status", "Status must be succeeded or failed")
+		return
+	}
+	refund, err := h.service.ConfirmRefund(refundID, status == service.RefundStatusSucceeded, strings.TrimSpace(req.ExternalRef), strings.TrimSpace(req.FailureReason))
+	if err != nil {
+		respondRefundError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, refund)
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/service"
+)
+
+type fakeAdminRefundService struct {
+	refunds []*domain.PaymentRefund
+}
+
+func (f *fakeAdminRefundService) ListOrderRefunds(orderID int64) ([]*domain.PaymentRefund, error) {
+	var result []*domain.PaymentRefund
+	for _, refund := range f.refunds {
+		if refund.OrderID == orderID {
+			result = append(result, refund)
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeAdminRefundService) ConfirmRefund(refundID int64, succeeded bool, externalRef, failureReason string) (*domain.PaymentRefund, error) {
+	for _, refund := range f.refunds {
+		if refund.ID != refundID {
+			continue
+		}
+		if refund.Status != service.RefundStatusPending {
+			return nil, service.ErrRefundNotPending
+		}
+		refund.Status = service.RefundStatusFailed
+		if succeeded {
+			refund.Status = service.RefundStatusSucceeded
+		}
+		return refund, nil
+	}
+	return nil, service.ErrRefundNotFound
+}
+
+func TestAdminRefundListAndConfirm(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	svc := &fakeAdminRefundService{refunds: []*domain.PaymentRefund{
+		{ID: 1, OrderID: 20, PaymentID: 10, Amount: 40, Status: service.RefundStatusPending},
+		{ID: 2, OrderID: 21, PaymentID: 11, Amount: 10, Status: service.RefundStatusSucceeded},
+	}}
+	handler := NewAdminRefundHandler(svc)
+
+	r := gin.New()
+	r.GET("/api/v1/admin/orders/:id/refunds", handler.List)
+	r.POST("/api/v1/admin/refunds/:id/confirm", handler.Confirm)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/orders/20/refunds", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	var body struct {
+		Items []domain.PaymentRefund `json:"items"`
+		Total int                    `json:"total"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if body.Total != 1 || len(body.Items) != 1 || body.Items[0].ID != 1 {
+		t.Fatalf("expected only the order's refunds, got %+v", body)
+	}
+
+	confirm := func(id, payload string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/refunds/"+id+"/confirm", strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp.Code
+	}
+	if code := confirm("1", `{"status":"done"}`); code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", code)
+	}
+	if code := confirm("1", `{"status":"succeeded","external_ref":"rf_1"}`); code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", code)
+	}
+	if code := confirm("1", `{"status":"failed"}`); code != http.StatusConflict {
+		t.Fatalf("expected status 409, got %d", code)
+	}
+	if code := confirm("9", `{"status":"failed"}`); code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", code)
+	}
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/service"
+)
+
+type AdminSigningKeyService interface {
+	List() ([]*domain.UCPSigningKey, error)
+	Rotate(actor string) (*domain.UCPSigningKey, error)
+	Retire(kid, actor string) (*domain.UCPSigningKey, error)
+}
+
+type AdminSigningKeyHandler struct {
+	service AdminSigningKeyService
+}
+
+func NewAdminSigningKeyHandler(service AdminSigningKeyService) *AdminSigningKeyHandler {
+	return &AdminSigningKeyHandler{service: service}
+}
+
+func (h *AdminSigningKeyHandler) List(c *gin.Context) {
+	if h.service == nil {
+		respondError(c, http.StatusServiceUnavailable, "key_store_unavailable", "Signing key store is not configured")
+		return
+	}
+	keys, err := h.service.List()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "signing_key_list_failed", "Failed to list signing keys")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": keys, "total": len(keys)})
+}
+
+func (h *AdminSigningKeyHandler) Rotate(c *gin.Context) {
+	if h.service == nil {
+		respondError(c, http.StatusServiceUnavailable, "key_store_unavailable", "Signing key store is not configured")
+		return
+	}
+	key, err := h.service.Rotate(adminActor(c))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "signing_key_rotate_failed", "Failed to rotate signing key")
+		return
+	}
+	c.JSON(http.StatusCreated, key)
+}
+
+func (h *AdminSigningKeyHandler) Retire(c *gin.Context) {
+	if h.service == nil {
+		respondError(c, http.StatusServiceUnavailable, "key_store_unavailable", "Signing key store is not configured")
+		return
+	}
+	kid := strings.TrimSpace(c.Param("kid"))
+	if kid == "" {
+		respondError(c, http.StatusBadRequest, "invalid_kid", "Key id is required")
+		return
+	}
+	key, err := h.service.Retire(kid, adminActor(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrSigningKeyNotFound):
+			respondError(c, http.StatusNotFound, "signing_key_not_found", "Signing key not found")
+		case errors.Is(err, service.ErrSigningKeyInUse):
+			respondError(c, http.StatusConflict, "signing_key_in_use", "Rotate before retiring the key currently signing")
+		default:
+			respondError(c, http.StatusInternalServerError, "signing_key_retire_failed", "Failed to retire signing key")
+		}
+		return
+	}
+	c.JSON(http.StatusOK, key)
+}
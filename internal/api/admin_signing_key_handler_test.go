@@ -0,0 +1,79 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/service"
+)
+
+type fakeAdminSigningKeyService struct {
+	keys  []*domain.UCPSigningKey
+	actor string
+}
+
+func (f *fakeAdminSigningKeyService) List() ([]*domain.UCPSigningKey, error) {
+	return f.keys, nil
+}
+
+func (f *fakeAdminSigningKeyService) Rotate(actor string) (*domain.UCPSigningKey, error) {
+	f.actor = actor
+	key := &domain.UCPSigningKey{KID: "new", Status: service.SigningKeyStatusActive}
+	f.keys = append([]*domain.UCPSigningKey{key}, f.keys...)
+	return key, nil
+}
+
+func (f *fakeAdminSigningKeyService) Retire(kid, actor string) (*domain.UCPSigningKey, error) {
+	f.actor = actor
+	if kid == "new" {
+		return nil, service.ErrSigningKeyInUse
+	}
+	return nil, service.ErrSigningKeyNotFound
+}
+
+func TestAdminSigningKeyRotateAndRetire(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	svc := &fakeAdminSigningKeyService{}
+	handler := NewAdminSigningKeyHandler(svc)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", int64(7)) })
+	r.GET("/api/v1/admin/ucp/signing-keys", handler.List)
+	r.POST("/api/v1/admin/ucp/signing-keys/rotate", handler.Rotate)
+	r.POST("/api/v1/admin/ucp/signing-keys/:kid/retire", handler.Retire)
+
+	send := func(method, path string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, httptest.NewRequest(method, path, nil))
+		return resp
+	}
+
+	if resp := send(http.MethodPost, "/api/v1/admin/ucp/signing-keys/rotate"); resp.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", resp.Code)
+	}
+	if svc.actor != "admin:7" {
+		t.Fatalf("expected admin actor for the audit log, got %q", svc.actor)
+	}
+	if resp := send(http.MethodGet, "/api/v1/admin/ucp/signing-keys"); resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	if resp := send(http.MethodPost, "/api/v1/admin/ucp/signing-keys/new/retire"); resp.Code != http.StatusConflict {
+		t.Fatalf("expected status 409, got %d", resp.Code)
+	}
+	if resp := send(http.MethodPost, "/api/v1/admin/ucp/signing-keys/missing/retire"); resp.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", resp.Code)
+	}
+
+	unconfigured := NewAdminSigningKeyHandler(nil)
+	r2 := gin.New()
+	r2.GET("/keys", unconfigured.List)
+	resp := httptest.NewRecorder()
+	r2.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/keys", nil))
+	if resp.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503 without a key store, got %d", resp.Code)
+	}
+}
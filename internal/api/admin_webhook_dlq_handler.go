@@ -1,16 +1,20 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/service"
 )
 
 type AdminWebhookDLQService interface {
-	ListDLQ(offset, limit int) ([]*domain.WebhookDLQ, int64, error)
+	ListDLQ(offset, limit int, filters map[string]interface{}) ([]*domain.WebhookDLQ, int64, error)
 	ReplayDLQ(id int64) error
+	ReplayDLQBulk(filters map[string]interface{}, limit int, dryRun bool) (*service.DLQBulkReplayResult, error)
+	PurgeDLQ(olderThanDays int) (int64, error)
 }
 
 type AdminWebhookDLQHandler struct {
@@ -36,7 +40,7 @@ func (h *AdminWebhookDLQHandler) List(c *gin.Context) {
 	}
 
 	offset := (pageInt - 1) * limitInt
-	items, total, err := h.service.ListDLQ(offset, limitInt)
+	items, total, err := h.service.ListDLQ(offset, limitInt, dlqFilters(c))
 	if err != nil {
 		respondError(c, http.StatusInternalServerError, "list_failed", "Failed to list DLQ")
 		return
@@ -62,8 +66,63 @@ func (h *AdminWebhookDLQHandler) Replay(c *gin.Context) {
 		return
 	}
 	if err := h.service.ReplayDLQ(jobID); err != nil {
+		if errors.Is(err, service.ErrDLQAlreadyReplayed) {
+			respondError(c, http.StatusConflict, "already_replayed", "DLQ item was already replayed")
+			return
+		}
 		respondError(c, http.StatusInternalServerError, "replay_failed", "Failed to replay DLQ")
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
+
+// ReplayBulk replays every dead letter matching the List filters. With
+// dry_run=true it only reports how many items would be replayed.
+func (h *AdminWebhookDLQHandler) ReplayBulk(c *gin.Context) {
+	if h.service == nil {
+		respondError(c, http.StatusInternalServerError, "service_unavailable", "DLQ service unavailable")
+		return
+	}
+	dryRun, _ := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	result, err := h.service.ReplayDLQBulk(dlqFilters(c), parseInt(c.Query("limit")), dryRun)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "replay_failed", "Failed to replay DLQ")
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *AdminWebhookDLQHandler) Purge(c *gin.Context) {
+	if h.service == nil {
+		respondError(c, http.StatusInternalServerError, "service_unavailable", "DLQ service unavailable")
+		return
+	}
+	days := parseInt(c.Query("older_than_days"))
+	if days <= 0 {
+		respondError(c, http.StatusBadRequest, "invalid_older_than_days", "older_than_days must be a positive integer")
+		return
+	}
+	deleted, err := h.service.PurgeDLQ(days)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "purge_failed", "Failed to purge DLQ")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deleted": deleted})
+}
+
+func dlqFilters(c *gin.Context) map[string]interface{} {
+	filters := map[string]interface{}{}
+	if reason := c.Query("reason"); reason != "" {
+		filters["reason = ?"] = reason
+	}
+	if eventType := c.Query("event_type"); eventType != "" {
+		filters["event_type = ?"] = eventType
+	}
+	if from := parseOrderTime(c.Query("from")); from != nil {
+		filters["created_at >= ?"] = *from
+	}
+	if to := parseOrderTime(c.Query("to")); to != nil {
+		filters["created_at <= ?"] = *to
+	}
+	return filters
+}
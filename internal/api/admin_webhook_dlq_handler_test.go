@@ -1,20 +1,26 @@
 package api
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/service"
 )
 
 type fakeWebhookDLQService struct {
-	items    []*domain.WebhookDLQ
-	replayed int64
+	items       []*domain.WebhookDLQ
+	replayed    int64
+	filters     map[string]interface{}
+	dryRun      bool
+	purgedAfter int
 }
 
-func (f *fakeWebhookDLQService) ListDLQ(offset, limit int) ([]*domain.WebhookDLQ, int64, error) {
+func (f *fakeWebhookDLQService) ListDLQ(offset, limit int, filters map[string]interface{}) ([]*domain.WebhookDLQ, int64, error) {
+	f.filters = filters
 	return f.items, int64(len(f.items)), nil
 }
 
@@ -23,6 +29,17 @@ func (f *fakeWebhookDLQService) ReplayDLQ(id int64) error {
 	return nil
 }
 
+func (f *fakeWebhookDLQService) ReplayDLQBulk(filters map[string]interface{}, limit int, dryRun bool) (*service.DLQBulkReplayResult, error) {
+	f.filters = filters
+	f.dryRun = dryRun
+	return &service.DLQBulkReplayResult{DryRun: dryRun, Matched: int64(len(f.items)), Items: []service.DLQReplayItem{}}, nil
+}
+
+func (f *fakeWebhookDLQService) PurgeDLQ(olderThanDays int) (int64, error) {
+	f.purgedAfter = olderThanDays
+	return 3, nil
+}
+
 func TestAdminListWebhookDLQ(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -61,3 +78,85 @@ func TestAdminReplayWebhookDLQ(t *testing.T) {
 		t.Fatalf("expected replay to be called")
 	}
 }
+
+func TestAdminListWebhookDLQFilters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	service := &fakeWebhookDLQService{}
+	handler := NewAdminWebhookDLQHandler(service)
+
+	r := gin.New()
+	r.GET("/api/v1/admin/webhooks/dlq", handler.List)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/webhooks/dlq?reason=max_attempts&event_type=order.paid&from=2026-01-01", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	if service.filters["reason = ?"] != "max_attempts" || service.filters["event_type = ?"] != "order.paid" {
+		t.Fatalf("expected reason and event_type filters, got %v", service.filters)
+	}
+	if _, ok := service.filters["created_at >= ?"]; !ok {
+		t.Fatalf("expected from filter, got %v", service.filters)
+	}
+}
+
+func TestAdminBulkReplayWebhookDLQDryRun(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	service := &fakeWebhookDLQService{items: []*domain.WebhookDLQ{{ID: 1}, {ID: 2}}}
+	handler := NewAdminWebhookDLQHandler(service)
+
+	r := gin.New()
+	r.POST("/api/v1/admin/webhooks/dlq/replay", handler.ReplayBulk)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/webhooks/dlq/replay?reason=max_attempts&dry_run=true", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	if !service.dryRun {
+		t.Fatalf("expected dry run to be passed through")
+	}
+	var body struct {
+		DryRun  bool  `json:"dry_run"`
+		Matched int64 `json:"matched"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if !body.DryRun || body.Matched != 2 {
+		t.Fatalf("expected dry run count of 2, got %+v", body)
+	}
+}
+
+func TestAdminPurgeWebhookDLQRequiresDays(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	service := &fakeWebhookDLQService{}
+	handler := NewAdminWebhookDLQHandler(service)
+
+	r := gin.New()
+	r.DELETE("/api/v1/admin/webhooks/dlq", handler.Purge)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/admin/webhooks/dlq", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", resp.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/admin/webhooks/dlq?older_than_days=30", nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	if service.purgedAfter != 30 {
+		t.Fatalf("expected purge of items older than 30 days, got %d", service.purgedAfter)
+	}
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/service"
+)
+
+type AdminWebhookSubscriptionService interface {
+	Create(input service.WebhookSubscriptionInput) (*domain.UCPWebhookSubscription, error)
+	Update(id int64, input service.WebhookSubscriptionInput) (*domain.UCPWebhookSubscription, error)
+	Delete(id int64) error
+	Get(id int64) (*domain.UCPWebhookSubscription, error)
+	List(offset, limit int) ([]*domain.UCPWebhookSubscription, int64, error)
+}
+
+type AdminWebhookSubscriptionHandler struct {
+	service AdminWebhookSubscriptionService
+}
+
+func NewAdminWebhookSubscriptionHandler(service AdminWebhookSubscriptionService) *AdminWebhookSubscriptionHandler {
+	return &AdminWebhookSubscriptionHandler{service: service}
+}
+
+type adminWebhookSubscriptionRequest struct {
+	ClientID   string   `json:"client_id"`
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret"`
+	EventTypes []string `json:"event_types"`
+	Active     *bool    `json:"active"`
+}
+
+func (r adminWebhookSubscriptionRequest) input() service.WebhookSubscriptionInput {
+	return service.WebhookSubscriptionInput{
+		ClientID:   r.ClientID,
+		URL:        r.URL,
+		Secret:     r.Secret,
+		EventTypes: r.EventTypes,
+		Active:     r.Active,
+	}
+}
+
+func (h *AdminWebhookSubscriptionHandler) List(c *gin.Context) {
+	if h.service == nil {
+		respondError(c, http.StatusInternalServerError, "service_unavailable", "Webhook subscription service unavailable")
+		return
+	}
+	limitInt := parseInt(c.DefaultQuery("limit", "20"))
+	pageInt := parseInt(c.DefaultQuery("page", "1"))
+	if pageInt < 1 {
+		pageInt = 1
+	}
+	if limitInt < 1 {
+		limitInt = 20
+	}
+	offset := (pageInt - 1) * limitInt
+	items, total, err := h.service.List(offset, limitInt)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "list_failed", "Failed to list webhook subscriptions")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"items": items,
+		"pagination": gin.H{
+			"page":  pageInt,
+			"limit": limitInt,
+			"total": total,
+		},
+	})
+}
+
+func (h *AdminWebhookSubscriptionHandler) Get(c *gin.Context) {
+	if h.service == nil {
+		respondError(c, http.StatusInternalServerError, "service_unavailable", "Webhook subscription service unavailable")
+		return
+	}
+	id, ok := parseSubscriptionID(c)
+	if !ok {
+		return
+	}
+	subscription, err := h.service.Get(id)
+	if err != nil {
+		respondWebhookSubscriptionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, subscription)
+}
+
+func (h *AdminWebhookSubscriptionHandler) Create(c *gin.Context) {
+	if h.service == nil {
+		respondError(c, http.StatusInternalServerError, "service_unavailable", "Webhook subscription service unavailable")
+		return
+	}
+	var req adminWebhookSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_request", "Invalid request body")
+		return
+	}
+	subscription, err := h.service.Create(req.input())
+	if err != nil {
+		respondWebhookSubscriptionError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, subscription)
+}
+
+func (h *AdminWebhookSubscriptionHandler) Update(c *gin.Context) {
+	if h.service == nil {
+		respondError(c, http.StatusInternalServerError, "service_unavailable", "Webhook subscription service unavailable")
+		return
+	}
+	id, ok := parseSubscriptionID(c)
+	if !ok {
+		return
+	}
+	var req adminWebhookSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_request", "Invalid request body")
+		return
+	}
+	subscription, err := h.service.Update(id, req.input())
+	if err != nil {
+		respondWebhookSubscriptionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, subscription)
+}
+
+func (h *AdminWebhookSubscriptionHandler) Delete(c *gin.Context) {
+	if h.service == nil {
+		respondError(c, http.StatusInternalServerError, "service_unavailable", "Webhook subscription service unavailable")
+		return
+	}
+	id, ok := parseSubscriptionID(c)
+	if !ok {
+		return
+	}
+	if err := h.service.Delete(id); err != nil {
+		respondWebhookSubscriptionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
+func parseSubscriptionID(c *gin.Context) (int64, bool) {
+	id := int64(parseInt(c.Param("id")))
+	if id <= 0 {
+		respondError(c, http.StatusBadRequest, "invalid_id", "Invalid subscription id")
+		return 0, false
+	}
+	return id, true
+}
+
+func respondWebhookSubscriptionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrWebhookSubscriptionNotFound):
+		respondError(c, http.StatusNotFound, "subscription_not_found", "Webhook subscription not found")
+	case errors.Is(err, service.ErrWebhookSubscriptionInvalidURL):
+		respondError(c, http.StatusBadRequest, "invalid_url", "Subscription URL must be an absolute http(s) URL")
+	case errors.Is(err, service.ErrWebhookSubscriptionClient):
+		respondError(c, http.StatusBadRequest, "invalid_client", "Unknown OAuth client")
+	default:
+		respondError(c, http.StatusInternalServerError, "subscription_save_failed", "Failed to save webhook subscription")
+	}
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/service"
+)
+
+type fakeAdminWebhookSubscriptionService struct {
+	created service.WebhookSubscriptionInput
+	deleted int64
+}
+
+func (f *fakeAdminWebhookSubscriptionService) Create(input service.WebhookSubscriptionInput) (*domain.UCPWebhookSubscription, error) {
+	if input.URL == "" {
+		return nil, service.ErrWebhookSubscriptionInvalidURL
+	}
+	f.created = input
+	return &domain.UCPWebhookSubscription{ID: 1, ClientID: input.ClientID, URL: input.URL, Secret: input.Secret, Active: true}, nil
+}
+func (f *fakeAdminWebhookSubscriptionService) Update(id int64, input service.WebhookSubscriptionInput) (*domain.UCPWebhookSubscription, error) {
+	return nil, service.ErrWebhookSubscriptionNotFound
+}
+func (f *fakeAdminWebhookSubscriptionService) Delete(id int64) error {
+	f.deleted = id
+	return nil
+}
+func (f *fakeAdminWebhookSubscriptionService) Get(id int64) (*domain.UCPWebhookSubscription, error) {
+	return nil, service.ErrWebhookSubscriptionNotFound
+}
+func (f *fakeAdminWebhookSubscriptionService) List(offset, limit int) ([]*domain.UCPWebhookSubscription, int64, error) {
+	return []*domain.UCPWebhookSubscription{}, 0, nil
+}
+
+func TestAdminWebhookSubscriptionHandlerCRUD(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	svc := &fakeAdminWebhookSubscriptionService{}
+	handler := NewAdminWebhookSubscriptionHandler(svc)
+	r := gin.New()
+	r.POST("/subscriptions", handler.Create)
+	r.PUT("/subscriptions/:id", handler.Update)
+	r.DELETE("/subscriptions/:id", handler.Delete)
+
+	send := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := send(http.MethodPost, "/subscriptions", map[string]interface{}{
+		"client_id":   "agent-a",
+		"url":         "https://a.example/hook",
+		"secret":      "shh",
+		"event_types": []string{"order.*"},
+	})
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", resp.Code)
+	}
+	if bytes.Contains(resp.Body.Bytes(), []byte("shh")) {
+		t.Fatalf("expected secret to be omitted from the response")
+	}
+	if len(svc.created.EventTypes) != 1 || svc.created.EventTypes[0] != "order.*" {
+		t.Fatalf("expected event filters to reach the service, got %+v", svc.created)
+	}
+	if resp := send(http.MethodPost, "/subscriptions", map[string]string{"client_id": "agent-a"}); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", resp.Code)
+	}
+	if resp := send(http.MethodPut, "/subscriptions/9", map[string]string{}); resp.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", resp.Code)
+	}
+	if resp := send(http.MethodDelete, "/subscriptions/3", nil); resp.Code != http.StatusOK || svc.deleted != 3 {
+		t.Fatalf("expected delete of subscription 3, got %d", resp.Code)
+	}
+}
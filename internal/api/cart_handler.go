@@ -0,0 +1,142 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/meowucp/internal/service"
+)
+
+type CartService interface {
+	GetCartView(userID int64) (*service.CartView, error)
+	AddToCart(userID, productID int64, quantity int) error
+	UpdateCartItem(userID, productID int64, quantity int) error
+	RemoveFromCart(userID, productID int64) error
+	ClearCart(userID int64) error
+}
+
+type CartHandler struct {
+	service CartService
+}
+
+func NewCartHandler(service CartService) *CartHandler {
+	return &CartHandler{service: service}
+}
+
+type CartAddItemRequest struct {
+	ProductID int64 `json:"product_id"`
+	Quantity  int   `json:"quantity"`
+}
+
+type CartUpdateItemRequest struct {
+	Quantity int `json:"quantity"`
+}
+
+func (h *CartHandler) Get(c *gin.Context) {
+	h.respondCart(c, http.StatusOK)
+}
+
+func (h *CartHandler) AddItem(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+	var req CartAddItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_request", "Invalid request body")
+		return
+	}
+	if req.ProductID <= 0 || req.Quantity <= 0 {
+		respondError(c, http.StatusBadRequest, "missing_required_fields", "Product id and positive quantity are required")
+		return
+	}
+	if err := h.service.AddToCart(userID, req.ProductID, req.Quantity); err != nil {
+		respondCartError(c, err)
+		return
+	}
+	h.respondCart(c, http.StatusOK)
+}
+
+func (h *CartHandler) UpdateItem(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+	productID, err := strconv.ParseInt(c.Param("product_id"), 10, 64)
+	if err != nil || productID <= 0 {
+		respondError(c, http.StatusBadRequest, "invalid_product_id", "Invalid product id")
+		return
+	}
+	var req CartUpdateItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_request", "Invalid request body")
+		return
+	}
+	if req.Quantity <= 0 {
+		respondError(c, http.StatusBadRequest, "invalid_quantity", "Quantity must be positive")
+		return
+	}
+	if err := h.service.UpdateCartItem(userID, productID, req.Quantity); err != nil {
+		respondCartError(c, err)
+		return
+	}
+	h.respondCart(c, http.StatusOK)
+}
+
+func (h *CartHandler) RemoveItem(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+	productID, err := strconv.ParseInt(c.Param("product_id"), 10, 64)
+	if err != nil || productID <= 0 {
+		respondError(c, http.StatusBadRequest, "invalid_product_id", "Invalid product id")
+		return
+	}
+	if err := h.service.RemoveFromCart(userID, productID); err != nil {
+		respondCartError(c, err)
+		return
+	}
+	h.respondCart(c, http.StatusOK)
+}
+
+func (h *CartHandler) Clear(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+	if err := h.service.ClearCart(userID); err != nil && err.Error() != "cart not found" {
+		respondError(c, http.StatusInternalServerError, "cart_update_failed", "Failed to clear cart")
+		return
+	}
+	h.respondCart(c, http.StatusOK)
+}
+
+func (h *CartHandler) respondCart(c *gin.Context, status int) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+	view, err := h.service.GetCartView(userID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "cart_load_failed", "Failed to load cart")
+		return
+	}
+	c.JSON(status, view)
+}
+
+func respondCartError(c *gin.Context, err error) {
+	switch err.Error() {
+	case "product not found":
+		respondError(c, http.StatusNotFound, "product_not_found", "Product not found")
+	case "cart not found", "item not found in cart":
+		respondError(c, http.StatusNotFound, "cart_item_not_found", "Cart item not found")
+	case "insufficient stock":
+		respondError(c, http.StatusConflict, "insufficient_stock", "Insufficient stock")
+	case "invalid quantity":
+		respondError(c, http.StatusBadRequest, "invalid_quantity", "Quantity must be positive")
+	default:
+		respondError(c, http.StatusInternalServerError, "cart_update_failed", "Failed to update cart")
+	}
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/meowucp/internal/service"
+)
+
+type fakeCartService struct {
+	view        *service.CartView
+	addErr      error
+	lastUserID  int64
+	lastProduct int64
+	lastQty     int
+	cleared     bool
+}
+
+func (f *fakeCartService) GetCartView(userID int64) (*service.CartView, error) {
+	f.lastUserID = userID
+	if f.view == nil {
+		return &service.CartView{Items: []service.CartLine{}}, nil
+	}
+	return f.view, nil
+}
+
+func (f *fakeCartService) AddToCart(userID, productID int64, quantity int) error {
+	f.lastUserID = userID
+	f.lastProduct = productID
+	f.lastQty = quantity
+	return f.addErr
+}
+
+func (f *fakeCartService) UpdateCartItem(userID, productID int64, quantity int) error {
+	f.lastUserID = userID
+	f.lastProduct = productID
+	f.lastQty = quantity
+	return nil
+}
+
+func (f *fakeCartService) RemoveFromCart(userID, productID int64) error {
+	f.lastProduct = productID
+	return nil
+}
+
+func (f *fakeCartService) ClearCart(userID int64) error {
+	f.cleared = true
+	return errors.New("cart not found")
+}
+
+func newCartRouter(handler *CartHandler) *gin.Engine {
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", int64(7))
+		c.Next()
+	})
+	r.GET("/api/v1/user/cart", handler.Get)
+	r.POST("/api/v1/user/cart/items", handler.AddItem)
+	r.PUT("/api/v1/user/cart/items/:product_id", handler.UpdateItem)
+	r.DELETE("/api/v1/user/cart", handler.Clear)
+	return r
+}
+
+func TestCartGetReturnsView(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	svc := &fakeCartService{view: &service.CartView{
+		Items:     []service.CartLine{{ProductID: 1, Quantity: 2, CurrentPrice: 5, LineTotal: 10, PriceChanged: true}},
+		ItemCount: 2,
+		Subtotal:  10,
+		HasIssues: true,
+	}}
+	r := newCartRouter(NewCartHandler(svc))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/user/cart", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.Code)
+	}
+	if svc.lastUserID != 7 {
+		t.Fatalf("expected user 7, got %d", svc.lastUserID)
+	}
+	var body service.CartView
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if len(body.Items) != 1 || body.Items[0].LineTotal != 10 || !body.Items[0].PriceChanged || !body.HasIssues {
+		t.Fatalf("unexpected body: %s", resp.Body.String())
+	}
+}
+
+func TestCartAddItemMapsInsufficientStock(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	svc := &fakeCartService{addErr: errors.New("insufficient stock")}
+	r := newCartRouter(NewCartHandler(svc))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/user/cart/items", strings.NewReader(`{"product_id":3,"quantity":2}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", resp.Code)
+	}
+	if svc.lastProduct != 3 || svc.lastQty != 2 {
+		t.Fatalf("unexpected add args: %d x%d", svc.lastProduct, svc.lastQty)
+	}
+}
+
+func TestCartUpdateItemRejectsNonPositiveQuantity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := newCartRouter(NewCartHandler(&fakeCartService{}))
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/user/cart/items/3", strings.NewReader(`{"quantity":0}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", resp.Code)
+	}
+}
+
+func TestCartClearWithoutCartReturnsEmptyView(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	svc := &fakeCartService{}
+	r := newCartRouter(NewCartHandler(svc))
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/user/cart", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK || !svc.cleared {
+		t.Fatalf("expected 200 after clear, got %d", resp.Code)
+	}
+}
@@ -6,10 +6,11 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/pkg/money"
 )
 
 type CouponService interface {
-	ValidateCoupon(code string, subtotal float64) (*domain.Coupon, error)
+	ValidateCoupon(code string, subtotal money.Amount) (*domain.Coupon, error)
 }
 
 type CouponHandler struct {
@@ -21,8 +22,8 @@ func NewCouponHandler(service CouponService) *CouponHandler {
 }
 
 type couponValidateRequest struct {
-	Code     string  `json:"code"`
-	Subtotal float64 `json:"subtotal"`
+	Code     string       `json:"code"`
+	Subtotal money.Amount `json:"subtotal"`
 }
 
 func (h *CouponHandler) Validate(c *gin.Context) {
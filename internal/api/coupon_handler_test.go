@@ -8,13 +8,14 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/pkg/money"
 )
 
 type fakeCouponService struct {
 	coupon *domain.Coupon
 }
 
-func (f *fakeCouponService) ValidateCoupon(code string, subtotal float64) (*domain.Coupon, error) {
+func (f *fakeCouponService) ValidateCoupon(code string, subtotal money.Amount) (*domain.Coupon, error) {
 	f.coupon = &domain.Coupon{Code: code, Value: 10}
 	return f.coupon, nil
 }
@@ -1,40 +1,174 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 	"net/url"
-	"strconv"
-	"time"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/service"
 )
 
-type OAuthAuthorizeHandler struct{}
+// OAuthAuthorizationFlow is the authorization code flow behind the authorize,
+// consent and token endpoints.
+type OAuthAuthorizationFlow interface {
+	Validate(req service.OAuthAuthorizeRequest) (string, error)
+	Approve(req service.OAuthAuthorizeRequest, userID int64) (string, error)
+	Exchange(clientID, code, redirectURI, codeVerifier string) (*domain.OAuthAuthorizationCode, error)
+}
+
+type OAuthAuthorizeHandler struct {
+	flow       OAuthAuthorizationFlow
+	consentURL string
+}
+
+func NewOAuthAuthorizeHandler(flow OAuthAuthorizationFlow) *OAuthAuthorizeHandler {
+	return &OAuthAuthorizeHandler{flow: flow}
+}
+
+// SetConsentURL sends shoppers to the storefront consent page, with the
+// authorization query appended, instead of answering with the consent JSON.
+func (h *OAuthAuthorizeHandler) SetConsentURL(consentURL string) {
+	h.consentURL = consentURL
+}
 
-func NewOAuthAuthorizeHandler() *OAuthAuthorizeHandler {
-	return &OAuthAuthorizeHandler{}
+type oauthConsentRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Approve             bool   `json:"approve"`
 }
 
+// Authorize validates an authorization request and hands it to the consent
+// step. Codes are only issued by Consent, for a logged-in shopper.
 func (h *OAuthAuthorizeHandler) Authorize(c *gin.Context) {
-	responseType := c.Query("response_type")
-	clientID := c.Query("client_id")
-	redirectURI := c.Query("redirect_uri")
-	state := c.Query("state")
+	if h.flow == nil {
+		respondError(c, http.StatusInternalServerError, "service_unavailable", "OAuth service unavailable")
+		return
+	}
+	req := service.OAuthAuthorizeRequest{
+		ResponseType:        c.Query("response_type"),
+		ClientID:            c.Query("client_id"),
+		RedirectURI:         c.Query("redirect_uri"),
+		Scope:               c.Query("scope"),
+		State:               c.Query("state"),
+		CodeChallenge:       c.Query("code_challenge"),
+		CodeChallengeMethod: c.Query("code_challenge_method"),
+	}
+	scope, err := h.flow.Validate(req)
+	if err != nil {
+		if redirect, ok := h.errorRedirect(c, req, err); ok {
+			c.Redirect(http.StatusFound, redirect)
+		}
+		return
+	}
 
-	if responseType != "code" {
-		respondError(c, http.StatusBadRequest, "unsupported_response_type", "Unsupported response type")
+	if h.consentURL != "" {
+		separator := "?"
+		if strings.Contains(h.consentURL, "?") {
+			separator = "&"
+		}
+		c.Redirect(http.StatusFound, h.consentURL+separator+c.Request.URL.RawQuery)
 		return
 	}
-	if clientID != oauthClientID || redirectURI == "" {
-		respondError(c, http.StatusBadRequest, "invalid_request", "Invalid client or redirect URI")
+	c.JSON(http.StatusOK, gin.H{
+		"response_type":         req.ResponseType,
+		"client_id":             req.ClientID,
+		"redirect_uri":          req.RedirectURI,
+		"scope":                 scope,
+		"state":                 req.State,
+		"code_challenge":        req.CodeChallenge,
+		"code_challenge_method": req.CodeChallengeMethod,
+	})
+}
+
+// Consent records the logged-in shopper's decision on an authorization
+// request and returns where to send the browser: the client's redirect URI
+// with a code bound to the shopper, or with access_denied.
+func (h *OAuthAuthorizeHandler) Consent(c *gin.Context) {
+	if h.flow == nil {
+		respondError(c, http.StatusInternalServerError, "service_unavailable", "OAuth service unavailable")
+		return
+	}
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+	var body oauthConsentRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_request", "Invalid request body")
+		return
+	}
+	req := service.OAuthAuthorizeRequest{
+		ResponseType:        body.ResponseType,
+		ClientID:            body.ClientID,
+		RedirectURI:         body.RedirectURI,
+		Scope:               body.Scope,
+		State:               body.State,
+		CodeChallenge:       body.CodeChallenge,
+		CodeChallengeMethod: body.CodeChallengeMethod,
+	}
+
+	if !body.Approve {
+		if _, err := h.flow.Validate(req); err != nil {
+			if redirect, ok := h.errorRedirect(c, req, err); ok {
+				c.JSON(http.StatusOK, gin.H{"redirect_to": redirect})
+			}
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"redirect_to": oauthRedirect(req.RedirectURI, map[string]string{"error": "access_denied", "state": req.State})})
 		return
 	}
 
-	code := "code_" + strconv.FormatInt(time.Now().UnixNano(), 10)
-	redirect := redirectURI + "?code=" + url.QueryEscape(code)
-	if state != "" {
-		redirect += "&state=" + url.QueryEscape(state)
+	code, err := h.flow.Approve(req, userID)
+	if err != nil {
+		if redirect, ok := h.errorRedirect(c, req, err); ok {
+			c.JSON(http.StatusOK, gin.H{"redirect_to": redirect})
+		}
+		return
 	}
+	c.JSON(http.StatusOK, gin.H{"redirect_to": oauthRedirect(req.RedirectURI, map[string]string{"code": code, "state": req.State})})
+}
 
-	c.Redirect(http.StatusFound, redirect)
+// errorRedirect maps a flow error to the redirect URI carrying it. Errors
+// that leave the redirect URI untrusted, and internal failures, are answered
+// directly and report false.
+func (h *OAuthAuthorizeHandler) errorRedirect(c *gin.Context, req service.OAuthAuthorizeRequest, err error) (string, bool) {
+	switch {
+	case errors.Is(err, service.ErrOAuthInvalidClient):
+		respondError(c, http.StatusBadRequest, "invalid_client", "Unknown or inactive client")
+		return "", false
+	case errors.Is(err, service.ErrOAuthInvalidRedirectURI):
+		respondError(c, http.StatusBadRequest, "invalid_request", "Redirect URI is not registered for this client")
+		return "", false
+	case errors.Is(err, service.ErrOAuthUnsupportedResponseType),
+		errors.Is(err, service.ErrOAuthInvalidRequest),
+		errors.Is(err, service.ErrOAuthInvalidScope):
+		return oauthRedirect(req.RedirectURI, map[string]string{"error": err.Error(), "state": req.State}), true
+	}
+	respondError(c, http.StatusInternalServerError, "server_error", "Failed to process authorization")
+	return "", false
+}
+
+// oauthRedirect adds the non-empty params to a registered redirect URI,
+// keeping any query it already has.
+func oauthRedirect(redirectURI string, params map[string]string) string {
+	parsed, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+	query := parsed.Query()
+	for key, value := range params {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
 }
@@ -1,23 +1,124 @@
 package api
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/service"
 )
 
+const (
+	testCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testRedirectURI  = "https://agent.example.com/cb"
+)
+
+func testCodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+type fakeOAuthFlowClientRepo struct {
+	fakeOAuthClientRepo
+}
+
+func (f *fakeOAuthFlowClientRepo) FindByClientID(clientID string) (*domain.OAuthClient, error) {
+	if clientID != "agent" {
+		return nil, errors.New("not found")
+	}
+	return &domain.OAuthClient{
+		ClientID:     clientID,
+		SecretHash:   string(mustHash("secret")),
+		Scopes:       service.OAuthScopeCheckoutSession,
+		Status:       "active",
+		RedirectURIs: testRedirectURI,
+	}, nil
+}
+
+type fakeOAuthCodeRepo struct {
+	items []*domain.OAuthAuthorizationCode
+}
+
+func (f *fakeOAuthCodeRepo) Create(code *domain.OAuthAuthorizationCode) error {
+	code.ID = int64(len(f.items) + 1)
+	f.items = append(f.items, code)
+	return nil
+}
+
+func (f *fakeOAuthCodeRepo) FindByCode(code string) (*domain.OAuthAuthorizationCode, error) {
+	for _, item := range f.items {
+		if item.Code == code {
+			copied := *item
+			return &copied, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+func (f *fakeOAuthCodeRepo) MarkUsed(id int64, usedAt time.Time) (bool, error) {
+	for _, item := range f.items {
+		if item.ID == id && item.UsedAt == nil {
+			item.UsedAt = &usedAt
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type recordingOAuthTokenRepo struct {
+	fakeOAuthTokenRepo
+	created []*domain.OAuthToken
+}
+
+func (f *recordingOAuthTokenRepo) Create(token *domain.OAuthToken) error {
+	f.created = append(f.created, token)
+	return nil
+}
+
+func newTestOAuthFlow() (*service.OAuthAuthorizationService, *fakeOAuthFlowClientRepo) {
+	clients := &fakeOAuthFlowClientRepo{}
+	return service.NewOAuthAuthorizationService(clients, &fakeOAuthCodeRepo{}), clients
+}
+
+func authorizeQuery(overrides map[string]string) string {
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"agent"},
+		"redirect_uri":          {testRedirectURI},
+		"state":                 {"abc"},
+		"code_challenge":        {testCodeChallenge(testCodeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+	for key, value := range overrides {
+		if value == "" {
+			query.Del(key)
+		} else {
+			query.Set(key, value)
+		}
+	}
+	return query.Encode()
+}
+
 func TestOAuthAuthorizeRedirect(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
-	handler := NewOAuthAuthorizeHandler()
+	flow, _ := newTestOAuthFlow()
+	handler := NewOAuthAuthorizeHandler(flow)
+	handler.SetConsentURL("https://shop.example.com/oauth/consent")
 	r := gin.New()
 	r.GET("/oauth2/authorize", handler.Authorize)
 
-	url := "/oauth2/authorize?response_type=code&client_id=ucp-client&redirect_uri=https%3A%2F%2Fexample.com%2Fcb&state=abc"
-	req := httptest.NewRequest(http.MethodGet, url, nil)
+	req := httptest.NewRequest(http.MethodGet, "/oauth2/authorize?"+authorizeQuery(nil), nil)
 	resp := httptest.NewRecorder()
 	r.ServeHTTP(resp, req)
 
@@ -25,13 +126,131 @@ func TestOAuthAuthorizeRedirect(t *testing.T) {
 		t.Fatalf("expected status 302, got %d", resp.Code)
 	}
 	location := resp.Header().Get("Location")
-	if !strings.HasPrefix(location, "https://example.com/cb") {
-		t.Fatalf("expected redirect to callback")
+	if !strings.HasPrefix(location, "https://shop.example.com/oauth/consent?") {
+		t.Fatalf("expected redirect to the consent page, got %s", location)
 	}
-	if !strings.Contains(location, "code=") {
-		t.Fatalf("expected code in redirect")
+	if strings.Contains(location, "code=") {
+		t.Fatalf("expected no code before consent")
 	}
 	if !strings.Contains(location, "state=abc") {
 		t.Fatalf("expected state to be preserved")
 	}
 }
+
+func TestOAuthAuthorizeRejectsBadRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	flow, _ := newTestOAuthFlow()
+	r := gin.New()
+	r.GET("/oauth2/authorize", NewOAuthAuthorizeHandler(flow).Authorize)
+
+	req := httptest.NewRequest(http.MethodGet, "/oauth2/authorize?"+authorizeQuery(map[string]string{"redirect_uri": "https://evil.example.com/cb"}), nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if resp.Code != http.StatusBadRequest || resp.Header().Get("Location") != "" {
+		t.Fatalf("expected unregistered redirect uri to be refused without redirect, got %d %s", resp.Code, resp.Header().Get("Location"))
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/oauth2/authorize?"+authorizeQuery(map[string]string{"code_challenge": ""}), nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	location := resp.Header().Get("Location")
+	if resp.Code != http.StatusFound || !strings.HasPrefix(location, testRedirectURI) || !strings.Contains(location, "error=invalid_request") {
+		t.Fatalf("expected missing PKCE challenge to be reported to the client, got %d %s", resp.Code, location)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/oauth2/authorize?"+authorizeQuery(map[string]string{"scope": "admin"}), nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if location := resp.Header().Get("Location"); !strings.Contains(location, "error=invalid_scope") {
+		t.Fatalf("expected unregistered scope to be rejected, got %s", location)
+	}
+}
+
+func TestOAuthAuthorizationCodeFlow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	flow, clients := newTestOAuthFlow()
+	authorize := NewOAuthAuthorizeHandler(flow)
+	tokens := &recordingOAuthTokenRepo{}
+	tokenHandler := NewOAuthTokenHandlerWithRepos(clients, tokens)
+	tokenHandler.SetAuthorizationFlow(flow)
+
+	r := gin.New()
+	r.POST("/api/v1/user/oauth/consent", func(c *gin.Context) { c.Set("user_id", int64(42)) }, authorize.Consent)
+	r.POST("/api/v1/anonymous/oauth/consent", authorize.Consent)
+	r.POST("/oauth2/token", tokenHandler.Token)
+
+	consent, _ := json.Marshal(map[string]interface{}{
+		"response_type":         "code",
+		"client_id":             "agent",
+		"redirect_uri":          testRedirectURI,
+		"scope":                 service.OAuthScopeCheckoutSession,
+		"state":                 "abc",
+		"code_challenge":        testCodeChallenge(testCodeVerifier),
+		"code_challenge_method": "S256",
+		"approve":               true,
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/anonymous/oauth/consent", bytes.NewReader(consent))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatalf("expected consent without a shopper to be refused, got %d", resp.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/user/oauth/consent", bytes.NewReader(consent))
+	req.Header.Set("Content-Type", "application/json")
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected consent status 200, got %d", resp.Code)
+	}
+	var consentResp struct {
+		RedirectTo string `json:"redirect_to"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &consentResp); err != nil {
+		t.Fatalf("unmarshal consent: %v", err)
+	}
+	redirect, err := url.Parse(consentResp.RedirectTo)
+	if err != nil {
+		t.Fatalf("parse redirect: %v", err)
+	}
+	code := redirect.Query().Get("code")
+	if code == "" || redirect.Query().Get("state") != "abc" {
+		t.Fatalf("expected code and state in redirect, got %s", consentResp.RedirectTo)
+	}
+
+	exchange := func(verifier string) *httptest.ResponseRecorder {
+		form := url.Values{
+			"grant_type":    {"authorization_code"},
+			"client_id":     {"agent"},
+			"client_secret": {"secret"},
+			"code":          {code},
+			"redirect_uri":  {testRedirectURI},
+			"code_verifier": {verifier},
+		}
+		req := httptest.NewRequest(http.MethodPost, "/oauth2/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	if resp := exchange(strings.Repeat("x", 43)); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected wrong code verifier to be rejected, got %d", resp.Code)
+	}
+	if resp := exchange(testCodeVerifier); resp.Code != http.StatusOK {
+		t.Fatalf("expected token exchange status 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if len(tokens.created) != 1 || tokens.created[0].UserID == nil || *tokens.created[0].UserID != 42 {
+		t.Fatalf("expected token bound to the consenting shopper, got %+v", tokens.created)
+	}
+	if tokens.created[0].Scopes != service.OAuthScopeCheckoutSession {
+		t.Fatalf("expected granted scope on token, got %q", tokens.created[0].Scopes)
+	}
+	if resp := exchange(testCodeVerifier); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected a used code to be rejected, got %d", resp.Code)
+	}
+}
@@ -5,10 +5,9 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/meowucp/internal/service"
 )
 
-const oauthCheckoutScope = "ucp:scopes:checkout_session"
-
 type OAuthMetadataHandler struct{}
 
 func NewOAuthMetadataHandler() *OAuthMetadataHandler {
@@ -19,12 +18,18 @@ func (h *OAuthMetadataHandler) WellKnown(c *gin.Context) {
 	baseURL := resolveOAuthBaseURL(c)
 
 	c.JSON(http.StatusOK, gin.H{
-		"issuer":                                baseURL,
-		"authorization_endpoint":                baseURL + "/oauth2/authorize",
-		"token_endpoint":                        baseURL + "/oauth2/token",
-		"scopes_supported":                      []string{oauthCheckoutScope},
-		"response_types_supported":              []string{"code"},
-		"token_endpoint_auth_methods_supported": []string{"client_secret_post"},
+		"issuer":                                        baseURL,
+		"authorization_endpoint":                        baseURL + "/oauth2/authorize",
+		"token_endpoint":                                baseURL + "/oauth2/token",
+		"jwks_uri":                                      baseURL + "/oauth2/jwks",
+		"revocation_endpoint":                           baseURL + "/oauth2/revoke",
+		"introspection_endpoint":                        baseURL + "/oauth2/introspect",
+		"scopes_supported":                              service.OAuthScopesSupported,
+		"response_types_supported":                      []string{"code"},
+		"grant_types_supported":                         []string{"authorization_code", "refresh_token", "client_credentials"},
+		"code_challenge_methods_supported":              []string{"S256"},
+		"token_endpoint_auth_methods_supported":         []string{"client_secret_post"},
+		"introspection_endpoint_auth_methods_supported": []string{"client_secret_post"},
 	})
 }
 
@@ -40,6 +40,16 @@ func TestOAuthMetadataWellKnown(t *testing.T) {
 	if payload["authorization_endpoint"] != "http://example.com/oauth2/authorize" {
 		t.Fatalf("expected authorization_endpoint to be set")
 	}
+	if payload["jwks_uri"] != "http://example.com/oauth2/jwks" {
+		t.Fatalf("expected jwks_uri to be set")
+	}
+	if payload["introspection_endpoint"] != "http://example.com/oauth2/introspect" {
+		t.Fatalf("expected introspection_endpoint to be set")
+	}
+	grants, _ := payload["grant_types_supported"].([]interface{})
+	if len(grants) != 3 {
+		t.Fatalf("expected authorization_code, refresh_token and client_credentials grants, got %v", grants)
+	}
 
 	scopes, ok := payload["scopes_supported"].([]interface{})
 	if !ok || len(scopes) == 0 {
@@ -1,6 +1,9 @@
 package api
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
@@ -9,18 +12,25 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/meowucp/internal/domain"
 	"github.com/meowucp/internal/repository"
+	"github.com/meowucp/internal/service"
 	"golang.org/x/crypto/bcrypt"
 )
 
-const (
-	oauthClientID     = "ucp-client"
-	oauthClientSecret = "ucp-secret"
-	oauthTokenTTL     = time.Hour
-)
+const oauthTokenTTL = time.Hour
+
+// OAuthRefreshTokens issues, rotates and introspects tokens beyond the
+// access tokens the handler stores itself.
+type OAuthRefreshTokens interface {
+	IssueRefreshToken(clientID string, userID *int64, scopes, familyID string) (string, *domain.OAuthRefreshToken, error)
+	RotateRefreshToken(clientID, token, requestedScope string, mint service.OAuthAccessTokenMinter) (*service.OAuthRefreshGrant, error)
+	Introspect(caller *domain.OAuthClient, token string) (*service.OAuthIntrospection, error)
+}
 
 type OAuthTokenHandler struct {
 	clientRepo repository.OAuthClientRepository
 	tokenRepo  repository.OAuthTokenRepository
+	flow       OAuthAuthorizationFlow
+	refresh    OAuthRefreshTokens
 }
 
 func NewOAuthTokenHandler() *OAuthTokenHandler {
@@ -31,66 +41,232 @@ func NewOAuthTokenHandlerWithRepos(clientRepo repository.OAuthClientRepository,
 	return &OAuthTokenHandler{clientRepo: clientRepo, tokenRepo: tokenRepo}
 }
 
+// SetAuthorizationFlow lets Token redeem authorization codes.
+func (h *OAuthTokenHandler) SetAuthorizationFlow(flow OAuthAuthorizationFlow) {
+	h.flow = flow
+}
+
+// SetRefreshTokens enables the refresh_token grant and introspection. Without
+// it authorization codes are redeemed for access tokens only.
+func (h *OAuthTokenHandler) SetRefreshTokens(refresh OAuthRefreshTokens) {
+	h.refresh = refresh
+}
+
+// Token serves the authorization_code, refresh_token and client_credentials
+// grants. Clients authenticate with client_secret_post.
 func (h *OAuthTokenHandler) Token(c *gin.Context) {
 	grantType := c.PostForm("grant_type")
+	switch grantType {
+	case "authorization_code", "client_credentials":
+	case "refresh_token":
+		if h.refresh == nil {
+			respondError(c, http.StatusBadRequest, "unsupported_grant_type", "Unsupported grant type")
+			return
+		}
+	default:
+		respondError(c, http.StatusBadRequest, "unsupported_grant_type", "Unsupported grant type")
+		return
+	}
+
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+	switch grantType {
+	case "authorization_code":
+		h.exchangeCode(c, client)
+	case "refresh_token":
+		h.refreshToken(c, client)
+	case "client_credentials":
+		h.clientCredentials(c, client)
+	}
+}
+
+// Introspect is the RFC 7662 endpoint. Callers authenticate as a client;
+// unknown, expired and revoked tokens, and tokens of other clients unless the
+// caller holds the introspection scope, are reported as inactive.
+func (h *OAuthTokenHandler) Introspect(c *gin.Context) {
+	token := strings.TrimSpace(c.PostForm("token"))
+	caller, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+	if token == "" {
+		respondError(c, http.StatusBadRequest, "invalid_request", "Missing token")
+		return
+	}
+	if h.refresh == nil {
+		respondError(c, http.StatusInternalServerError, "service_unavailable", "OAuth service unavailable")
+		return
+	}
+	result, err := h.refresh.Introspect(caller, token)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "server_error", "Failed to introspect token")
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *OAuthTokenHandler) authenticateClient(c *gin.Context) (*domain.OAuthClient, bool) {
 	clientID := c.PostForm("client_id")
 	clientSecret := c.PostForm("client_secret")
-	code := c.PostForm("code")
+	if clientID == "" || clientSecret == "" {
+		respondError(c, http.StatusBadRequest, "invalid_request", "Missing required fields")
+		return nil, false
+	}
+	if h.clientRepo == nil || h.tokenRepo == nil {
+		respondError(c, http.StatusInternalServerError, "service_unavailable", "OAuth service unavailable")
+		return nil, false
+	}
+	client, err := h.clientRepo.FindByClientID(clientID)
+	if err != nil || client == nil || client.Status == "disabled" {
+		respondError(c, http.StatusUnauthorized, "invalid_client", "Invalid client credentials")
+		return nil, false
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(client.SecretHash), []byte(clientSecret)); err != nil {
+		respondError(c, http.StatusUnauthorized, "invalid_client", "Invalid client credentials")
+		return nil, false
+	}
+	if strings.TrimSpace(client.Scopes) == "" {
+		respondError(c, http.StatusForbidden, "invalid_scope", "No scopes assigned")
+		return nil, false
+	}
+	return client, true
+}
 
-	if grantType != "authorization_code" {
-		respondError(c, http.StatusBadRequest, "unsupported_grant_type", "Unsupported grant type")
+// exchangeCode redeems a single-use authorization code for tokens bound to
+// the shopper who consented, after checking the PKCE code verifier.
+func (h *OAuthTokenHandler) exchangeCode(c *gin.Context, client *domain.OAuthClient) {
+	code := c.PostForm("code")
+	redirectURI := c.PostForm("redirect_uri")
+	codeVerifier := c.PostForm("code_verifier")
+	if code == "" || redirectURI == "" || codeVerifier == "" {
+		respondError(c, http.StatusBadRequest, "invalid_request", "Missing required fields")
 		return
 	}
-	if clientID == "" || clientSecret == "" || code == "" {
-		respondError(c, http.StatusBadRequest, "invalid_request", "Missing required fields")
+	if h.flow == nil {
+		respondError(c, http.StatusInternalServerError, "service_unavailable", "OAuth service unavailable")
 		return
 	}
-	if h.clientRepo != nil {
-		client, err := h.clientRepo.FindByClientID(clientID)
-		if err != nil || client == nil {
-			respondError(c, http.StatusUnauthorized, "invalid_client", "Invalid client credentials")
+
+	grant, err := h.flow.Exchange(client.ClientID, code, redirectURI, codeVerifier)
+	if err != nil {
+		if errors.Is(err, service.ErrOAuthInvalidGrant) {
+			respondError(c, http.StatusBadRequest, "invalid_grant", "Invalid, expired or used authorization code")
 			return
 		}
-		if err := bcrypt.CompareHashAndPassword([]byte(client.SecretHash), []byte(clientSecret)); err != nil {
-			respondError(c, http.StatusUnauthorized, "invalid_client", "Invalid client credentials")
-			return
+		respondError(c, http.StatusInternalServerError, "server_error", "Failed to redeem authorization code")
+		return
+	}
+	userID := grant.UserID
+	h.issueTokens(c, client.ClientID, &userID, grant.Scopes, "", h.refresh != nil)
+}
+
+// refreshToken rotates a refresh token: the presented one is consumed and a
+// new one in the same family is issued with the access token. A narrower
+// scope may be requested, never a wider one; a wider request leaves the
+// presented token usable.
+func (h *OAuthTokenHandler) refreshToken(c *gin.Context, client *domain.OAuthClient) {
+	token := c.PostForm("refresh_token")
+	if token == "" {
+		respondError(c, http.StatusBadRequest, "invalid_request", "Missing required fields")
+		return
+	}
+	grant, err := h.refresh.RotateRefreshToken(client.ClientID, token, c.PostForm("scope"), func(scope string, userID *int64) (*domain.OAuthToken, error) {
+		return newOAuthAccessToken(client.ClientID, userID, scope)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrOAuthInvalidScope):
+			respondError(c, http.StatusBadRequest, "invalid_scope", "Requested scope exceeds the original grant")
+		case errors.Is(err, service.ErrOAuthInvalidGrant):
+			respondError(c, http.StatusBadRequest, "invalid_grant", "Invalid, expired or reused refresh token")
+		default:
+			respondError(c, http.StatusInternalServerError, "server_error", "Failed to refresh token")
 		}
-		if strings.TrimSpace(client.Scopes) == "" {
-			respondError(c, http.StatusForbidden, "invalid_scope", "No scopes assigned")
+		return
+	}
+	response := oauthTokenResponse(grant.Access)
+	response["refresh_token"] = grant.RefreshToken
+	c.JSON(http.StatusOK, response)
+}
+
+// clientCredentials issues an access token for the client itself, with no
+// shopper and no refresh token.
+func (h *OAuthTokenHandler) clientCredentials(c *gin.Context, client *domain.OAuthClient) {
+	scope, err := service.GrantedOAuthScope(client.Scopes, c.PostForm("scope"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_scope", "Requested scope is not assigned to the client")
+		return
+	}
+	h.issueTokens(c, client.ClientID, nil, scope, "", false)
+}
+
+func (h *OAuthTokenHandler) issueTokens(c *gin.Context, clientID string, userID *int64, scope, familyID string, withRefresh bool) {
+	refreshToken := ""
+	if withRefresh {
+		token, record, err := h.refresh.IssueRefreshToken(clientID, userID, scope, familyID)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "token_failed", "Failed to issue token")
 			return
 		}
+		familyID = record.FamilyID
+		refreshToken = token
 	}
 
-	token, err := generateOAuthToken(clientID)
+	access, err := newOAuthAccessToken(clientID, userID, scope)
 	if err != nil {
 		respondError(c, http.StatusInternalServerError, "token_failed", "Failed to issue token")
 		return
 	}
-	if h.tokenRepo != nil {
-		_ = h.tokenRepo.Create(&domain.OAuthToken{
-			Token:     token,
-			ClientID:  clientID,
-			Scopes:    oauthCheckoutScope,
-			ExpiresAt: time.Now().Add(oauthTokenTTL),
-		})
+	access.FamilyID = familyID
+	if err := h.tokenRepo.Create(access); err != nil {
+		respondError(c, http.StatusInternalServerError, "token_failed", "Failed to issue token")
+		return
+	}
+
+	response := oauthTokenResponse(access)
+	if refreshToken != "" {
+		response["refresh_token"] = refreshToken
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// newOAuthAccessToken signs an access token and returns its unsaved record.
+func newOAuthAccessToken(clientID string, userID *int64, scope string) (*domain.OAuthToken, error) {
+	token, err := generateOAuthToken(clientID, scope)
+	if err != nil {
+		return nil, err
 	}
+	return &domain.OAuthToken{
+		Token:     token,
+		ClientID:  clientID,
+		UserID:    userID,
+		Scopes:    scope,
+		ExpiresAt: time.Now().Add(oauthTokenTTL),
+	}, nil
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"access_token": token,
+func oauthTokenResponse(access *domain.OAuthToken) gin.H {
+	return gin.H{
+		"access_token": access.Token,
 		"token_type":   "bearer",
 		"expires_in":   int(oauthTokenTTL.Seconds()),
-		"scope":        oauthCheckoutScope,
-	})
+		"scope":        access.Scopes,
+	}
 }
 
-func generateOAuthToken(clientID string) (string, error) {
+func generateOAuthToken(clientID, scope string) (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
 	claims := jwt.MapClaims{
 		"sub":   clientID,
-		"scope": oauthCheckoutScope,
+		"scope": scope,
 		"typ":   "oauth",
+		"jti":   hex.EncodeToString(jti),
 		"exp":   time.Now().Add(oauthTokenTTL).Unix(),
 	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	return signToken(claims)
 }
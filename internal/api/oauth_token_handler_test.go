@@ -26,6 +26,7 @@ func (f *fakeOAuthClientRepo) Create(client *domain.OAuthClient) error { return
 func (f *fakeOAuthClientRepo) FindByClientID(clientID string) (*domain.OAuthClient, error) {
 	return &domain.OAuthClient{ClientID: clientID, SecretHash: string(mustHash("secret")), Scopes: "checkout"}, nil
 }
+func (f *fakeOAuthClientRepo) Update(client *domain.OAuthClient) error               { return nil }
 func (f *fakeOAuthClientRepo) List(offset, limit int) ([]*domain.OAuthClient, error) { return nil, nil }
 func (f *fakeOAuthClientRepo) Count() (int64, error)                                 { return 0, nil }
 
@@ -36,46 +37,15 @@ func (f *fakeOAuthTokenRepo) FindByToken(token string) (*domain.OAuthToken, erro
 	return nil, errors.New("not found")
 }
 func (f *fakeOAuthTokenRepo) Revoke(token string, revokedAt time.Time) error { return nil }
+func (f *fakeOAuthTokenRepo) RevokeFamily(familyID string, revokedAt time.Time) error {
+	return nil
+}
 
 func mustHash(value string) []byte {
 	hash, _ := bcrypt.GenerateFromPassword([]byte(value), bcrypt.DefaultCost)
 	return hash
 }
 
-func TestOAuthTokenExchange(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-
-	handler := NewOAuthTokenHandlerWithRepos(nil, nil)
-	r := gin.New()
-	r.POST("/oauth2/token", handler.Token)
-
-	body := "grant_type=authorization_code&client_id=ucp-client&client_secret=ucp-secret&code=authcode"
-	req := httptest.NewRequest(http.MethodPost, "/oauth2/token", strings.NewReader(body))
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	resp := httptest.NewRecorder()
-	r.ServeHTTP(resp, req)
-
-	if resp.Code != http.StatusOK {
-		t.Fatalf("expected status 200, got %d", resp.Code)
-	}
-
-	var payload map[string]interface{}
-	if err := json.Unmarshal(resp.Body.Bytes(), &payload); err != nil {
-		t.Fatalf("unmarshal response: %v", err)
-	}
-	accessToken, _ := payload["access_token"].(string)
-	if accessToken == "" {
-		t.Fatalf("expected access_token to be set")
-	}
-	if payload["token_type"] != "bearer" {
-		t.Fatalf("expected token_type bearer")
-	}
-	expiresIn, ok := payload["expires_in"].(float64)
-	if !ok || expiresIn <= 0 {
-		t.Fatalf("expected expires_in to be positive")
-	}
-}
-
 func TestOAuthTokenScopesRestricted(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -88,7 +58,7 @@ func TestOAuthTokenScopesRestricted(t *testing.T) {
 	r2 := gin.New()
 	r2.POST("/oauth2/token", clientHandler.Token)
 
-	body := "grant_type=authorization_code&client_id=client_1&client_secret=wrong-secret&code=authcode"
+	body := "grant_type=authorization_code&client_id=client_1&client_secret=wrong-secret&code=authcode&redirect_uri=https%3A%2F%2Fexample.com%2Fcb&code_verifier=" + testCodeVerifier
 	req := httptest.NewRequest(http.MethodPost, "/oauth2/token", strings.NewReader(body))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	resp := httptest.NewRecorder()
@@ -116,3 +86,45 @@ func TestOAuthRevokeToken(t *testing.T) {
 		t.Fatalf("expected status 200, got %d", resp.Code)
 	}
 }
+
+func TestOAuthClientCredentialsGrant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tokens := &recordingOAuthTokenRepo{}
+	handler := NewOAuthTokenHandlerWithRepos(&fakeOAuthClientRepo{}, tokens)
+	r := gin.New()
+	r.POST("/oauth2/token", handler.Token)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/oauth2/token", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	if resp := post("grant_type=password&client_id=client_1&client_secret=secret"); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected unsupported grant to return 400, got %d", resp.Code)
+	}
+	if resp := post("grant_type=refresh_token&client_id=client_1&client_secret=secret&refresh_token=x"); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected refresh_token without refresh support to return 400, got %d", resp.Code)
+	}
+	if resp := post("grant_type=client_credentials&client_id=client_1&client_secret=secret&scope=admin"); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected an unassigned scope to return 400, got %d", resp.Code)
+	}
+
+	resp := post("grant_type=client_credentials&client_id=client_1&client_secret=secret")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if _, ok := payload["refresh_token"]; ok {
+		t.Fatalf("expected no refresh token for client_credentials")
+	}
+	if payload["scope"] != "checkout" || len(tokens.created) != 1 || tokens.created[0].UserID != nil {
+		t.Fatalf("expected a client token without a shopper, got %v %+v", payload, tokens.created)
+	}
+}
@@ -22,7 +22,7 @@ func NewOrderHandler(service OrderService) *OrderHandler {
 }
 
 type OrderCreateRequest struct {
-	UserID          int64  `json:"user_id" binding:"required"`
+	UserID          int64  `json:"user_id"`
 	ShippingAddress string `json:"shipping_address" binding:"required"`
 	BillingAddress  string `json:"billing_address" binding:"required"`
 	Notes           string `json:"notes"`
@@ -35,6 +35,16 @@ func (h *OrderHandler) Create(c *gin.Context) {
 		respondError(c, http.StatusBadRequest, "invalid_request", "Invalid request body")
 		return
 	}
+	// Behind the auth middleware the caller always orders for themselves; a
+	// body user_id is only honoured when no authenticated user is present.
+	if value, exists := c.Get("user_id"); exists {
+		authUserID, _ := value.(int64)
+		if req.UserID != 0 && req.UserID != authUserID {
+			respondError(c, http.StatusForbidden, "forbidden", "Cannot create orders for another user")
+			return
+		}
+		req.UserID = authUserID
+	}
 	if req.UserID <= 0 {
 		respondError(c, http.StatusBadRequest, "missing_required_fields", "User id is required")
 		return
@@ -119,3 +119,34 @@ func TestOrderCreateIdempotencyConflict(t *testing.T) {
 		t.Fatalf("expected idempotency conflict code")
 	}
 }
+
+func TestOrderCreateRejectsOtherUserWhenAuthenticated(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	svc := &fakeOrderCreator{order: &domain.Order{ID: 10, OrderNo: "ORD-10"}}
+	handler := NewOrderHandler(svc)
+
+	r := gin.New()
+	r.POST("/api/v1/orders", func(c *gin.Context) {
+		c.Set("user_id", int64(5))
+		handler.Create(c)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/orders", strings.NewReader(`{
+  "user_id": 12,
+  "shipping_address": "Ship",
+  "billing_address": "Bill",
+  "payment_method": "card"
+}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403, got %d", resp.Code)
+	}
+	if svc.lastUserID != 0 {
+		t.Fatalf("expected service not to be called")
+	}
+}
@@ -1,56 +1,82 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/meowucp/internal/service"
 )
 
-type PaymentCallbackPaymentService interface {
-	MarkPaymentPaid(orderID int64, transactionID string) error
-}
+// PaymentHandlerHeader names the payment handler when the route has no
+// :handler segment.
+const PaymentHandlerHeader = "X-Payment-Handler"
 
-type PaymentCallbackOrderService interface {
-	UpdateOrderStatus(id int64, status string) error
+type PaymentCallbackPaymentService interface {
+	ProcessCallback(handlerName string, header http.Header, body []byte) (*service.PaymentCallbackOutcome, error)
 }
 
 type PaymentCallbackHandler struct {
 	payment PaymentCallbackPaymentService
-	orders  PaymentCallbackOrderService
-}
-
-func NewPaymentCallbackHandler(payment PaymentCallbackPaymentService, orders PaymentCallbackOrderService) *PaymentCallbackHandler {
-	return &PaymentCallbackHandler{payment: payment, orders: orders}
 }
 
-type PaymentCallbackRequest struct {
-	OrderID       int64  `json:"order_id"`
-	TransactionID string `json:"transaction_id"`
+func NewPaymentCallbackHandler(payment PaymentCallbackPaymentService) *PaymentCallbackHandler {
+	return &PaymentCallbackHandler{payment: payment}
 }
 
+// Handle accepts a signed {order_id, transaction_id, amount, currency}
+// callback; the payment service marks the payment and order paid together.
+// Replays of an already confirmed transaction are acknowledged as duplicates.
 func (h *PaymentCallbackHandler) Handle(c *gin.Context) {
-	var req PaymentCallbackRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		respondError(c, http.StatusBadRequest, "invalid_request", "Invalid request body")
+	if h.payment == nil {
+		respondError(c, http.StatusInternalServerError, "service_unavailable", "Payment callback unavailable")
 		return
 	}
-	if req.OrderID <= 0 || strings.TrimSpace(req.TransactionID) == "" {
-		respondError(c, http.StatusBadRequest, "missing_required_fields", "Order id and transaction id are required")
+	handlerName := strings.TrimSpace(c.Param("handler"))
+	if handlerName == "" {
+		handlerName = strings.TrimSpace(c.GetHeader(PaymentHandlerHeader))
+	}
+	if handlerName == "" {
+		respondError(c, http.StatusBadRequest, "missing_payment_handler", "Payment handler is required")
 		return
 	}
-	if h.payment == nil || h.orders == nil {
-		respondError(c, http.StatusInternalServerError, "service_unavailable", "Payment callback unavailable")
+	body, err := c.GetRawData()
+	if err != nil || len(body) == 0 {
+		respondError(c, http.StatusBadRequest, "invalid_request", "Invalid request body")
 		return
 	}
-	if err := h.payment.MarkPaymentPaid(req.OrderID, req.TransactionID); err != nil {
-		respondError(c, http.StatusInternalServerError, "payment_update_failed", "Failed to update payment")
+
+	outcome, err := h.payment.ProcessCallback(handlerName, c.Request.Header, body)
+	if err != nil {
+		respondPaymentCallbackError(c, err)
 		return
 	}
-	if err := h.orders.UpdateOrderStatus(req.OrderID, "paid"); err != nil {
-		respondError(c, http.StatusInternalServerError, "order_update_failed", "Failed to update order")
+	if outcome.Duplicate {
+		c.JSON(http.StatusOK, gin.H{"status": "duplicate"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
+
+func respondPaymentCallbackError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrPaymentCallbackUnknownHandler):
+		respondError(c, http.StatusNotFound, "unknown_payment_handler", "Unknown payment handler")
+	case errors.Is(err, service.ErrPaymentCallbackSecretMissing):
+		respondError(c, http.StatusServiceUnavailable, "callback_secret_missing", "Payment handler has no callback secret")
+	case errors.Is(err, service.ErrPaymentCallbackSignature):
+		respondError(c, http.StatusUnauthorized, "invalid_signature", "Invalid callback signature")
+	case errors.Is(err, service.ErrPaymentCallbackPayload):
+		respondError(c, http.StatusBadRequest, "invalid_callback", "Order id, transaction id and amount are required")
+	case errors.Is(err, service.ErrOrderNotFound):
+		respondError(c, http.StatusNotFound, "order_not_found", "Order not found")
+	case errors.Is(err, service.ErrPaymentCallbackAmountMismatch):
+		respondError(c, http.StatusUnprocessableEntity, "amount_mismatch", "Amount or currency does not match the order")
+	case errors.Is(err, service.ErrPaymentCallbackOrderNotPayable):
+		respondError(c, http.StatusConflict, "order_not_payable", "Order is not awaiting payment")
+	default:
+		respondError(c, http.StatusInternalServerError, "payment_update_failed", "Failed to update payment")
+	}
+}
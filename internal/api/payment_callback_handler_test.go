@@ -7,56 +7,72 @@ import (
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/meowucp/internal/service"
 )
 
 type fakePaymentCallbackPaymentService struct {
-	called        bool
-	orderID       int64
-	transactionID string
+	handlerName string
+	body        string
+	outcome     *service.PaymentCallbackOutcome
+	err         error
 }
 
-func (f *fakePaymentCallbackPaymentService) MarkPaymentPaid(orderID int64, transactionID string) error {
-	f.called = true
-	f.orderID = orderID
-	f.transactionID = transactionID
-	return nil
-}
-
-type fakePaymentCallbackOrderService struct {
-	called bool
-	id     int64
-	status string
-}
-
-func (f *fakePaymentCallbackOrderService) UpdateOrderStatus(id int64, status string) error {
-	f.called = true
-	f.id = id
-	f.status = status
-	return nil
+func (f *fakePaymentCallbackPaymentService) ProcessCallback(handlerName string, header http.Header, body []byte) (*service.PaymentCallbackOutcome, error) {
+	f.handlerName = handlerName
+	f.body = string(body)
+	return f.outcome, f.err
 }
 
 func TestPaymentCallbackMarksOrderPaid(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
-	paymentService := &fakePaymentCallbackPaymentService{}
-	orderService := &fakePaymentCallbackOrderService{}
-	handler := NewPaymentCallbackHandler(paymentService, orderService)
+	paymentService := &fakePaymentCallbackPaymentService{outcome: &service.PaymentCallbackOutcome{OrderID: 123, PaymentID: 1}}
+	handler := NewPaymentCallbackHandler(paymentService)
 
 	r := gin.New()
-	r.POST("/api/v1/payment/callback", handler.Handle)
+	r.POST("/api/v1/payment/callback/:handler", handler.Handle)
 
-	body := `{"order_id": 123, "transaction_id": "tx_001"}`
-	req := httptest.NewRequest(http.MethodPost, "/api/v1/payment/callback", strings.NewReader(body))
+	body := `{"order_id": 123, "transaction_id": "tx_001", "amount": 1999, "currency": "CNY"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/payment/callback/com.nowpayments", strings.NewReader(body))
 	resp := httptest.NewRecorder()
 	r.ServeHTTP(resp, req)
 
 	if resp.Code != http.StatusOK {
 		t.Fatalf("expected status 200, got %d", resp.Code)
 	}
-	if !paymentService.called || paymentService.orderID != 123 || paymentService.transactionID != "tx_001" {
-		t.Fatalf("expected payment to be marked paid")
+	if paymentService.handlerName != "com.nowpayments" || paymentService.body != body {
+		t.Fatalf("expected raw body to be verified for the handler")
+	}
+	if !strings.Contains(resp.Body.String(), `"ok"`) {
+		t.Fatalf("expected accepted callback, got %s", resp.Body.String())
+	}
+}
+
+func TestPaymentCallbackRejectsBadSignatureAndSkipsDuplicates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	paymentService := &fakePaymentCallbackPaymentService{err: service.ErrPaymentCallbackSignature}
+	handler := NewPaymentCallbackHandler(paymentService)
+
+	r := gin.New()
+	r.POST("/api/v1/payment/callback", handler.Handle)
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/payment/callback", strings.NewReader(`{"order_id": 1}`))
+		req.Header.Set(PaymentHandlerHeader, "com.nowpayments")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	if resp := send(); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", resp.Code)
 	}
-	if !orderService.called || orderService.id != 123 || orderService.status != "paid" {
-		t.Fatalf("expected order status to be updated to paid")
+
+	paymentService.err = nil
+	paymentService.outcome = &service.PaymentCallbackOutcome{OrderID: 1, Duplicate: true}
+	resp := send()
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), "duplicate") {
+		t.Fatalf("expected duplicate acknowledgement, got %d %s", resp.Code, resp.Body.String())
 	}
 }
@@ -1,16 +1,19 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/service"
+	"github.com/meowucp/pkg/money"
 )
 
 type PaymentRefundService interface {
-	CreateRefund(paymentID int64, amount float64, reason string) (*domain.PaymentRefund, error)
+	CreateRefund(paymentID int64, amount money.Amount, reason string, items []service.RefundItemRequest) (*domain.PaymentRefund, error)
 }
 
 type PaymentRefundHandler struct {
@@ -22,8 +25,9 @@ func NewPaymentRefundHandler(service PaymentRefundService) *PaymentRefundHandler
 }
 
 type PaymentRefundRequest struct {
-	Amount float64 `json:"amount"`
-	Reason string  `json:"reason"`
+	Amount money.Amount                `json:"amount"`
+	Reason string                      `json:"reason"`
+	Items  []service.RefundItemRequest `json:"items"`
 }
 
 func (h *PaymentRefundHandler) Create(c *gin.Context) {
@@ -49,11 +53,36 @@ func (h *PaymentRefundHandler) Create(c *gin.Context) {
 	}
 	reason := strings.TrimSpace(req.Reason)
 
-	refund, err := h.service.CreateRefund(paymentID, req.Amount, reason)
+	refund, err := h.service.CreateRefund(paymentID, req.Amount, reason, req.Items)
 	if err != nil {
-		respondError(c, http.StatusInternalServerError, "refund_failed", "Refund failed")
+		respondRefundError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, refund)
 }
+
+func respondRefundError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrRefundPaymentNotFound):
+		respondError(c, http.StatusNotFound, "payment_not_found", "Payment not found")
+	case errors.Is(err, service.ErrRefundNotFound):
+		respondError(c, http.StatusNotFound, "refund_not_found", "Refund not found")
+	case errors.Is(err, service.ErrRefundInvalidAmount):
+		respondError(c, http.StatusBadRequest, "invalid_amount", "Refund amount required")
+	case errors.Is(err, service.ErrRefundInvalidItem):
+		respondError(c, http.StatusBadRequest, "invalid_refund_item", "Refund item does not belong to the order")
+	case errors.Is(err, service.ErrRefundExceedsPayment):
+		respondError(c, http.StatusUnprocessableEntity, "refund_amount_exceeds_payment", "Refund exceeds the amount left on the payment")
+	case errors.Is(err, service.ErrRefundItemQuantity):
+		respondError(c, http.StatusUnprocessableEntity, "refund_item_quantity_exceeded", "Refund quantity exceeds what is left on the order item")
+	case errors.Is(err, service.ErrRefundPaymentNotRefundable):
+		respondError(c, http.StatusConflict, "payment_not_refundable", "Payment cannot be refunded")
+	case errors.Is(err, service.ErrRefundOrderNotRefundable):
+		respondError(c, http.StatusConflict, "order_not_refundable", "Order cannot be fully refunded in its current status")
+	case errors.Is(err, service.ErrRefundNotPending):
+		respondError(c, http.StatusConflict, "refund_not_pending", "Refund is already settled")
+	default:
+		respondError(c, http.StatusInternalServerError, "refund_failed", "Refund failed")
+	}
+}
@@ -8,14 +8,22 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/service"
+	"github.com/meowucp/pkg/money"
 )
 
 type fakeRefundPaymentService struct {
 	refund *domain.PaymentRefund
 }
 
-func (f *fakeRefundPaymentService) CreateRefund(paymentID int64, amount float64, reason string) (*domain.PaymentRefund, error) {
+func (f *fakeRefundPaymentService) CreateRefund(paymentID int64, amount money.Amount, reason string, items []service.RefundItemRequest) (*domain.PaymentRefund, error) {
+	if amount > 100 {
+		return nil, service.ErrRefundExceedsPayment
+	}
 	f.refund = &domain.PaymentRefund{PaymentID: paymentID, Amount: amount, Reason: reason}
+	for _, item := range items {
+		f.refund.Items = append(f.refund.Items, domain.PaymentRefundItem{OrderItemID: item.OrderItemID, Quantity: item.Quantity})
+	}
 	return f.refund, nil
 }
 
@@ -28,7 +36,7 @@ func TestPaymentRefundHandlerCreatesRefund(t *testing.T) {
 	r := gin.New()
 	r.POST("/api/v1/payments/:id/refund", handler.Create)
 
-	body := `{"amount":40,"reason":"customer_request"}`
+	body := `{"amount":40,"reason":"customer_request","items":[{"order_item_id":3,"quantity":1}]}`
 	req := httptest.NewRequest(http.MethodPost, "/api/v1/payments/10/refund", strings.NewReader(body))
 	req.Header.Set("Content-Type", "application/json")
 	resp := httptest.NewRecorder()
@@ -40,4 +48,15 @@ func TestPaymentRefundHandlerCreatesRefund(t *testing.T) {
 	if service.refund == nil || service.refund.PaymentID != 10 {
 		t.Fatalf("expected refund to be created")
 	}
+	if len(service.refund.Items) != 1 || service.refund.Items[0].OrderItemID != 3 {
+		t.Fatalf("expected refund items to be passed through")
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/payments/10/refund", strings.NewReader(`{"amount":400}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if resp.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422, got %d", resp.Code)
+	}
 }
@@ -5,10 +5,11 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/pkg/money"
 )
 
 type ShippingRateService interface {
-	Quote(region string, items []domain.OrderItem) (float64, float64, error)
+	Quote(region string, items []domain.OrderItem) (money.Amount, money.Amount, error)
 }
 
 type ShippingRateHandler struct {
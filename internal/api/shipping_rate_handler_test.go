@@ -7,21 +7,22 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/pkg/money"
 )
 
 type fakeShippingRateService struct {
-	tax      float64
-	shipping float64
+	tax      money.Amount
+	shipping money.Amount
 }
 
-func (f *fakeShippingRateService) Quote(region string, items []domain.OrderItem) (float64, float64, error) {
+func (f *fakeShippingRateService) Quote(region string, items []domain.OrderItem) (money.Amount, money.Amount, error) {
 	return f.tax, f.shipping, nil
 }
 
 func TestShippingRateEndpoint(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
-	service := &fakeShippingRateService{tax: 1.5, shipping: 10}
+	service := &fakeShippingRateService{tax: 150, shipping: 1000}
 	handler := NewShippingRateHandler(service)
 
 	r := gin.New()
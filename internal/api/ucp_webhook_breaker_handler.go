@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/meowucp/internal/domain"
+)
+
+type WebhookBreakerLister interface {
+	List() ([]*domain.UCPWebhookBreaker, error)
+}
+
+type WebhookBreakerHandler struct {
+	lister WebhookBreakerLister
+}
+
+func NewWebhookBreakerHandler(lister WebhookBreakerLister) *WebhookBreakerHandler {
+	return &WebhookBreakerHandler{lister: lister}
+}
+
+func (h *WebhookBreakerHandler) List(c *gin.Context) {
+	items, err := h.lister.List()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "list_failed", "Failed to list webhook circuit breakers")
+		return
+	}
+	open := 0
+	for _, item := range items {
+		if item != nil && item.State != "closed" {
+			open++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items), "open": open})
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/meowucp/internal/domain"
+)
+
+type fakeWebhookBreakerLister struct {
+	items []*domain.UCPWebhookBreaker
+}
+
+func (f fakeWebhookBreakerLister) List() ([]*domain.UCPWebhookBreaker, error) {
+	return f.items, nil
+}
+
+func TestWebhookBreakerHandlerList(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler := NewWebhookBreakerHandler(fakeWebhookBreakerLister{items: []*domain.UCPWebhookBreaker{
+		{Destination: "default", State: "closed"},
+		{Destination: "subscription:2", State: "open", ConsecutiveFailures: 5},
+	}})
+	r := gin.New()
+	r.GET("/api/v1/admin/ucp/webhook-breakers", handler.List)
+
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/v1/admin/ucp/webhook-breakers", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	var body struct {
+		Total int `json:"total"`
+		Open  int `json:"open"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Total != 2 || body.Open != 1 {
+		t.Fatalf("expected 2 breakers with 1 open, got %+v", body)
+	}
+}
@@ -11,12 +11,19 @@ import (
 
 type UserHandler struct {
 	userService *service.UserService
+	sessions    UserSessionManager
 }
 
 func NewUserHandler(userService *service.UserService) *UserHandler {
 	return &UserHandler{userService: userService}
 }
 
+// SetSessions makes Login open a server-side session and return its refresh
+// token alongside the access token.
+func (h *UserHandler) SetSessions(sessions UserSessionManager) {
+	h.sessions = sessions
+}
+
 type RegisterRequest struct {
 	Username string `json:"username" binding:"required"`
 	Email    string `json:"email" binding:"required,email"`
@@ -79,21 +86,34 @@ func (h *UserHandler) Login(c *gin.Context) {
 		return
 	}
 
-	token, err := generateToken(user.ID, user.Role)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"token": token,
+	response := gin.H{
 		"user": gin.H{
 			"id":       user.ID,
 			"username": user.Username,
 			"email":    user.Email,
 			"role":     user.Role,
 		},
-	})
+	}
+	sessionID := ""
+	if h.sessions != nil {
+		session, refreshToken, err := h.sessions.Start(user.ID, c.ClientIP(), c.Request.UserAgent())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start session"})
+			return
+		}
+		sessionID = session.SessionID
+		response["refresh_token"] = refreshToken
+		response["expires_in"] = int(userTokenTTL.Seconds())
+	}
+
+	token, err := generateToken(user.ID, user.Role, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	response["token"] = token
+
+	c.JSON(http.StatusOK, response)
 }
 
 func (h *UserHandler) GetCurrentUser(c *gin.Context) {
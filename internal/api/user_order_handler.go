@@ -0,0 +1,89 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/service"
+)
+
+type UserOrderService interface {
+	ListUserOrders(userID int64, status string, offset, limit int) ([]*domain.Order, int64, error)
+	GetUserOrderDetail(userID, orderID int64) (*service.OrderDetail, error)
+}
+
+type UserOrderHandler struct {
+	service UserOrderService
+}
+
+func NewUserOrderHandler(service UserOrderService) *UserOrderHandler {
+	return &UserOrderHandler{service: service}
+}
+
+func (h *UserOrderHandler) List(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	limitInt := parseInt(c.DefaultQuery("limit", "20"))
+	pageInt := parseInt(c.DefaultQuery("page", "1"))
+	if pageInt < 1 {
+		pageInt = 1
+	}
+	if limitInt < 1 {
+		limitInt = 20
+	}
+	if limitInt > 100 {
+		limitInt = 100
+	}
+
+	status := c.Query("status")
+	if status != "" && !service.IsOrderStatus(status) {
+		respondError(c, http.StatusBadRequest, "invalid_status", "Invalid order status")
+		return
+	}
+
+	offset := (pageInt - 1) * limitInt
+	orders, total, err := h.service.ListUserOrders(userID, status, offset, limitInt)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "list_failed", "Failed to list orders")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"orders": orders,
+		"pagination": gin.H{
+			"page":  pageInt,
+			"limit": limitInt,
+			"total": total,
+		},
+	})
+}
+
+func (h *UserOrderHandler) Get(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		respondError(c, http.StatusBadRequest, "invalid_id", "Invalid order id")
+		return
+	}
+
+	detail, err := h.service.GetUserOrderDetail(userID, id)
+	if err != nil {
+		if errors.Is(err, service.ErrOrderNotFound) {
+			respondError(c, http.StatusNotFound, "order_not_found", "Order not found")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "load_failed", "Failed to load order")
+		return
+	}
+
+	c.JSON(http.StatusOK, detail)
+}
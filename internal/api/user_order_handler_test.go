@@ -0,0 +1,118 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/service"
+)
+
+type fakeUserOrderService struct {
+	lastUserID int64
+	lastStatus string
+	lastOffset int
+	lastLimit  int
+	detail     *service.OrderDetail
+}
+
+func (f *fakeUserOrderService) ListUserOrders(userID int64, status string, offset, limit int) ([]*domain.Order, int64, error) {
+	f.lastUserID = userID
+	f.lastStatus = status
+	f.lastOffset = offset
+	f.lastLimit = limit
+	return []*domain.Order{{ID: 1, OrderNo: "ORD-1", Status: status}}, 11, nil
+}
+
+func (f *fakeUserOrderService) GetUserOrderDetail(userID, orderID int64) (*service.OrderDetail, error) {
+	f.lastUserID = userID
+	if f.detail == nil || f.detail.Order.ID != orderID {
+		return nil, service.ErrOrderNotFound
+	}
+	return f.detail, nil
+}
+
+func newUserOrderRouter(handler *UserOrderHandler) *gin.Engine {
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", int64(7))
+		c.Next()
+	})
+	r.GET("/api/v1/user/orders", handler.List)
+	r.GET("/api/v1/user/orders/:id", handler.Get)
+	return r
+}
+
+func TestUserOrderListScopesToCallerWithFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	svc := &fakeUserOrderService{}
+	r := newUserOrderRouter(NewUserOrderHandler(svc))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/user/orders?status=paid&page=2&limit=5", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.Code)
+	}
+	if svc.lastUserID != 7 || svc.lastStatus != "paid" || svc.lastOffset != 5 || svc.lastLimit != 5 {
+		t.Fatalf("unexpected list args: %+v", svc)
+	}
+	if !strings.Contains(resp.Body.String(), `"total":11`) {
+		t.Fatalf("expected pagination total, got %s", resp.Body.String())
+	}
+}
+
+func TestUserOrderListRejectsUnknownStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := newUserOrderRouter(NewUserOrderHandler(&fakeUserOrderService{}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/user/orders?status=lost", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", resp.Code)
+	}
+}
+
+func TestUserOrderGetReturnsDetail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	svc := &fakeUserOrderService{detail: &service.OrderDetail{
+		Order:    &domain.Order{ID: 3, OrderNo: "ORD-3"},
+		Shipment: &domain.Shipment{OrderID: 3, TrackingNo: "TRK-1"},
+		Timeline: []*domain.OrderStatusLog{{OrderID: 3, FromStatus: "pending", ToStatus: "paid"}},
+	}}
+	r := newUserOrderRouter(NewUserOrderHandler(svc))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/user/orders/3", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.Code)
+	}
+	if !strings.Contains(resp.Body.String(), "TRK-1") || !strings.Contains(resp.Body.String(), `"ToStatus":"paid"`) {
+		t.Fatalf("expected shipment and timeline, got %s", resp.Body.String())
+	}
+}
+
+func TestUserOrderGetNotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := newUserOrderRouter(NewUserOrderHandler(&fakeUserOrderService{}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/user/orders/9", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", resp.Code)
+	}
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/service"
+)
+
+// UserSessionManager is the server-side session store behind login, token
+// refresh, logout and the session list.
+type UserSessionManager interface {
+	Start(userID int64, ip, userAgent string) (*domain.UserSession, string, error)
+	Refresh(refreshToken, ip, userAgent string) (*domain.UserSession, string, error)
+	List(userID int64) ([]*domain.UserSession, error)
+	Revoke(userID int64, sessionID string) error
+	RevokeAll(userID int64, actor string) (int64, error)
+}
+
+type SessionUserLookup interface {
+	GetUserByID(id int64) (*domain.User, error)
+}
+
+type UserSessionHandler struct {
+	sessions UserSessionManager
+	users    SessionUserLookup
+}
+
+func NewUserSessionHandler(sessions UserSessionManager, users SessionUserLookup) *UserSessionHandler {
+	return &UserSessionHandler{sessions: sessions, users: users}
+}
+
+type refreshSessionRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh
+// token on the same session.
+func (h *UserSessionHandler) Refresh(c *gin.Context) {
+	if h.sessions == nil || h.users == nil {
+		respondError(c, http.StatusInternalServerError, "service_unavailable", "Session service unavailable")
+		return
+	}
+	var req refreshSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid_request", "Refresh token is required")
+		return
+	}
+	session, refreshToken, err := h.sessions.Refresh(req.RefreshToken, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		if errors.Is(err, service.ErrUserSessionInvalid) {
+			respondError(c, http.StatusUnauthorized, "invalid_session", "Session expired or revoked")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "refresh_failed", "Failed to refresh session")
+		return
+	}
+	user, err := h.users.GetUserByID(session.UserID)
+	if err != nil || user == nil || user.Status == 0 {
+		_ = h.sessions.Revoke(session.UserID, session.SessionID)
+		respondError(c, http.StatusUnauthorized, "invalid_session", "Session expired or revoked")
+		return
+	}
+	token, err := generateToken(user.ID, user.Role, session.SessionID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "refresh_failed", "Failed to generate token")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    int(userTokenTTL.Seconds()),
+	})
+}
+
+// List shows the signed-in user's live sessions, marking the one making the
+// request as current.
+func (h *UserSessionHandler) List(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+	if h.sessions == nil {
+		respondError(c, http.StatusInternalServerError, "service_unavailable", "Session service unavailable")
+		return
+	}
+	sessions, err := h.sessions.List(userID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "session_list_failed", "Failed to list sessions")
+		return
+	}
+	current := c.GetString("session_id")
+	items := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		items = append(items, gin.H{
+			"session_id":   session.SessionID,
+			"user_agent":   session.UserAgent,
+			"ip":           session.IP,
+			"last_seen_at": session.LastSeenAt,
+			"created_at":   session.CreatedAt,
+			"expires_at":   session.ExpiresAt,
+			"current":      session.SessionID == current,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+}
+
+// Logout ends the session making the request.
+func (h *UserSessionHandler) Logout(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+	sessionID := c.GetString("session_id")
+	if sessionID == "" {
+		respondError(c, http.StatusBadRequest, "no_session", "Token is not bound to a session")
+		return
+	}
+	h.revoke(c, userID, sessionID)
+}
+
+// Revoke ends another of the user's sessions, e.g. a lost device.
+func (h *UserSessionHandler) Revoke(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+	h.revoke(c, userID, c.Param("session_id"))
+}
+
+func (h *UserSessionHandler) revoke(c *gin.Context, userID int64, sessionID string) {
+	if h.sessions == nil {
+		respondError(c, http.StatusInternalServerError, "service_unavailable", "Session service unavailable")
+		return
+	}
+	if err := h.sessions.Revoke(userID, sessionID); err != nil {
+		if errors.Is(err, service.ErrUserSessionNotFound) {
+			respondError(c, http.StatusNotFound, "session_not_found", "Session not found")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "logout_failed", "Failed to end session")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"revoked": 1})
+}
+
+// LogoutAll ends every session of the signed-in user, this one included.
+func (h *UserSessionHandler) LogoutAll(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+	h.revokeAll(c, userID, "")
+}
+
+// AdminRevokeAll terminates every session of the user in the path.
+func (h *UserSessionHandler) AdminRevokeAll(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || userID <= 0 {
+		respondError(c, http.StatusBadRequest, "invalid_user_id", "Invalid user id")
+		return
+	}
+	h.revokeAll(c, userID, adminActor(c))
+}
+
+func (h *UserSessionHandler) revokeAll(c *gin.Context, userID int64, actor string) {
+	if h.sessions == nil {
+		respondError(c, http.StatusInternalServerError, "service_unavailable", "Session service unavailable")
+		return
+	}
+	count, err := h.sessions.RevokeAll(userID, actor)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "logout_failed", "Failed to end sessions")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"revoked": count})
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/service"
+)
+
+type fakeUserSessionManager struct {
+	sessions     []*domain.UserSession
+	refreshToken string
+	revoked      []string
+	revokeAllFor int64
+	revokeActor  string
+}
+
+func (f *fakeUserSessionManager) Start(userID int64, ip, userAgent string) (*domain.UserSession, string, error) {
+	session := &domain.UserSession{SessionID: "sess-new", UserID: userID, IP: ip, UserAgent: userAgent}
+	f.sessions = append(f.sessions, session)
+	return session, "refresh-new", nil
+}
+
+func (f *fakeUserSessionManager) Refresh(refreshToken, ip, userAgent string) (*domain.UserSession, string, error) {
+	if refreshToken != f.refreshToken || len(f.sessions) == 0 {
+		return nil, "", service.ErrUserSessionInvalid
+	}
+	return f.sessions[0], "refresh-rotated", nil
+}
+
+func (f *fakeUserSessionManager) List(userID int64) ([]*domain.UserSession, error) {
+	result := []*domain.UserSession{}
+	for _, session := range f.sessions {
+		if session.UserID == userID {
+			result = append(result, session)
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeUserSessionManager) Revoke(userID int64, sessionID string) error {
+	for _, session := range f.sessions {
+		if session.SessionID == sessionID && session.UserID == userID {
+			f.revoked = append(f.revoked, sessionID)
+			return nil
+		}
+	}
+	return service.ErrUserSessionNotFound
+}
+
+func (f *fakeUserSessionManager) RevokeAll(userID int64, actor string) (int64, error) {
+	f.revokeAllFor, f.revokeActor = userID, actor
+	return 2, nil
+}
+
+type fakeSessionUsers struct {
+	user *domain.User
+}
+
+func (f *fakeSessionUsers) GetUserByID(id int64) (*domain.User, error) {
+	return f.user, nil
+}
+
+func newUserSessionRouter(handler *UserSessionHandler) *gin.Engine {
+	r := gin.New()
+	r.POST("/public/token/refresh", handler.Refresh)
+	user := r.Group("/user", func(c *gin.Context) {
+		c.Set("user_id", int64(7))
+		c.Set("session_id", "sess-a")
+		c.Next()
+	})
+	user.GET("/sessions", handler.List)
+	user.DELETE("/sessions/:session_id", handler.Revoke)
+	user.POST("/logout", handler.Logout)
+	user.POST("/logout-all", handler.LogoutAll)
+	admin := r.Group("/admin", func(c *gin.Context) {
+		c.Set("user_id", int64(1))
+		c.Next()
+	})
+	admin.DELETE("/users/:id/sessions", handler.AdminRevokeAll)
+	return r
+}
+
+func TestUserSessionRefreshIssuesTokensBoundToTheSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sessions := &fakeUserSessionManager{
+		sessions:     []*domain.UserSession{{SessionID: "sess-a", UserID: 7}},
+		refreshToken: "refresh-a",
+	}
+	users := &fakeSessionUsers{user: &domain.User{ID: 7, Role: "user", Status: 1}}
+	r := newUserSessionRouter(NewUserSessionHandler(sessions, users))
+
+	refresh := func(token string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/public/token/refresh", strings.NewReader(`{"refresh_token":"`+token+`"}`))
+		request.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := refresh("refresh-a")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var body struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	_ = json.Unmarshal(recorder.Body.Bytes(), &body)
+	if body.RefreshToken != "refresh-rotated" {
+		t.Fatalf("expected the rotated refresh token, got %q", body.RefreshToken)
+	}
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(body.Token, claims); err != nil {
+		t.Fatalf("parse access token: %v", err)
+	}
+	if claims["sid"] != "sess-a" {
+		t.Fatalf("expected access token bound to sess-a, got %v", claims["sid"])
+	}
+
+	if code := refresh("refresh-old").Code; code != http.StatusUnauthorized {
+		t.Fatalf("expected an invalid refresh token to be 401, got %d", code)
+	}
+
+	users.user.Status = 0
+	if code := refresh("refresh-a").Code; code != http.StatusUnauthorized {
+		t.Fatalf("expected a disabled user to be refused, got %d", code)
+	}
+	if len(sessions.revoked) != 1 || sessions.revoked[0] != "sess-a" {
+		t.Fatalf("expected the disabled user's session to be revoked, got %v", sessions.revoked)
+	}
+}
+
+func TestUserSessionListLogoutAndAdminRevoke(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sessions := &fakeUserSessionManager{sessions: []*domain.UserSession{
+		{SessionID: "sess-a", UserID: 7, UserAgent: "phone"},
+		{SessionID: "sess-b", UserID: 7, UserAgent: "laptop"},
+		{SessionID: "sess-c", UserID: 8, UserAgent: "tablet"},
+	}}
+	r := newUserSessionRouter(NewUserSessionHandler(sessions, &fakeSessionUsers{}))
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+		return recorder
+	}
+
+	recorder := serve(http.MethodGet, "/user/sessions")
+	var list struct {
+		Items []struct {
+			SessionID string `json:"session_id"`
+			Current   bool   `json:"current"`
+		} `json:"items"`
+	}
+	_ = json.Unmarshal(recorder.Body.Bytes(), &list)
+	if recorder.Code != http.StatusOK || len(list.Items) != 2 {
+		t.Fatalf("expected the user's two sessions, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if !list.Items[0].Current || list.Items[1].Current {
+		t.Fatalf("expected only sess-a marked current, got %+v", list.Items)
+	}
+
+	if code := serve(http.MethodDelete, "/user/sessions/sess-c").Code; code != http.StatusNotFound {
+		t.Fatalf("expected another user's session to be 404, got %d", code)
+	}
+	if code := serve(http.MethodDelete, "/user/sessions/sess-b").Code; code != http.StatusOK {
+		t.Fatalf("expected revoking sess-b to succeed, got %d", code)
+	}
+	if code := serve(http.MethodPost, "/user/logout").Code; code != http.StatusOK {
+		t.Fatalf("expected logout to succeed, got %d", code)
+	}
+	if len(sessions.revoked) != 2 || sessions.revoked[1] != "sess-a" {
+		t.Fatalf("expected logout to revoke the current session, got %v", sessions.revoked)
+	}
+
+	if code := serve(http.MethodPost, "/user/logout-all").Code; code != http.StatusOK || sessions.revokeAllFor != 7 || sessions.revokeActor != "" {
+		t.Fatalf("expected logout-all for user 7 without an audit actor, got %d %d %q", code, sessions.revokeAllFor, sessions.revokeActor)
+	}
+	if code := serve(http.MethodDelete, "/admin/users/8/sessions").Code; code != http.StatusOK || sessions.revokeAllFor != 8 || sessions.revokeActor == "" {
+		t.Fatalf("expected admin revoke for user 8 with an actor, got %d %d %q", code, sessions.revokeAllFor, sessions.revokeActor)
+	}
+	if code := serve(http.MethodDelete, "/admin/users/abc/sessions").Code; code != http.StatusBadRequest {
+		t.Fatalf("expected an invalid user id to be 400, got %d", code)
+	}
+}
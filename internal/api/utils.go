@@ -1,20 +1,74 @@
 package api
 
 import (
+	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
 var jwtSecret = []byte("your-secret-key-change-in-production")
 
-func generateToken(userID int64, role string) (string, error) {
+// TokenSigner signs access tokens with an asymmetric key named in the kid
+// header.
+type TokenSigner interface {
+	SignToken(claims jwt.MapClaims) (string, error)
+}
+
+var tokenSigner TokenSigner
+
+// SetTokenSigner moves session and OAuth access tokens off the shared HS256
+// secret onto signer.
+func SetTokenSigner(signer TokenSigner) {
+	tokenSigner = signer
+}
+
+// userTokenTTL is the lifetime of a shopper's access token; sessions are
+// kept alive with their refresh token.
+const userTokenTTL = time.Hour
+
+// generateToken issues an access token for userID, naming sessionID as "sid"
+// when the login opened a session.
+func generateToken(userID int64, role, sessionID string) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id": userID,
 		"role":    role,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
+		"exp":     time.Now().Add(userTokenTTL).Unix(),
 	}
+	if sessionID != "" {
+		claims["sid"] = sessionID
+	}
+	return signToken(claims)
+}
 
+func signToken(claims jwt.MapClaims) (string, error) {
+	if tokenSigner != nil {
+		return tokenSigner.SignToken(claims)
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(jwtSecret)
 }
+
+// requireUserID reads the user id set by the auth middleware and responds with
+// 401 when it is missing.
+func requireUserID(c *gin.Context) (int64, bool) {
+	value, exists := c.Get("user_id")
+	userID, ok := value.(int64)
+	if !exists || !ok || userID <= 0 {
+		respondError(c, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return 0, false
+	}
+	return userID, true
+}
+
+// adminActor names the signed-in admin for audit log entries.
+func adminActor(c *gin.Context) string {
+	if value, exists := c.Get("user_id"); exists {
+		if userID, ok := value.(int64); ok && userID > 0 {
+			return "admin:" + strconv.FormatInt(userID, 10)
+		}
+	}
+	return "admin"
+}
@@ -1,6 +1,10 @@
 package domain
 
-import "time"
+import (
+	"time"
+
+	"github.com/meowucp/pkg/money"
+)
 
 type User struct {
 	ID           int64  `gorm:"primary_key"`
@@ -15,6 +19,22 @@ type User struct {
 	UpdatedAt    time.Time
 }
 
+// UserSession is a signed-in device. Access tokens carry its SessionID as
+// "sid"; the refresh token is stored hashed and replaced on every refresh.
+type UserSession struct {
+	ID                       int64      `gorm:"primary_key"`
+	SessionID                string     `gorm:"unique_index;not null" json:"session_id"`
+	UserID                   int64      `gorm:"index;not null" json:"user_id"`
+	RefreshTokenHash         string     `gorm:"unique_index;not null" json:"-"`
+	PreviousRefreshTokenHash string     `gorm:"index" json:"-"`
+	UserAgent                string     `json:"user_agent"`
+	IP                       string     `gorm:"column:ip" json:"ip"`
+	LastSeenAt               time.Time  `json:"last_seen_at"`
+	ExpiresAt                time.Time  `json:"expires_at"`
+	RevokedAt                *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt                time.Time  `json:"created_at"`
+}
+
 type Category struct {
 	ID          int64  `gorm:"primary_key"`
 	Name        string `gorm:"not null"`
@@ -71,16 +91,16 @@ type CartItem struct {
 }
 
 type Order struct {
-	ID              int64   `gorm:"primary_key"`
-	OrderNo         string  `gorm:"unique_index;not null"`
-	UserID          *int64  `gorm:"index"`
-	Status          string  `gorm:"default:'pending';check:status IN ('pending', 'paid', 'shipped', 'delivered', 'cancelled', 'refunded')"`
-	Subtotal        float64 `gorm:"type:decimal(10,2);not null"`
-	ShippingFee     float64 `gorm:"type:decimal(10,2);default:0"`
-	Tax             float64 `gorm:"type:decimal(10,2);default:0"`
-	Discount        float64 `gorm:"type:decimal(10,2);default:0"`
-	Total           float64 `gorm:"type:decimal(10,2);not null"`
-	Currency        string  `gorm:"default:'CNY'"`
+	ID              int64        `gorm:"primary_key"`
+	OrderNo         string       `gorm:"unique_index;not null"`
+	UserID          *int64       `gorm:"index"`
+	Status          string       `gorm:"default:'pending';check:status IN ('pending', 'paid', 'shipped', 'delivered', 'cancelled', 'refunded')"`
+	Subtotal        money.Amount `gorm:"type:bigint;not null"`
+	ShippingFee     money.Amount `gorm:"type:bigint;default:0"`
+	Tax             money.Amount `gorm:"type:bigint;default:0"`
+	Discount        money.Amount `gorm:"type:bigint;default:0"`
+	Total           money.Amount `gorm:"type:bigint;not null"`
+	Currency        string       `gorm:"default:'CNY'"`
 	PaymentMethod   string
 	PaymentStatus   string `gorm:"default:'unpaid'"`
 	PaymentTime     *time.Time
@@ -96,6 +116,9 @@ type Order struct {
 	User            User        `gorm:"foreignkey:UserID"`
 	Items           []OrderItem `gorm:"foreignkey:OrderID"`
 	Payments        []Payment   `gorm:"foreignkey:OrderID"`
+
+	// CheckoutSessionID links orders placed through a UCP checkout session.
+	CheckoutSessionID string `gorm:"index"`
 }
 
 type OrderIdempotency struct {
@@ -125,9 +148,9 @@ type OrderItem struct {
 	ProductID   *int64 `gorm:"index"`
 	ProductName string `gorm:"not null"`
 	SKU         string
-	Quantity    int     `gorm:"not null;check:quantity > 0"`
-	UnitPrice   float64 `gorm:"type:decimal(10,2);not null"`
-	TotalPrice  float64 `gorm:"type:decimal(10,2);not null"`
+	Quantity    int          `gorm:"not null;check:quantity > 0"`
+	UnitPrice   money.Amount `gorm:"type:bigint;not null"`
+	TotalPrice  money.Amount `gorm:"type:bigint;not null"`
 	CreatedAt   time.Time
 }
 
@@ -135,8 +158,8 @@ type Payment struct {
 	ID             int64 `gorm:"primary_key"`
 	OrderID        int64 `gorm:"index;not null"`
 	UserID         *int64
-	Amount         float64 `gorm:"type:decimal(10,2);not null"`
-	PaymentMethod  string  `gorm:"not null"`
+	Amount         money.Amount `gorm:"type:bigint;not null"`
+	PaymentMethod  string       `gorm:"not null"`
 	TransactionID  string
 	Status         string `gorm:"default:'pending'"`
 	ErrorMessage   string
@@ -146,14 +169,29 @@ type Payment struct {
 }
 
 type PaymentRefund struct {
+	ID            int64 `gorm:"primary_key"`
+	PaymentID     int64 `gorm:"not null"`
+	OrderID       int64 `gorm:"index"`
+	Amount        money.Amount
+	Status        string `gorm:"default:'pending';check:status IN ('pending', 'succeeded', 'failed')"`
+	Reason        string
+	FailureReason string
+	ExternalRef   *string
+	CompletedAt   *time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Items         []PaymentRefundItem `gorm:"foreignkey:RefundID"`
+}
+
+// PaymentRefundItem ties part of a refund to an order line so its stock can
+// be put back once the refund succeeds.
+type PaymentRefundItem struct {
 	ID          int64 `gorm:"primary_key"`
-	PaymentID   int64 `gorm:"not null"`
-	Amount      float64
-	Status      string
-	Reason      string
-	ExternalRef *string
+	RefundID    int64 `gorm:"index;not null"`
+	OrderItemID int64 `gorm:"not null"`
+	ProductID   *int64
+	Quantity    int `gorm:"not null;check:quantity > 0"`
 	CreatedAt   time.Time
-	UpdatedAt   time.Time
 }
 
 type PaymentEvent struct {
@@ -196,6 +234,19 @@ type InventoryLog struct {
 	CreatedAt      time.Time
 }
 
+type StockReservation struct {
+	ID                int64  `gorm:"primary_key"`
+	CheckoutSessionID string `gorm:"not null"`
+	ProductID         int64  `gorm:"index;not null"`
+	SKU               string `gorm:"not null"`
+	Quantity          int    `gorm:"not null;check:quantity > 0"`
+	Status            string `gorm:"not null;default:'active'"`
+	OrderID           *int64
+	ExpiresAt         time.Time
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
 type CheckoutSession struct {
 	ID          string `gorm:"primary_key"`
 	Status      string `gorm:"not null"`
@@ -203,9 +254,12 @@ type CheckoutSession struct {
 	LineItems   string `gorm:"type:jsonb;not null"`
 	Totals      string `gorm:"type:jsonb;not null"`
 	Buyer       string `gorm:"type:jsonb"`
+	Fulfillment string `gorm:"type:jsonb"`
+	Discounts   string `gorm:"type:jsonb"`
 	Messages    string `gorm:"type:jsonb"`
 	Links       string `gorm:"type:jsonb"`
 	ContinueURL string `gorm:"type:text"`
+	ClientID    string `gorm:"index"`
 	ExpiresAt   *time.Time
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
@@ -239,6 +293,7 @@ type UCPWebhookAudit struct {
 	Reason          string `gorm:"not null"`
 	SignatureHeader string
 	KeyID           string
+	Sender          string `gorm:"index"`
 	PayloadHash     string `gorm:"not null"`
 	CreatedAt       time.Time
 }
@@ -251,15 +306,70 @@ type UCPWebhookReplay struct {
 }
 
 type UCPWebhookJob struct {
-	ID            int64     `gorm:"primary_key"`
-	EventID       string    `gorm:"index;not null"`
-	Payload       string    `gorm:"type:text;not null"`
-	Status        string    `gorm:"not null"`
-	Attempts      int       `gorm:"not null"`
-	NextRetryAt   time.Time `gorm:"index"`
-	LastError     string
-	LastAttemptAt time.Time
-	CreatedAt     time.Time
+	ID             int64     `gorm:"primary_key"`
+	EventID        string    `gorm:"index;not null"`
+	SubscriptionID *int64    `gorm:"index"`
+	Payload        string    `gorm:"type:text;not null"`
+	Status         string    `gorm:"not null"`
+	Attempts       int       `gorm:"not null"`
+	NextRetryAt    time.Time `gorm:"index"`
+	LastError      string
+	LastAttemptAt  time.Time
+	// LeaseOwner and LeaseExpiresAt are set while a worker holds the job in
+	// status "processing"; an expired lease makes the job claimable again.
+	LeaseOwner     string
+	LeaseExpiresAt *time.Time
+	// Kind is "inbound" for partner events the worker applies to local
+	// orders; anything else is an outbound delivery.
+	Kind string
+	// Sender is the verified sender of an inbound event ("oauth:<client_id>",
+	// "profile:<url>" or "default"); it limits which orders the event may touch.
+	Sender    string
+	CreatedAt time.Time
+}
+
+// UCPWebhookSubscription routes outbound webhook events to a partner endpoint.
+// EventTypes is a comma separated filter; empty or "*" matches every event and
+// a trailing ".*" matches a prefix such as "order.*".
+type UCPWebhookSubscription struct {
+	ID         int64  `gorm:"primary_key"`
+	ClientID   string `gorm:"index;not null"`
+	URL        string `gorm:"column:url;not null"`
+	Secret     string `json:"-"`
+	EventTypes string
+	Active     bool `gorm:"not null;default:true"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// UCPSigningKey is one of our own webhook signing keys. The private key is
+// stored sealed; PublicKey holds the JWK published to partners.
+type UCPSigningKey struct {
+	ID                  int64  `gorm:"primary_key"`
+	KID                 string `gorm:"column:kid;unique_index;not null"`
+	Algorithm           string `gorm:"not null"`
+	PublicKey           string `gorm:"type:jsonb;not null"`
+	EncryptedPrivateKey string `gorm:"type:text;not null" json:"-"`
+	Status              string `gorm:"not null;default:'active';check:status IN ('active', 'retired')"`
+	ExpiresAt           *time.Time
+	RetiredAt           *time.Time
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+}
+
+// JWTSigningKey signs access tokens; its public half is published at
+// /oauth2/jwks.
+type JWTSigningKey struct {
+	ID                  int64  `gorm:"primary_key"`
+	KID                 string `gorm:"column:kid;unique_index;not null"`
+	Algorithm           string `gorm:"not null"`
+	PublicKey           string `gorm:"type:jsonb;not null"`
+	EncryptedPrivateKey string `gorm:"type:text;not null" json:"-"`
+	Status              string `gorm:"not null;default:'active';check:status IN ('active', 'retired')"`
+	ExpiresAt           *time.Time
+	RetiredAt           *time.Time
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
 }
 
 type UCPWebhookAlert struct {
@@ -271,12 +381,30 @@ type UCPWebhookAlert struct {
 	CreatedAt time.Time
 }
 
+// UCPWebhookBreaker is the last circuit breaker state the worker saw for a
+// delivery destination.
+type UCPWebhookBreaker struct {
+	ID                  int64  `gorm:"primary_key"`
+	Destination         string `gorm:"unique_index;not null"`
+	State               string `gorm:"not null"`
+	ConsecutiveFailures int    `gorm:"not null"`
+	OpenedAt            *time.Time
+	RetryAt             *time.Time
+	LastError           string
+	UpdatedAt           time.Time
+}
+
 type WebhookDLQ struct {
 	ID        int64 `gorm:"primary_key"`
 	JobID     int64
+	EventID   string
+	EventType string
 	Reason    string
 	Payload   string
 	CreatedAt time.Time
+	// ReplayedAt is set when the dead letter's job was put back in the queue;
+	// a dead letter is replayed at most once.
+	ReplayedAt *time.Time
 }
 
 type WebhookReplayLog struct {
@@ -293,6 +421,14 @@ type OAuthClient struct {
 	Scopes     string
 	Status     string
 	CreatedAt  time.Time
+
+	// JWKSetURL is where the client publishes the keys it signs order
+	// webhooks with; JWKSCacheSeconds overrides the verifier's cache TTL.
+	JWKSetURL        string
+	JWKSCacheSeconds int
+	// RedirectURIs lists, space separated, the exact URIs authorization
+	// codes may be sent to.
+	RedirectURIs string
 }
 
 type OAuthToken struct {
@@ -303,6 +439,41 @@ type OAuthToken struct {
 	Scopes    string
 	ExpiresAt time.Time
 	RevokedAt *time.Time
+	// FamilyID links the token to the refresh token chain it was issued
+	// with, so reuse of a rotated refresh token revokes it too.
+	FamilyID string
+}
+
+// OAuthRefreshToken is one link of a rotating refresh token chain. Only the
+// SHA-256 of the token is stored. Presenting a token that was already used
+// revokes every token in its family.
+type OAuthRefreshToken struct {
+	ID        int64  `gorm:"primary_key"`
+	TokenHash string `gorm:"unique_index;not null"`
+	FamilyID  string `gorm:"index;not null"`
+	ClientID  string `gorm:"not null"`
+	UserID    *int64
+	Scopes    string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+// OAuthAuthorizationCode is issued when a shopper consents to a client. It is
+// single-use, short-lived and bound to the PKCE challenge the client sent.
+type OAuthAuthorizationCode struct {
+	ID                  int64  `gorm:"primary_key"`
+	Code                string `gorm:"unique_index;not null"`
+	ClientID            string `gorm:"not null"`
+	UserID              int64  `gorm:"not null"`
+	RedirectURI         string `gorm:"not null"`
+	Scopes              string
+	CodeChallenge       string `gorm:"not null"`
+	CodeChallengeMethod string `gorm:"not null"`
+	ExpiresAt           time.Time
+	UsedAt              *time.Time
+	CreatedAt           time.Time
 }
 
 type TaxRule struct {
@@ -317,16 +488,18 @@ type ShippingRule struct {
 	ID            int64 `gorm:"primary_key"`
 	Region        string
 	Method        string
-	BaseAmount    float64
-	PerItemAmount float64
+	BaseAmount    money.Amount
+	PerItemAmount money.Amount
 }
 
 type Coupon struct {
-	ID         int64 `gorm:"primary_key"`
-	Code       string
-	Type       string
-	Value      float64
-	MinSpend   float64
+	ID   int64 `gorm:"primary_key"`
+	Code string
+	Type string
+	// Value is minor units for "fixed" coupons and basis points for
+	// "percent" coupons (1000 = 10%).
+	Value      int64
+	MinSpend   money.Amount
 	UsageLimit int
 	UsedCount  int
 	StartsAt   *time.Time
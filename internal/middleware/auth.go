@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"crypto"
 	"net/http"
 	"strings"
 
@@ -8,14 +9,42 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// TokenKeySource resolves the asymmetric key an access token names in its
+// kid header, and the algorithm the key verifies.
+type TokenKeySource interface {
+	VerificationKey(kid string) (crypto.PublicKey, string, error)
+}
+
+// SessionValidator reports whether a session named in an access token is
+// still live for its user.
+type SessionValidator interface {
+	Active(sessionID string, userID int64, ip, userAgent string) bool
+}
+
 type AuthMiddleware struct {
-	secret string
+	secret      string
+	keys        TokenKeySource
+	acceptHS256 bool
+	sessions    SessionValidator
 }
 
 func NewAuthMiddleware(secret string) *AuthMiddleware {
 	return &AuthMiddleware{secret: secret}
 }
 
+// SetTokenKeys verifies RS256/ES256 tokens against keys. HS256 tokens signed
+// with the shared secret are then only accepted while acceptHS256 is set.
+func (m *AuthMiddleware) SetTokenKeys(keys TokenKeySource, acceptHS256 bool) {
+	m.keys = keys
+	m.acceptHS256 = acceptHS256
+}
+
+// SetSessions makes Auth require a live session: tokens must carry the
+// "sid" of one that has not been logged out, revoked or expired.
+func (m *AuthMiddleware) SetSessions(sessions SessionValidator) {
+	m.sessions = sessions
+}
+
 func (m *AuthMiddleware) Auth() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
@@ -32,12 +61,7 @@ func (m *AuthMiddleware) Auth() gin.HandlerFunc {
 			return
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return []byte(m.secret), nil
-		})
+		token, err := jwt.Parse(tokenString, accessTokenKeyFunc(m.secret, m.keys, m.acceptHS256), accessTokenMethods)
 
 		if err != nil || !token.Valid {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
@@ -52,16 +76,57 @@ func (m *AuthMiddleware) Auth() gin.HandlerFunc {
 			return
 		}
 
-		userID := claims["user_id"].(float64)
-		role := claims["role"].(string)
+		userID, ok := claims["user_id"].(float64)
+		role, roleOK := claims["role"].(string)
+		if !ok || !roleOK {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+			c.Abort()
+			return
+		}
+
+		sessionID, _ := claims["sid"].(string)
+		if m.sessions != nil && !m.sessions.Active(sessionID, int64(userID), c.ClientIP(), c.Request.UserAgent()) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired or revoked"})
+			c.Abort()
+			return
+		}
 
 		c.Set("user_id", int64(userID))
 		c.Set("role", role)
+		if sessionID != "" {
+			c.Set("session_id", sessionID)
+		}
 
 		c.Next()
 	}
 }
 
+// accessTokenMethods are the algorithms access tokens may be signed with.
+var accessTokenMethods = jwt.WithValidMethods([]string{"HS256", "RS256", "ES256"})
+
+// accessTokenKeyFunc verifies HS256 tokens with the shared secret, unless
+// asymmetric keys are configured and HS256 is no longer accepted, and
+// RS256/ES256 tokens with the key their kid header names.
+func accessTokenKeyFunc(secret string, keys TokenKeySource, acceptHS256 bool) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+			if keys != nil && !acceptHS256 {
+				return nil, jwt.ErrSignatureInvalid
+			}
+			return []byte(secret), nil
+		}
+		if keys == nil {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		kid, _ := token.Header["kid"].(string)
+		key, alg, err := keys.VerificationKey(kid)
+		if err != nil || alg != token.Method.Alg() {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return key, nil
+	}
+}
+
 func (m *AuthMiddleware) AdminOnly() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		role, exists := c.Get("role")
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type fakeTokenKeySource struct {
+	kid string
+	key *ecdsa.PrivateKey
+}
+
+func (f *fakeTokenKeySource) VerificationKey(kid string) (crypto.PublicKey, string, error) {
+	if kid != f.kid {
+		return nil, "", errors.New("not found")
+	}
+	return &f.key.PublicKey, "ES256", nil
+}
+
+func TestAuthMiddlewareVerifiesAsymmetricTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	keys := &fakeTokenKeySource{kid: "key-1", key: private}
+	claims := jwt.MapClaims{"user_id": 7, "role": "user", "exp": time.Now().Add(time.Hour).Unix()}
+	signES256 := func(kid string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(private)
+		if err != nil {
+			t.Fatalf("sign token: %v", err)
+		}
+		return signed
+	}
+	hs256 := signTestOAuthToken(t, testOAuthSecret, claims)
+
+	serve := func(auth *AuthMiddleware, token string) int {
+		r := gin.New()
+		r.GET("/me", auth.Auth(), func(c *gin.Context) { c.Status(http.StatusOK) })
+		request := httptest.NewRequest(http.MethodGet, "/me", nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	secretOnly := NewAuthMiddleware(testOAuthSecret)
+	if code := serve(secretOnly, hs256); code != http.StatusOK {
+		t.Fatalf("expected HS256 without keys to pass, got %d", code)
+	}
+	if code := serve(secretOnly, signES256("key-1")); code != http.StatusUnauthorized {
+		t.Fatalf("expected ES256 without keys to be rejected, got %d", code)
+	}
+
+	asymmetric := NewAuthMiddleware(testOAuthSecret)
+	asymmetric.SetTokenKeys(keys, false)
+	if code := serve(asymmetric, signES256("key-1")); code != http.StatusOK {
+		t.Fatalf("expected ES256 with a published kid to pass, got %d", code)
+	}
+	if code := serve(asymmetric, signES256("key-2")); code != http.StatusUnauthorized {
+		t.Fatalf("expected an unknown kid to be rejected, got %d", code)
+	}
+	if code := serve(asymmetric, hs256); code != http.StatusUnauthorized {
+		t.Fatalf("expected HS256 to be rejected once keys are configured, got %d", code)
+	}
+
+	transition := NewAuthMiddleware(testOAuthSecret)
+	transition.SetTokenKeys(keys, true)
+	if code := serve(transition, hs256); code != http.StatusOK {
+		t.Fatalf("expected HS256 to pass while still accepted, got %d", code)
+	}
+}
+
+type fakeSessionValidator struct {
+	active map[string]int64
+}
+
+func (f *fakeSessionValidator) Active(sessionID string, userID int64, ip, userAgent string) bool {
+	owner, ok := f.active[sessionID]
+	return ok && owner == userID
+}
+
+func TestAuthMiddlewareRejectsRevokedSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	auth := NewAuthMiddleware(testOAuthSecret)
+	auth.SetSessions(&fakeSessionValidator{active: map[string]int64{"sess-a": 7}})
+	serve := func(claims jwt.MapClaims) (int, string) {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+		var sessionID string
+		r := gin.New()
+		r.GET("/me", auth.Auth(), func(c *gin.Context) {
+			sessionID = c.GetString("session_id")
+			c.Status(http.StatusOK)
+		})
+		request := httptest.NewRequest(http.MethodGet, "/me", nil)
+		request.Header.Set("Authorization", "Bearer "+signTestOAuthToken(t, testOAuthSecret, claims))
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, request)
+		return recorder.Code, sessionID
+	}
+
+	if code, sessionID := serve(jwt.MapClaims{"user_id": 7, "role": "user", "sid": "sess-a"}); code != http.StatusOK || sessionID != "sess-a" {
+		t.Fatalf("expected a live session to pass with its id, got %d %q", code, sessionID)
+	}
+	if code, _ := serve(jwt.MapClaims{"user_id": 7, "role": "user", "sid": "sess-gone"}); code != http.StatusUnauthorized {
+		t.Fatalf("expected a revoked session to be rejected, got %d", code)
+	}
+	if code, _ := serve(jwt.MapClaims{"user_id": 8, "role": "user", "sid": "sess-a"}); code != http.StatusUnauthorized {
+		t.Fatalf("expected another user's session to be rejected, got %d", code)
+	}
+	if code, _ := serve(jwt.MapClaims{"user_id": 7, "role": "user"}); code != http.StatusUnauthorized {
+		t.Fatalf("expected a token without a session to be rejected, got %d", code)
+	}
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/service"
+)
+
+// OAuthClientKey is the context key holding the *domain.OAuthClient a
+// bearer token was issued to.
+const OAuthClientKey = "oauth_client"
+
+type OAuthTokenStore interface {
+	FindByToken(token string) (*domain.OAuthToken, error)
+}
+
+type OAuthClientStore interface {
+	FindByClientID(clientID string) (*domain.OAuthClient, error)
+}
+
+// OAuthBearerMiddleware authenticates UCP platforms by the OAuth access
+// tokens issued at /oauth2/token.
+type OAuthBearerMiddleware struct {
+	secret      string
+	keys        TokenKeySource
+	acceptHS256 bool
+	tokens      OAuthTokenStore
+	clients     OAuthClientStore
+}
+
+func NewOAuthBearerMiddleware(secret string, tokens OAuthTokenStore, clients OAuthClientStore) *OAuthBearerMiddleware {
+	return &OAuthBearerMiddleware{secret: secret, tokens: tokens, clients: clients}
+}
+
+// SetTokenKeys verifies tokens as AuthMiddleware.SetTokenKeys does.
+func (m *OAuthBearerMiddleware) SetTokenKeys(keys TokenKeySource, acceptHS256 bool) {
+	m.keys = keys
+	m.acceptHS256 = acceptHS256
+}
+
+// RequireScopes accepts a request only with a validly signed, unexpired and
+// unrevoked access token whose grant covers every scope in scopes. The
+// token's active client is stored under OAuthClientKey.
+func (m *OAuthBearerMiddleware) RequireScopes(scopes ...string) gin.HandlerFunc {
+	required := strings.Join(scopes, " ")
+	return func(c *gin.Context) {
+		if m == nil || m.tokens == nil || m.clients == nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "service_unavailable"})
+			return
+		}
+		tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if tokenString == "" || tokenString == c.GetHeader("Authorization") {
+			rejectBearer(c, http.StatusUnauthorized, "invalid_request", required)
+			return
+		}
+
+		claims := jwt.MapClaims{}
+		token, err := jwt.ParseWithClaims(tokenString, claims, accessTokenKeyFunc(m.secret, m.keys, m.acceptHS256), accessTokenMethods)
+		if err != nil || !token.Valid || claims["typ"] != "oauth" {
+			rejectBearer(c, http.StatusUnauthorized, "invalid_token", required)
+			return
+		}
+
+		stored, err := m.tokens.FindByToken(tokenString)
+		if err != nil || stored == nil || stored.RevokedAt != nil || !time.Now().Before(stored.ExpiresAt) || claims["sub"] != stored.ClientID {
+			rejectBearer(c, http.StatusUnauthorized, "invalid_token", required)
+			return
+		}
+		client, err := m.clients.FindByClientID(stored.ClientID)
+		if err != nil || client == nil || client.Status != "active" {
+			rejectBearer(c, http.StatusUnauthorized, "invalid_token", required)
+			return
+		}
+		for _, scope := range scopes {
+			if !service.OAuthScopeSatisfies(stored.Scopes, scope) {
+				rejectBearer(c, http.StatusForbidden, "insufficient_scope", required)
+				return
+			}
+		}
+
+		c.Set(OAuthClientKey, client)
+		c.Next()
+	}
+}
+
+// OAuthClientFromContext returns the client set by RequireScopes.
+func OAuthClientFromContext(c *gin.Context) (*domain.OAuthClient, bool) {
+	value, exists := c.Get(OAuthClientKey)
+	client, ok := value.(*domain.OAuthClient)
+	return client, exists && ok && client != nil
+}
+
+// rejectBearer answers with an RFC 6750 challenge.
+func rejectBearer(c *gin.Context, status int, code, scope string) {
+	challenge := `Bearer error="` + code + `"`
+	if code == "insufficient_scope" && scope != "" {
+		challenge += `, scope="` + scope + `"`
+	}
+	c.Header("WWW-Authenticate", challenge)
+	c.AbortWithStatusJSON(status, gin.H{"error": code})
+}
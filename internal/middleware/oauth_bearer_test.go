@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jinzhu/gorm"
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/service"
+)
+
+const testOAuthSecret = "test-secret"
+
+type fakeOAuthTokenStore struct {
+	tokens map[string]*domain.OAuthToken
+}
+
+func (f *fakeOAuthTokenStore) FindByToken(token string) (*domain.OAuthToken, error) {
+	item, ok := f.tokens[token]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return item, nil
+}
+
+type fakeOAuthClientStore struct {
+	clients map[string]*domain.OAuthClient
+}
+
+func (f *fakeOAuthClientStore) FindByClientID(clientID string) (*domain.OAuthClient, error) {
+	client, ok := f.clients[clientID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return client, nil
+}
+
+func signTestOAuthToken(t *testing.T, secret string, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return token
+}
+
+func TestOAuthBearerRequiresScopesAndLiveToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	exp := time.Now().Add(time.Hour)
+	claims := func(sub, jti string) jwt.MapClaims {
+		return jwt.MapClaims{"sub": sub, "typ": "oauth", "exp": exp.Unix(), "jti": jti}
+	}
+	readOnly := signTestOAuthToken(t, testOAuthSecret, claims("agent-a", "1"))
+	full := signTestOAuthToken(t, testOAuthSecret, claims("agent-a", "2"))
+	revoked := signTestOAuthToken(t, testOAuthSecret, claims("agent-a", "3"))
+	disabled := signTestOAuthToken(t, testOAuthSecret, claims("agent-b", "4"))
+	forged := signTestOAuthToken(t, "other-secret", claims("agent-a", "5"))
+	session := signTestOAuthToken(t, testOAuthSecret, jwt.MapClaims{"user_id": 1, "role": "user", "exp": exp.Unix()})
+	revokedAt := time.Now()
+
+	tokens := &fakeOAuthTokenStore{tokens: map[string]*domain.OAuthToken{
+		readOnly: {Token: readOnly, ClientID: "agent-a", Scopes: service.OAuthScopeCheckoutSessionRead, ExpiresAt: exp},
+		full:     {Token: full, ClientID: "agent-a", Scopes: service.OAuthScopeCheckoutSession, ExpiresAt: exp},
+		revoked:  {Token: revoked, ClientID: "agent-a", Scopes: service.OAuthScopeCheckoutSession, ExpiresAt: exp, RevokedAt: &revokedAt},
+		disabled: {Token: disabled, ClientID: "agent-b", Scopes: service.OAuthScopeCheckoutSession, ExpiresAt: exp},
+		forged:   {Token: forged, ClientID: "agent-a", Scopes: service.OAuthScopeCheckoutSession, ExpiresAt: exp},
+	}}
+	clients := &fakeOAuthClientStore{clients: map[string]*domain.OAuthClient{
+		"agent-a": {ClientID: "agent-a", Status: "active"},
+		"agent-b": {ClientID: "agent-b", Status: "disabled"},
+	}}
+	bearer := NewOAuthBearerMiddleware(testOAuthSecret, tokens, clients)
+
+	r := gin.New()
+	handler := func(c *gin.Context) {
+		client, ok := OAuthClientFromContext(c)
+		if !ok {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.String(http.StatusOK, client.ClientID)
+	}
+	r.GET("/read", bearer.RequireScopes(service.OAuthScopeCheckoutSessionRead), handler)
+	r.POST("/write", bearer.RequireScopes(service.OAuthScopeCheckoutSession), handler)
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{"missing token", http.MethodGet, "/read", "", http.StatusUnauthorized},
+		{"read scope reads", http.MethodGet, "/read", readOnly, http.StatusOK},
+		{"read scope cannot write", http.MethodPost, "/write", readOnly, http.StatusForbidden},
+		{"checkout scope reads", http.MethodGet, "/read", full, http.StatusOK},
+		{"checkout scope writes", http.MethodPost, "/write", full, http.StatusOK},
+		{"revoked token", http.MethodGet, "/read", revoked, http.StatusUnauthorized},
+		{"disabled client", http.MethodGet, "/read", disabled, http.StatusUnauthorized},
+		{"bad signature", http.MethodGet, "/read", forged, http.StatusUnauthorized},
+		{"user session token", http.MethodGet, "/read", session, http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		request := httptest.NewRequest(tc.method, tc.path, nil)
+		if tc.token != "" {
+			request.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, request)
+		if recorder.Code != tc.status {
+			t.Fatalf("%s: expected status %d, got %d", tc.name, tc.status, recorder.Code)
+		}
+		if tc.status == http.StatusOK && recorder.Body.String() != "agent-a" {
+			t.Fatalf("%s: expected client agent-a in context, got %q", tc.name, recorder.Body.String())
+		}
+		if tc.status == http.StatusForbidden && recorder.Header().Get("WWW-Authenticate") == "" {
+			t.Fatalf("%s: expected a bearer challenge", tc.name)
+		}
+	}
+
+	tokens.tokens[full].ExpiresAt = time.Now().Add(-time.Second)
+	request := httptest.NewRequest(http.MethodGet, "/read", nil)
+	request.Header.Set("Authorization", "Bearer "+full)
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("expected an expired token to be rejected, got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/pkg/database"
+)
+
+type jwtSigningKeyRepository struct {
+	db *database.DB
+}
+
+func NewJWTSigningKeyRepository(db *database.DB) JWTSigningKeyRepository {
+	return &jwtSigningKeyRepository{db: db}
+}
+
+func (r *jwtSigningKeyRepository) Create(key *domain.JWTSigningKey) error {
+	return r.db.Create(key).Error
+}
+
+func (r *jwtSigningKeyRepository) Update(key *domain.JWTSigningKey) error {
+	return r.db.Save(key).Error
+}
+
+// List returns every key, newest first.
+func (r *jwtSigningKeyRepository) List() ([]*domain.JWTSigningKey, error) {
+	var keys []*domain.JWTSigningKey
+	err := r.db.Order("created_at DESC, id DESC").Find(&keys).Error
+	return keys, err
+}
+
+// WithRotationLock runs fn in a transaction holding a table lock that only
+// rotations take, so processes rotating at once go one after another and
+// each sees the keys the previous one wrote. Plain reads are not blocked.
+func (r *jwtSigningKeyRepository) WithRotationLock(fn func(repo JWTSigningKeyRepository) error) error {
+	return r.db.Transaction(func(tx *database.DB) error {
+		if err := tx.Exec("LOCK TABLE jwt_signing_keys IN SHARE ROW EXCLUSIVE MODE").Error; err != nil {
+			return err
+		}
+		return fn(&jwtSigningKeyRepository{db: tx})
+	})
+}
@@ -25,6 +25,10 @@ func (r *oauthClientRepository) FindByClientID(clientID string) (*domain.OAuthCl
 	return &client, nil
 }
 
+func (r *oauthClientRepository) Update(client *domain.OAuthClient) error {
+	return r.db.Save(client).Error
+}
+
 func (r *oauthClientRepository) List(offset, limit int) ([]*domain.OAuthClient, error) {
 	clients := []*domain.OAuthClient{}
 	if err := r.db.Order("created_at DESC").Offset(offset).Limit(limit).Find(&clients).Error; err != nil {
@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/pkg/database"
+)
+
+type oauthAuthorizationCodeRepository struct {
+	db *database.DB
+}
+
+func NewOAuthAuthorizationCodeRepository(db *database.DB) OAuthAuthorizationCodeRepository {
+	return &oauthAuthorizationCodeRepository{db: db}
+}
+
+func (r *oauthAuthorizationCodeRepository) Create(code *domain.OAuthAuthorizationCode) error {
+	return r.db.Create(code).Error
+}
+
+func (r *oauthAuthorizationCodeRepository) FindByCode(code string) (*domain.OAuthAuthorizationCode, error) {
+	var item domain.OAuthAuthorizationCode
+	if err := r.db.Where("code = ?", code).First(&item).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (r *oauthAuthorizationCodeRepository) MarkUsed(id int64, usedAt time.Time) (bool, error) {
+	result := r.db.Model(&domain.OAuthAuthorizationCode{}).Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", usedAt)
+	return result.RowsAffected == 1, result.Error
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/pkg/database"
+)
+
+type oauthRefreshTokenRepository struct {
+	db *database.DB
+}
+
+func NewOAuthRefreshTokenRepository(db *database.DB) OAuthRefreshTokenRepository {
+	return &oauthRefreshTokenRepository{db: db}
+}
+
+func (r *oauthRefreshTokenRepository) Create(token *domain.OAuthRefreshToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r *oauthRefreshTokenRepository) FindByHash(tokenHash string) (*domain.OAuthRefreshToken, error) {
+	var item domain.OAuthRefreshToken
+	if err := r.db.Where("token_hash = ?", tokenHash).First(&item).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (r *oauthRefreshTokenRepository) Rotate(id int64, usedAt time.Time, next *domain.OAuthRefreshToken, access *domain.OAuthToken) (bool, error) {
+	rotated := false
+	err := r.db.Transaction(func(tx *database.DB) error {
+		result := tx.Model(&domain.OAuthRefreshToken{}).Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", id).
+			Update("used_at", usedAt)
+		if result.Error != nil || result.RowsAffected != 1 {
+			return result.Error
+		}
+		if err := tx.Create(next).Error; err != nil {
+			return err
+		}
+		if access != nil {
+			if err := tx.Create(access).Error; err != nil {
+				return err
+			}
+		}
+		rotated = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return rotated, nil
+}
+
+func (r *oauthRefreshTokenRepository) Revoke(tokenHash string, revokedAt time.Time) error {
+	return r.db.Model(&domain.OAuthRefreshToken{}).Where("token_hash = ? AND revoked_at IS NULL", tokenHash).
+		Update("revoked_at", revokedAt).Error
+}
+
+func (r *oauthRefreshTokenRepository) RevokeFamily(familyID string, revokedAt time.Time) error {
+	return r.db.Model(&domain.OAuthRefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", revokedAt).Error
+}
@@ -30,3 +30,8 @@ func (r *oauthTokenRepository) FindByToken(token string) (*domain.OAuthToken, er
 func (r *oauthTokenRepository) Revoke(token string, revokedAt time.Time) error {
 	return r.db.Model(&domain.OAuthToken{}).Where("token = ?", token).Update("revoked_at", revokedAt).Error
 }
+
+func (r *oauthTokenRepository) RevokeFamily(familyID string, revokedAt time.Time) error {
+	return r.db.Model(&domain.OAuthToken{}).Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", revokedAt).Error
+}
@@ -96,6 +96,14 @@ func (r *orderRepository) UpdateStatus(id int64, status string) error {
 		Update("status", status).Error
 }
 
+// SwapStatus moves the order to status "to" only if it is still in "from",
+// and reports whether this call made the change.
+func (r *orderRepository) SwapStatus(id int64, from, to string) (bool, error) {
+	result := r.db.Model(&domain.Order{}).Where("id = ? AND status = ?", id, from).
+		Update("status", to)
+	return result.RowsAffected == 1, result.Error
+}
+
 func (r *orderRepository) CreateOrderItem(item *domain.OrderItem) error {
 	return r.db.Create(item).Error
 }
@@ -16,3 +16,9 @@ func NewOrderStatusLogRepository(db *database.DB) OrderStatusLogRepository {
 func (r *orderStatusLogRepository) Create(log *domain.OrderStatusLog) error {
 	return r.db.Create(log).Error
 }
+
+func (r *orderStatusLogRepository) ListByOrderID(orderID int64) ([]*domain.OrderStatusLog, error) {
+	var logs []*domain.OrderStatusLog
+	err := r.db.Where("order_id = ?", orderID).Order("created_at ASC, id ASC").Find(&logs).Error
+	return logs, err
+}
@@ -1,10 +1,17 @@
 package repository
 
 import (
+	"errors"
+
 	"github.com/meowucp/internal/domain"
 	"github.com/meowucp/pkg/database"
+	"github.com/meowucp/pkg/money"
 )
 
+// ErrRefundLimitExceeded is returned by CreateWithinLimit when the refund
+// would take the payment's open and settled refunds past the limit.
+var ErrRefundLimitExceeded = errors.New("refund_limit_exceeded")
+
 type paymentRefundRepository struct {
 	db *database.DB
 }
@@ -16,3 +23,74 @@ func NewPaymentRefundRepository(db *database.DB) PaymentRefundRepository {
 func (r *paymentRefundRepository) Create(refund *domain.PaymentRefund) error {
 	return r.db.Create(refund).Error
 }
+
+// CreateWithinLimit inserts refund unless it would take the payment's pending
+// and succeeded refunds past limit. The payment row is locked first, so
+// concurrent refunds against one payment are checked one at a time.
+func (r *paymentRefundRepository) CreateWithinLimit(refund *domain.PaymentRefund, limit money.Amount) error {
+	if r.db == nil {
+		return errors.New("database not initialized")
+	}
+	return r.db.Transaction(func(tx *database.DB) error {
+		var payment domain.Payment
+		if err := tx.Model(&domain.Payment{}).
+			Set("gorm:query_option", "FOR UPDATE").
+			Where("id = ?", refund.PaymentID).
+			First(&payment).Error; err != nil {
+			return err
+		}
+		var committed int64
+		row := tx.Model(&domain.PaymentRefund{}).
+			Select("COALESCE(SUM(amount), 0)").
+			Where("payment_id = ? AND status <> ?", refund.PaymentID, "failed").
+			Row()
+		if err := row.Scan(&committed); err != nil {
+			return err
+		}
+		if money.Amount(committed)+refund.Amount > limit {
+			return ErrRefundLimitExceeded
+		}
+		return tx.Create(refund).Error
+	})
+}
+
+func (r *paymentRefundRepository) Update(refund *domain.PaymentRefund) error {
+	return r.db.Save(refund).Error
+}
+
+// Settle writes refund's outcome only while the stored refund is still
+// pending and reports whether it did, so a refund is settled once however
+// many confirmations race.
+func (r *paymentRefundRepository) Settle(refund *domain.PaymentRefund) (bool, error) {
+	result := r.db.Model(&domain.PaymentRefund{}).
+		Where("id = ? AND status = ?", refund.ID, "pending").
+		Updates(map[string]interface{}{
+			"status":         refund.Status,
+			"failure_reason": refund.FailureReason,
+			"external_ref":   refund.ExternalRef,
+			"completed_at":   refund.CompletedAt,
+			"updated_at":     refund.UpdatedAt,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *paymentRefundRepository) FindByID(id int64) (*domain.PaymentRefund, error) {
+	var refund domain.PaymentRefund
+	err := r.db.Preload("Items").First(&refund, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+func (r *paymentRefundRepository) ListByPaymentID(paymentID int64) ([]*domain.PaymentRefund, error) {
+	var refunds []*domain.PaymentRefund
+	err := r.db.Preload("Items").Where("payment_id = ?", paymentID).Order("id ASC").Find(&refunds).Error
+	return refunds, err
+}
+
+func (r *paymentRefundRepository) ListByOrderID(orderID int64) ([]*domain.PaymentRefund, error) {
+	var refunds []*domain.PaymentRefund
+	err := r.db.Preload("Items").Where("order_id = ?", orderID).Order("id ASC").Find(&refunds).Error
+	return refunds, err
+}
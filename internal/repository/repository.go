@@ -5,6 +5,7 @@ import (
 
 	"github.com/meowucp/internal/domain"
 	"github.com/meowucp/pkg/database"
+	"github.com/meowucp/pkg/money"
 )
 
 type UserRepository interface {
@@ -79,6 +80,7 @@ type ShipmentRepository interface {
 
 type OrderStatusLogRepository interface {
 	Create(log *domain.OrderStatusLog) error
+	ListByOrderID(orderID int64) ([]*domain.OrderStatusLog, error)
 }
 
 type OrderIdempotencyRepository interface {
@@ -93,6 +95,15 @@ type IdempotencyKeyRepository interface {
 	Update(record *domain.IdempotencyKey) error
 }
 
+type StockReservationRepository interface {
+	ReplaceForSession(sessionID string, reservations []*domain.StockReservation) error
+	ListBySession(sessionID string) ([]*domain.StockReservation, error)
+	ReleaseBySession(sessionID string) error
+	ConvertBySession(sessionID string, orderID int64) error
+	ReleaseExpired(now time.Time) (int64, error)
+	SumActiveByProduct(productID int64, excludeSessionID string) (int, error)
+}
+
 type PaymentRepository interface {
 	Create(payment *domain.Payment) error
 	Update(payment *domain.Payment) error
@@ -105,6 +116,12 @@ type PaymentRepository interface {
 
 type PaymentRefundRepository interface {
 	Create(refund *domain.PaymentRefund) error
+	CreateWithinLimit(refund *domain.PaymentRefund, limit money.Amount) error
+	Update(refund *domain.PaymentRefund) error
+	Settle(refund *domain.PaymentRefund) (bool, error)
+	FindByID(id int64) (*domain.PaymentRefund, error)
+	ListByPaymentID(paymentID int64) ([]*domain.PaymentRefund, error)
+	ListByOrderID(orderID int64) ([]*domain.PaymentRefund, error)
 }
 
 type PaymentEventRepository interface {
@@ -124,6 +141,34 @@ type CheckoutSessionRepository interface {
 	Delete(id string) error
 }
 
+type UCPSigningKeyRepository interface {
+	Create(key *domain.UCPSigningKey) error
+	Update(key *domain.UCPSigningKey) error
+	FindByKID(kid string) (*domain.UCPSigningKey, error)
+	List() ([]*domain.UCPSigningKey, error)
+	WithRotationLock(fn func(repo UCPSigningKeyRepository) error) error
+}
+
+type UserSessionRepository interface {
+	Create(session *domain.UserSession) error
+	FindBySessionID(sessionID string) (*domain.UserSession, error)
+	// FindByRefreshHash matches the current or the previous refresh token.
+	FindByRefreshHash(tokenHash string) (*domain.UserSession, error)
+	// RotateRefresh reports whether this call replaced fromHash.
+	RotateRefresh(id int64, fromHash, toHash string, expiresAt, seenAt time.Time) (bool, error)
+	Touch(id int64, ip, userAgent string, seenAt time.Time) error
+	ListActiveByUser(userID int64, now time.Time) ([]*domain.UserSession, error)
+	Revoke(id int64, revokedAt time.Time) error
+	RevokeAllByUser(userID int64, revokedAt time.Time) (int64, error)
+}
+
+type JWTSigningKeyRepository interface {
+	Create(key *domain.JWTSigningKey) error
+	Update(key *domain.JWTSigningKey) error
+	List() ([]*domain.JWTSigningKey, error)
+	WithRotationLock(fn func(repo JWTSigningKeyRepository) error) error
+}
+
 type PaymentHandlerRepository interface {
 	Create(handler *domain.PaymentHandler) error
 	Update(handler *domain.PaymentHandler) error
@@ -135,14 +180,34 @@ type PaymentHandlerRepository interface {
 type OAuthClientRepository interface {
 	Create(client *domain.OAuthClient) error
 	FindByClientID(clientID string) (*domain.OAuthClient, error)
+	Update(client *domain.OAuthClient) error
 	List(offset, limit int) ([]*domain.OAuthClient, error)
 	Count() (int64, error)
 }
 
+type OAuthAuthorizationCodeRepository interface {
+	Create(code *domain.OAuthAuthorizationCode) error
+	FindByCode(code string) (*domain.OAuthAuthorizationCode, error)
+	// MarkUsed reports whether this call consumed the code.
+	MarkUsed(id int64, usedAt time.Time) (bool, error)
+}
+
 type OAuthTokenRepository interface {
 	Create(token *domain.OAuthToken) error
 	FindByToken(token string) (*domain.OAuthToken, error)
 	Revoke(token string, revokedAt time.Time) error
+	RevokeFamily(familyID string, revokedAt time.Time) error
+}
+
+type OAuthRefreshTokenRepository interface {
+	Create(token *domain.OAuthRefreshToken) error
+	FindByHash(tokenHash string) (*domain.OAuthRefreshToken, error)
+	// Rotate marks the token used and stores the next token of its chain and
+	// the access token issued with it, in one transaction. It reports whether
+	// this call rotated the token; when it did not, nothing is stored.
+	Rotate(id int64, usedAt time.Time, next *domain.OAuthRefreshToken, access *domain.OAuthToken) (bool, error)
+	Revoke(tokenHash string, revokedAt time.Time) error
+	RevokeFamily(familyID string, revokedAt time.Time) error
 }
 
 type TaxRuleRepository interface {
@@ -168,6 +233,7 @@ type UCPWebhookEventRepository interface {
 	FindByEventID(eventID string) (*domain.UCPWebhookEvent, error)
 	UpdateStatus(eventID string, status string) error
 	MarkProcessed(eventID string) error
+	MarkFailed(eventID string) error
 }
 
 type UCPWebhookAuditRepository interface {
@@ -184,12 +250,29 @@ type UCPWebhookReplayRepository interface {
 type UCPWebhookQueueRepository interface {
 	Create(job *domain.UCPWebhookJob) error
 	ListDue(limit int) ([]*domain.UCPWebhookJob, error)
+	ClaimDue(owner string, limit int, lease time.Duration) ([]*domain.UCPWebhookJob, error)
 	Update(job *domain.UCPWebhookJob) error
+	Release(job *domain.UCPWebhookJob) (bool, error)
 	List(offset, limit int) ([]*domain.UCPWebhookJob, error)
 	Count() (int64, error)
 	FindByID(id int64) (*domain.UCPWebhookJob, error)
 }
 
+type UCPWebhookSubscriptionRepository interface {
+	Create(subscription *domain.UCPWebhookSubscription) error
+	Update(subscription *domain.UCPWebhookSubscription) error
+	Delete(id int64) error
+	FindByID(id int64) (*domain.UCPWebhookSubscription, error)
+	List(offset, limit int) ([]*domain.UCPWebhookSubscription, error)
+	Count() (int64, error)
+	ListActive() ([]*domain.UCPWebhookSubscription, error)
+}
+
+type UCPWebhookBreakerRepository interface {
+	Save(breaker *domain.UCPWebhookBreaker) error
+	List() ([]*domain.UCPWebhookBreaker, error)
+}
+
 type UCPWebhookAlertRepository interface {
 	Create(alert *domain.UCPWebhookAlert) error
 	List(offset, limit int) ([]*domain.UCPWebhookAlert, error)
@@ -200,8 +283,13 @@ type UCPWebhookAlertRepository interface {
 type WebhookDLQRepository interface {
 	Create(item *domain.WebhookDLQ) error
 	FindByID(id int64) (*domain.WebhookDLQ, error)
-	List(offset, limit int) ([]*domain.WebhookDLQ, error)
-	Count() (int64, error)
+	List(offset, limit int, filters map[string]interface{}) ([]*domain.WebhookDLQ, error)
+	Count(filters map[string]interface{}) (int64, error)
+	DeleteBefore(cutoff time.Time) (int64, error)
+	// MarkReplayed stamps the dead letter replayed and saves job in one
+	// transaction. It reports false, saving nothing, when the dead letter was
+	// already replayed.
+	MarkReplayed(id int64, job *domain.UCPWebhookJob, replayedAt time.Time) (bool, error)
 }
 
 type WebhookReplayLogRepository interface {
@@ -219,67 +307,83 @@ type I18nStringRepository interface {
 }
 
 type Repositories struct {
-	User             UserRepository
-	Product          ProductRepository
-	Category         CategoryRepository
-	Cart             CartRepository
-	Order            OrderRepository
-	OrderIdempotency OrderIdempotencyRepository
-	IdempotencyKey   IdempotencyKeyRepository
-	Shipment         ShipmentRepository
-	OrderStatusLog   OrderStatusLogRepository
-	Payment          PaymentRepository
-	PaymentRefund    PaymentRefundRepository
-	PaymentEvent     PaymentEventRepository
-	Inventory        InventoryRepository
-	Checkout         CheckoutSessionRepository
-	Handler          PaymentHandlerRepository
-	OAuthClient      OAuthClientRepository
-	OAuthToken       OAuthTokenRepository
-	TaxRule          TaxRuleRepository
-	ShippingRule     ShippingRuleRepository
-	Coupon           CouponRepository
-	AuditLog         AuditLogRepository
-	Webhook          UCPWebhookEventRepository
-	WebhookAudit     UCPWebhookAuditRepository
-	WebhookReplay    UCPWebhookReplayRepository
-	WebhookQueue     UCPWebhookQueueRepository
-	WebhookAlert     UCPWebhookAlertRepository
-	WebhookDLQ       WebhookDLQRepository
-	WebhookReplayLog WebhookReplayLogRepository
-	CurrencyRate     CurrencyRateRepository
-	I18nString       I18nStringRepository
+	User                UserRepository
+	Product             ProductRepository
+	Category            CategoryRepository
+	Cart                CartRepository
+	Order               OrderRepository
+	OrderIdempotency    OrderIdempotencyRepository
+	IdempotencyKey      IdempotencyKeyRepository
+	Shipment            ShipmentRepository
+	OrderStatusLog      OrderStatusLogRepository
+	Payment             PaymentRepository
+	PaymentRefund       PaymentRefundRepository
+	PaymentEvent        PaymentEventRepository
+	Inventory           InventoryRepository
+	StockReservation    StockReservationRepository
+	Checkout            CheckoutSessionRepository
+	Handler             PaymentHandlerRepository
+	OAuthClient         OAuthClientRepository
+	OAuthToken          OAuthTokenRepository
+	OAuthCode           OAuthAuthorizationCodeRepository
+	OAuthRefresh        OAuthRefreshTokenRepository
+	TaxRule             TaxRuleRepository
+	ShippingRule        ShippingRuleRepository
+	Coupon              CouponRepository
+	AuditLog            AuditLogRepository
+	Webhook             UCPWebhookEventRepository
+	WebhookAudit        UCPWebhookAuditRepository
+	WebhookReplay       UCPWebhookReplayRepository
+	WebhookQueue        UCPWebhookQueueRepository
+	WebhookSubscription UCPWebhookSubscriptionRepository
+	WebhookAlert        UCPWebhookAlertRepository
+	WebhookBreaker      UCPWebhookBreakerRepository
+	WebhookDLQ          WebhookDLQRepository
+	WebhookReplayLog    WebhookReplayLogRepository
+	SigningKey          UCPSigningKeyRepository
+	JWTSigningKey       JWTSigningKeyRepository
+	UserSession         UserSessionRepository
+	CurrencyRate        CurrencyRateRepository
+	I18nString          I18nStringRepository
 }
 
 func NewRepositories(db *database.DB) *Repositories {
 	return &Repositories{
-		User:             NewUserRepository(db),
-		Product:          NewProductRepository(db),
-		Category:         NewCategoryRepository(db),
-		Cart:             NewCartRepository(db),
-		Order:            NewOrderRepository(db),
-		OrderIdempotency: NewOrderIdempotencyRepository(db),
-		IdempotencyKey:   NewIdempotencyKeyRepository(db),
-		Shipment:         NewShipmentRepository(db),
-		OrderStatusLog:   NewOrderStatusLogRepository(db),
-		Payment:          NewPaymentRepository(db),
-		PaymentRefund:    NewPaymentRefundRepository(db),
-		PaymentEvent:     NewPaymentEventRepository(db),
-		Inventory:        NewInventoryRepository(db),
-		Checkout:         NewCheckoutSessionRepository(db),
-		Handler:          NewPaymentHandlerRepository(db),
-		OAuthClient:      NewOAuthClientRepository(db),
-		OAuthToken:       NewOAuthTokenRepository(db),
-		TaxRule:          NewTaxRuleRepository(db),
-		ShippingRule:     NewShippingRuleRepository(db),
-		Coupon:           NewCouponRepository(db),
-		AuditLog:         NewAuditLogRepository(db),
-		Webhook:          NewUCPWebhookEventRepository(db),
-		WebhookAudit:     NewUCPWebhookAuditRepository(db),
-		WebhookReplay:    NewUCPWebhookReplayRepository(db),
-		WebhookQueue:     NewUCPWebhookQueueRepository(db),
-		WebhookAlert:     NewUCPWebhookAlertRepository(db),
-		WebhookDLQ:       NewWebhookDLQRepository(db),
-		WebhookReplayLog: NewWebhookReplayLogRepository(db),
+		User:                NewUserRepository(db),
+		Product:             NewProductRepository(db),
+		Category:            NewCategoryRepository(db),
+		Cart:                NewCartRepository(db),
+		Order:               NewOrderRepository(db),
+		OrderIdempotency:    NewOrderIdempotencyRepository(db),
+		IdempotencyKey:      NewIdempotencyKeyRepository(db),
+		Shipment:            NewShipmentRepository(db),
+		OrderStatusLog:      NewOrderStatusLogRepository(db),
+		Payment:             NewPaymentRepository(db),
+		PaymentRefund:       NewPaymentRefundRepository(db),
+		PaymentEvent:        NewPaymentEventRepository(db),
+		Inventory:           NewInventoryRepository(db),
+		StockReservation:    NewStockReservationRepository(db),
+		Checkout:            NewCheckoutSessionRepository(db),
+		Handler:             NewPaymentHandlerRepository(db),
+		OAuthClient:         NewOAuthClientRepository(db),
+		OAuthToken:          NewOAuthTokenRepository(db),
+		OAuthCode:           NewOAuthAuthorizationCodeRepository(db),
+		OAuthRefresh:        NewOAuthRefreshTokenRepository(db),
+		TaxRule:             NewTaxRuleRepository(db),
+		ShippingRule:        NewShippingRuleRepository(db),
+		Coupon:              NewCouponRepository(db),
+		AuditLog:            NewAuditLogRepository(db),
+		Webhook:             NewUCPWebhookEventRepository(db),
+		WebhookAudit:        NewUCPWebhookAuditRepository(db),
+		WebhookReplay:       NewUCPWebhookReplayRepository(db),
+		WebhookQueue:        NewUCPWebhookQueueRepository(db),
+		WebhookSubscription: NewUCPWebhookSubscriptionRepository(db),
+		WebhookAlert:        NewUCPWebhookAlertRepository(db),
+		WebhookBreaker:      NewUCPWebhookBreakerRepository(db),
+		WebhookDLQ:          NewWebhookDLQRepository(db),
+		WebhookReplayLog:    NewWebhookReplayLogRepository(db),
+		SigningKey:          NewUCPSigningKeyRepository(db),
+		JWTSigningKey:       NewJWTSigningKeyRepository(db),
+		UserSession:         NewUserSessionRepository(db),
 	}
 }
@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/pkg/database"
+)
+
+// InsufficientStockError reports the first SKU that could not be held. Its
+// message matches the plain "insufficient stock" error used elsewhere.
+type InsufficientStockError struct {
+	SKU       string
+	Available int
+}
+
+func (e *InsufficientStockError) Error() string {
+	return "insufficient stock"
+}
+
+type stockReservationRepository struct {
+	db *database.DB
+}
+
+func NewStockReservationRepository(db *database.DB) StockReservationRepository {
+	return &stockReservationRepository{db: db}
+}
+
+// ReplaceForSession swaps the session's holds for the given set. Product rows
+// are locked in id order so concurrent sessions cannot both claim the last
+// units; units held by other live sessions count against stock. A session
+// whose holds were already converted to an order is left alone, so a retried
+// completion does not collide with the converted rows.
+func (r *stockReservationRepository) ReplaceForSession(sessionID string, reservations []*domain.StockReservation) error {
+	if r.db == nil {
+		return errors.New("database not initialized")
+	}
+	sorted := append([]*domain.StockReservation{}, reservations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ProductID < sorted[j].ProductID })
+
+	return r.db.Transaction(func(tx *database.DB) error {
+		var converted int64
+		if err := tx.Model(&domain.StockReservation{}).
+			Where("checkout_session_id = ? AND status = ?", sessionID, "converted").
+			Count(&converted).Error; err != nil {
+			return err
+		}
+		if converted > 0 {
+			return nil
+		}
+		txRepo := &stockReservationRepository{db: tx}
+		for _, reservation := range sorted {
+			var product domain.Product
+			if err := tx.Model(&domain.Product{}).
+				Set("gorm:query_option", "FOR UPDATE").
+				Where("id = ?", reservation.ProductID).
+				First(&product).Error; err != nil {
+				return err
+			}
+			reserved, err := txRepo.SumActiveByProduct(reservation.ProductID, sessionID)
+			if err != nil {
+				return err
+			}
+			available := product.StockQuantity - reserved
+			if available < reservation.Quantity {
+				if available < 0 {
+					available = 0
+				}
+				return &InsufficientStockError{SKU: reservation.SKU, Available: available}
+			}
+		}
+
+		if err := tx.Where("checkout_session_id = ? AND status <> ?", sessionID, "converted").
+			Delete(&domain.StockReservation{}).Error; err != nil {
+			return err
+		}
+		for _, reservation := range sorted {
+			reservation.CheckoutSessionID = sessionID
+			reservation.Status = "active"
+			if err := tx.Create(reservation).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *stockReservationRepository) ListBySession(sessionID string) ([]*domain.StockReservation, error) {
+	var reservations []*domain.StockReservation
+	err := r.db.Where("checkout_session_id = ?", sessionID).Order("id ASC").Find(&reservations).Error
+	return reservations, err
+}
+
+func (r *stockReservationRepository) ReleaseBySession(sessionID string) error {
+	return r.db.Exec(
+		"UPDATE stock_reservations SET status = 'released', updated_at = NOW() WHERE checkout_session_id = ? AND status = 'active'",
+		sessionID,
+	).Error
+}
+
+func (r *stockReservationRepository) ConvertBySession(sessionID string, orderID int64) error {
+	return r.db.Exec(
+		"UPDATE stock_reservations SET status = 'converted', order_id = ?, updated_at = NOW() WHERE checkout_session_id = ? AND status = 'active'",
+		orderID,
+		sessionID,
+	).Error
+}
+
+func (r *stockReservationRepository) ReleaseExpired(now time.Time) (int64, error) {
+	result := r.db.Exec(
+		"UPDATE stock_reservations SET status = 'released', updated_at = NOW() WHERE status = 'active' AND expires_at <= ?",
+		now,
+	)
+	return result.RowsAffected, result.Error
+}
+
+func (r *stockReservationRepository) SumActiveByProduct(productID int64, excludeSessionID string) (int, error) {
+	var total int
+	row := r.db.Model(&domain.StockReservation{}).
+		Select("COALESCE(SUM(quantity), 0)").
+		Where("product_id = ? AND status = ? AND expires_at > NOW() AND checkout_session_id <> ?", productID, "active", excludeSessionID).
+		Row()
+	if err := row.Scan(&total); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
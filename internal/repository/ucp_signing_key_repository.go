@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/pkg/database"
+)
+
+type ucpSigningKeyRepository struct {
+	db *database.DB
+}
+
+func NewUCPSigningKeyRepository(db *database.DB) UCPSigningKeyRepository {
+	return &ucpSigningKeyRepository{db: db}
+}
+
+func (r *ucpSigningKeyRepository) Create(key *domain.UCPSigningKey) error {
+	return r.db.Create(key).Error
+}
+
+func (r *ucpSigningKeyRepository) Update(key *domain.UCPSigningKey) error {
+	return r.db.Save(key).Error
+}
+
+func (r *ucpSigningKeyRepository) FindByKID(kid string) (*domain.UCPSigningKey, error) {
+	var key domain.UCPSigningKey
+	err := r.db.Where("kid = ?", kid).First(&key).Error
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// List returns every key, newest first.
+func (r *ucpSigningKeyRepository) List() ([]*domain.UCPSigningKey, error) {
+	var keys []*domain.UCPSigningKey
+	err := r.db.Order("created_at DESC, id DESC").Find(&keys).Error
+	return keys, err
+}
+
+// WithRotationLock runs fn in a transaction holding a table lock that only
+// rotations take, so processes rotating at once go one after another and
+// each sees the keys the previous one wrote. Plain reads are not blocked.
+func (r *ucpSigningKeyRepository) WithRotationLock(fn func(repo UCPSigningKeyRepository) error) error {
+	return r.db.Transaction(func(tx *database.DB) error {
+		if err := tx.Exec("LOCK TABLE ucp_signing_keys IN SHARE ROW EXCLUSIVE MODE").Error; err != nil {
+			return err
+		}
+		return fn(&ucpSigningKeyRepository{db: tx})
+	})
+}
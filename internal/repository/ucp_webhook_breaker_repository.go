@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/pkg/database"
+)
+
+type ucpWebhookBreakerRepository struct {
+	db *database.DB
+}
+
+func NewUCPWebhookBreakerRepository(db *database.DB) UCPWebhookBreakerRepository {
+	return &ucpWebhookBreakerRepository{db: db}
+}
+
+// Save upserts the state for breaker.Destination.
+func (r *ucpWebhookBreakerRepository) Save(breaker *domain.UCPWebhookBreaker) error {
+	return r.db.Where(domain.UCPWebhookBreaker{Destination: breaker.Destination}).
+		Assign(map[string]interface{}{
+			"state":                breaker.State,
+			"consecutive_failures": breaker.ConsecutiveFailures,
+			"opened_at":            breaker.OpenedAt,
+			"retry_at":             breaker.RetryAt,
+			"last_error":           breaker.LastError,
+			"updated_at":           breaker.UpdatedAt,
+		}).
+		FirstOrCreate(breaker).Error
+}
+
+func (r *ucpWebhookBreakerRepository) List() ([]*domain.UCPWebhookBreaker, error) {
+	var breakers []*domain.UCPWebhookBreaker
+	err := r.db.Order("destination asc").Find(&breakers).Error
+	return breakers, err
+}
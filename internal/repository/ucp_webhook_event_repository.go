@@ -39,3 +39,11 @@ func (r *ucpWebhookEventRepository) MarkProcessed(eventID string) error {
 		Where("event_id = ?", eventID).
 		Updates(map[string]interface{}{"status": "processed", "processed_at": time.Now()}).Error
 }
+
+// MarkFailed closes an event that cannot be applied; ProcessedAt records when
+// the worker gave up on it.
+func (r *ucpWebhookEventRepository) MarkFailed(eventID string) error {
+	return r.db.Model(&domain.UCPWebhookEvent{}).
+		Where("event_id = ?", eventID).
+		Updates(map[string]interface{}{"status": "failed", "processed_at": time.Now()}).Error
+}
@@ -30,10 +30,51 @@ func (r *ucpWebhookQueueRepository) ListDue(limit int) ([]*domain.UCPWebhookJob,
 	return jobs, err
 }
 
+// ClaimDue leases up to limit due jobs to owner. Rows locked by another worker
+// are skipped, and jobs whose lease has expired are taken back from a worker
+// that died mid-delivery.
+func (r *ucpWebhookQueueRepository) ClaimDue(owner string, limit int, lease time.Duration) ([]*domain.UCPWebhookJob, error) {
+	var jobs []*domain.UCPWebhookJob
+	now := time.Now()
+	err := r.db.Raw(`UPDATE ucp_webhook_jobs SET status = 'processing', lease_owner = ?, lease_expires_at = ?
+WHERE id IN (
+  SELECT id FROM ucp_webhook_jobs
+  WHERE (status IN ('pending', 'retrying') AND next_retry_at <= ?)
+     OR (status = 'processing' AND lease_expires_at < ?)
+  ORDER BY next_retry_at ASC
+  LIMIT ?
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *`, owner, now.Add(lease), now, now, limit).Scan(&jobs).Error
+	return jobs, err
+}
+
 func (r *ucpWebhookQueueRepository) Update(job *domain.UCPWebhookJob) error {
 	return r.db.Save(job).Error
 }
 
+// Release writes back the outcome of a claimed job and clears its lease, but
+// only while the row still carries the lease recorded on job. A worker whose
+// lease expired and was reclaimed gets false and changes nothing.
+func (r *ucpWebhookQueueRepository) Release(job *domain.UCPWebhookJob) (bool, error) {
+	query := r.db.Model(&domain.UCPWebhookJob{}).Where("id = ? AND lease_owner = ?", job.ID, job.LeaseOwner)
+	if job.LeaseExpiresAt != nil {
+		query = query.Where("lease_expires_at = ?", *job.LeaseExpiresAt)
+	} else {
+		query = query.Where("lease_expires_at IS NULL")
+	}
+	result := query.Updates(map[string]interface{}{
+		"status":           job.Status,
+		"attempts":         job.Attempts,
+		"next_retry_at":    job.NextRetryAt,
+		"last_error":       job.LastError,
+		"last_attempt_at":  job.LastAttemptAt,
+		"lease_owner":      "",
+		"lease_expires_at": nil,
+	})
+	return result.RowsAffected == 1, result.Error
+}
+
 func (r *ucpWebhookQueueRepository) List(offset, limit int) ([]*domain.UCPWebhookJob, error) {
 	var jobs []*domain.UCPWebhookJob
 	err := r.db.Offset(offset).Limit(limit).Order("id desc").Find(&jobs).Error
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/pkg/database"
+)
+
+type ucpWebhookSubscriptionRepository struct {
+	db *database.DB
+}
+
+func NewUCPWebhookSubscriptionRepository(db *database.DB) UCPWebhookSubscriptionRepository {
+	return &ucpWebhookSubscriptionRepository{db: db}
+}
+
+func (r *ucpWebhookSubscriptionRepository) Create(subscription *domain.UCPWebhookSubscription) error {
+	return r.db.Create(subscription).Error
+}
+
+func (r *ucpWebhookSubscriptionRepository) Update(subscription *domain.UCPWebhookSubscription) error {
+	return r.db.Save(subscription).Error
+}
+
+func (r *ucpWebhookSubscriptionRepository) Delete(id int64) error {
+	return r.db.Delete(&domain.UCPWebhookSubscription{}, id).Error
+}
+
+func (r *ucpWebhookSubscriptionRepository) FindByID(id int64) (*domain.UCPWebhookSubscription, error) {
+	var subscription domain.UCPWebhookSubscription
+	err := r.db.First(&subscription, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func (r *ucpWebhookSubscriptionRepository) List(offset, limit int) ([]*domain.UCPWebhookSubscription, error) {
+	var subscriptions []*domain.UCPWebhookSubscription
+	err := r.db.Offset(offset).Limit(limit).Order("id desc").Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+func (r *ucpWebhookSubscriptionRepository) Count() (int64, error) {
+	var count int64
+	err := r.db.Model(&domain.UCPWebhookSubscription{}).Count(&count).Error
+	return count, err
+}
+
+func (r *ucpWebhookSubscriptionRepository) ListActive() ([]*domain.UCPWebhookSubscription, error) {
+	var subscriptions []*domain.UCPWebhookSubscription
+	err := r.db.Where("active = ?", true).Order("id asc").Find(&subscriptions).Error
+	return subscriptions, err
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/pkg/database"
+)
+
+type userSessionRepository struct {
+	db *database.DB
+}
+
+func NewUserSessionRepository(db *database.DB) UserSessionRepository {
+	return &userSessionRepository{db: db}
+}
+
+func (r *userSessionRepository) Create(session *domain.UserSession) error {
+	return r.db.Create(session).Error
+}
+
+func (r *userSessionRepository) FindBySessionID(sessionID string) (*domain.UserSession, error) {
+	var session domain.UserSession
+	if err := r.db.Where("session_id = ?", sessionID).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *userSessionRepository) FindByRefreshHash(tokenHash string) (*domain.UserSession, error) {
+	var session domain.UserSession
+	err := r.db.Where("refresh_token_hash = ? OR previous_refresh_token_hash = ?", tokenHash, tokenHash).
+		First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *userSessionRepository) RotateRefresh(id int64, fromHash, toHash string, expiresAt, seenAt time.Time) (bool, error) {
+	result := r.db.Model(&domain.UserSession{}).
+		Where("id = ? AND refresh_token_hash = ? AND revoked_at IS NULL", id, fromHash).
+		Updates(map[string]interface{}{
+			"refresh_token_hash":          toHash,
+			"previous_refresh_token_hash": fromHash,
+			"expires_at":                  expiresAt,
+			"last_seen_at":                seenAt,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *userSessionRepository) Touch(id int64, ip, userAgent string, seenAt time.Time) error {
+	return r.db.Model(&domain.UserSession{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"ip": ip, "user_agent": userAgent, "last_seen_at": seenAt}).Error
+}
+
+// ListActiveByUser returns the user's live sessions, most recently seen
+// first.
+func (r *userSessionRepository) ListActiveByUser(userID int64, now time.Time) ([]*domain.UserSession, error) {
+	var sessions []*domain.UserSession
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Order("last_seen_at DESC, id DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+func (r *userSessionRepository) Revoke(id int64, revokedAt time.Time) error {
+	return r.db.Model(&domain.UserSession{}).Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", revokedAt).Error
+}
+
+func (r *userSessionRepository) RevokeAllByUser(userID int64, revokedAt time.Time) (int64, error) {
+	result := r.db.Model(&domain.UserSession{}).Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", revokedAt)
+	return result.RowsAffected, result.Error
+}
@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/meowucp/internal/domain"
 	"github.com/meowucp/pkg/database"
 )
@@ -25,18 +27,53 @@ func (r *webhookDLQRepository) FindByID(id int64) (*domain.WebhookDLQ, error) {
 	return &item, nil
 }
 
-func (r *webhookDLQRepository) List(offset, limit int) ([]*domain.WebhookDLQ, error) {
+func (r *webhookDLQRepository) List(offset, limit int, filters map[string]interface{}) ([]*domain.WebhookDLQ, error) {
 	items := []*domain.WebhookDLQ{}
-	if err := r.db.Order("created_at DESC").Offset(offset).Limit(limit).Find(&items).Error; err != nil {
+	query := r.db.Order("created_at DESC").Offset(offset).Limit(limit)
+	for key, value := range filters {
+		query = query.Where(key, value)
+	}
+	if err := query.Find(&items).Error; err != nil {
 		return nil, err
 	}
 	return items, nil
 }
 
-func (r *webhookDLQRepository) Count() (int64, error) {
+func (r *webhookDLQRepository) Count(filters map[string]interface{}) (int64, error) {
 	var count int64
-	if err := r.db.Model(&domain.WebhookDLQ{}).Count(&count).Error; err != nil {
+	query := r.db.Model(&domain.WebhookDLQ{})
+	for key, value := range filters {
+		query = query.Where(key, value)
+	}
+	if err := query.Count(&count).Error; err != nil {
 		return 0, err
 	}
 	return count, nil
 }
+
+// DeleteBefore purges dead letters created before cutoff and reports how many
+// were removed.
+func (r *webhookDLQRepository) DeleteBefore(cutoff time.Time) (int64, error) {
+	result := r.db.Where("created_at < ?", cutoff).Delete(&domain.WebhookDLQ{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *webhookDLQRepository) MarkReplayed(id int64, job *domain.UCPWebhookJob, replayedAt time.Time) (bool, error) {
+	replayed := false
+	err := r.db.Transaction(func(tx *database.DB) error {
+		result := tx.Model(&domain.WebhookDLQ{}).Where("id = ? AND replayed_at IS NULL", id).
+			Update("replayed_at", replayedAt)
+		if result.Error != nil || result.RowsAffected != 1 {
+			return result.Error
+		}
+		if err := tx.Save(job).Error; err != nil {
+			return err
+		}
+		replayed = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return replayed, nil
+}
@@ -3,8 +3,10 @@ package service
 import (
 	"errors"
 
+	"github.com/jinzhu/gorm"
 	"github.com/meowucp/internal/domain"
 	"github.com/meowucp/internal/repository"
+	"github.com/meowucp/pkg/money"
 )
 
 type CartService struct {
@@ -28,15 +30,14 @@ func (s *CartService) GetCart(userID int64) (*domain.Cart, error) {
 }
 
 func (s *CartService) AddToCart(userID, productID int64, quantity int) error {
+	if quantity <= 0 {
+		return errors.New("invalid quantity")
+	}
 	product, err := s.productRepo.FindByID(productID)
-	if err != nil {
+	if err != nil || product == nil || product.Status != 1 {
 		return errors.New("product not found")
 	}
 
-	if product.StockQuantity < quantity {
-		return errors.New("insufficient stock")
-	}
-
 	cart, err := s.cartRepo.FindByUserID(userID)
 	if err != nil {
 		cart = &domain.Cart{UserID: userID}
@@ -54,10 +55,18 @@ func (s *CartService) AddToCart(userID, productID int64, quantity int) error {
 	}
 
 	if existingItem != nil {
+		if product.StockQuantity < existingItem.Quantity+quantity {
+			return errors.New("insufficient stock")
+		}
 		existingItem.Quantity += quantity
+		existingItem.Price = product.Price
 		return s.cartRepo.UpdateItem(existingItem)
 	}
 
+	if product.StockQuantity < quantity {
+		return errors.New("insufficient stock")
+	}
+
 	item := &domain.CartItem{
 		CartID:    cart.ID,
 		ProductID: productID,
@@ -68,6 +77,9 @@ func (s *CartService) AddToCart(userID, productID int64, quantity int) error {
 }
 
 func (s *CartService) UpdateCartItem(userID, productID int64, quantity int) error {
+	if quantity <= 0 {
+		return errors.New("invalid quantity")
+	}
 	cart, err := s.cartRepo.FindByUserID(userID)
 	if err != nil {
 		return errors.New("cart not found")
@@ -85,7 +97,16 @@ func (s *CartService) UpdateCartItem(userID, productID int64, quantity int) erro
 		return errors.New("item not found in cart")
 	}
 
+	product, err := s.productRepo.FindByID(productID)
+	if err != nil || product == nil || product.Status != 1 {
+		return errors.New("product not found")
+	}
+	if product.StockQuantity < quantity {
+		return errors.New("insufficient stock")
+	}
+
 	existingItem.Quantity = quantity
+	existingItem.Price = product.Price
 	return s.cartRepo.UpdateItem(existingItem)
 }
 
@@ -106,3 +127,88 @@ func (s *CartService) ClearCart(userID int64) error {
 
 	return s.cartRepo.ClearCart(cart.ID)
 }
+
+// CartLine is a cart item priced against the current product record. UnitPrice
+// is what the item was added at; LineTotal always uses CurrentPrice, the price
+// an order placed from the cart is charged. Amounts are minor units of the
+// default currency.
+type CartLine struct {
+	ProductID      int64        `json:"product_id"`
+	Name           string       `json:"name"`
+	SKU            string       `json:"sku"`
+	Quantity       int          `json:"quantity"`
+	UnitPrice      money.Amount `json:"unit_price"`
+	CurrentPrice   money.Amount `json:"current_price"`
+	LineTotal      money.Amount `json:"line_total"`
+	AvailableStock int          `json:"available_stock"`
+	PriceChanged   bool         `json:"price_changed"`
+	OutOfStock     bool         `json:"out_of_stock"`
+	Unavailable    bool         `json:"unavailable"`
+}
+
+type CartView struct {
+	Items     []CartLine   `json:"items"`
+	ItemCount int          `json:"item_count"`
+	Subtotal  money.Amount `json:"subtotal"`
+	HasIssues bool         `json:"has_issues"`
+}
+
+// GetCartView returns the user's cart with line totals at current prices. A
+// user without a cart gets an empty view.
+func (s *CartService) GetCartView(userID int64) (*CartView, error) {
+	view := &CartView{Items: []CartLine{}}
+	cart, err := s.cartRepo.FindByUserID(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return view, nil
+		}
+		return nil, err
+	}
+	if cart == nil || len(cart.Items) == 0 {
+		return view, nil
+	}
+
+	ids := make([]int64, 0, len(cart.Items))
+	for _, item := range cart.Items {
+		ids = append(ids, item.ProductID)
+	}
+	products, err := s.productRepo.GetByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	productByID := make(map[int64]*domain.Product, len(products))
+	for _, product := range products {
+		productByID[product.ID] = product
+	}
+
+	for _, item := range cart.Items {
+		line := CartLine{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+			UnitPrice: money.FromMajor(item.Price, money.DefaultCurrency),
+		}
+		product, ok := productByID[item.ProductID]
+		if !ok || product.Status != 1 {
+			line.Unavailable = true
+			if ok {
+				line.Name = product.Name
+				line.SKU = product.SKU
+			}
+		} else {
+			line.Name = product.Name
+			line.SKU = product.SKU
+			line.CurrentPrice = money.FromMajor(product.Price, money.DefaultCurrency)
+			line.AvailableStock = product.StockQuantity
+			line.LineTotal = line.CurrentPrice.Mul(item.Quantity)
+			line.PriceChanged = line.UnitPrice != line.CurrentPrice
+			line.OutOfStock = product.StockQuantity < item.Quantity
+			view.Subtotal += line.LineTotal
+			view.ItemCount += item.Quantity
+		}
+		if line.Unavailable || line.PriceChanged || line.OutOfStock {
+			view.HasIssues = true
+		}
+		view.Items = append(view.Items, line)
+	}
+	return view, nil
+}
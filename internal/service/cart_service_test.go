@@ -0,0 +1,58 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/meowucp/internal/domain"
+)
+
+func TestCartServiceViewFlagsStaleAndOutOfStockItems(t *testing.T) {
+	cartRepo := &fakeCartRepo{cart: &domain.Cart{ID: 1, UserID: 7, Items: []domain.CartItem{
+		{ProductID: 1, Quantity: 2, Price: 10},
+		{ProductID: 2, Quantity: 5, Price: 20},
+		{ProductID: 3, Quantity: 1, Price: 30},
+	}}}
+	productRepo := &fakeProductRepo{products: map[int64]*domain.Product{
+		1: {ID: 1, Name: "A", Price: 12.5, StockQuantity: 10, Status: 1},
+		2: {ID: 2, Name: "B", Price: 20, StockQuantity: 3, Status: 1},
+		3: {ID: 3, Name: "C", Price: 30, StockQuantity: 10, Status: 0},
+	}}
+	svc := NewCartService(cartRepo, productRepo)
+
+	view, err := svc.GetCartView(7)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(view.Items) != 3 {
+		t.Fatalf("expected 3 lines, got %d", len(view.Items))
+	}
+	if !view.Items[0].PriceChanged || view.Items[0].LineTotal != 2500 || view.Items[0].CurrentPrice != 1250 {
+		t.Fatalf("expected repriced stale line, got %+v", view.Items[0])
+	}
+	if view.Items[1].PriceChanged || !view.Items[1].OutOfStock {
+		t.Fatalf("expected out of stock line, got %+v", view.Items[1])
+	}
+	if !view.Items[2].Unavailable || view.Items[2].LineTotal != 0 {
+		t.Fatalf("expected unavailable line, got %+v", view.Items[2])
+	}
+	if view.Subtotal != 12500 || view.ItemCount != 7 || !view.HasIssues {
+		t.Fatalf("unexpected totals: %+v", view)
+	}
+}
+
+func TestCartServiceAddCountsExistingQuantityAgainstStock(t *testing.T) {
+	cartRepo := &fakeCartRepo{cart: &domain.Cart{ID: 1, UserID: 7, Items: []domain.CartItem{
+		{ProductID: 1, Quantity: 3, Price: 10},
+	}}}
+	productRepo := &fakeProductRepo{products: map[int64]*domain.Product{
+		1: {ID: 1, Price: 10, StockQuantity: 4, Status: 1},
+	}}
+	svc := NewCartService(cartRepo, productRepo)
+
+	if err := svc.AddToCart(7, 1, 2); err == nil || err.Error() != "insufficient stock" {
+		t.Fatalf("expected insufficient stock, got %v", err)
+	}
+	if err := svc.AddToCart(7, 1, 1); err != nil {
+		t.Fatalf("expected add within stock to succeed, got %v", err)
+	}
+}
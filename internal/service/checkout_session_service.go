@@ -1,13 +1,34 @@
 package service
 
 import (
+	"strings"
+
 	"github.com/meowucp/internal/domain"
 	"github.com/meowucp/internal/repository"
+	"github.com/meowucp/pkg/money"
 )
 
 type CheckoutSessionService struct {
-	repo repository.CheckoutSessionRepository
-	tax  *TaxShippingService
+	repo       repository.CheckoutSessionRepository
+	tax        *TaxShippingService
+	promotions *PromotionService
+}
+
+// CheckoutPriceLine is a checkout line priced in minor currency units.
+type CheckoutPriceLine struct {
+	UnitPrice money.Amount
+	Quantity  int
+}
+
+// CheckoutPricing is the price breakdown for a checkout, in minor units.
+type CheckoutPricing struct {
+	Subtotal      money.Amount
+	Discount      money.Amount
+	Shipping      money.Amount
+	Tax           money.Amount
+	Total         money.Amount
+	AppliedCodes  []string
+	RejectedCodes []string
 }
 
 func NewCheckoutSessionService(repo repository.CheckoutSessionRepository) *CheckoutSessionService {
@@ -18,7 +39,11 @@ func (s *CheckoutSessionService) SetTaxShippingService(service *TaxShippingServi
 	s.tax = service
 }
 
-func (s *CheckoutSessionService) Quote(region string, items []domain.OrderItem) (float64, float64, error) {
+func (s *CheckoutSessionService) SetPromotionService(service *PromotionService) {
+	s.promotions = service
+}
+
+func (s *CheckoutSessionService) Quote(region string, items []domain.OrderItem) (money.Amount, money.Amount, error) {
 	if s == nil || s.tax == nil {
 		return 0, 0, nil
 	}
@@ -40,3 +65,54 @@ func (s *CheckoutSessionService) GetByID(id string) (*domain.CheckoutSession, er
 func (s *CheckoutSessionService) Delete(id string) error {
 	return s.repo.Delete(id)
 }
+
+// Price computes the checkout breakdown for the buyer's region. Coupons are
+// applied to the subtotal first and tax is charged on the discounted amount.
+// Without a region, tax and shipping are zero.
+func (s *CheckoutSessionService) Price(region string, lines []CheckoutPriceLine, discountCodes []string) (*CheckoutPricing, error) {
+	pricing := &CheckoutPricing{}
+	quantity := 0
+	for _, line := range lines {
+		pricing.Subtotal += line.UnitPrice.Mul(line.Quantity)
+		quantity += line.Quantity
+	}
+
+	seen := map[string]bool{}
+	for _, code := range discountCodes {
+		code = strings.TrimSpace(code)
+		if code == "" || seen[code] {
+			continue
+		}
+		seen[code] = true
+		if s == nil || s.promotions == nil {
+			pricing.RejectedCodes = append(pricing.RejectedCodes, code)
+			continue
+		}
+		coupon, err := s.promotions.ValidateCoupon(code, pricing.Subtotal)
+		if err != nil {
+			pricing.RejectedCodes = append(pricing.RejectedCodes, code)
+			continue
+		}
+		pricing.Discount += s.promotions.CouponDiscount(coupon, pricing.Subtotal)
+		pricing.AppliedCodes = append(pricing.AppliedCodes, code)
+	}
+	if pricing.Discount > pricing.Subtotal {
+		pricing.Discount = pricing.Subtotal
+	}
+
+	if region != "" && s != nil && s.tax != nil {
+		rate, err := s.tax.TaxRate(region)
+		if err != nil {
+			return nil, err
+		}
+		shipping, err := s.tax.ShippingFee(region, quantity)
+		if err != nil {
+			return nil, err
+		}
+		pricing.Tax = (pricing.Subtotal - pricing.Discount).MulRate(rate)
+		pricing.Shipping = shipping
+	}
+
+	pricing.Total = pricing.Subtotal - pricing.Discount + pricing.Shipping + pricing.Tax
+	return pricing, nil
+}
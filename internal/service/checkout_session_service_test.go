@@ -0,0 +1,63 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/meowucp/internal/domain"
+)
+
+func TestCheckoutSessionPriceBreaksDownTotals(t *testing.T) {
+	taxRepo := &fakeTaxRuleRepo{rules: []*domain.TaxRule{{Region: "CN-SH", Rate: 0.1, EffectiveAt: time.Now().Add(-time.Hour)}}}
+	shippingRepo := &fakeShippingRuleRepo{rules: []*domain.ShippingRule{{Region: "CN-SH", BaseAmount: 500, PerItemAmount: 100}}}
+	svc := NewCheckoutSessionService(nil)
+	svc.SetTaxShippingService(NewTaxShippingService(taxRepo, shippingRepo))
+	svc.SetPromotionService(NewPromotionService(&fakeCouponRepo{coupon: &domain.Coupon{Code: "SAVE10", Type: "fixed", Value: 1000}}))
+
+	pricing, err := svc.Price("CN-SH", []CheckoutPriceLine{{UnitPrice: 5000, Quantity: 2}}, []string{"SAVE10"})
+	if err != nil {
+		t.Fatalf("price: %v", err)
+	}
+	if pricing.Subtotal != 10000 || pricing.Discount != 1000 || pricing.Shipping != 700 || pricing.Tax != 900 {
+		t.Fatalf("unexpected breakdown: %+v", pricing)
+	}
+	if pricing.Total != 10000-1000+700+900 {
+		t.Fatalf("unexpected total: %d", pricing.Total)
+	}
+	if len(pricing.AppliedCodes) != 1 || len(pricing.RejectedCodes) != 0 {
+		t.Fatalf("expected SAVE10 applied, got %+v", pricing)
+	}
+}
+
+func TestCheckoutSessionPriceWithoutRegionSkipsTaxAndShipping(t *testing.T) {
+	taxRepo := &fakeTaxRuleRepo{rules: []*domain.TaxRule{{Rate: 0.1, EffectiveAt: time.Now().Add(-time.Hour)}}}
+	svc := NewCheckoutSessionService(nil)
+	svc.SetTaxShippingService(NewTaxShippingService(taxRepo, &fakeShippingRuleRepo{}))
+
+	pricing, err := svc.Price("", []CheckoutPriceLine{{UnitPrice: 1999, Quantity: 1}}, []string{"NOPE"})
+	if err != nil {
+		t.Fatalf("price: %v", err)
+	}
+	if pricing.Tax != 0 || pricing.Shipping != 0 || pricing.Total != 1999 {
+		t.Fatalf("unexpected breakdown: %+v", pricing)
+	}
+	if len(pricing.RejectedCodes) != 1 {
+		t.Fatalf("expected code rejected without promotions, got %+v", pricing)
+	}
+}
+
+func TestCheckoutSessionPriceRoundsPercentCouponAndTaxHalfToEven(t *testing.T) {
+	taxRepo := &fakeTaxRuleRepo{rules: []*domain.TaxRule{{Region: "CN-SH", Rate: 0.1, EffectiveAt: time.Now().Add(-time.Hour)}}}
+	svc := NewCheckoutSessionService(nil)
+	svc.SetTaxShippingService(NewTaxShippingService(taxRepo, &fakeShippingRuleRepo{}))
+	svc.SetPromotionService(NewPromotionService(&fakeCouponRepo{coupon: &domain.Coupon{Code: "HALF", Type: "percent", Value: 5000}}))
+
+	// 50% of 2.45 is 1.225 -> 1.22; tax on the remaining 1.23 is 0.123 -> 0.12.
+	pricing, err := svc.Price("CN-SH", []CheckoutPriceLine{{UnitPrice: 245, Quantity: 1}}, []string{"HALF"})
+	if err != nil {
+		t.Fatalf("price: %v", err)
+	}
+	if pricing.Discount != 122 || pricing.Tax != 12 || pricing.Total != 135 {
+		t.Fatalf("unexpected breakdown: %+v", pricing)
+	}
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/repository"
+	"github.com/meowucp/internal/ucp/model"
+)
+
+// Alert reasons recorded when an inbound order event cannot be applied.
+const (
+	InboundAlertInvalidPayload     = "inbound_invalid_payload"
+	InboundAlertOrderNotFound      = "inbound_order_not_found"
+	InboundAlertOrderNotOwned      = "inbound_order_not_owned"
+	InboundAlertIllegalTransition  = "inbound_illegal_transition"
+	InboundAlertPaymentUnconfirmed = "inbound_payment_unconfirmed"
+)
+
+// inboundOAuthSenderPrefix marks senders attributed to an OAuth client.
+const inboundOAuthSenderPrefix = "oauth:"
+
+// InboundOrderWebhookService applies verified partner order events, queued by
+// the UCP webhook endpoint, to local orders through OrderService so stock,
+// status logs and outbound events follow the same rules as any other change.
+// A sender may only touch orders placed through its own checkout sessions,
+// and may not mark an order paid or refunded that our payments disagree with.
+type InboundOrderWebhookService struct {
+	orders    *OrderService
+	events    *WebhookEventService
+	alerts    *WebhookAlertService
+	checkouts repository.CheckoutSessionRepository
+	payments  repository.PaymentRepository
+}
+
+func NewInboundOrderWebhookService(orders *OrderService, events *WebhookEventService, alerts *WebhookAlertService) *InboundOrderWebhookService {
+	return &InboundOrderWebhookService{orders: orders, events: events, alerts: alerts}
+}
+
+// SetCheckoutSessions lets events be matched to the client that created the
+// order. Without it no order is attributable and every event is refused.
+func (s *InboundOrderWebhookService) SetCheckoutSessions(repo repository.CheckoutSessionRepository) {
+	s.checkouts = repo
+}
+
+// SetPayments lets "paid" and "refunded" events be checked against our own
+// payment records. Without it those events are refused.
+func (s *InboundOrderWebhookService) SetPayments(repo repository.PaymentRepository) {
+	s.payments = repo
+}
+
+// Apply handles one inbound job. Events that can never apply (bad payload,
+// unknown order, illegal transition) are marked failed with an alert and
+// return nil so the job is not retried. Other errors leave the event
+// "retrying" and are returned so the queue retries the job.
+func (s *InboundOrderWebhookService) Apply(job *domain.UCPWebhookJob) error {
+	if s == nil || s.orders == nil || job == nil {
+		return errors.New("inbound webhook service unavailable")
+	}
+	err := s.apply(job)
+	if err != nil && s.events != nil {
+		_ = s.events.UpdateStatus(job.EventID, "retrying")
+	}
+	return err
+}
+
+func (s *InboundOrderWebhookService) apply(job *domain.UCPWebhookJob) error {
+	var event model.OrderWebhookEvent
+	if err := json.Unmarshal([]byte(job.Payload), &event); err != nil {
+		return s.reject(job.EventID, InboundAlertInvalidPayload, err.Error())
+	}
+	status := inboundTargetStatus(event)
+	if status == "" {
+		return s.reject(event.EventID, InboundAlertInvalidPayload, "unsupported event_type "+event.EventType)
+	}
+
+	order, err := s.resolveOrder(event.Order)
+	if err != nil {
+		return err
+	}
+	if order == nil {
+		return s.reject(event.EventID, InboundAlertOrderNotFound, "order "+event.Order.OrderNo+" checkout "+event.Order.CheckoutSessionID)
+	}
+	owned, err := s.ownedBy(order, job.Sender)
+	if err != nil {
+		return err
+	}
+	if !owned {
+		return s.reject(event.EventID, InboundAlertOrderNotOwned, "order "+order.OrderNo+" sender "+job.Sender)
+	}
+	if order.Status != status {
+		if err := checkOrderTransition(order.Status, status); err != nil {
+			return s.reject(event.EventID, InboundAlertIllegalTransition, err.Error())
+		}
+		confirmed, err := s.paymentConfirms(order, status)
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			return s.reject(event.EventID, InboundAlertPaymentUnconfirmed, "order "+order.OrderNo+" has no payment "+status)
+		}
+		if err := s.transition(order, status, event.Order.Fulfillment); err != nil {
+			if errors.Is(err, ErrInvalidOrderTransition) {
+				return s.reject(event.EventID, InboundAlertIllegalTransition, err.Error())
+			}
+			return err
+		}
+	}
+	if s.events == nil {
+		return nil
+	}
+	return s.events.MarkProcessed(event.EventID)
+}
+
+func (s *InboundOrderWebhookService) transition(order *domain.Order, status string, fulfillment *model.OrderWebhookFulfillment) error {
+	switch status {
+	case "shipped":
+		carrier, tracking := "", ""
+		if fulfillment != nil {
+			carrier, tracking = fulfillment.Carrier, fulfillment.TrackingNumber
+		}
+		_, err := s.orders.ShipOrder(order.ID, carrier, tracking)
+		return err
+	case "delivered":
+		return s.orders.ReceiveOrder(order.ID)
+	case "cancelled":
+		return s.orders.CancelOrder(order.ID, "ucp_webhook")
+	default:
+		return s.orders.UpdateOrderStatus(order.ID, status)
+	}
+}
+
+// resolveOrder looks the order up by our order number, then by the checkout
+// session it was placed through. The partner's own order id is never taken
+// for one of ours. When both are given they must name the same order. A
+// missing order is reported as nil without an error.
+func (s *InboundOrderWebhookService) resolveOrder(ref model.OrderWebhookOrder) (*domain.Order, error) {
+	var order *domain.Order
+	var err error
+	if ref.OrderNo != "" {
+		order, err = s.orders.GetOrderByOrderNo(ref.OrderNo)
+	} else if ref.CheckoutSessionID != "" {
+		order, err = s.orders.GetOrderByCheckoutSession(ref.CheckoutSessionID)
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if order == nil || (ref.CheckoutSessionID != "" && order.CheckoutSessionID != ref.CheckoutSessionID) {
+		return nil, nil
+	}
+	return order, nil
+}
+
+// ownedBy reports whether sender may change order: the order must come from
+// a checkout session, and that session's OAuth client must be the sender.
+// Sessions created without a client can only be updated by senders that are
+// not OAuth clients (the configured default sender or a trusted profile).
+func (s *InboundOrderWebhookService) ownedBy(order *domain.Order, sender string) (bool, error) {
+	if s.checkouts == nil || order.CheckoutSessionID == "" {
+		return false, nil
+	}
+	session, err := s.checkouts.FindByID(order.CheckoutSessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if session == nil {
+		return false, nil
+	}
+	if session.ClientID == "" {
+		return !strings.HasPrefix(sender, inboundOAuthSenderPrefix), nil
+	}
+	return sender == inboundOAuthSenderPrefix+session.ClientID, nil
+}
+
+// paymentConfirms reports whether our payment records back a move to
+// status. Only "paid" and "refunded" need confirmation.
+func (s *InboundOrderWebhookService) paymentConfirms(order *domain.Order, status string) (bool, error) {
+	var accepted map[string]bool
+	switch status {
+	case "paid":
+		accepted = map[string]bool{"paid": true, "partially_refunded": true, "refunded": true}
+	case "refunded":
+		accepted = map[string]bool{"refunded": true}
+	default:
+		return true, nil
+	}
+	if s.payments == nil {
+		return false, nil
+	}
+	payments, err := s.payments.FindByOrderID(order.ID)
+	if err != nil {
+		return false, err
+	}
+	for _, payment := range payments {
+		if accepted[payment.Status] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *InboundOrderWebhookService) reject(eventID, reason, details string) error {
+	if s.alerts != nil {
+		if err := s.alerts.Create(&domain.UCPWebhookAlert{
+			EventID:   eventID,
+			Reason:    reason,
+			Details:   details,
+			CreatedAt: time.Now(),
+		}); err != nil {
+			return err
+		}
+	}
+	if s.events == nil || eventID == "" {
+		return nil
+	}
+	return s.events.MarkFailed(eventID)
+}
+
+// inboundTargetStatus maps an event to the order status it asks for: the
+// event type ("order.shipped") wins over the snapshot status.
+func inboundTargetStatus(event model.OrderWebhookEvent) string {
+	status := strings.TrimPrefix(event.EventType, "order.")
+	if status == event.EventType || !IsOrderStatus(status) {
+		status = event.Order.Status
+	}
+	if status == "pending" || !IsOrderStatus(status) {
+		return ""
+	}
+	return status
+}
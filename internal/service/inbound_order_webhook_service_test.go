@@ -0,0 +1,220 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/ucp/model"
+)
+
+type fakeInboundCheckoutRepo struct {
+	sessions map[string]*domain.CheckoutSession
+}
+
+func (f *fakeInboundCheckoutRepo) Create(session *domain.CheckoutSession) error { return nil }
+func (f *fakeInboundCheckoutRepo) Update(session *domain.CheckoutSession) error { return nil }
+func (f *fakeInboundCheckoutRepo) Delete(id string) error                       { return nil }
+func (f *fakeInboundCheckoutRepo) FindByID(id string) (*domain.CheckoutSession, error) {
+	if session, ok := f.sessions[id]; ok {
+		return session, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// newInboundTestService places order through checkout session "cs_1" owned
+// by OAuth client "partner-a".
+func newInboundTestService(order *domain.Order) (*InboundOrderWebhookService, *fakeOrderStatusRepo, *fakeWebhookEventRepo, *fakeWebhookAlertRepo) {
+	if order != nil && order.CheckoutSessionID == "" {
+		order.CheckoutSessionID = "cs_1"
+	}
+	orderRepo := &fakeOrderStatusRepo{order: order}
+	eventRepo := &fakeWebhookEventRepo{}
+	alertRepo := &fakeWebhookAlertRepo{}
+	orders := NewOrderService(orderRepo, nil, nil, nil, nil)
+	orders.SetShipmentRepo(&fakeShipmentRepo{})
+	svc := NewInboundOrderWebhookService(orders, NewWebhookEventService(eventRepo), NewWebhookAlertService(alertRepo, eventRepo))
+	svc.SetCheckoutSessions(&fakeInboundCheckoutRepo{sessions: map[string]*domain.CheckoutSession{
+		"cs_1":      {ID: "cs_1", ClientID: "partner-a"},
+		"cs_legacy": {ID: "cs_legacy"},
+	}})
+	svc.SetPayments(&fakeCallbackPaymentRepo{})
+	return svc, orderRepo, eventRepo, alertRepo
+}
+
+func inboundJob(t *testing.T, eventRepo *fakeWebhookEventRepo, event model.OrderWebhookEvent) *domain.UCPWebhookJob {
+	t.Helper()
+	return inboundJobFrom(t, eventRepo, "oauth:partner-a", event)
+}
+
+func inboundJobFrom(t *testing.T, eventRepo *fakeWebhookEventRepo, sender string, event model.OrderWebhookEvent) *domain.UCPWebhookJob {
+	t.Helper()
+	body, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("encode event: %v", err)
+	}
+	_ = eventRepo.Create(&domain.UCPWebhookEvent{EventID: event.EventID, Status: "received"})
+	return &domain.UCPWebhookJob{EventID: event.EventID, Kind: "inbound", Sender: sender, Payload: string(body)}
+}
+
+func TestInboundOrderWebhookAppliesShipment(t *testing.T) {
+	svc, orderRepo, eventRepo, alertRepo := newInboundTestService(&domain.Order{ID: 5, OrderNo: "ORD-5", Status: "paid"})
+	job := inboundJob(t, eventRepo, model.OrderWebhookEvent{
+		EventID:   "evt_ship",
+		EventType: "order.shipped",
+		Order: model.OrderWebhookOrder{
+			ID:          "partner-5",
+			OrderNo:     "ORD-5",
+			Status:      "shipped",
+			Fulfillment: &model.OrderWebhookFulfillment{Carrier: "UPS", TrackingNumber: "1Z"},
+		},
+	})
+
+	if err := svc.Apply(job); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if orderRepo.order.Status != "shipped" {
+		t.Fatalf("expected order shipped, got %s", orderRepo.order.Status)
+	}
+	event := eventRepo.items["evt_ship"]
+	if event.Status != "processed" || event.ProcessedAt == nil {
+		t.Fatalf("expected event processed, got %+v", event)
+	}
+	if len(alertRepo.items) != 0 {
+		t.Fatalf("expected no alerts, got %d", len(alertRepo.items))
+	}
+}
+
+func TestInboundOrderWebhookAlertsOnUnknownOrder(t *testing.T) {
+	svc, _, eventRepo, alertRepo := newInboundTestService(nil)
+	job := inboundJob(t, eventRepo, model.OrderWebhookEvent{
+		EventID:   "evt_missing",
+		EventType: "order.paid",
+		Order:     model.OrderWebhookOrder{ID: "404", OrderNo: "ORD-404", Status: "paid"},
+	})
+
+	if err := svc.Apply(job); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if len(alertRepo.items) != 1 || alertRepo.items[0].Reason != InboundAlertOrderNotFound {
+		t.Fatalf("expected order_not_found alert, got %+v", alertRepo.items)
+	}
+	if event := eventRepo.items["evt_missing"]; event.Status != "failed" || event.ProcessedAt == nil {
+		t.Fatalf("expected event failed, got %+v", event)
+	}
+}
+
+func TestInboundOrderWebhookAlertsOnIllegalTransition(t *testing.T) {
+	svc, orderRepo, eventRepo, alertRepo := newInboundTestService(&domain.Order{ID: 6, OrderNo: "ORD-6", Status: "cancelled"})
+	job := inboundJob(t, eventRepo, model.OrderWebhookEvent{
+		EventID:   "evt_paid",
+		EventType: "order.paid",
+		Order:     model.OrderWebhookOrder{ID: "partner-6", OrderNo: "ORD-6", Status: "paid"},
+	})
+
+	if err := svc.Apply(job); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if orderRepo.order.Status != "cancelled" {
+		t.Fatalf("expected order to stay cancelled, got %s", orderRepo.order.Status)
+	}
+	if len(alertRepo.items) != 1 || alertRepo.items[0].Reason != InboundAlertIllegalTransition {
+		t.Fatalf("expected illegal_transition alert, got %+v", alertRepo.items)
+	}
+	if event := eventRepo.items["evt_paid"]; event.Status != "failed" {
+		t.Fatalf("expected event failed, got %s", event.Status)
+	}
+}
+
+func TestInboundOrderWebhookIgnoresPartnerOrderIDs(t *testing.T) {
+	svc, orderRepo, eventRepo, alertRepo := newInboundTestService(&domain.Order{ID: 5, OrderNo: "ORD-5", Status: "paid"})
+	job := inboundJob(t, eventRepo, model.OrderWebhookEvent{
+		EventID:   "evt_partner_id",
+		EventType: "order.shipped",
+		Order:     model.OrderWebhookOrder{ID: "5", Status: "shipped"},
+	})
+
+	if err := svc.Apply(job); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if orderRepo.order.Status != "paid" {
+		t.Fatalf("expected the partner's id not to match our order, got %s", orderRepo.order.Status)
+	}
+	if len(alertRepo.items) != 1 || alertRepo.items[0].Reason != InboundAlertOrderNotFound {
+		t.Fatalf("expected order_not_found alert, got %+v", alertRepo.items)
+	}
+}
+
+func TestInboundOrderWebhookRefusesOtherSendersOrders(t *testing.T) {
+	cases := []struct {
+		name    string
+		sender  string
+		session string
+	}{
+		{"other client", "oauth:partner-b", "cs_1"},
+		{"default sender on a client's session", "default", "cs_1"},
+		{"client on a session without one", "oauth:partner-a", "cs_legacy"},
+		{"storefront order", "oauth:partner-a", "-"},
+	}
+	for _, tc := range cases {
+		svc, orderRepo, eventRepo, alertRepo := newInboundTestService(&domain.Order{ID: 5, OrderNo: "ORD-5", Status: "paid", CheckoutSessionID: tc.session})
+		if tc.session == "-" {
+			orderRepo.order.CheckoutSessionID = ""
+		}
+		job := inboundJobFrom(t, eventRepo, tc.sender, model.OrderWebhookEvent{
+			EventID:   "evt_foreign",
+			EventType: "order.shipped",
+			Order:     model.OrderWebhookOrder{ID: "x", OrderNo: "ORD-5", Status: "shipped"},
+		})
+		if err := svc.Apply(job); err != nil {
+			t.Fatalf("%s: apply: %v", tc.name, err)
+		}
+		if orderRepo.order.Status != "paid" {
+			t.Fatalf("%s: expected order untouched, got %s", tc.name, orderRepo.order.Status)
+		}
+		if len(alertRepo.items) != 1 || alertRepo.items[0].Reason != InboundAlertOrderNotOwned {
+			t.Fatalf("%s: expected order_not_owned alert, got %+v", tc.name, alertRepo.items)
+		}
+	}
+
+	svc, orderRepo, eventRepo, _ := newInboundTestService(&domain.Order{ID: 5, OrderNo: "ORD-5", Status: "paid", CheckoutSessionID: "cs_legacy"})
+	job := inboundJobFrom(t, eventRepo, "default", model.OrderWebhookEvent{
+		EventID:   "evt_legacy",
+		EventType: "order.shipped",
+		Order:     model.OrderWebhookOrder{ID: "x", CheckoutSessionID: "cs_legacy", Status: "shipped"},
+	})
+	if err := svc.Apply(job); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if orderRepo.order.Status != "shipped" {
+		t.Fatalf("expected the default sender to update a session without a client, got %s", orderRepo.order.Status)
+	}
+}
+
+func TestInboundOrderWebhookRequiresPaymentForPaid(t *testing.T) {
+	svc, orderRepo, eventRepo, alertRepo := newInboundTestService(&domain.Order{ID: 7, OrderNo: "ORD-7", Status: "pending"})
+	paid := model.OrderWebhookEvent{
+		EventID:   "evt_forged",
+		EventType: "order.paid",
+		Order:     model.OrderWebhookOrder{ID: "x", OrderNo: "ORD-7", Status: "paid"},
+	}
+	if err := svc.Apply(inboundJob(t, eventRepo, paid)); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if orderRepo.order.Status != "pending" {
+		t.Fatalf("expected an unconfirmed payment to be refused, got %s", orderRepo.order.Status)
+	}
+	if len(alertRepo.items) != 1 || alertRepo.items[0].Reason != InboundAlertPaymentUnconfirmed {
+		t.Fatalf("expected payment_unconfirmed alert, got %+v", alertRepo.items)
+	}
+
+	svc.SetPayments(&fakeCallbackPaymentRepo{items: []*domain.Payment{{ID: 1, OrderID: 7, Status: "paid"}}})
+	paid.EventID = "evt_confirmed"
+	if err := svc.Apply(inboundJob(t, eventRepo, paid)); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if orderRepo.order.Status != "paid" {
+		t.Fatalf("expected a confirmed payment to mark the order paid, got %s", orderRepo.order.Status)
+	}
+}
@@ -2,14 +2,16 @@ package service
 
 import (
 	"errors"
+	"time"
 
 	"github.com/meowucp/internal/domain"
 	"github.com/meowucp/internal/repository"
 )
 
 type InventoryService struct {
-	productRepo   repository.ProductRepository
-	inventoryRepo repository.InventoryRepository
+	productRepo     repository.ProductRepository
+	inventoryRepo   repository.InventoryRepository
+	reservationRepo repository.StockReservationRepository
 }
 
 type atomicStockUpdater interface {
@@ -23,6 +25,10 @@ func NewInventoryService(productRepo repository.ProductRepository, inventoryRepo
 	}
 }
 
+func (s *InventoryService) SetReservationRepo(repo repository.StockReservationRepository) {
+	s.reservationRepo = repo
+}
+
 func (s *InventoryService) AdjustStock(productID int64, quantity int, typeName, referenceID, referenceType, notes string) error {
 	if updater, ok := s.productRepo.(atomicStockUpdater); ok {
 		if err := updater.UpdateStockWithDelta(productID, quantity); err != nil {
@@ -68,3 +74,95 @@ func (s *InventoryService) GetInventoryLogs(productID int64, offset, limit int)
 
 	return logs, count, nil
 }
+
+type StockReservationItem struct {
+	SKU      string
+	Quantity int
+}
+
+// ReserveForCheckout replaces the holds for a checkout session with the given
+// items. It fails with *repository.InsufficientStockError when any SKU cannot
+// be covered, leaving the previous holds in place.
+func (s *InventoryService) ReserveForCheckout(sessionID string, items []StockReservationItem, ttl time.Duration) error {
+	if s.reservationRepo == nil {
+		return nil
+	}
+	if sessionID == "" {
+		return errors.New("checkout session required")
+	}
+
+	quantities := map[string]int{}
+	order := make([]string, 0, len(items))
+	for _, item := range items {
+		if item.SKU == "" || item.Quantity <= 0 {
+			continue
+		}
+		if _, ok := quantities[item.SKU]; !ok {
+			order = append(order, item.SKU)
+		}
+		quantities[item.SKU] += item.Quantity
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	reservations := make([]*domain.StockReservation, 0, len(order))
+	for _, sku := range order {
+		product, err := s.productRepo.FindBySKU(sku)
+		if err != nil || product == nil || product.Status != 1 {
+			return &repository.InsufficientStockError{SKU: sku}
+		}
+		reservations = append(reservations, &domain.StockReservation{
+			ProductID: product.ID,
+			SKU:       sku,
+			Quantity:  quantities[sku],
+			ExpiresAt: expiresAt,
+		})
+	}
+	return s.reservationRepo.ReplaceForSession(sessionID, reservations)
+}
+
+func (s *InventoryService) ReleaseReservations(sessionID string) error {
+	if s.reservationRepo == nil {
+		return nil
+	}
+	return s.reservationRepo.ReleaseBySession(sessionID)
+}
+
+// ConvertReservations marks a session's holds as consumed by an order. The
+// stock itself is deducted when the order is created.
+func (s *InventoryService) ConvertReservations(sessionID string, orderID int64) error {
+	if s.reservationRepo == nil {
+		return nil
+	}
+	return s.reservationRepo.ConvertBySession(sessionID, orderID)
+}
+
+func (s *InventoryService) ReleaseExpiredReservations() (int64, error) {
+	if s.reservationRepo == nil {
+		return 0, nil
+	}
+	return s.reservationRepo.ReleaseExpired(time.Now())
+}
+
+// AvailableStock is on-hand stock minus units held by live reservations.
+func (s *InventoryService) AvailableStock(productID int64) (int, error) {
+	product, err := s.productRepo.FindByID(productID)
+	if err != nil {
+		return 0, err
+	}
+	return availableStock(s.reservationRepo, product)
+}
+
+func availableStock(reservationRepo repository.StockReservationRepository, product *domain.Product) (int, error) {
+	if reservationRepo == nil {
+		return product.StockQuantity, nil
+	}
+	reserved, err := reservationRepo.SumActiveByProduct(product.ID, "")
+	if err != nil {
+		return 0, err
+	}
+	available := product.StockQuantity - reserved
+	if available < 0 {
+		available = 0
+	}
+	return available, nil
+}
@@ -3,8 +3,10 @@ package service
 import (
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/repository"
 )
 
 type atomicProductRepo struct {
@@ -110,3 +112,132 @@ func TestInventoryServiceAdjustStockFailsWhenAtomicUpdateFails(t *testing.T) {
 		t.Fatalf("expected no inventory log on failure")
 	}
 }
+
+type fakeReservationRepo struct {
+	stock        map[int64]int
+	reservations []*domain.StockReservation
+	releasedAt   time.Time
+}
+
+func (f *fakeReservationRepo) ReplaceForSession(sessionID string, reservations []*domain.StockReservation) error {
+	for _, reservation := range reservations {
+		reserved, _ := f.SumActiveByProduct(reservation.ProductID, sessionID)
+		if f.stock[reservation.ProductID]-reserved < reservation.Quantity {
+			return &repository.InsufficientStockError{SKU: reservation.SKU}
+		}
+	}
+	kept := f.reservations[:0]
+	for _, existing := range f.reservations {
+		if existing.CheckoutSessionID != sessionID || existing.Status == "converted" {
+			kept = append(kept, existing)
+		}
+	}
+	f.reservations = kept
+	for _, reservation := range reservations {
+		reservation.CheckoutSessionID = sessionID
+		reservation.Status = "active"
+		f.reservations = append(f.reservations, reservation)
+	}
+	return nil
+}
+
+func (f *fakeReservationRepo) ListBySession(sessionID string) ([]*domain.StockReservation, error) {
+	var result []*domain.StockReservation
+	for _, reservation := range f.reservations {
+		if reservation.CheckoutSessionID == sessionID {
+			result = append(result, reservation)
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeReservationRepo) ReleaseBySession(sessionID string) error {
+	return f.setStatus(sessionID, "released", nil)
+}
+
+func (f *fakeReservationRepo) ConvertBySession(sessionID string, orderID int64) error {
+	return f.setStatus(sessionID, "converted", &orderID)
+}
+
+func (f *fakeReservationRepo) setStatus(sessionID, status string, orderID *int64) error {
+	for _, reservation := range f.reservations {
+		if reservation.CheckoutSessionID == sessionID && reservation.Status == "active" {
+			reservation.Status = status
+			reservation.OrderID = orderID
+		}
+	}
+	return nil
+}
+
+func (f *fakeReservationRepo) ReleaseExpired(now time.Time) (int64, error) {
+	f.releasedAt = now
+	var released int64
+	for _, reservation := range f.reservations {
+		if reservation.Status == "active" && !reservation.ExpiresAt.After(now) {
+			reservation.Status = "released"
+			released++
+		}
+	}
+	return released, nil
+}
+
+func (f *fakeReservationRepo) SumActiveByProduct(productID int64, excludeSessionID string) (int, error) {
+	total := 0
+	now := time.Now()
+	for _, reservation := range f.reservations {
+		if reservation.ProductID == productID && reservation.Status == "active" &&
+			reservation.ExpiresAt.After(now) && reservation.CheckoutSessionID != excludeSessionID {
+			total += reservation.Quantity
+		}
+	}
+	return total, nil
+}
+
+func TestInventoryServiceReserveCountsOtherSessions(t *testing.T) {
+	productRepo := &fakeProductRepo{products: map[int64]*domain.Product{
+		1: {ID: 1, SKU: "sku_1", StockQuantity: 5, Status: 1},
+	}}
+	reservationRepo := &fakeReservationRepo{stock: map[int64]int{1: 5}}
+	svc := NewInventoryService(productRepo, &fakeInventoryRepo{})
+	svc.SetReservationRepo(reservationRepo)
+
+	if err := svc.ReserveForCheckout("chk_a", []StockReservationItem{{SKU: "sku_1", Quantity: 2}, {SKU: "sku_1", Quantity: 1}}, time.Minute); err != nil {
+		t.Fatalf("expected reservation to succeed, got %v", err)
+	}
+	err := svc.ReserveForCheckout("chk_b", []StockReservationItem{{SKU: "sku_1", Quantity: 3}}, time.Minute)
+	var stockErr *repository.InsufficientStockError
+	if !errors.As(err, &stockErr) || stockErr.SKU != "sku_1" {
+		t.Fatalf("expected insufficient stock for sku_1, got %v", err)
+	}
+	available, err := svc.AvailableStock(1)
+	if err != nil || available != 2 {
+		t.Fatalf("expected 2 available, got %d (%v)", available, err)
+	}
+
+	if err := svc.ReleaseReservations("chk_a"); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if err := svc.ReserveForCheckout("chk_b", []StockReservationItem{{SKU: "sku_1", Quantity: 3}}, time.Minute); err != nil {
+		t.Fatalf("expected reservation after release to succeed, got %v", err)
+	}
+}
+
+func TestInventoryServiceReleaseExpiredReservations(t *testing.T) {
+	productRepo := &fakeProductRepo{products: map[int64]*domain.Product{
+		1: {ID: 1, SKU: "sku_1", StockQuantity: 5, Status: 1},
+	}}
+	reservationRepo := &fakeReservationRepo{stock: map[int64]int{1: 5}}
+	svc := NewInventoryService(productRepo, &fakeInventoryRepo{})
+	svc.SetReservationRepo(reservationRepo)
+
+	if err := svc.ReserveForCheckout("chk_a", []StockReservationItem{{SKU: "sku_1", Quantity: 5}}, -time.Second); err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	released, err := svc.ReleaseExpiredReservations()
+	if err != nil || released != 1 {
+		t.Fatalf("expected one released hold, got %d (%v)", released, err)
+	}
+	if reservationRepo.reservations[0].Status != "released" {
+		t.Fatalf("expected released status, got %s", reservationRepo.reservations[0].Status)
+	}
+}
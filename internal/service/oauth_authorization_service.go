@@ -0,0 +1,190 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/repository"
+)
+
+// OAuthCodeTTL bounds how long an authorization code can be exchanged.
+const OAuthCodeTTL = 5 * time.Minute
+
+// The error strings are the OAuth 2.0 error codes handlers report.
+var (
+	ErrOAuthInvalidClient           = errors.New("invalid_client")
+	ErrOAuthInvalidRedirectURI      = errors.New("invalid_redirect_uri")
+	ErrOAuthUnsupportedResponseType = errors.New("unsupported_response_type")
+	ErrOAuthInvalidRequest          = errors.New("invalid_request")
+	ErrOAuthInvalidScope            = errors.New("invalid_scope")
+	ErrOAuthInvalidGrant            = errors.New("invalid_grant")
+)
+
+// OAuthAuthorizeRequest carries the authorization endpoint parameters.
+type OAuthAuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// OAuthAuthorizationService runs the authorization code flow: it validates
+// authorization requests against the registered client, issues PKCE-bound
+// codes for a consenting shopper and consumes them at the token endpoint.
+type OAuthAuthorizationService struct {
+	clients repository.OAuthClientRepository
+	codes   repository.OAuthAuthorizationCodeRepository
+}
+
+func NewOAuthAuthorizationService(clients repository.OAuthClientRepository, codes repository.OAuthAuthorizationCodeRepository) *OAuthAuthorizationService {
+	return &OAuthAuthorizationService{clients: clients, codes: codes}
+}
+
+// Validate checks req and returns the scope it grants: the requested scopes,
+// or all of the client's when none are requested. ErrOAuthInvalidClient and
+// ErrOAuthInvalidRedirectURI mean the redirect URI cannot be trusted with the
+// error; the other errors may be reported to it.
+func (s *OAuthAuthorizationService) Validate(req OAuthAuthorizeRequest) (string, error) {
+	if s == nil || s.clients == nil {
+		return "", errors.New("oauth_client_repo_unavailable")
+	}
+	client, err := s.clients.FindByClientID(req.ClientID)
+	if err != nil || client == nil || client.Status != "active" {
+		return "", ErrOAuthInvalidClient
+	}
+	if req.RedirectURI == "" || !containsField(client.RedirectURIs, req.RedirectURI) {
+		return "", ErrOAuthInvalidRedirectURI
+	}
+	if req.ResponseType != "code" {
+		return "", ErrOAuthUnsupportedResponseType
+	}
+	if req.CodeChallengeMethod != "S256" || req.CodeChallenge == "" {
+		return "", ErrOAuthInvalidRequest
+	}
+	return GrantedOAuthScope(client.Scopes, req.Scope)
+}
+
+// GrantedOAuthScope narrows allowed to the requested scopes, or grants all of
+// allowed when none are requested. Asking for anything outside allowed is
+// ErrOAuthInvalidScope.
+func GrantedOAuthScope(allowed, requested string) (string, error) {
+	scopes := strings.Fields(requested)
+	if len(scopes) == 0 {
+		scopes = oauthListFields(allowed)
+	}
+	for _, scope := range scopes {
+		if !containsField(allowed, scope) {
+			return "", ErrOAuthInvalidScope
+		}
+	}
+	if len(scopes) == 0 {
+		return "", ErrOAuthInvalidScope
+	}
+	return strings.Join(scopes, " "), nil
+}
+
+// Approve issues a code for the shopper userID after they consented to req.
+func (s *OAuthAuthorizationService) Approve(req OAuthAuthorizeRequest, userID int64) (string, error) {
+	if userID <= 0 {
+		return "", errors.New("user_required")
+	}
+	scope, err := s.Validate(req)
+	if err != nil {
+		return "", err
+	}
+	if s.codes == nil {
+		return "", errors.New("oauth_code_repo_unavailable")
+	}
+	code, err := randomOAuthCode()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	if err := s.codes.Create(&domain.OAuthAuthorizationCode{
+		Code:                code,
+		ClientID:            req.ClientID,
+		UserID:              userID,
+		RedirectURI:         req.RedirectURI,
+		Scopes:              scope,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		ExpiresAt:           now.Add(OAuthCodeTTL),
+		CreatedAt:           now,
+	}); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// Exchange consumes code for the authenticated clientID. The redirect URI
+// must match the one the code was issued for and codeVerifier must satisfy
+// its S256 challenge. Any mismatch, reuse or expiry is ErrOAuthInvalidGrant.
+func (s *OAuthAuthorizationService) Exchange(clientID, code, redirectURI, codeVerifier string) (*domain.OAuthAuthorizationCode, error) {
+	if s == nil || s.codes == nil {
+		return nil, errors.New("oauth_code_repo_unavailable")
+	}
+	grant, err := s.codes.FindByCode(code)
+	if err != nil || grant == nil {
+		return nil, ErrOAuthInvalidGrant
+	}
+	now := time.Now()
+	if grant.ClientID != clientID || grant.RedirectURI != redirectURI || grant.UsedAt != nil || !now.Before(grant.ExpiresAt) {
+		return nil, ErrOAuthInvalidGrant
+	}
+	if !verifyPKCE(grant.CodeChallenge, codeVerifier) {
+		return nil, ErrOAuthInvalidGrant
+	}
+	consumed, err := s.codes.MarkUsed(grant.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		return nil, ErrOAuthInvalidGrant
+	}
+	grant.UsedAt = &now
+	return grant, nil
+}
+
+// verifyPKCE checks an RFC 7636 S256 code verifier against its challenge.
+func verifyPKCE(challenge, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+func randomOAuthCode() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// oauthListFields splits a stored scope or redirect URI list, which may be
+// space or comma separated.
+func oauthListFields(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+}
+
+func containsField(list, value string) bool {
+	for _, item := range oauthListFields(list) {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/meowucp/internal/domain"
+)
+
+type fakeOAuthCodeRepo struct {
+	items map[string]*domain.OAuthAuthorizationCode
+}
+
+func (f *fakeOAuthCodeRepo) Create(code *domain.OAuthAuthorizationCode) error {
+	code.ID = int64(len(f.items) + 1)
+	f.items[code.Code] = code
+	return nil
+}
+
+func (f *fakeOAuthCodeRepo) FindByCode(code string) (*domain.OAuthAuthorizationCode, error) {
+	if item, ok := f.items[code]; ok {
+		copied := *item
+		return &copied, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func (f *fakeOAuthCodeRepo) MarkUsed(id int64, usedAt time.Time) (bool, error) {
+	for _, item := range f.items {
+		if item.ID == id && item.UsedAt == nil {
+			item.UsedAt = &usedAt
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type fakeOAuthAgentRepo struct {
+	fakeSubscriptionClientRepo
+}
+
+func (fakeOAuthAgentRepo) FindByClientID(clientID string) (*domain.OAuthClient, error) {
+	return &domain.OAuthClient{
+		ClientID:     clientID,
+		Scopes:       "ucp:scopes:checkout_session",
+		Status:       "active",
+		RedirectURIs: "https://a.example/cb https://a.example/alt",
+	}, nil
+}
+
+func TestOAuthAuthorizationExchangeBindsCode(t *testing.T) {
+	codes := &fakeOAuthCodeRepo{items: map[string]*domain.OAuthAuthorizationCode{}}
+	svc := NewOAuthAuthorizationService(fakeOAuthAgentRepo{}, codes)
+
+	verifier := "M25iVXpKU3puUjFaYWg3T1NDTDQtcW1ROUY5YXlwalNoc0hhakxifmZHag"
+	sum := sha256.Sum256([]byte(verifier))
+	req := OAuthAuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            "agent-a",
+		RedirectURI:         "https://a.example/cb",
+		CodeChallenge:       base64.RawURLEncoding.EncodeToString(sum[:]),
+		CodeChallengeMethod: "S256",
+	}
+
+	if _, err := svc.Approve(req, 0); err == nil {
+		t.Fatalf("expected approval without a shopper to fail")
+	}
+	code, err := svc.Approve(req, 9)
+	if err != nil {
+		t.Fatalf("approve: %v", err)
+	}
+	if codes.items[code].Scopes != "ucp:scopes:checkout_session" {
+		t.Fatalf("expected the client's scopes by default, got %q", codes.items[code].Scopes)
+	}
+
+	if _, err := svc.Exchange("agent-b", code, req.RedirectURI, verifier); !errors.Is(err, ErrOAuthInvalidGrant) {
+		t.Fatalf("expected another client to be refused, got %v", err)
+	}
+	if _, err := svc.Exchange("agent-a", code, "https://a.example/alt", verifier); !errors.Is(err, ErrOAuthInvalidGrant) {
+		t.Fatalf("expected a different redirect uri to be refused, got %v", err)
+	}
+
+	codes.items[code].ExpiresAt = time.Now().Add(-time.Second)
+	if _, err := svc.Exchange("agent-a", code, req.RedirectURI, verifier); !errors.Is(err, ErrOAuthInvalidGrant) {
+		t.Fatalf("expected an expired code to be refused, got %v", err)
+	}
+
+	codes.items[code].ExpiresAt = time.Now().Add(OAuthCodeTTL)
+	grant, err := svc.Exchange("agent-a", code, req.RedirectURI, verifier)
+	if err != nil || grant.UserID != 9 {
+		t.Fatalf("expected exchange for shopper 9, got %+v %v", grant, err)
+	}
+	if _, err := svc.Exchange("agent-a", code, req.RedirectURI, verifier); !errors.Is(err, ErrOAuthInvalidGrant) {
+		t.Fatalf("expected a used code to be refused, got %v", err)
+	}
+}
@@ -2,6 +2,8 @@ package service
 
 import (
 	"errors"
+	"net/url"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -10,6 +12,12 @@ import (
 	"github.com/meowucp/internal/repository"
 )
 
+var (
+	ErrOAuthClientNotFound           = errors.New("oauth_client_not_found")
+	ErrOAuthClientInvalidURL         = errors.New("oauth_client_invalid_jwk_set_url")
+	ErrOAuthClientInvalidRedirectURI = errors.New("oauth_client_invalid_redirect_uri")
+)
+
 type OAuthClientService struct {
 	repo repository.OAuthClientRepository
 }
@@ -18,13 +26,21 @@ func NewOAuthClientService(repo repository.OAuthClientRepository) *OAuthClientSe
 	return &OAuthClientService{repo: repo}
 }
 
-func (s *OAuthClientService) Create(clientID, secret, scopes string) (*domain.OAuthClient, error) {
+// Create registers a client. redirectURIs are the only URIs authorization
+// codes will be sent to and must be absolute without a fragment.
+func (s *OAuthClientService) Create(clientID, secret, scopes string, redirectURIs []string) (*domain.OAuthClient, error) {
 	if s == nil || s.repo == nil {
 		return nil, errors.New("oauth_client_repo_unavailable")
 	}
 	if clientID == "" || secret == "" {
 		return nil, errors.New("missing_client_credentials")
 	}
+	for _, uri := range redirectURIs {
+		parsed, err := url.Parse(uri)
+		if err != nil || !parsed.IsAbs() || parsed.Fragment != "" || strings.ContainsAny(uri, " ,") {
+			return nil, ErrOAuthClientInvalidRedirectURI
+		}
+	}
 	secretHash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, err
@@ -35,6 +51,8 @@ func (s *OAuthClientService) Create(clientID, secret, scopes string) (*domain.OA
 		Scopes:     scopes,
 		Status:     "active",
 		CreatedAt:  time.Now(),
+
+		RedirectURIs: strings.Join(redirectURIs, " "),
 	}
 	if err := s.repo.Create(client); err != nil {
 		return nil, err
@@ -56,3 +74,31 @@ func (s *OAuthClientService) List(offset, limit int) ([]*domain.OAuthClient, int
 	}
 	return items, count, nil
 }
+
+// SetJWKS registers where the client publishes its webhook signing keys. An
+// empty jwkSetURL clears it; cacheSeconds <= 0 uses the verifier's default TTL.
+func (s *OAuthClientService) SetJWKS(clientID, jwkSetURL string, cacheSeconds int) (*domain.OAuthClient, error) {
+	if s == nil || s.repo == nil {
+		return nil, errors.New("oauth_client_repo_unavailable")
+	}
+	client, err := s.repo.FindByClientID(clientID)
+	if err != nil || client == nil {
+		return nil, ErrOAuthClientNotFound
+	}
+	jwkSetURL = strings.TrimSpace(jwkSetURL)
+	if jwkSetURL != "" {
+		parsed, err := url.Parse(jwkSetURL)
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			return nil, ErrOAuthClientInvalidURL
+		}
+	}
+	if cacheSeconds < 0 {
+		cacheSeconds = 0
+	}
+	client.JWKSetURL = jwkSetURL
+	client.JWKSCacheSeconds = cacheSeconds
+	if err := s.repo.Update(client); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
@@ -0,0 +1,41 @@
+package service
+
+// Scopes UCP routes require of OAuth access tokens. The checkout session
+// scope covers reading as well as creating and changing sessions.
+const (
+	OAuthScopeCheckoutSession     = "ucp:scopes:checkout_session"
+	OAuthScopeCheckoutSessionRead = "ucp:scopes:checkout_session:read"
+	OAuthScopeOrderRead           = "ucp:scopes:order:read"
+)
+
+// OAuthScopeTokenIntrospect lets a client introspect tokens issued to other
+// clients. It is assigned by an administrator, never requested, so it is not
+// advertised.
+const OAuthScopeTokenIntrospect = "ucp:scopes:token_introspection"
+
+// OAuthScopesSupported lists the scopes advertised in server metadata.
+var OAuthScopesSupported = []string{
+	OAuthScopeCheckoutSession,
+	OAuthScopeCheckoutSessionRead,
+	OAuthScopeOrderRead,
+}
+
+var oauthScopeImplies = map[string][]string{
+	OAuthScopeCheckoutSession: {OAuthScopeCheckoutSessionRead},
+}
+
+// OAuthScopeSatisfies reports whether the granted scope list includes
+// required, directly or through a broader scope.
+func OAuthScopeSatisfies(granted, required string) bool {
+	for _, scope := range oauthListFields(granted) {
+		if scope == required {
+			return true
+		}
+		for _, implied := range oauthScopeImplies[scope] {
+			if implied == required {
+				return true
+			}
+		}
+	}
+	return false
+}
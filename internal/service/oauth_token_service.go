@@ -1,16 +1,38 @@
 package service
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"strconv"
 	"time"
 
 	"github.com/meowucp/internal/domain"
 	"github.com/meowucp/internal/repository"
 )
 
+// OAuthRefreshTokenTTL bounds a refresh token chain link; every rotation
+// starts a new one.
+const OAuthRefreshTokenTTL = 30 * 24 * time.Hour
+
+var ErrOAuthTokenInvalid = errors.New("invalid_token")
+
 type OAuthTokenService struct {
-	clientRepo repository.OAuthClientRepository
-	tokenRepo  repository.OAuthTokenRepository
+	clientRepo  repository.OAuthClientRepository
+	tokenRepo   repository.OAuthTokenRepository
+	refreshRepo repository.OAuthRefreshTokenRepository
+}
+
+// OAuthIntrospection is an RFC 7662 introspection response. Inactive tokens
+// report only Active.
+type OAuthIntrospection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
 }
 
 func NewOAuthTokenService(clientRepo repository.OAuthClientRepository, tokenRepo repository.OAuthTokenRepository) *OAuthTokenService {
@@ -33,9 +55,214 @@ func (s *OAuthTokenService) IssueToken(clientID, scopes string, expiresAt time.T
 	return item, nil
 }
 
+// SetRefreshTokens enables refresh token issuance and rotation.
+func (s *OAuthTokenService) SetRefreshTokens(repo repository.OAuthRefreshTokenRepository) {
+	s.refreshRepo = repo
+}
+
+// Revoke revokes an access token, or a refresh token together with the rest
+// of its chain.
 func (s *OAuthTokenService) Revoke(token string) error {
 	if s == nil || s.tokenRepo == nil {
 		return errors.New("oauth_token_repo_unavailable")
 	}
-	return s.tokenRepo.Revoke(token, time.Now())
+	now := time.Now()
+	if s.refreshRepo != nil {
+		if item, err := s.refreshRepo.FindByHash(hashOAuthToken(token)); err == nil && item != nil {
+			return s.revokeFamily(item.FamilyID, now)
+		}
+	}
+	return s.tokenRepo.Revoke(token, now)
+}
+
+// IssueRefreshToken starts a new refresh token chain when familyID is empty,
+// or continues familyID. It returns the token, which is only stored hashed,
+// and its record.
+func (s *OAuthTokenService) IssueRefreshToken(clientID string, userID *int64, scopes, familyID string) (string, *domain.OAuthRefreshToken, error) {
+	if s == nil || s.refreshRepo == nil {
+		return "", nil, errors.New("oauth_refresh_repo_unavailable")
+	}
+	token, item, err := newOAuthRefreshToken(clientID, userID, scopes, familyID)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := s.refreshRepo.Create(item); err != nil {
+		return "", nil, err
+	}
+	return token, item, nil
+}
+
+// OAuthAccessTokenMinter builds, without storing, the access token issued
+// for scope alongside a rotated refresh token.
+type OAuthAccessTokenMinter func(scope string, userID *int64) (*domain.OAuthToken, error)
+
+// OAuthRefreshGrant is the outcome of a rotation: the new refresh token, its
+// record and the access token issued with it.
+type OAuthRefreshGrant struct {
+	RefreshToken string
+	Refresh      *domain.OAuthRefreshToken
+	Access       *domain.OAuthToken
+}
+
+// RotateRefreshToken consumes token for clientID and issues the next link of
+// its chain with an access token from mint, narrowed to requestedScope when
+// one is given. The scope is checked before the token is consumed, and the
+// consumed token, its successor and the access token are stored together.
+// A token that was already rotated is a sign of theft: the whole family,
+// refresh and access tokens, is revoked. A scope wider than the original
+// grant is ErrOAuthInvalidScope; every other failure is ErrOAuthInvalidGrant.
+func (s *OAuthTokenService) RotateRefreshToken(clientID, token, requestedScope string, mint OAuthAccessTokenMinter) (*OAuthRefreshGrant, error) {
+	if s == nil || s.refreshRepo == nil || mint == nil {
+		return nil, errors.New("oauth_refresh_repo_unavailable")
+	}
+	item, err := s.refreshRepo.FindByHash(hashOAuthToken(token))
+	if err != nil || item == nil || item.ClientID != clientID {
+		return nil, ErrOAuthInvalidGrant
+	}
+	now := time.Now()
+	if item.RevokedAt != nil || !now.Before(item.ExpiresAt) {
+		return nil, ErrOAuthInvalidGrant
+	}
+	if item.UsedAt != nil {
+		if err := s.revokeFamily(item.FamilyID, now); err != nil {
+			return nil, err
+		}
+		return nil, ErrOAuthInvalidGrant
+	}
+	scope, err := GrantedOAuthScope(item.Scopes, requestedScope)
+	if err != nil {
+		return nil, ErrOAuthInvalidScope
+	}
+
+	nextToken, next, err := newOAuthRefreshToken(clientID, item.UserID, scope, item.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	access, err := mint(scope, item.UserID)
+	if err != nil {
+		return nil, err
+	}
+	access.FamilyID = item.FamilyID
+	rotated, err := s.refreshRepo.Rotate(item.ID, now, next, access)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		if err := s.revokeFamily(item.FamilyID, now); err != nil {
+			return nil, err
+		}
+		return nil, ErrOAuthInvalidGrant
+	}
+	return &OAuthRefreshGrant{RefreshToken: nextToken, Refresh: next, Access: access}, nil
+}
+
+func newOAuthRefreshToken(clientID string, userID *int64, scopes, familyID string) (string, *domain.OAuthRefreshToken, error) {
+	token, err := randomOAuthCode()
+	if err != nil {
+		return "", nil, err
+	}
+	if familyID == "" {
+		if familyID, err = randomOAuthCode(); err != nil {
+			return "", nil, err
+		}
+	}
+	now := time.Now()
+	return token, &domain.OAuthRefreshToken{
+		TokenHash: hashOAuthToken(token),
+		FamilyID:  familyID,
+		ClientID:  clientID,
+		UserID:    userID,
+		Scopes:    scopes,
+		ExpiresAt: now.Add(OAuthRefreshTokenTTL),
+		CreatedAt: now,
+	}, nil
+}
+
+// Introspect reports whether token is a live access or refresh token. A
+// caller sees only its own tokens unless it holds OAuthScopeTokenIntrospect;
+// anyone else's are reported inactive.
+func (s *OAuthTokenService) Introspect(caller *domain.OAuthClient, token string) (*OAuthIntrospection, error) {
+	if s == nil || s.tokenRepo == nil {
+		return nil, errors.New("oauth_token_repo_unavailable")
+	}
+	if caller == nil {
+		return &OAuthIntrospection{}, nil
+	}
+	result, err := s.introspect(token)
+	if err != nil {
+		return nil, err
+	}
+	if result.Active && result.ClientID != caller.ClientID && !containsField(caller.Scopes, OAuthScopeTokenIntrospect) {
+		return &OAuthIntrospection{}, nil
+	}
+	return result, nil
+}
+
+func (s *OAuthTokenService) introspect(token string) (*OAuthIntrospection, error) {
+	now := time.Now()
+	if item, err := s.tokenRepo.FindByToken(token); err == nil && item != nil {
+		if item.RevokedAt != nil || !now.Before(item.ExpiresAt) {
+			return &OAuthIntrospection{}, nil
+		}
+		return &OAuthIntrospection{
+			Active:    true,
+			Scope:     item.Scopes,
+			ClientID:  item.ClientID,
+			Subject:   oauthSubject(item.UserID),
+			TokenType: "Bearer",
+			ExpiresAt: item.ExpiresAt.Unix(),
+		}, nil
+	}
+	if s.refreshRepo != nil {
+		if item, err := s.refreshRepo.FindByHash(hashOAuthToken(token)); err == nil && item != nil {
+			if item.RevokedAt != nil || item.UsedAt != nil || !now.Before(item.ExpiresAt) {
+				return &OAuthIntrospection{}, nil
+			}
+			return &OAuthIntrospection{
+				Active:    true,
+				Scope:     item.Scopes,
+				ClientID:  item.ClientID,
+				Subject:   oauthSubject(item.UserID),
+				TokenType: "refresh_token",
+				ExpiresAt: item.ExpiresAt.Unix(),
+				IssuedAt:  item.CreatedAt.Unix(),
+			}, nil
+		}
+	}
+	return &OAuthIntrospection{}, nil
+}
+
+func (s *OAuthTokenService) revokeFamily(familyID string, at time.Time) error {
+	if err := s.refreshRepo.RevokeFamily(familyID, at); err != nil {
+		return err
+	}
+	return s.tokenRepo.RevokeFamily(familyID, at)
+}
+
+func hashOAuthToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func oauthSubject(userID *int64) string {
+	if userID == nil {
+		return ""
+	}
+	return strconv.FormatInt(*userID, 10)
+}
+
+// ClientForToken returns the active client a live bearer token was issued to.
+func (s *OAuthTokenService) ClientForToken(token string) (*domain.OAuthClient, error) {
+	if s == nil || s.tokenRepo == nil || s.clientRepo == nil {
+		return nil, errors.New("oauth_token_repo_unavailable")
+	}
+	item, err := s.tokenRepo.FindByToken(token)
+	if err != nil || item == nil || item.RevokedAt != nil || !time.Now().Before(item.ExpiresAt) {
+		return nil, ErrOAuthTokenInvalid
+	}
+	client, err := s.clientRepo.FindByClientID(item.ClientID)
+	if err != nil || client == nil || client.Status != "active" {
+		return nil, ErrOAuthTokenInvalid
+	}
+	return client, nil
 }
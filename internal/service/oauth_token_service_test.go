@@ -0,0 +1,208 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/meowucp/internal/domain"
+)
+
+type fakeOAuthAccessTokenRepo struct {
+	items map[string]*domain.OAuthToken
+}
+
+func (f *fakeOAuthAccessTokenRepo) Create(token *domain.OAuthToken) error {
+	f.items[token.Token] = token
+	return nil
+}
+
+func (f *fakeOAuthAccessTokenRepo) FindByToken(token string) (*domain.OAuthToken, error) {
+	if item, ok := f.items[token]; ok {
+		copied := *item
+		return &copied, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func (f *fakeOAuthAccessTokenRepo) Revoke(token string, revokedAt time.Time) error {
+	if item, ok := f.items[token]; ok {
+		item.RevokedAt = &revokedAt
+	}
+	return nil
+}
+
+func (f *fakeOAuthAccessTokenRepo) RevokeFamily(familyID string, revokedAt time.Time) error {
+	for _, item := range f.items {
+		if item.FamilyID == familyID && item.RevokedAt == nil {
+			item.RevokedAt = &revokedAt
+		}
+	}
+	return nil
+}
+
+type fakeOAuthRefreshRepo struct {
+	items  map[string]*domain.OAuthRefreshToken
+	access *fakeOAuthAccessTokenRepo
+}
+
+func (f *fakeOAuthRefreshRepo) Create(token *domain.OAuthRefreshToken) error {
+	token.ID = int64(len(f.items) + 1)
+	f.items[token.TokenHash] = token
+	return nil
+}
+
+func (f *fakeOAuthRefreshRepo) FindByHash(tokenHash string) (*domain.OAuthRefreshToken, error) {
+	if item, ok := f.items[tokenHash]; ok {
+		copied := *item
+		return &copied, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func (f *fakeOAuthRefreshRepo) Rotate(id int64, usedAt time.Time, next *domain.OAuthRefreshToken, access *domain.OAuthToken) (bool, error) {
+	for _, item := range f.items {
+		if item.ID == id && item.UsedAt == nil {
+			item.UsedAt = &usedAt
+			if f.access != nil && access != nil {
+				f.access.Create(access)
+			}
+			return true, f.Create(next)
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeOAuthRefreshRepo) Revoke(tokenHash string, revokedAt time.Time) error {
+	if item, ok := f.items[tokenHash]; ok {
+		item.RevokedAt = &revokedAt
+	}
+	return nil
+}
+
+func (f *fakeOAuthRefreshRepo) RevokeFamily(familyID string, revokedAt time.Time) error {
+	for _, item := range f.items {
+		if item.FamilyID == familyID && item.RevokedAt == nil {
+			item.RevokedAt = &revokedAt
+		}
+	}
+	return nil
+}
+
+func newTestOAuthTokenService() (*OAuthTokenService, *fakeOAuthAccessTokenRepo) {
+	tokens := &fakeOAuthAccessTokenRepo{items: map[string]*domain.OAuthToken{}}
+	svc := NewOAuthTokenService(fakeOAuthAgentRepo{}, tokens)
+	svc.SetRefreshTokens(&fakeOAuthRefreshRepo{items: map[string]*domain.OAuthRefreshToken{}, access: tokens})
+	return svc, tokens
+}
+
+func testAccessMinter(clientID string) OAuthAccessTokenMinter {
+	count := 0
+	return func(scope string, userID *int64) (*domain.OAuthToken, error) {
+		count++
+		return &domain.OAuthToken{Token: clientID + ":access-" + string(rune('0'+count)), ClientID: clientID, UserID: userID, Scopes: scope, ExpiresAt: time.Now().Add(time.Hour)}, nil
+	}
+}
+
+func TestOAuthRefreshTokenRotationDetectsReuse(t *testing.T) {
+	svc, tokens := newTestOAuthTokenService()
+	userID := int64(9)
+	mint := testAccessMinter("agent-a")
+
+	first, issued, err := svc.IssueRefreshToken("agent-a", &userID, "ucp:scopes:checkout_session", "")
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	tokens.Create(&domain.OAuthToken{Token: "access-1", ClientID: "agent-a", FamilyID: issued.FamilyID, ExpiresAt: time.Now().Add(time.Hour)})
+
+	if _, err := svc.RotateRefreshToken("agent-b", first, "", mint); !errors.Is(err, ErrOAuthInvalidGrant) {
+		t.Fatalf("expected another client to be refused, got %v", err)
+	}
+	grant, err := svc.RotateRefreshToken("agent-a", first, "", mint)
+	if err != nil || grant.Refresh.FamilyID != issued.FamilyID || *grant.Refresh.UserID != 9 || grant.RefreshToken == first {
+		t.Fatalf("expected a new token in the same family, got %+v %v", grant, err)
+	}
+	if stored := tokens.items[grant.Access.Token]; stored == nil || stored.FamilyID != issued.FamilyID {
+		t.Fatalf("expected the access token to be stored with the rotation, got %+v", stored)
+	}
+	second := grant.RefreshToken
+
+	if _, err := svc.RotateRefreshToken("agent-a", first, "", mint); !errors.Is(err, ErrOAuthInvalidGrant) {
+		t.Fatalf("expected reuse to be refused, got %v", err)
+	}
+	if _, err := svc.RotateRefreshToken("agent-a", second, "", mint); !errors.Is(err, ErrOAuthInvalidGrant) {
+		t.Fatalf("expected reuse to revoke the rest of the family, got %v", err)
+	}
+	if tokens.items["access-1"].RevokedAt == nil {
+		t.Fatalf("expected reuse to revoke the family's access tokens")
+	}
+}
+
+func TestOAuthRefreshTokenChecksScopeBeforeRotating(t *testing.T) {
+	svc, _ := newTestOAuthTokenService()
+	userID := int64(9)
+	mint := testAccessMinter("agent-a")
+
+	token, _, err := svc.IssueRefreshToken("agent-a", &userID, OAuthScopeCheckoutSession+" "+OAuthScopeOrderRead, "")
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	if _, err := svc.RotateRefreshToken("agent-a", token, OAuthScopeTokenIntrospect, mint); !errors.Is(err, ErrOAuthInvalidScope) {
+		t.Fatalf("expected a wider scope to be refused, got %v", err)
+	}
+	grant, err := svc.RotateRefreshToken("agent-a", token, OAuthScopeOrderRead, mint)
+	if err != nil {
+		t.Fatalf("expected the refused request to leave the token usable, got %v", err)
+	}
+	if grant.Access.Scopes != OAuthScopeOrderRead || grant.Refresh.Scopes != OAuthScopeOrderRead {
+		t.Fatalf("expected the narrower scope, got %+v", grant)
+	}
+}
+
+func TestOAuthIntrospectHonorsRevocationAndExpiry(t *testing.T) {
+	svc, tokens := newTestOAuthTokenService()
+	agentA := &domain.OAuthClient{ClientID: "agent-a", Scopes: OAuthScopeCheckoutSession}
+	userID := int64(9)
+	tokens.Create(&domain.OAuthToken{Token: "access-1", ClientID: "agent-a", UserID: &userID, Scopes: "ucp:scopes:checkout_session", ExpiresAt: time.Now().Add(time.Hour)})
+	refresh, _, err := svc.IssueRefreshToken("agent-a", &userID, "ucp:scopes:checkout_session", "")
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+
+	result, err := svc.Introspect(agentA, "access-1")
+	if err != nil || !result.Active || result.ClientID != "agent-a" || result.Subject != "9" {
+		t.Fatalf("expected an active access token, got %+v %v", result, err)
+	}
+	result, err = svc.Introspect(agentA, refresh)
+	if err != nil || !result.Active || result.TokenType != "refresh_token" {
+		t.Fatalf("expected an active refresh token, got %+v %v", result, err)
+	}
+	if result, _ := svc.Introspect(agentA, "unknown"); result.Active {
+		t.Fatalf("expected an unknown token to be inactive")
+	}
+
+	tokens.items["access-1"].ExpiresAt = time.Now().Add(-time.Second)
+	if result, _ := svc.Introspect(agentA, "access-1"); result.Active {
+		t.Fatalf("expected an expired token to be inactive")
+	}
+	if err := svc.Revoke(refresh); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if result, _ := svc.Introspect(agentA, refresh); result.Active || result.ClientID != "" {
+		t.Fatalf("expected a revoked token to report only inactive, got %+v", result)
+	}
+}
+
+func TestOAuthIntrospectHidesOtherClientsTokens(t *testing.T) {
+	svc, tokens := newTestOAuthTokenService()
+	tokens.Create(&domain.OAuthToken{Token: "access-1", ClientID: "agent-a", Scopes: OAuthScopeCheckoutSession, ExpiresAt: time.Now().Add(time.Hour)})
+
+	other := &domain.OAuthClient{ClientID: "agent-b", Scopes: OAuthScopeCheckoutSession}
+	if result, err := svc.Introspect(other, "access-1"); err != nil || result.Active || result.ClientID != "" {
+		t.Fatalf("expected another client's token to be reported inactive, got %+v %v", result, err)
+	}
+	introspector := &domain.OAuthClient{ClientID: "gateway", Scopes: OAuthScopeTokenIntrospect}
+	if result, err := svc.Introspect(introspector, "access-1"); err != nil || !result.Active || result.ClientID != "agent-a" {
+		t.Fatalf("expected the introspection scope to see any token, got %+v %v", result, err)
+	}
+}
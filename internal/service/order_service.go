@@ -8,6 +8,7 @@ import (
 	"github.com/jinzhu/gorm"
 	"github.com/meowucp/internal/domain"
 	"github.com/meowucp/internal/repository"
+	"github.com/meowucp/pkg/money"
 )
 
 type OrderService struct {
@@ -19,6 +20,7 @@ type OrderService struct {
 	webhookQueue    *WebhookQueueService
 	shipmentRepo    repository.ShipmentRepository
 	statusLogRepo   repository.OrderStatusLogRepository
+	reservationRepo repository.StockReservationRepository
 }
 
 func NewOrderService(orderRepo repository.OrderRepository, cartRepo repository.CartRepository, productRepo repository.ProductRepository, inventoryRepo repository.InventoryRepository, idempotencyRepo repository.OrderIdempotencyRepository) *OrderService {
@@ -43,12 +45,36 @@ func (s *OrderService) SetStatusLogRepo(repo repository.OrderStatusLogRepository
 	s.statusLogRepo = repo
 }
 
+func (s *OrderService) SetReservationRepo(repo repository.StockReservationRepository) {
+	s.reservationRepo = repo
+}
+
 type orderTransactionRunner interface {
 	Transaction(fn func(orderRepo repository.OrderRepository, cartRepo repository.CartRepository, productRepo repository.ProductRepository, inventoryRepo repository.InventoryRepository, idempotencyRepo repository.OrderIdempotencyRepository, paymentRepo repository.PaymentRepository) error) error
 }
 
 var ErrOrderIdempotencyConflict = errors.New("order idempotency conflict")
 
+var ErrOrderNotFound = errors.New("order not found")
+
+// ErrOrderStatusChanged is returned when another writer moved the order on
+// between reading it and changing its status.
+var ErrOrderStatusChanged = errors.New("order status changed")
+
+// orderStatusSwapper changes an order's status only if it still holds the
+// expected one, so concurrent cancellations restore stock once.
+type orderStatusSwapper interface {
+	SwapStatus(id int64, from, to string) (bool, error)
+}
+
+// OrderDetail is an order with its shipment and status timeline, as shown to
+// the shopper who placed it.
+type OrderDetail struct {
+	Order    *domain.Order            `json:"order"`
+	Shipment *domain.Shipment         `json:"shipment"`
+	Timeline []*domain.OrderStatusLog `json:"timeline"`
+}
+
 func (s *OrderService) CreateOrder(userID int64, idempotencyKey string, shippingAddress, billingAddress, notes string, paymentMethod string) (*domain.Order, error) {
 	if txRunner, ok := s.orderRepo.(orderTransactionRunner); ok {
 		var createdOrder *domain.Order
@@ -60,10 +86,30 @@ func (s *OrderService) CreateOrder(userID int64, idempotencyKey string, shipping
 		if err != nil {
 			return nil, err
 		}
+		s.announceCreatedOrder(createdOrder)
 		return createdOrder, nil
 	}
 
-	return s.createOrderWithRepos(s.orderRepo, s.cartRepo, s.productRepo, s.inventoryRepo, s.idempotencyRepo, userID, idempotencyKey, shippingAddress, billingAddress, notes, paymentMethod, false)
+	order, err := s.createOrderWithRepos(s.orderRepo, s.cartRepo, s.productRepo, s.inventoryRepo, s.idempotencyRepo, userID, idempotencyKey, shippingAddress, billingAddress, notes, paymentMethod, false)
+	if err != nil {
+		return nil, err
+	}
+	s.announceCreatedOrder(order)
+	return order, nil
+}
+
+// announceCreatedOrder queues order.created, plus order.paid for orders that
+// were paid at creation. The order is already committed, so a queue failure
+// must not fail the request. An idempotent replay queues the same event IDs
+// again, which receivers already dedupe.
+func (s *OrderService) announceCreatedOrder(order *domain.Order) {
+	if order == nil {
+		return
+	}
+	_ = s.webhookQueue.EnqueueOrderEvent(order, "created")
+	if order.Status == "paid" {
+		_ = s.webhookQueue.EnqueueOrderEvent(order, "paid")
+	}
 }
 
 func resolveIdempotencyRecord(orderRepo repository.OrderRepository, record *domain.OrderIdempotency) (*domain.Order, error) {
@@ -104,7 +150,7 @@ func (s *OrderService) createOrderWithRepos(orderRepo repository.OrderRepository
 		return nil, errors.New("cart is empty")
 	}
 
-	subtotal := 0.0
+	var subtotal money.Amount
 	orderItems := make([]domain.OrderItem, 0, len(cart.Items))
 	productIDs := make([]int64, 0, len(cart.Items))
 	productIDSet := map[int64]struct{}{}
@@ -130,20 +176,31 @@ func (s *OrderService) createOrderWithRepos(orderRepo repository.OrderRepository
 			return nil, errors.New("product not found")
 		}
 		productID := item.ProductID
+		if s.reservationRepo != nil {
+			available, err := availableStock(s.reservationRepo, product)
+			if err != nil {
+				return nil, err
+			}
+			if available < item.Quantity {
+				return nil, errors.New("insufficient stock")
+			}
+		}
 
-		subtotal += item.Price * float64(item.Quantity)
+		unitPrice := money.FromMajor(product.Price, money.DefaultCurrency)
+		lineTotal := unitPrice.Mul(item.Quantity)
+		subtotal += lineTotal
 		orderItems = append(orderItems, domain.OrderItem{
 			ProductID:   &productID,
 			ProductName: product.Name,
 			SKU:         product.SKU,
 			Quantity:    item.Quantity,
-			UnitPrice:   item.Price,
-			TotalPrice:  item.Price * float64(item.Quantity),
+			UnitPrice:   unitPrice,
+			TotalPrice:  lineTotal,
 		})
 	}
 
-	shippingFee := 10.0
-	tax := subtotal * 0.1
+	shippingFee := money.FromMajor(10, money.DefaultCurrency)
+	tax := subtotal.MulRate(0.1)
 	total := subtotal + shippingFee + tax
 
 	orderNo := fmt.Sprintf("ORD%d%04d", time.Now().Unix(), userID%10000)
@@ -201,6 +258,7 @@ func (s *OrderService) createOrderWithRepos(orderRepo repository.OrderRepository
 		if err := orderRepo.CreateOrderItem(&item); err != nil {
 			return nil, err
 		}
+		order.Items = append(order.Items, item)
 		if err := inventorySvc.AdjustStock(
 			*item.ProductID,
 			-item.Quantity,
@@ -241,75 +299,286 @@ func (s *OrderService) GetOrderByOrderNo(orderNo string) (*domain.Order, error)
 	return s.orderRepo.FindByOrderNo(orderNo)
 }
 
-func (s *OrderService) ListUserOrders(userID int64, offset, limit int) ([]*domain.Order, int64, error) {
-	orders, err := s.orderRepo.FindByUserID(userID, offset, limit)
+// GetOrderByCheckoutSession returns the order placed through a UCP checkout
+// session, or nil when the session has none.
+func (s *OrderService) GetOrderByCheckoutSession(sessionID string) (*domain.Order, error) {
+	orders, err := s.orderRepo.List(0, 1, map[string]interface{}{"checkout_session_id = ?": sessionID})
+	if err != nil || len(orders) == 0 {
+		return nil, err
+	}
+	return orders[0], nil
+}
+
+func (s *OrderService) ListUserOrders(userID int64, status string, offset, limit int) ([]*domain.Order, int64, error) {
+	if status == "" {
+		orders, err := s.orderRepo.FindByUserID(userID, offset, limit)
+		if err != nil {
+			return nil, 0, err
+		}
+		count, err := s.orderRepo.CountByUserID(userID)
+		if err != nil {
+			return nil, 0, err
+		}
+		return orders, count, nil
+	}
+
+	filters := map[string]interface{}{
+		"user_id = ?": userID,
+		"status = ?":  status,
+	}
+	orders, err := s.orderRepo.List(offset, limit, filters)
 	if err != nil {
 		return nil, 0, err
 	}
-
-	count, err := s.orderRepo.CountByUserID(userID)
+	count, err := s.orderRepo.Count(filters)
 	if err != nil {
 		return nil, 0, err
 	}
-
 	return orders, count, nil
 }
 
-func (s *OrderService) UpdateOrderStatus(id int64, status string) error {
-	var order *domain.Order
-	if status == "paid" {
-		var err error
-		order, err = s.orderRepo.FindByID(id)
-		if err != nil {
-			return err
+// GetUserOrderDetail loads an order for its owner. Orders belonging to anyone
+// else are reported as ErrOrderNotFound so their existence is not revealed.
+func (s *OrderService) GetUserOrderDetail(userID, orderID int64) (*OrderDetail, error) {
+	order, err := s.orderRepo.FindByID(orderID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrderNotFound
 		}
-		order.Status = status
-		order.PaymentStatus = "paid"
-		now := time.Now()
-		order.PaymentTime = &now
-		if err := s.orderRepo.Update(order); err != nil {
-			return err
+		return nil, err
+	}
+	if order == nil || order.UserID == nil || *order.UserID != userID {
+		return nil, ErrOrderNotFound
+	}
+
+	detail := &OrderDetail{Order: order, Timeline: []*domain.OrderStatusLog{}}
+	if s.shipmentRepo != nil {
+		shipment, err := s.shipmentRepo.FindByOrderID(order.ID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
 		}
-	} else {
-		if err := s.orderRepo.UpdateStatus(id, status); err != nil {
-			return err
+		detail.Shipment = shipment
+	}
+	if s.statusLogRepo != nil {
+		logs, err := s.statusLogRepo.ListByOrderID(order.ID)
+		if err != nil {
+			return nil, err
 		}
-		if s.webhookQueue != nil {
-			var err error
-			order, err = s.orderRepo.FindByID(id)
-			if err != nil {
-				return err
-			}
-			order.Status = status
+		if logs != nil {
+			detail.Timeline = logs
 		}
 	}
-	if s.webhookQueue == nil || order == nil {
-		return nil
+	return detail, nil
+}
+
+func (s *OrderService) UpdateOrderStatus(id int64, status string) error {
+	return s.updateOrderStatus(id, status, status)
+}
+
+// RefundOrder marks a fully refunded order as refunded, through the same
+// transition check, status log and order.refunded event as any other change.
+func (s *OrderService) RefundOrder(id int64, reason string) error {
+	return s.updateOrderStatus(id, "refunded", reason)
+}
+
+// ConfirmPayment saves payment as paid and moves its order from pending to
+// paid in one transaction, so a paid payment is never left behind an unpaid
+// order. paymentRepo is used when the order repository cannot run
+// transactions. It returns ErrOrderStatusChanged when the order is no longer
+// pending.
+func (s *OrderService) ConfirmPayment(payment *domain.Payment, paymentRepo repository.PaymentRepository, reason string) (*domain.Order, error) {
+	if s.orderRepo == nil || payment == nil {
+		return nil, errors.New("order repository unavailable")
 	}
-	if status == "paid" {
-		if _, err := s.webhookQueue.EnqueuePaidEvent(order); err != nil {
+	var order *domain.Order
+	var err error
+	if txRunner, ok := s.orderRepo.(orderTransactionRunner); ok {
+		err = txRunner.Transaction(func(orderRepo repository.OrderRepository, cartRepo repository.CartRepository, productRepo repository.ProductRepository, inventoryRepo repository.InventoryRepository, idempotencyRepo repository.OrderIdempotencyRepository, txPaymentRepo repository.PaymentRepository) error {
+			order, err = confirmPaymentWithRepos(orderRepo, txPaymentRepo, payment)
 			return err
+		})
+	} else {
+		order, err = confirmPaymentWithRepos(s.orderRepo, paymentRepo, payment)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.logStatusTransition(order.ID, "pending", "paid", reason)
+	return order, s.webhookQueue.EnqueueOrderEvent(order, "paid")
+}
+
+func confirmPaymentWithRepos(orderRepo repository.OrderRepository, paymentRepo repository.PaymentRepository, payment *domain.Payment) (*domain.Order, error) {
+	if paymentRepo == nil {
+		return nil, errors.New("payment repository unavailable")
+	}
+	order, err := orderRepo.FindByID(payment.OrderID)
+	if err != nil || order == nil {
+		return nil, ErrOrderNotFound
+	}
+	if order.Status != "pending" {
+		return nil, ErrOrderStatusChanged
+	}
+	if swapper, ok := orderRepo.(orderStatusSwapper); ok {
+		swapped, err := swapper.SwapStatus(order.ID, "pending", "paid")
+		if err != nil {
+			return nil, err
+		}
+		if !swapped {
+			return nil, ErrOrderStatusChanged
 		}
 	}
+	now := time.Now()
+	order.Status = "paid"
+	order.PaymentStatus = "paid"
+	order.PaymentTime = &now
+	if err := orderRepo.Update(order); err != nil {
+		return nil, err
+	}
+	payment.Status = "paid"
+	if payment.ID == 0 {
+		err = paymentRepo.Create(payment)
+	} else {
+		err = paymentRepo.Update(payment)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+func (s *OrderService) updateOrderStatus(id int64, status, reason string) error {
+	if s.orderRepo == nil {
+		return errors.New("order repository unavailable")
+	}
+	order, err := s.orderRepo.FindByID(id)
+	if err != nil {
+		return err
+	}
+	if order == nil {
+		return errors.New("order not found")
+	}
+	fromStatus := order.Status
+	if err := checkOrderTransition(fromStatus, status); err != nil {
+		return err
+	}
+	if err := s.swapStatus(order.ID, fromStatus, status); err != nil {
+		return err
+	}
+	now := time.Now()
+	order.Status = status
+	switch status {
+	case "paid":
+		order.PaymentStatus = "paid"
+		order.PaymentTime = &now
+	case "shipped":
+		order.ShippedAt = &now
+	case "delivered":
+		order.DeliveredAt = &now
+	case "cancelled":
+		order.CancelledAt = &now
+	case "refunded":
+		order.PaymentStatus = "refunded"
+		order.RefundedAt = &now
+	}
+	if err := s.orderRepo.Update(order); err != nil {
+		return err
+	}
+	s.logStatusTransition(order.ID, fromStatus, status, reason)
 	return s.webhookQueue.EnqueueOrderEvent(order, status)
 }
 
+// swapStatus moves the order from fromStatus to status only if no one else
+// changed it since it was read, returning ErrOrderStatusChanged otherwise.
+func (s *OrderService) swapStatus(id int64, fromStatus, status string) error {
+	swapper, ok := s.orderRepo.(orderStatusSwapper)
+	if !ok {
+		return nil
+	}
+	swapped, err := swapper.SwapStatus(id, fromStatus, status)
+	if err != nil {
+		return err
+	}
+	if !swapped {
+		return ErrOrderStatusChanged
+	}
+	return nil
+}
+
 func (s *OrderService) CancelOrder(id int64, reason string) error {
+	_, err := s.cancelOrder(id, reason)
+	return err
+}
+
+// cancelOrder returns the order when this call cancelled it, and nil when it
+// was already cancelled. The status change and the stock it puts back are
+// written in one transaction when the repository supports it.
+func (s *OrderService) cancelOrder(id int64, reason string) (*domain.Order, error) {
 	if s.orderRepo == nil || s.productRepo == nil || s.inventoryRepo == nil {
-		return errors.New("order dependencies unavailable")
+		return nil, errors.New("order dependencies unavailable")
 	}
 	order, err := s.orderRepo.FindByID(id)
 	if err != nil || order == nil {
-		return errors.New("order not found")
+		return nil, errors.New("order not found")
 	}
 	if order.Status == "cancelled" {
-		return nil
+		return nil, nil
+	}
+	fromStatus := order.Status
+	if err := checkOrderTransition(fromStatus, "cancelled"); err != nil {
+		return nil, err
+	}
+	if txRunner, ok := s.orderRepo.(orderTransactionRunner); ok {
+		err = txRunner.Transaction(func(orderRepo repository.OrderRepository, cartRepo repository.CartRepository, productRepo repository.ProductRepository, inventoryRepo repository.InventoryRepository, idempotencyRepo repository.OrderIdempotencyRepository, paymentRepo repository.PaymentRepository) error {
+			return cancelOrderWithRepos(orderRepo, productRepo, inventoryRepo, order, true)
+		})
+	} else {
+		err = cancelOrderWithRepos(s.orderRepo, s.productRepo, s.inventoryRepo, order, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.logStatusTransition(order.ID, fromStatus, "cancelled", reason)
+	if err := s.webhookQueue.EnqueueOrderEvent(order, "cancelled"); err != nil {
+		return order, err
+	}
+	return order, nil
+}
+
+// cancelOrderWithRepos moves order to cancelled and restocks its items. Out
+// of a transaction, a failure puts back the stock already restored and the
+// previous status.
+func cancelOrderWithRepos(orderRepo repository.OrderRepository, productRepo repository.ProductRepository, inventoryRepo repository.InventoryRepository, order *domain.Order, inTransaction bool) (err error) {
+	fromStatus := order.Status
+	swapper, canSwap := orderRepo.(orderStatusSwapper)
+	if canSwap {
+		swapped, err := swapper.SwapStatus(order.ID, fromStatus, "cancelled")
+		if err != nil {
+			return err
+		}
+		if !swapped {
+			return ErrOrderStatusChanged
+		}
 	}
+	inventorySvc := NewInventoryService(productRepo, inventoryRepo)
+	var restocked []domain.OrderItem
+	defer func() {
+		if err == nil || inTransaction {
+			return
+		}
+		for _, item := range restocked {
+			_ = inventorySvc.AdjustStock(*item.ProductID, -item.Quantity, "out", order.OrderNo, "order_cancel_revert", fmt.Sprintf("Order %s cancel failed", order.OrderNo))
+		}
+		if canSwap {
+			_, _ = swapper.SwapStatus(order.ID, "cancelled", fromStatus)
+		}
+		order.Status = fromStatus
+		order.CancelledAt = nil
+	}()
+
 	for _, item := range order.Items {
 		if item.ProductID == nil {
 			continue
 		}
-		inventorySvc := NewInventoryService(s.productRepo, s.inventoryRepo)
 		if err := inventorySvc.AdjustStock(
 			*item.ProductID,
 			item.Quantity,
@@ -320,23 +589,47 @@ func (s *OrderService) CancelOrder(id int64, reason string) error {
 		); err != nil {
 			return err
 		}
+		restocked = append(restocked, item)
 	}
 	now := time.Now()
 	order.Status = "cancelled"
 	order.CancelledAt = &now
-	if err := s.orderRepo.Update(order); err != nil {
-		return err
+	return orderRepo.Update(order)
+}
+
+// CancelUnpaidOrders cancels up to limit orders still unpaid after window.
+// Each goes through the CancelOrder path, so stock is restored and the transition is
+// logged, and an order.cancelled webhook is queued. Orders another worker
+// cancelled, or that were paid meanwhile, are skipped.
+func (s *OrderService) CancelUnpaidOrders(window time.Duration, limit int) (int, error) {
+	if s.orderRepo == nil {
+		return 0, errors.New("order repository unavailable")
 	}
-	if s.statusLogRepo != nil {
-		_ = s.statusLogRepo.Create(&domain.OrderStatusLog{
-			OrderID:    order.ID,
-			FromStatus: "paid",
-			ToStatus:   "cancelled",
-			Reason:     reason,
-			CreatedAt:  time.Now(),
-		})
+	if window <= 0 || limit <= 0 {
+		return 0, nil
 	}
-	return nil
+	orders, err := s.orderRepo.List(0, limit, map[string]interface{}{
+		"status = ?":         "pending",
+		"payment_status = ?": "unpaid",
+		"created_at < ?":     time.Now().Add(-window),
+	})
+	if err != nil {
+		return 0, err
+	}
+	cancelled := 0
+	for _, candidate := range orders {
+		order, err := s.cancelOrder(candidate.ID, "payment_timeout")
+		if order != nil {
+			cancelled++
+		}
+		if err != nil {
+			if errors.Is(err, ErrOrderStatusChanged) || errors.Is(err, ErrInvalidOrderTransition) {
+				continue
+			}
+			return cancelled, err
+		}
+	}
+	return cancelled, nil
 }
 
 func (s *OrderService) ShipOrder(id int64, carrier, tracking string) (*domain.Shipment, error) {
@@ -347,6 +640,13 @@ func (s *OrderService) ShipOrder(id int64, carrier, tracking string) (*domain.Sh
 	if err != nil || order == nil {
 		return nil, errors.New("order not found")
 	}
+	fromStatus := order.Status
+	if err := checkOrderTransition(fromStatus, "shipped"); err != nil {
+		return nil, err
+	}
+	if err := s.swapStatus(order.ID, fromStatus, "shipped"); err != nil {
+		return nil, err
+	}
 	now := time.Now()
 	order.Status = "shipped"
 	order.ShippedAt = &now
@@ -368,14 +668,9 @@ func (s *OrderService) ShipOrder(id int64, carrier, tracking string) (*domain.Sh
 			return nil, err
 		}
 	}
-	if s.statusLogRepo != nil {
-		_ = s.statusLogRepo.Create(&domain.OrderStatusLog{
-			OrderID:    id,
-			FromStatus: "paid",
-			ToStatus:   "shipped",
-			Reason:     "shipped",
-			CreatedAt:  time.Now(),
-		})
+	s.logStatusTransition(id, fromStatus, "shipped", "shipped")
+	if err := s.webhookQueue.EnqueueOrderEvent(order, "shipped"); err != nil {
+		return shipment, err
 	}
 	return shipment, nil
 }
@@ -388,6 +683,13 @@ func (s *OrderService) ReceiveOrder(id int64) error {
 	if err != nil || order == nil {
 		return errors.New("order not found")
 	}
+	fromStatus := order.Status
+	if err := checkOrderTransition(fromStatus, "delivered"); err != nil {
+		return err
+	}
+	if err := s.swapStatus(order.ID, fromStatus, "delivered"); err != nil {
+		return err
+	}
 	now := time.Now()
 	order.Status = "delivered"
 	order.DeliveredAt = &now
@@ -403,16 +705,21 @@ func (s *OrderService) ReceiveOrder(id int64) error {
 			_ = s.shipmentRepo.Update(shipment)
 		}
 	}
-	if s.statusLogRepo != nil {
-		_ = s.statusLogRepo.Create(&domain.OrderStatusLog{
-			OrderID:    id,
-			FromStatus: "shipped",
-			ToStatus:   "delivered",
-			Reason:     "delivered",
-			CreatedAt:  time.Now(),
-		})
+	s.logStatusTransition(id, fromStatus, "delivered", "delivered")
+	return s.webhookQueue.EnqueueOrderEvent(order, "delivered")
+}
+
+func (s *OrderService) logStatusTransition(orderID int64, fromStatus, toStatus, reason string) {
+	if s.statusLogRepo == nil {
+		return
 	}
-	return nil
+	_ = s.statusLogRepo.Create(&domain.OrderStatusLog{
+		OrderID:    orderID,
+		FromStatus: fromStatus,
+		ToStatus:   toStatus,
+		Reason:     reason,
+		CreatedAt:  time.Now(),
+	})
 }
 
 func (s *OrderService) CreateOrderFromCheckout(order *domain.Order, items []domain.OrderItem, idempotencyKey string) (*domain.Order, error) {
@@ -481,6 +788,7 @@ func (s *OrderService) CreateOrderFromCheckout(order *domain.Order, items []doma
 		if err := s.orderRepo.CreateOrderItem(&item); err != nil {
 			return nil, err
 		}
+		order.Items = append(order.Items, item)
 		if err := inventorySvc.AdjustStock(
 			productID,
 			-item.Quantity,
@@ -505,6 +813,7 @@ func (s *OrderService) CreateOrderFromCheckout(order *domain.Order, items []doma
 		}
 	}
 
+	s.announceCreatedOrder(order)
 	return order, nil
 }
 
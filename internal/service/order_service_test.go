@@ -3,7 +3,9 @@ package service
 import (
 	"encoding/json"
 	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/jinzhu/gorm"
 	"github.com/meowucp/internal/domain"
@@ -80,10 +82,16 @@ func (f *fakeWebhookQueueRepo) Create(job *domain.UCPWebhookJob) error {
 func (f *fakeWebhookQueueRepo) ListDue(limit int) ([]*domain.UCPWebhookJob, error) {
 	return []*domain.UCPWebhookJob{}, nil
 }
+func (f *fakeWebhookQueueRepo) ClaimDue(owner string, limit int, lease time.Duration) ([]*domain.UCPWebhookJob, error) {
+	return f.ListDue(limit)
+}
 func (f *fakeWebhookQueueRepo) Update(job *domain.UCPWebhookJob) error {
 	f.jobs = append(f.jobs, job)
 	return nil
 }
+func (f *fakeWebhookQueueRepo) Release(job *domain.UCPWebhookJob) (bool, error) {
+	return true, f.Update(job)
+}
 func (f *fakeWebhookQueueRepo) List(offset, limit int) ([]*domain.UCPWebhookJob, error) {
 	return []*domain.UCPWebhookJob{}, nil
 }
@@ -157,15 +165,23 @@ type fakeOrderStatusRepo struct {
 	order *domain.Order
 }
 
-func (f *fakeOrderStatusRepo) Create(order *domain.Order) error                    { return nil }
-func (f *fakeOrderStatusRepo) Update(order *domain.Order) error                    { f.order = order; return nil }
-func (f *fakeOrderStatusRepo) FindByID(id int64) (*domain.Order, error)            { return f.order, nil }
-func (f *fakeOrderStatusRepo) FindByOrderNo(orderNo string) (*domain.Order, error) { return nil, nil }
+func (f *fakeOrderStatusRepo) Create(order *domain.Order) error         { return nil }
+func (f *fakeOrderStatusRepo) Update(order *domain.Order) error         { f.order = order; return nil }
+func (f *fakeOrderStatusRepo) FindByID(id int64) (*domain.Order, error) { return f.order, nil }
+func (f *fakeOrderStatusRepo) FindByOrderNo(orderNo string) (*domain.Order, error) {
+	if f.order != nil && f.order.OrderNo == orderNo {
+		return f.order, nil
+	}
+	return nil, nil
+}
 func (f *fakeOrderStatusRepo) FindByUserID(userID int64, offset, limit int) ([]*domain.Order, error) {
 	return nil, nil
 }
 func (f *fakeOrderStatusRepo) CountByUserID(userID int64) (int64, error) { return 0, nil }
 func (f *fakeOrderStatusRepo) List(offset, limit int, filters map[string]interface{}) ([]*domain.Order, error) {
+	if sessionID, ok := filters["checkout_session_id = ?"]; ok && f.order != nil && f.order.CheckoutSessionID == sessionID {
+		return []*domain.Order{f.order}, nil
+	}
 	return nil, nil
 }
 func (f *fakeOrderStatusRepo) Count(filters map[string]interface{}) (int64, error) { return 0, nil }
@@ -211,6 +227,16 @@ func (f *fakeOrderStatusLogRepo) Create(log *domain.OrderStatusLog) error {
 	return nil
 }
 
+func (f *fakeOrderStatusLogRepo) ListByOrderID(orderID int64) ([]*domain.OrderStatusLog, error) {
+	logs := make([]*domain.OrderStatusLog, 0, len(f.logs))
+	for _, log := range f.logs {
+		if log.OrderID == orderID {
+			logs = append(logs, log)
+		}
+	}
+	return logs, nil
+}
+
 type fakeAuditLogRepo struct {
 	created *domain.AuditLog
 }
@@ -239,10 +265,16 @@ func (f *fakeOrderWebhookQueueRepo) Create(job *domain.UCPWebhookJob) error {
 func (f *fakeOrderWebhookQueueRepo) ListDue(limit int) ([]*domain.UCPWebhookJob, error) {
 	return []*domain.UCPWebhookJob{}, nil
 }
+func (f *fakeOrderWebhookQueueRepo) ClaimDue(owner string, limit int, lease time.Duration) ([]*domain.UCPWebhookJob, error) {
+	return f.ListDue(limit)
+}
 func (f *fakeOrderWebhookQueueRepo) Update(job *domain.UCPWebhookJob) error {
 	f.jobs = append(f.jobs, job)
 	return nil
 }
+func (f *fakeOrderWebhookQueueRepo) Release(job *domain.UCPWebhookJob) (bool, error) {
+	return true, f.Update(job)
+}
 func (f *fakeOrderWebhookQueueRepo) List(offset, limit int) ([]*domain.UCPWebhookJob, error) {
 	return []*domain.UCPWebhookJob{}, nil
 }
@@ -350,7 +382,14 @@ func (f *fakeProductRepo) FindByID(id int64) (*domain.Product, error) {
 	}
 	return product, nil
 }
-func (f *fakeProductRepo) FindBySKU(sku string) (*domain.Product, error) { return nil, nil }
+func (f *fakeProductRepo) FindBySKU(sku string) (*domain.Product, error) {
+	for _, product := range f.products {
+		if product.SKU == sku {
+			return product, nil
+		}
+	}
+	return nil, errors.New("product not found")
+}
 func (f *fakeProductRepo) FindBySlug(slug string) (*domain.Product, error) {
 	return nil, nil
 }
@@ -689,11 +728,11 @@ func TestOrderServiceEnqueuesOrderWebhookOnStatusChange(t *testing.T) {
 
 	found := false
 	for _, job := range queueRepo.jobs {
-		var payload orderWebhookPayload
+		var payload model.OrderWebhookEvent
 		if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
 			continue
 		}
-		if payload.EventType == "paid" && payload.OrderNo == "ORD-1" {
+		if payload.EventType == "order.paid" && payload.Order.OrderNo == "ORD-1" {
 			found = true
 			break
 		}
@@ -777,6 +816,35 @@ func TestOrderServiceShipCreatesShipmentAndLog(t *testing.T) {
 	}
 }
 
+func TestOrderServiceShipEnqueuesShippedEventWithTracking(t *testing.T) {
+	orderRepo := &fakeOrderStatusRepo{order: &domain.Order{ID: 2, OrderNo: "ORD-2", Status: "paid"}}
+	shipmentRepo := &fakeShipmentRepo{}
+	queueRepo := &fakeOrderWebhookQueueRepo{}
+	queue := NewWebhookQueueService(queueRepo)
+	queue.SetShipments(shipmentRepo)
+
+	svc := NewOrderService(orderRepo, nil, nil, nil, nil)
+	svc.SetShipmentRepo(shipmentRepo)
+	svc.SetWebhookQueue(queue)
+
+	if _, err := svc.ShipOrder(2, "UPS", "TRACK-1"); err != nil {
+		t.Fatalf("ship order: %v", err)
+	}
+	if len(queueRepo.jobs) != 1 {
+		t.Fatalf("expected one webhook job, got %d", len(queueRepo.jobs))
+	}
+	var payload model.OrderWebhookEvent
+	if err := json.Unmarshal([]byte(queueRepo.jobs[0].Payload), &payload); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if payload.EventType != "order.shipped" || payload.EventID != "order_2_order.shipped" {
+		t.Fatalf("unexpected event %s %s", payload.EventType, payload.EventID)
+	}
+	if payload.Order.Fulfillment == nil || payload.Order.Fulfillment.TrackingNumber != "TRACK-1" {
+		t.Fatalf("expected tracking in payload, got %+v", payload.Order.Fulfillment)
+	}
+}
+
 func TestOrderServiceReceiveMarksDelivered(t *testing.T) {
 	orderRepo := &fakeOrderStatusRepo{order: &domain.Order{ID: 3, Status: "shipped"}}
 	shipmentRepo := &fakeShipmentRepo{}
@@ -794,6 +862,83 @@ func TestOrderServiceReceiveMarksDelivered(t *testing.T) {
 	}
 }
 
+func TestOrderServiceShipRejectsCancelledOrder(t *testing.T) {
+	orderRepo := &fakeOrderStatusRepo{order: &domain.Order{ID: 4, Status: "cancelled"}}
+	shipmentRepo := &fakeShipmentRepo{}
+	statusLogRepo := &fakeOrderStatusLogRepo{}
+
+	svc := NewOrderService(orderRepo, nil, nil, nil, nil)
+	svc.shipmentRepo = shipmentRepo
+	svc.statusLogRepo = statusLogRepo
+
+	_, err := svc.ShipOrder(4, "UPS", "TRACK-4")
+	if !errors.Is(err, ErrInvalidOrderTransition) {
+		t.Fatalf("expected invalid transition error, got %v", err)
+	}
+	var transitionErr *OrderTransitionError
+	if !errors.As(err, &transitionErr) || transitionErr.From != "cancelled" || transitionErr.To != "shipped" {
+		t.Fatalf("expected typed transition error from cancelled to shipped")
+	}
+	if orderRepo.order.Status != "cancelled" {
+		t.Fatalf("expected order status unchanged")
+	}
+	if shipmentRepo.created != nil || len(statusLogRepo.logs) != 0 {
+		t.Fatalf("expected no shipment or status log")
+	}
+}
+
+func TestOrderServiceUpdateStatusRejectsPendingToDelivered(t *testing.T) {
+	orderRepo := &fakeOrderStatusRepo{order: &domain.Order{ID: 5, Status: "pending"}}
+	statusLogRepo := &fakeOrderStatusLogRepo{}
+
+	svc := NewOrderService(orderRepo, nil, nil, nil, nil)
+	svc.statusLogRepo = statusLogRepo
+
+	if err := svc.UpdateOrderStatus(5, "delivered"); !errors.Is(err, ErrInvalidOrderTransition) {
+		t.Fatalf("expected invalid transition error, got %v", err)
+	}
+	if orderRepo.order.Status != "pending" {
+		t.Fatalf("expected order status unchanged")
+	}
+	if len(statusLogRepo.logs) != 0 {
+		t.Fatalf("expected no status log")
+	}
+}
+
+func TestOrderServiceTransitionsLogActualFromStatus(t *testing.T) {
+	productID := int64(10)
+	orderRepo := &fakeOrderStatusRepo{order: &domain.Order{ID: 6, Status: "pending", Items: []domain.OrderItem{{OrderID: 6, ProductID: &productID, Quantity: 1}}}}
+	productRepo := &fakeProductRepo{products: map[int64]*domain.Product{
+		10: {ID: 10, Name: "Item", SKU: "SKU-1", StockQuantity: 1},
+	}}
+	statusLogRepo := &fakeOrderStatusLogRepo{}
+
+	svc := NewOrderService(orderRepo, nil, productRepo, &fakeInventoryRepo{}, nil)
+	svc.statusLogRepo = statusLogRepo
+
+	if err := svc.CancelOrder(6, "customer_request"); err != nil {
+		t.Fatalf("cancel order: %v", err)
+	}
+	if len(statusLogRepo.logs) != 1 {
+		t.Fatalf("expected status log to be created")
+	}
+	log := statusLogRepo.logs[0]
+	if log.FromStatus != "pending" || log.ToStatus != "cancelled" || log.Reason != "customer_request" {
+		t.Fatalf("expected pending -> cancelled log, got %s -> %s", log.FromStatus, log.ToStatus)
+	}
+
+	shippedRepo := &fakeOrderStatusRepo{order: &domain.Order{ID: 7, Status: "paid"}}
+	svc = NewOrderService(shippedRepo, nil, nil, nil, nil)
+	svc.statusLogRepo = statusLogRepo
+	if err := svc.UpdateOrderStatus(7, "refunded"); err != nil {
+		t.Fatalf("refund order: %v", err)
+	}
+	log = statusLogRepo.logs[1]
+	if log.FromStatus != "paid" || log.ToStatus != "refunded" {
+		t.Fatalf("expected paid -> refunded log, got %s -> %s", log.FromStatus, log.ToStatus)
+	}
+}
+
 func TestAdminOrderShipWritesAuditLog(t *testing.T) {
 	order := &domain.Order{ID: 100, Status: "paid"}
 	orderRepo := &fakeOrderStatusRepo{order: order}
@@ -871,6 +1016,31 @@ func TestOrderServiceCreateOrderFillsProductInfoAndAdjustsStock(t *testing.T) {
 	}
 }
 
+func TestOrderServiceCreateOrderChargesTheCartViewPrice(t *testing.T) {
+	orderRepo := &fakeOrderCreateRepo{}
+	productRepo := &fakeProductRepo{products: map[int64]*domain.Product{
+		10: {ID: 10, Name: "Cat Toy", Price: 12.5, StockQuantity: 5, Status: 1},
+	}}
+	cartRepo := &fakeCartRepo{cart: &domain.Cart{
+		ID:     100,
+		UserID: 1,
+		Items:  []domain.CartItem{{ProductID: 10, Quantity: 2, Price: 10}},
+	}}
+
+	view, err := NewCartService(cartRepo, productRepo).GetCartView(1)
+	if err != nil {
+		t.Fatalf("cart view: %v", err)
+	}
+	svc := NewOrderService(orderRepo, cartRepo, productRepo, &fakeInventoryRepo{}, nil)
+	order, err := svc.CreateOrder(1, "", "ship", "bill", "", "card")
+	if err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	if order.Subtotal != view.Subtotal || orderRepo.createdItems[0].UnitPrice != view.Items[0].CurrentPrice {
+		t.Fatalf("expected the order to charge the price the cart showed, got subtotal %d want %d", order.Subtotal, view.Subtotal)
+	}
+}
+
 func TestOrderServiceCreateOrderUsesBatchProductLookup(t *testing.T) {
 	orderRepo := &fakeOrderCreateRepo{}
 	productRepo := &batchOnlyProductRepo{products: map[int64]*domain.Product{
@@ -1335,3 +1505,204 @@ func TestOrderServiceCreateOrderIncrementsProductSales(t *testing.T) {
 		t.Fatalf("expected product 61 sales to be incremented")
 	}
 }
+
+func TestOrderServiceUserOrderDetailIncludesTimelineAndShipment(t *testing.T) {
+	owner := int64(7)
+	repo := &fakeOrderStatusRepo{order: &domain.Order{ID: 3, UserID: &owner, Status: "shipped"}}
+	shipmentRepo := &fakeShipmentRepo{created: &domain.Shipment{OrderID: 3, TrackingNo: "TRK-1"}}
+	statusLogRepo := &fakeOrderStatusLogRepo{logs: []*domain.OrderStatusLog{
+		{OrderID: 3, FromStatus: "pending", ToStatus: "paid"},
+		{OrderID: 4, FromStatus: "pending", ToStatus: "cancelled"},
+		{OrderID: 3, FromStatus: "paid", ToStatus: "shipped"},
+	}}
+	svc := NewOrderService(repo, nil, nil, nil, nil)
+	svc.SetShipmentRepo(shipmentRepo)
+	svc.SetStatusLogRepo(statusLogRepo)
+
+	detail, err := svc.GetUserOrderDetail(7, 3)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if detail.Shipment == nil || detail.Shipment.TrackingNo != "TRK-1" {
+		t.Fatalf("expected shipment, got %+v", detail.Shipment)
+	}
+	if len(detail.Timeline) != 2 || detail.Timeline[1].ToStatus != "shipped" {
+		t.Fatalf("expected two timeline entries, got %+v", detail.Timeline)
+	}
+}
+
+func TestOrderServiceUserOrderDetailHidesOtherUsersOrders(t *testing.T) {
+	owner := int64(8)
+	repo := &fakeOrderStatusRepo{order: &domain.Order{ID: 3, UserID: &owner}}
+	svc := NewOrderService(repo, nil, nil, nil, nil)
+
+	if _, err := svc.GetUserOrderDetail(7, 3); !errors.Is(err, ErrOrderNotFound) {
+		t.Fatalf("expected ErrOrderNotFound, got %v", err)
+	}
+}
+
+type fakeUnpaidOrderRepo struct {
+	fakeOrderStatusRepo
+	orders      map[int64]*domain.Order
+	lastFilters map[string]interface{}
+	// stale is returned by List as still pending, as another worker's
+	// snapshot would be.
+	stale []*domain.Order
+	// raced is cancelled by "another worker" just before our swap.
+	raced int64
+}
+
+func (f *fakeUnpaidOrderRepo) FindByID(id int64) (*domain.Order, error) {
+	order, ok := f.orders[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	copy := *order
+	return &copy, nil
+}
+func (f *fakeUnpaidOrderRepo) Update(order *domain.Order) error {
+	f.orders[order.ID] = order
+	return nil
+}
+func (f *fakeUnpaidOrderRepo) List(offset, limit int, filters map[string]interface{}) ([]*domain.Order, error) {
+	f.lastFilters = filters
+	if f.stale != nil {
+		return f.stale, nil
+	}
+	var result []*domain.Order
+	for _, order := range f.orders {
+		if order.Status == "pending" && order.PaymentStatus == "unpaid" {
+			copy := *order
+			result = append(result, &copy)
+		}
+	}
+	return result, nil
+}
+func (f *fakeUnpaidOrderRepo) SwapStatus(id int64, from, to string) (bool, error) {
+	order, ok := f.orders[id]
+	if id == f.raced {
+		order.Status = to
+	}
+	if !ok || order.Status != from {
+		return false, nil
+	}
+	order.Status = to
+	return true, nil
+}
+
+func TestOrderServiceCancelUnpaidOrdersRestocksOnce(t *testing.T) {
+	productID := int64(10)
+	orderRepo := &fakeUnpaidOrderRepo{orders: map[int64]*domain.Order{
+		1: {ID: 1, OrderNo: "ORD-1", Status: "pending", PaymentStatus: "unpaid", Items: []domain.OrderItem{{ProductID: &productID, Quantity: 2}}},
+		2: {ID: 2, OrderNo: "ORD-2", Status: "paid", PaymentStatus: "paid"},
+	}}
+	productRepo := &fakeProductRepo{products: map[int64]*domain.Product{productID: {ID: productID, StockQuantity: 0}}}
+	statusLogRepo := &fakeOrderStatusLogRepo{}
+	queueRepo := &fakeOrderWebhookQueueRepo{}
+
+	svc := NewOrderService(orderRepo, nil, productRepo, &fakeInventoryRepo{}, nil)
+	svc.SetStatusLogRepo(statusLogRepo)
+	svc.SetWebhookQueue(NewWebhookQueueService(queueRepo))
+
+	cancelled, err := svc.CancelUnpaidOrders(30*time.Minute, 10)
+	if err != nil || cancelled != 1 {
+		t.Fatalf("expected one cancelled order, got %d %v", cancelled, err)
+	}
+	if _, ok := orderRepo.lastFilters["created_at < ?"]; !ok {
+		t.Fatalf("expected sweep to filter by payment window")
+	}
+	if orderRepo.orders[1].Status != "cancelled" || productRepo.products[productID].StockQuantity != 2 {
+		t.Fatalf("expected order cancelled and stock restored")
+	}
+	if len(statusLogRepo.logs) != 1 || statusLogRepo.logs[0].Reason != "payment_timeout" {
+		t.Fatalf("expected payment_timeout status log")
+	}
+	if len(queueRepo.jobs) != 1 || !strings.Contains(queueRepo.jobs[0].Payload, `"event_type":"order.cancelled"`) {
+		t.Fatalf("expected order.cancelled webhook to be queued")
+	}
+
+	// A second worker that listed the order before it was cancelled must not
+	// restore stock or queue the webhook again.
+	orderRepo.stale = []*domain.Order{{ID: 1, Status: "pending", PaymentStatus: "unpaid"}}
+	cancelled, err = svc.CancelUnpaidOrders(30*time.Minute, 10)
+	if err != nil || cancelled != 0 {
+		t.Fatalf("expected no further cancellations, got %d %v", cancelled, err)
+	}
+	if productRepo.products[productID].StockQuantity != 2 || len(queueRepo.jobs) != 1 {
+		t.Fatalf("expected stock and webhooks to be untouched by the second sweep")
+	}
+
+	// Losing the status swap to a concurrent worker is skipped as well.
+	orderRepo.stale = nil
+	orderRepo.orders[3] = &domain.Order{ID: 3, Status: "pending", PaymentStatus: "unpaid", Items: []domain.OrderItem{{ProductID: &productID, Quantity: 1}}}
+	orderRepo.raced = 3
+	cancelled, err = svc.CancelUnpaidOrders(30*time.Minute, 10)
+	if err != nil || cancelled != 0 {
+		t.Fatalf("expected raced order to be skipped, got %d %v", cancelled, err)
+	}
+	if productRepo.products[productID].StockQuantity != 2 || len(queueRepo.jobs) != 1 {
+		t.Fatalf("expected the raced order to leave stock and webhooks alone")
+	}
+}
+
+func TestOrderServiceCancelPutsStockBackWhenRestockFails(t *testing.T) {
+	stocked, missing := int64(10), int64(11)
+	orderRepo := &fakeUnpaidOrderRepo{orders: map[int64]*domain.Order{
+		1: {ID: 1, OrderNo: "ORD-1", Status: "paid", Items: []domain.OrderItem{{ProductID: &stocked, Quantity: 2}, {ProductID: &missing, Quantity: 1}}},
+	}}
+	productRepo := &fakeProductRepo{products: map[int64]*domain.Product{stocked: {ID: stocked, StockQuantity: 3}}}
+	queueRepo := &fakeOrderWebhookQueueRepo{}
+
+	svc := NewOrderService(orderRepo, nil, productRepo, &fakeInventoryRepo{}, nil)
+	svc.SetWebhookQueue(NewWebhookQueueService(queueRepo))
+
+	if err := svc.CancelOrder(1, "customer_request"); err == nil {
+		t.Fatalf("expected the failed restock to fail the cancellation")
+	}
+	if productRepo.products[stocked].StockQuantity != 3 {
+		t.Fatalf("expected restored stock to be taken back, got %d", productRepo.products[stocked].StockQuantity)
+	}
+	if orderRepo.orders[1].Status != "paid" || len(queueRepo.jobs) != 0 {
+		t.Fatalf("expected the order to stay paid without a webhook, got %s", orderRepo.orders[1].Status)
+	}
+}
+
+func TestOrderServiceUpdateStatusLosesRaceToCancel(t *testing.T) {
+	orderRepo := &fakeUnpaidOrderRepo{orders: map[int64]*domain.Order{
+		1: {ID: 1, Status: "pending", PaymentStatus: "unpaid"},
+	}, raced: 1}
+
+	svc := NewOrderService(orderRepo, nil, nil, nil, nil)
+	if err := svc.UpdateOrderStatus(1, "paid"); !errors.Is(err, ErrOrderStatusChanged) {
+		t.Fatalf("expected the lost swap to be reported, got %v", err)
+	}
+	if orderRepo.orders[1].PaymentStatus != "unpaid" {
+		t.Fatalf("expected the order not to be overwritten as paid")
+	}
+}
+
+func TestOrderServiceShipAndReceiveLoseRaceToCancel(t *testing.T) {
+	orderRepo := &fakeUnpaidOrderRepo{orders: map[int64]*domain.Order{
+		1: {ID: 1, Status: "paid", PaymentStatus: "paid"},
+		2: {ID: 2, Status: "shipped", PaymentStatus: "paid"},
+	}}
+	shipmentRepo := &fakeShipmentRepo{}
+	svc := NewOrderService(orderRepo, nil, nil, nil, nil)
+	svc.SetShipmentRepo(shipmentRepo)
+
+	orderRepo.raced = 1
+	if _, err := svc.ShipOrder(1, "ups", "1Z"); !errors.Is(err, ErrOrderStatusChanged) {
+		t.Fatalf("expected the lost swap to be reported, got %v", err)
+	}
+	if orderRepo.orders[1].ShippedAt != nil || shipmentRepo.created != nil {
+		t.Fatalf("expected no shipment for an order changed meanwhile")
+	}
+
+	orderRepo.raced = 2
+	if err := svc.ReceiveOrder(2); !errors.Is(err, ErrOrderStatusChanged) {
+		t.Fatalf("expected the lost swap to be reported, got %v", err)
+	}
+	if orderRepo.orders[2].DeliveredAt != nil {
+		t.Fatalf("expected the order not to be overwritten as delivered")
+	}
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidOrderTransition = errors.New("invalid order status transition")
+
+// orderStatusTransitions lists, for every status allowed by the orders.status
+// check constraint, the statuses an order may move to next.
+var orderStatusTransitions = map[string][]string{
+	"pending":   {"paid", "cancelled"},
+	"paid":      {"shipped", "cancelled", "refunded"},
+	"shipped":   {"delivered"},
+	"delivered": {"refunded"},
+	"cancelled": {},
+	"refunded":  {},
+}
+
+type OrderTransitionError struct {
+	From string
+	To   string
+}
+
+func (e *OrderTransitionError) Error() string {
+	return fmt.Sprintf("invalid order status transition: %s -> %s", e.From, e.To)
+}
+
+func (e *OrderTransitionError) Is(target error) bool {
+	return target == ErrInvalidOrderTransition
+}
+
+func IsOrderStatus(status string) bool {
+	_, ok := orderStatusTransitions[status]
+	return ok
+}
+
+func CanTransitionOrderStatus(from, to string) bool {
+	for _, next := range orderStatusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+func checkOrderTransition(from, to string) error {
+	if !CanTransitionOrderStatus(from, to) {
+		return &OrderTransitionError{From: from, To: to}
+	}
+	return nil
+}
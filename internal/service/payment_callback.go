@@ -0,0 +1,222 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/pkg/money"
+)
+
+// PaymentSignatureHeader carries the hex HMAC-SHA256 of the raw callback body,
+// keyed with the handler's "webhook_secret" config value. A "sha256=" prefix
+// is accepted.
+const PaymentSignatureHeader = "X-Payment-Signature"
+
+var (
+	ErrPaymentCallbackUnknownHandler  = errors.New("payment_callback_unknown_handler")
+	ErrPaymentCallbackSecretMissing   = errors.New("payment_callback_secret_missing")
+	ErrPaymentCallbackSignature       = errors.New("payment_callback_invalid_signature")
+	ErrPaymentCallbackPayload         = errors.New("payment_callback_invalid_payload")
+	ErrPaymentCallbackAmountMismatch  = errors.New("payment_callback_amount_mismatch")
+	ErrPaymentCallbackOrderNotPayable = errors.New("payment_callback_order_not_payable")
+)
+
+// PaymentWebhookVerifier lets a provider check its own signature scheme in
+// place of the default HMAC.
+type PaymentWebhookVerifier interface {
+	VerifyWebhook(header http.Header, body []byte, secret string) error
+}
+
+type PaymentCallbackPayload struct {
+	OrderID       int64        `json:"order_id"`
+	TransactionID string       `json:"transaction_id"`
+	Amount        money.Amount `json:"amount"`
+	Currency      string       `json:"currency"`
+}
+
+type PaymentCallbackOutcome struct {
+	OrderID   int64
+	PaymentID int64
+	// Duplicate is set when the transaction was already recorded as paid and
+	// its order confirmed; the caller should acknowledge it as is.
+	Duplicate bool
+}
+
+// ProcessCallback verifies a payment callback for the named handler and marks
+// the payment and its order paid together. Every callback, accepted or not,
+// is stored as a PaymentEvent.
+func (s *PaymentService) ProcessCallback(handlerName string, header http.Header, body []byte) (*PaymentCallbackOutcome, error) {
+	if s == nil || s.paymentRepo == nil || s.orderRepo == nil {
+		return nil, errors.New("payment repository unavailable")
+	}
+	var payload PaymentCallbackPayload
+	_ = json.Unmarshal(body, &payload)
+
+	outcome, paymentID, err := s.verifyCallback(handlerName, header, body, &payload)
+	eventType := "callback_accepted"
+	reason := ""
+	switch {
+	case err != nil:
+		eventType = "callback_rejected"
+		reason = err.Error()
+	case outcome.Duplicate:
+		eventType = "callback_duplicate"
+	}
+	s.recordCallbackEvent(paymentID, eventType, handlerName, payload, reason)
+	if err != nil {
+		return nil, err
+	}
+	return outcome, nil
+}
+
+func (s *PaymentService) verifyCallback(handlerName string, header http.Header, body []byte, payload *PaymentCallbackPayload) (*PaymentCallbackOutcome, int64, error) {
+	handlerName = strings.TrimSpace(handlerName)
+	if handlerName == "" || s.handlerRepo == nil {
+		return nil, 0, ErrPaymentCallbackUnknownHandler
+	}
+	handler, err := s.handlerRepo.FindByName(handlerName)
+	if err != nil || handler == nil {
+		return nil, 0, ErrPaymentCallbackUnknownHandler
+	}
+	secret := handlerWebhookSecret(handler)
+	if secret == "" {
+		return nil, 0, ErrPaymentCallbackSecretMissing
+	}
+	if !s.validCallbackSignature(handler.Name, header, body, secret) {
+		return nil, 0, ErrPaymentCallbackSignature
+	}
+
+	if payload.OrderID <= 0 || strings.TrimSpace(payload.TransactionID) == "" || payload.Amount <= 0 {
+		return nil, 0, ErrPaymentCallbackPayload
+	}
+
+	if existing, err := s.paymentRepo.FindByTransactionID(payload.TransactionID); err == nil && existing != nil {
+		if existing.OrderID != payload.OrderID {
+			return nil, existing.ID, ErrPaymentCallbackPayload
+		}
+		// A recorded transaction whose order is still pending (written before
+		// payments and orders were confirmed together) falls through so the
+		// order transition is applied again.
+		if existing.Status == "paid" {
+			if order, err := s.orderRepo.FindByID(existing.OrderID); err != nil || order == nil || order.Status != "pending" {
+				return &PaymentCallbackOutcome{OrderID: existing.OrderID, PaymentID: existing.ID, Duplicate: true}, existing.ID, nil
+			}
+		}
+	}
+
+	order, err := s.orderRepo.FindByID(payload.OrderID)
+	if err != nil || order == nil {
+		return nil, 0, ErrOrderNotFound
+	}
+	payments, _ := s.paymentRepo.FindByOrderID(order.ID)
+	var payment *domain.Payment
+	for _, candidate := range payments {
+		if candidate.TransactionID == payload.TransactionID || (payment == nil && candidate.Status == "pending") {
+			payment = candidate
+		}
+	}
+	paymentID := int64(0)
+	if payment != nil {
+		paymentID = payment.ID
+	}
+
+	currency := order.Currency
+	if currency == "" {
+		currency = money.DefaultCurrency
+	}
+	if payload.Amount != order.Total || !strings.EqualFold(strings.TrimSpace(payload.Currency), currency) {
+		return nil, paymentID, ErrPaymentCallbackAmountMismatch
+	}
+	if order.Status != "pending" {
+		return nil, paymentID, ErrPaymentCallbackOrderNotPayable
+	}
+
+	if payment == nil {
+		payment = &domain.Payment{
+			OrderID:       order.ID,
+			UserID:        order.UserID,
+			Amount:        payload.Amount,
+			PaymentMethod: handler.Name,
+		}
+	}
+	payment.TransactionID = payload.TransactionID
+	if _, err := s.orderService().ConfirmPayment(payment, s.paymentRepo, "payment_callback"); err != nil {
+		if errors.Is(err, ErrOrderStatusChanged) {
+			return nil, paymentID, ErrPaymentCallbackOrderNotPayable
+		}
+		return nil, paymentID, err
+	}
+	return &PaymentCallbackOutcome{OrderID: order.ID, PaymentID: payment.ID}, payment.ID, nil
+}
+
+func (s *PaymentService) recordCallbackEvent(paymentID int64, eventType, handlerName string, payload PaymentCallbackPayload, reason string) {
+	if s.eventRepo == nil {
+		return
+	}
+	data := map[string]interface{}{
+		"handler":        handlerName,
+		"order_id":       payload.OrderID,
+		"transaction_id": payload.TransactionID,
+		"amount":         payload.Amount,
+		"currency":       payload.Currency,
+	}
+	if reason != "" {
+		data["reason"] = reason
+	}
+	raw, _ := json.Marshal(data)
+	text := string(raw)
+	_ = s.eventRepo.Create(&domain.PaymentEvent{
+		PaymentID: paymentID,
+		EventType: eventType,
+		Payload:   &text,
+		CreatedAt: time.Now(),
+	})
+}
+
+// validCallbackSignature uses the provider's own verification when it has one
+// and the default HMAC otherwise.
+func (s *PaymentService) validCallbackSignature(handlerName string, header http.Header, body []byte, secret string) bool {
+	if provider, ok := s.providers.Lookup(handlerName); ok {
+		if verifier, ok := provider.(PaymentWebhookVerifier); ok {
+			return verifier.VerifyWebhook(header, body, secret) == nil
+		}
+	}
+	return validPaymentSignature(header.Get(PaymentSignatureHeader), body, secret)
+}
+
+// SignPaymentCallback returns the signature header value for body, for
+// providers and tests that post callbacks.
+func SignPaymentCallback(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func validPaymentSignature(signature string, body []byte, secret string) bool {
+	signature = strings.TrimSpace(signature)
+	if signature == "" {
+		return false
+	}
+	signature = strings.TrimPrefix(signature, "sha256=")
+	expected := strings.TrimPrefix(SignPaymentCallback(body, secret), "sha256=")
+	return hmac.Equal([]byte(strings.ToLower(signature)), []byte(expected))
+}
+
+func handlerWebhookSecret(handler *domain.PaymentHandler) string {
+	if handler == nil || handler.Config == "" {
+		return ""
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal([]byte(handler.Config), &config); err != nil {
+		return ""
+	}
+	secret, _ := config["webhook_secret"].(string)
+	return strings.TrimSpace(secret)
+}
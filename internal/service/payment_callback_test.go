@@ -0,0 +1,151 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/meowucp/internal/domain"
+)
+
+type fakeCallbackPaymentRepo struct {
+	items []*domain.Payment
+}
+
+func (f *fakeCallbackPaymentRepo) Create(payment *domain.Payment) error {
+	payment.ID = int64(len(f.items) + 1)
+	f.items = append(f.items, payment)
+	return nil
+}
+func (f *fakeCallbackPaymentRepo) Update(payment *domain.Payment) error { return nil }
+func (f *fakeCallbackPaymentRepo) FindByID(id int64) (*domain.Payment, error) {
+	return nil, errors.New("not found")
+}
+func (f *fakeCallbackPaymentRepo) FindByOrderID(orderID int64) ([]*domain.Payment, error) {
+	var result []*domain.Payment
+	for _, item := range f.items {
+		if item.OrderID == orderID {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+func (f *fakeCallbackPaymentRepo) FindByTransactionID(transactionID string) (*domain.Payment, error) {
+	for _, item := range f.items {
+		if item.TransactionID == transactionID {
+			return item, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+func (f *fakeCallbackPaymentRepo) List(offset, limit int, filters map[string]interface{}) ([]*domain.Payment, error) {
+	return f.items, nil
+}
+func (f *fakeCallbackPaymentRepo) Count(filters map[string]interface{}) (int64, error) {
+	return int64(len(f.items)), nil
+}
+
+type fakePaymentHandlerRepo struct {
+	handlers map[string]*domain.PaymentHandler
+}
+
+func (f *fakePaymentHandlerRepo) Create(handler *domain.PaymentHandler) error { return nil }
+func (f *fakePaymentHandlerRepo) Update(handler *domain.PaymentHandler) error { return nil }
+func (f *fakePaymentHandlerRepo) FindByID(id int64) (*domain.PaymentHandler, error) {
+	for _, handler := range f.handlers {
+		if handler.ID == id {
+			return handler, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+func (f *fakePaymentHandlerRepo) FindByName(name string) (*domain.PaymentHandler, error) {
+	if handler, ok := f.handlers[name]; ok {
+		return handler, nil
+	}
+	return nil, errors.New("not found")
+}
+func (f *fakePaymentHandlerRepo) List() ([]*domain.PaymentHandler, error) { return nil, nil }
+
+func newCallbackPaymentService(order *domain.Order) (*PaymentService, *fakeCallbackPaymentRepo, *fakePaymentEventRepo) {
+	paymentRepo := &fakeCallbackPaymentRepo{items: []*domain.Payment{{ID: 1, OrderID: order.ID, Amount: order.Total, Status: "pending"}}}
+	eventRepo := &fakePaymentEventRepo{}
+	svc := NewPaymentServiceWithDeps(paymentRepo, &fakePaymentOrderRepo{order: order}, &fakePaymentRefundRepo{}, eventRepo)
+	svc.SetProviders(NewPaymentProviderRegistry(), &fakePaymentHandlerRepo{handlers: map[string]*domain.PaymentHandler{
+		"com.nowpayments": {ID: 1, Name: "com.nowpayments", Config: `{"webhook_secret":"s3cret"}`},
+	}})
+	return svc, paymentRepo, eventRepo
+}
+
+func signedHeader(body []byte, secret string) http.Header {
+	header := http.Header{}
+	header.Set(PaymentSignatureHeader, SignPaymentCallback(body, secret))
+	return header
+}
+
+func TestPaymentCallbackVerifiesSignatureAndDeduplicates(t *testing.T) {
+	svc, paymentRepo, eventRepo := newCallbackPaymentService(&domain.Order{ID: 7, Status: "pending", Total: 1999, Currency: "CNY"})
+	body := []byte(`{"order_id":7,"transaction_id":"tx_1","amount":1999,"currency":"CNY"}`)
+
+	if _, err := svc.ProcessCallback("com.nowpayments", signedHeader(body, "wrong"), body); !errors.Is(err, ErrPaymentCallbackSignature) {
+		t.Fatalf("expected signature rejection, got %v", err)
+	}
+	outcome, err := svc.ProcessCallback("com.nowpayments", signedHeader(body, "s3cret"), body)
+	if err != nil || outcome.Duplicate || outcome.OrderID != 7 {
+		t.Fatalf("expected accepted callback, got %+v %v", outcome, err)
+	}
+	if paymentRepo.items[0].Status != "paid" || paymentRepo.items[0].TransactionID != "tx_1" {
+		t.Fatalf("expected pending payment to be marked paid, got %+v", paymentRepo.items[0])
+	}
+	if order, _ := svc.orderRepo.FindByID(7); order.Status != "paid" || order.PaymentStatus != "paid" {
+		t.Fatalf("expected order to be marked paid with the payment, got %+v", order)
+	}
+	outcome, err = svc.ProcessCallback("com.nowpayments", signedHeader(body, "s3cret"), body)
+	if err != nil || !outcome.Duplicate {
+		t.Fatalf("expected duplicate callback, got %+v %v", outcome, err)
+	}
+
+	var types []string
+	for _, event := range eventRepo.events {
+		types = append(types, event.EventType)
+	}
+	if len(types) != 3 || types[0] != "callback_rejected" || types[1] != "callback_accepted" || types[2] != "callback_duplicate" {
+		t.Fatalf("expected every callback to be recorded, got %v", types)
+	}
+}
+
+func TestPaymentCallbackReappliesPaidTransactionToPendingOrder(t *testing.T) {
+	svc, paymentRepo, eventRepo := newCallbackPaymentService(&domain.Order{ID: 7, Status: "pending", Total: 1999, Currency: "CNY"})
+	paymentRepo.items[0].Status = "paid"
+	paymentRepo.items[0].TransactionID = "tx_1"
+	body := []byte(`{"order_id":7,"transaction_id":"tx_1","amount":1999,"currency":"CNY"}`)
+
+	outcome, err := svc.ProcessCallback("com.nowpayments", signedHeader(body, "s3cret"), body)
+	if err != nil || outcome.Duplicate || outcome.PaymentID != 1 {
+		t.Fatalf("expected the order transition to be re-applied, got %+v %v", outcome, err)
+	}
+	if order, _ := svc.orderRepo.FindByID(7); order.Status != "paid" {
+		t.Fatalf("expected order paid, got %s", order.Status)
+	}
+	if len(paymentRepo.items) != 1 || eventRepo.events[0].EventType != "callback_accepted" {
+		t.Fatalf("expected the recorded payment to be reused, got %d payments", len(paymentRepo.items))
+	}
+}
+
+func TestPaymentCallbackRejectsAmountAndCurrencyMismatch(t *testing.T) {
+	svc, _, eventRepo := newCallbackPaymentService(&domain.Order{ID: 7, Status: "pending", Total: 1999, Currency: "CNY"})
+	for _, body := range [][]byte{
+		[]byte(`{"order_id":7,"transaction_id":"tx_1","amount":1,"currency":"CNY"}`),
+		[]byte(`{"order_id":7,"transaction_id":"tx_1","amount":1999,"currency":"USD"}`),
+	} {
+		if _, err := svc.ProcessCallback("com.nowpayments", signedHeader(body, "s3cret"), body); !errors.Is(err, ErrPaymentCallbackAmountMismatch) {
+			t.Fatalf("expected mismatch for %s, got %v", body, err)
+		}
+	}
+	if _, err := svc.ProcessCallback("com.unknown", http.Header{}, []byte(`{}`)); !errors.Is(err, ErrPaymentCallbackUnknownHandler) {
+		t.Fatalf("expected unknown handler, got %v", err)
+	}
+	if len(eventRepo.events) != 3 {
+		t.Fatalf("expected rejected callbacks to be recorded, got %d", len(eventRepo.events))
+	}
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/meowucp/pkg/money"
+)
+
+const (
+	PaymentResultAuthorized     = "authorized"
+	PaymentResultCaptured       = "captured"
+	PaymentResultVoided         = "voided"
+	PaymentResultRefunded       = "refunded"
+	PaymentResultDeclined       = "declined"
+	PaymentResultActionRequired = "action_required"
+)
+
+var (
+	ErrPaymentProviderNotFound    = errors.New("payment_provider_not_found")
+	ErrPaymentTimeout             = errors.New("payment_provider_timeout")
+	ErrPaymentTransactionNotFound = errors.New("payment_transaction_not_found")
+	ErrPaymentInvalidState        = errors.New("payment_transaction_invalid_state")
+	ErrPaymentAmountExceeded      = errors.New("payment_amount_exceeded")
+	// ErrPaymentDeferred is returned for a published handler that no provider
+	// serves: the order is placed unpaid and settled by the handler's callback.
+	ErrPaymentDeferred = errors.New("payment_deferred")
+)
+
+// PaymentProvider moves money for a payment handler. Providers are registered
+// under the PaymentHandler.Name they serve.
+//
+// A declined or escalated authorization is a result, not an error; errors are
+// reserved for transport failures and invalid operations.
+type PaymentProvider interface {
+	Authorize(req PaymentAuthorizeRequest) (*PaymentProviderResult, error)
+	Capture(transactionID string, amount money.Amount) (*PaymentProviderResult, error)
+	Void(transactionID string) (*PaymentProviderResult, error)
+	Refund(transactionID string, amount money.Amount) (*PaymentProviderResult, error)
+	ParseWebhook(header http.Header, body []byte) (*PaymentWebhookEvent, error)
+}
+
+type PaymentAuthorizeRequest struct {
+	// IdempotencyKey makes retried authorizations return the original
+	// transaction instead of charging twice.
+	IdempotencyKey string
+	Reference      string
+	Amount         money.Amount
+	Currency       string
+	Credential     map[string]interface{}
+	Config         map[string]interface{}
+}
+
+type PaymentProviderResult struct {
+	Status        string
+	TransactionID string
+	Amount        money.Amount
+	DeclineCode   string
+	ActionURL     string
+}
+
+type PaymentWebhookEvent struct {
+	Type          string
+	TransactionID string
+	Reference     string
+	Amount        money.Amount
+	Currency      string
+}
+
+type PaymentProviderRegistry struct {
+	mu        sync.RWMutex
+	providers map[string]PaymentProvider
+}
+
+func NewPaymentProviderRegistry() *PaymentProviderRegistry {
+	return &PaymentProviderRegistry{providers: map[string]PaymentProvider{}}
+}
+
+func (r *PaymentProviderRegistry) Register(name string, provider PaymentProvider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[strings.TrimSpace(name)] = provider
+}
+
+func (r *PaymentProviderRegistry) Lookup(name string) (PaymentProvider, bool) {
+	if r == nil {
+		return nil, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	provider, ok := r.providers[strings.TrimSpace(name)]
+	return provider, ok
+}
@@ -0,0 +1,340 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/repository"
+	"github.com/meowucp/pkg/money"
+)
+
+const (
+	RefundStatusPending   = "pending"
+	RefundStatusSucceeded = "succeeded"
+	RefundStatusFailed    = "failed"
+)
+
+var (
+	ErrRefundInvalidAmount        = errors.New("invalid_refund_amount")
+	ErrRefundExceedsPayment       = errors.New("refund_amount_exceeds_payment")
+	ErrRefundPaymentNotFound      = errors.New("payment_not_found")
+	ErrRefundPaymentNotRefundable = errors.New("payment_not_refundable")
+	ErrRefundNotFound             = errors.New("refund_not_found")
+	ErrRefundNotPending           = errors.New("refund_not_pending")
+	ErrRefundInvalidItem          = errors.New("invalid_refund_item")
+	ErrRefundItemQuantity         = errors.New("refund_item_quantity_exceeded")
+	ErrRefundOrderNotRefundable   = errors.New("order_not_refundable")
+)
+
+// RefundItemRequest returns quantity units of an order line with the refund.
+type RefundItemRequest struct {
+	OrderItemID int64 `json:"order_item_id"`
+	Quantity    int   `json:"quantity"`
+}
+
+// CreateRefund opens a pending refund against a payment. The amount is checked
+// against what is left after earlier pending and succeeded refunds, and items
+// against the quantities not yet refunded. A refund that completes the payment
+// is refused while the order cannot move to "refunded"; a cancelled order
+// takes it and stays cancelled. When a provider
+// serves the payment's handler the refund is sent straight away and settled
+// from its answer; otherwise it stays pending until ConfirmRefund.
+func (s *PaymentService) CreateRefund(paymentID int64, amount money.Amount, reason string, items []RefundItemRequest) (*domain.PaymentRefund, error) {
+	if s == nil || s.paymentRepo == nil || s.orderRepo == nil || s.refundRepo == nil || s.eventRepo == nil {
+		return nil, errors.New("refund_dependencies_unavailable")
+	}
+	if amount <= 0 {
+		return nil, ErrRefundInvalidAmount
+	}
+	payment, err := s.paymentRepo.FindByID(paymentID)
+	if err != nil || payment == nil {
+		return nil, ErrRefundPaymentNotFound
+	}
+	if payment.Status != "paid" && payment.Status != "partially_refunded" {
+		return nil, ErrRefundPaymentNotRefundable
+	}
+
+	existing, err := s.refundRepo.ListByPaymentID(paymentID)
+	if err != nil {
+		return nil, err
+	}
+	committed := money.Amount(0)
+	for _, refund := range existing {
+		if refund.Status != RefundStatusFailed {
+			committed += refund.Amount
+		}
+	}
+	if committed+amount > payment.Amount {
+		return nil, ErrRefundExceedsPayment
+	}
+	if committed+amount == payment.Amount {
+		order, err := s.orderRepo.FindByID(payment.OrderID)
+		if err != nil || order == nil {
+			return nil, ErrOrderNotFound
+		}
+		if order.Status != "cancelled" && !CanTransitionOrderStatus(order.Status, "refunded") {
+			return nil, ErrRefundOrderNotRefundable
+		}
+	}
+
+	refundItems, err := s.refundItems(payment.OrderID, existing, items)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	refund := &domain.PaymentRefund{
+		PaymentID: paymentID,
+		OrderID:   payment.OrderID,
+		Amount:    amount,
+		Status:    RefundStatusPending,
+		Reason:    reason,
+		Items:     refundItems,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.refundRepo.CreateWithinLimit(refund, payment.Amount); err != nil {
+		if errors.Is(err, repository.ErrRefundLimitExceeded) {
+			return nil, ErrRefundExceedsPayment
+		}
+		return nil, err
+	}
+	if err := s.recordRefundEvent(refund, "refund_created"); err != nil {
+		return nil, err
+	}
+
+	// Payments no provider serves (none configured, or a handler such as
+	// NOWPayments that is settled by callback) are refunded by hand and
+	// settled by ConfirmRefund.
+	if s.providers == nil {
+		return refund, nil
+	}
+	provider, _, _, err := s.resolveProvider(payment.PaymentMethod)
+	if err != nil {
+		if errors.Is(err, ErrPaymentProviderNotFound) || errors.Is(err, ErrPaymentDeferred) {
+			return refund, nil
+		}
+		return nil, err
+	}
+	result, err := provider.Refund(payment.TransactionID, amount)
+	if err != nil {
+		if settleErr := s.settleRefund(refund, payment, false, "", err.Error()); settleErr != nil {
+			return nil, settleErr
+		}
+		return nil, err
+	}
+	if result.Status != PaymentResultRefunded {
+		if result.TransactionID != "" {
+			// Written through Settle so a confirmation that got in first is
+			// not overwritten with "pending".
+			externalRef := result.TransactionID
+			refund.ExternalRef = &externalRef
+			_, _ = s.refundRepo.Settle(refund)
+		}
+		return refund, nil
+	}
+	if err := s.settleRefund(refund, payment, true, result.TransactionID, ""); err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+// ConfirmRefund settles a pending refund once the provider (or an operator)
+// reports the outcome.
+func (s *PaymentService) ConfirmRefund(refundID int64, succeeded bool, externalRef, failureReason string) (*domain.PaymentRefund, error) {
+	if s == nil || s.paymentRepo == nil || s.refundRepo == nil {
+		return nil, errors.New("refund_dependencies_unavailable")
+	}
+	refund, err := s.refundRepo.FindByID(refundID)
+	if err != nil || refund == nil {
+		return nil, ErrRefundNotFound
+	}
+	if refund.Status != RefundStatusPending {
+		return nil, ErrRefundNotPending
+	}
+	payment, err := s.paymentRepo.FindByID(refund.PaymentID)
+	if err != nil || payment == nil {
+		return nil, ErrRefundPaymentNotFound
+	}
+	if err := s.settleRefund(refund, payment, succeeded, externalRef, failureReason); err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+func (s *PaymentService) ListOrderRefunds(orderID int64) ([]*domain.PaymentRefund, error) {
+	if s == nil || s.refundRepo == nil {
+		return nil, errors.New("refund_dependencies_unavailable")
+	}
+	return s.refundRepo.ListByOrderID(orderID)
+}
+
+func (s *PaymentService) refundItems(orderID int64, existing []*domain.PaymentRefund, items []RefundItemRequest) ([]domain.PaymentRefundItem, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	order, err := s.orderRepo.FindByID(orderID)
+	if err != nil || order == nil {
+		return nil, ErrOrderNotFound
+	}
+	lines := map[int64]domain.OrderItem{}
+	for _, line := range order.Items {
+		lines[line.ID] = line
+	}
+	refunded := map[int64]int{}
+	for _, refund := range existing {
+		if refund.Status == RefundStatusFailed {
+			continue
+		}
+		for _, item := range refund.Items {
+			refunded[item.OrderItemID] += item.Quantity
+		}
+	}
+
+	result := make([]domain.PaymentRefundItem, 0, len(items))
+	for _, item := range items {
+		line, ok := lines[item.OrderItemID]
+		if !ok || item.Quantity <= 0 {
+			return nil, ErrRefundInvalidItem
+		}
+		refunded[item.OrderItemID] += item.Quantity
+		if refunded[item.OrderItemID] > line.Quantity {
+			return nil, ErrRefundItemQuantity
+		}
+		result = append(result, domain.PaymentRefundItem{
+			OrderItemID: line.ID,
+			ProductID:   line.ProductID,
+			Quantity:    item.Quantity,
+			CreatedAt:   time.Now(),
+		})
+	}
+	return result, nil
+}
+
+// settleRefund moves a pending refund to succeeded or failed. A success rolls
+// the payment (and, once fully refunded, the order) forward and restocks the
+// refunded items. A cancelled order keeps its status, and its items are not
+// restocked again since cancelling already put them back.
+func (s *PaymentService) settleRefund(refund *domain.PaymentRefund, payment *domain.Payment, succeeded bool, externalRef, failureReason string) error {
+	now := time.Now()
+	refund.UpdatedAt = now
+	if externalRef != "" {
+		refund.ExternalRef = &externalRef
+	}
+	if !succeeded {
+		refund.Status = RefundStatusFailed
+		refund.FailureReason = failureReason
+		if err := s.writeSettlement(refund); err != nil {
+			return err
+		}
+		return s.recordRefundEvent(refund, "refund_failed")
+	}
+
+	refund.Status = RefundStatusSucceeded
+	refund.CompletedAt = &now
+	if err := s.writeSettlement(refund); err != nil {
+		return err
+	}
+
+	refunds, err := s.refundRepo.ListByPaymentID(payment.ID)
+	if err != nil {
+		return err
+	}
+	total := money.Amount(0)
+	for _, item := range refunds {
+		if item.Status == RefundStatusSucceeded {
+			total += item.Amount
+		}
+	}
+	payment.Status = "partially_refunded"
+	if total >= payment.Amount {
+		payment.Status = "refunded"
+	}
+	if err := s.paymentRepo.Update(payment); err != nil {
+		return err
+	}
+
+	order, err := s.orderRepo.FindByID(payment.OrderID)
+	if err != nil || order == nil {
+		return ErrOrderNotFound
+	}
+	cancelled := order.Status == "cancelled"
+	if payment.Status == "refunded" && !cancelled {
+		// CreateRefund refused full refunds the order could not take; an order
+		// that moved on (say, shipped) while the refund was pending keeps its
+		// status, and the payment still records the refund.
+		if err := s.orderService().RefundOrder(payment.OrderID, "payment_refund"); err != nil && !errors.Is(err, ErrInvalidOrderTransition) {
+			return err
+		}
+	}
+
+	if s.inventory != nil && !cancelled {
+		for _, item := range refund.Items {
+			if item.ProductID == nil {
+				continue
+			}
+			if err := s.inventory.AdjustStock(
+				*item.ProductID,
+				item.Quantity,
+				"in",
+				strconv.FormatInt(refund.ID, 10),
+				"payment_refund",
+				fmt.Sprintf("Refund %d for order %d", refund.ID, refund.OrderID),
+			); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.recordRefundEvent(refund, "refund_succeeded")
+}
+
+// writeSettlement stores refund's outcome if it is still pending. A refund
+// another caller settled first returns ErrRefundNotPending, so its payment,
+// stock and events are only touched once.
+func (s *PaymentService) writeSettlement(refund *domain.PaymentRefund) error {
+	settled, err := s.refundRepo.Settle(refund)
+	if err != nil {
+		return err
+	}
+	if !settled {
+		return ErrRefundNotPending
+	}
+	return nil
+}
+
+// orderService returns the configured OrderService, or one over orderRepo
+// that still checks transitions when none was set.
+func (s *PaymentService) orderService() *OrderService {
+	if s.orders != nil {
+		return s.orders
+	}
+	return NewOrderService(s.orderRepo, nil, nil, nil, nil)
+}
+
+func (s *PaymentService) recordRefundEvent(refund *domain.PaymentRefund, eventType string) error {
+	if s.eventRepo == nil {
+		return nil
+	}
+	data := map[string]interface{}{
+		"refund_id":  refund.ID,
+		"payment_id": refund.PaymentID,
+		"amount":     refund.Amount,
+		"reason":     refund.Reason,
+	}
+	if refund.FailureReason != "" {
+		data["failure_reason"] = refund.FailureReason
+	}
+	payload, _ := json.Marshal(data)
+	payloadText := string(payload)
+	return s.eventRepo.Create(&domain.PaymentEvent{
+		PaymentID: refund.PaymentID,
+		EventType: eventType,
+		Payload:   &payloadText,
+		CreatedAt: time.Now(),
+	})
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/meowucp/internal/domain"
+)
+
+func TestPaymentRefundCumulativeLimitAndRestock(t *testing.T) {
+	productID := int64(5)
+	paymentRepo := &fakePaymentRepo{payment: &domain.Payment{ID: 10, OrderID: 20, Amount: 1000, Status: "paid"}}
+	orderRepo := &fakePaymentOrderRepo{order: &domain.Order{ID: 20, Status: "paid", PaymentStatus: "paid", Items: []domain.OrderItem{
+		{ID: 3, OrderID: 20, ProductID: &productID, Quantity: 2, UnitPrice: 500, TotalPrice: 1000},
+	}}}
+	refundRepo := &fakePaymentRefundRepo{}
+	eventRepo := &fakePaymentEventRepo{}
+	productRepo := &fakeProductRepo{products: map[int64]*domain.Product{productID: {ID: productID, StockQuantity: 1}}}
+
+	svc := NewPaymentServiceWithDeps(paymentRepo, orderRepo, refundRepo, eventRepo)
+	svc.SetInventory(NewInventoryService(productRepo, &fakeInventoryRepo{}))
+
+	first, err := svc.CreateRefund(10, 600, "damaged", []RefundItemRequest{{OrderItemID: 3, Quantity: 1}})
+	if err != nil {
+		t.Fatalf("create refund: %v", err)
+	}
+	// Pending refunds still count towards the limit.
+	if _, err := svc.CreateRefund(10, 500, "again", nil); !errors.Is(err, ErrRefundExceedsPayment) {
+		t.Fatalf("expected cumulative limit, got %v", err)
+	}
+	if _, err := svc.CreateRefund(10, 100, "again", []RefundItemRequest{{OrderItemID: 3, Quantity: 2}}); !errors.Is(err, ErrRefundItemQuantity) {
+		t.Fatalf("expected item quantity limit, got %v", err)
+	}
+	if _, err := svc.CreateRefund(10, 100, "again", []RefundItemRequest{{OrderItemID: 99, Quantity: 1}}); !errors.Is(err, ErrRefundInvalidItem) {
+		t.Fatalf("expected unknown order item to be rejected, got %v", err)
+	}
+	if productRepo.products[productID].StockQuantity != 1 {
+		t.Fatalf("expected stock untouched before confirmation")
+	}
+
+	if _, err := svc.ConfirmRefund(first.ID, true, "rf_1", ""); err != nil {
+		t.Fatalf("confirm refund: %v", err)
+	}
+	if productRepo.products[productID].StockQuantity != 2 {
+		t.Fatalf("expected refunded item to be restocked, got %d", productRepo.products[productID].StockQuantity)
+	}
+	if _, err := svc.ConfirmRefund(first.ID, false, "", "late"); !errors.Is(err, ErrRefundNotPending) {
+		t.Fatalf("expected settled refund to be final, got %v", err)
+	}
+
+	// A failed refund frees its amount again.
+	second, err := svc.CreateRefund(10, 400, "rest", nil)
+	if err != nil {
+		t.Fatalf("create second refund: %v", err)
+	}
+	if _, err := svc.ConfirmRefund(second.ID, false, "", "provider_error"); err != nil {
+		t.Fatalf("fail refund: %v", err)
+	}
+	third, err := svc.CreateRefund(10, 400, "rest", []RefundItemRequest{{OrderItemID: 3, Quantity: 1}})
+	if err != nil {
+		t.Fatalf("create third refund: %v", err)
+	}
+	if _, err := svc.ConfirmRefund(third.ID, true, "", ""); err != nil {
+		t.Fatalf("confirm third refund: %v", err)
+	}
+	if paymentRepo.payment.Status != "refunded" || orderRepo.order.Status != "refunded" {
+		t.Fatalf("expected payment and order to be fully refunded, got %s/%s", paymentRepo.payment.Status, orderRepo.order.Status)
+	}
+
+	refunds, err := svc.ListOrderRefunds(20)
+	if err != nil || len(refunds) != 3 {
+		t.Fatalf("expected three refunds for the order, got %d %v", len(refunds), err)
+	}
+}
+
+func TestPaymentRefundWithoutProviderStaysPending(t *testing.T) {
+	paymentRepo := &fakePaymentRepo{payment: &domain.Payment{ID: 10, OrderID: 20, Amount: 1000, Status: "paid", PaymentMethod: "com.nowpayments"}}
+	orderRepo := &fakePaymentOrderRepo{order: &domain.Order{ID: 20, Status: "paid", PaymentStatus: "paid"}}
+	refundRepo := &fakePaymentRefundRepo{}
+	svc := NewPaymentServiceWithDeps(paymentRepo, orderRepo, refundRepo, &fakePaymentEventRepo{})
+	providers := NewPaymentProviderRegistry()
+	providers.Register(SandboxProviderName, NewSandboxPaymentProvider())
+	svc.SetProviders(providers, nil)
+
+	refund, err := svc.CreateRefund(10, 400, "return", nil)
+	if err != nil {
+		t.Fatalf("create refund: %v", err)
+	}
+	if refund.Status != RefundStatusPending {
+		t.Fatalf("expected a refund no provider serves to stay pending, got %s", refund.Status)
+	}
+	if paymentRepo.payment.Status != "paid" {
+		t.Fatalf("expected payment untouched, got %s", paymentRepo.payment.Status)
+	}
+}
+
+func TestPaymentRefundFullRefundFollowsOrderTransitions(t *testing.T) {
+	paymentRepo := &fakePaymentRepo{payment: &domain.Payment{ID: 10, OrderID: 20, Amount: 1000, Status: "paid"}}
+	orderRepo := &fakePaymentOrderRepo{order: &domain.Order{ID: 20, Status: "shipped", PaymentStatus: "paid"}}
+	svc := NewPaymentServiceWithDeps(paymentRepo, orderRepo, &fakePaymentRefundRepo{}, &fakePaymentEventRepo{})
+	logs := &fakeOrderStatusLogRepo{}
+	orders := NewOrderService(orderRepo, nil, nil, nil, nil)
+	orders.SetStatusLogRepo(logs)
+	svc.SetOrders(orders)
+
+	if _, err := svc.CreateRefund(10, 1000, "return", nil); !errors.Is(err, ErrRefundOrderNotRefundable) {
+		t.Fatalf("expected a full refund of a shipped order to be refused, got %v", err)
+	}
+	if _, err := svc.CreateRefund(10, 300, "partial", nil); err != nil {
+		t.Fatalf("expected a partial refund of a shipped order to be allowed, got %v", err)
+	}
+
+	orderRepo.order.Status = "delivered"
+	refund, err := svc.CreateRefund(10, 700, "return", nil)
+	if err != nil {
+		t.Fatalf("create refund: %v", err)
+	}
+	if _, err := svc.ConfirmRefund(1, true, "", ""); err != nil {
+		t.Fatalf("confirm first refund: %v", err)
+	}
+	if _, err := svc.ConfirmRefund(refund.ID, true, "", ""); err != nil {
+		t.Fatalf("confirm refund: %v", err)
+	}
+	if orderRepo.order.Status != "refunded" {
+		t.Fatalf("expected a delivered order to be refunded, got %s", orderRepo.order.Status)
+	}
+	if len(logs.logs) != 1 || logs.logs[0].FromStatus != "delivered" || logs.logs[0].Reason != "payment_refund" {
+		t.Fatalf("expected the refund transition to be logged, got %+v", logs.logs)
+	}
+}
+
+func TestPaymentRefundOfCancelledOrderKeepsStatusAndStock(t *testing.T) {
+	productID := int64(5)
+	paymentRepo := &fakePaymentRepo{payment: &domain.Payment{ID: 10, OrderID: 20, Amount: 1000, Status: "paid"}}
+	orderRepo := &fakePaymentOrderRepo{order: &domain.Order{ID: 20, Status: "cancelled", PaymentStatus: "paid", Items: []domain.OrderItem{
+		{ID: 3, OrderID: 20, ProductID: &productID, Quantity: 2, UnitPrice: 500, TotalPrice: 1000},
+	}}}
+	productRepo := &fakeProductRepo{products: map[int64]*domain.Product{productID: {ID: productID, StockQuantity: 2}}}
+	svc := NewPaymentServiceWithDeps(paymentRepo, orderRepo, &fakePaymentRefundRepo{}, &fakePaymentEventRepo{})
+	svc.SetInventory(NewInventoryService(productRepo, &fakeInventoryRepo{}))
+
+	refund, err := svc.CreateRefund(10, 1000, "cancelled", []RefundItemRequest{{OrderItemID: 3, Quantity: 2}})
+	if err != nil {
+		t.Fatalf("expected a cancelled order to be fully refundable, got %v", err)
+	}
+	if _, err := svc.ConfirmRefund(refund.ID, true, "", ""); err != nil {
+		t.Fatalf("confirm refund: %v", err)
+	}
+	if paymentRepo.payment.Status != "refunded" || orderRepo.order.Status != "cancelled" {
+		t.Fatalf("expected the payment refunded and the order still cancelled, got %s/%s", paymentRepo.payment.Status, orderRepo.order.Status)
+	}
+	if productRepo.products[productID].StockQuantity != 2 {
+		t.Fatalf("expected cancelled items not to be restocked twice, got %d", productRepo.products[productID].StockQuantity)
+	}
+}
+
+func TestPaymentRefundSettlesOnceUnderRacingConfirmations(t *testing.T) {
+	productID := int64(5)
+	paymentRepo := &fakePaymentRepo{payment: &domain.Payment{ID: 10, OrderID: 20, Amount: 1000, Status: "paid"}}
+	orderRepo := &fakePaymentOrderRepo{order: &domain.Order{ID: 20, Status: "paid", PaymentStatus: "paid", Items: []domain.OrderItem{
+		{ID: 3, OrderID: 20, ProductID: &productID, Quantity: 2, UnitPrice: 500, TotalPrice: 1000},
+	}}}
+	refundRepo := &fakePaymentRefundRepo{}
+	eventRepo := &fakePaymentEventRepo{}
+	productRepo := &fakeProductRepo{products: map[int64]*domain.Product{productID: {ID: productID, StockQuantity: 0}}}
+	svc := NewPaymentServiceWithDeps(paymentRepo, orderRepo, refundRepo, eventRepo)
+	svc.SetInventory(NewInventoryService(productRepo, &fakeInventoryRepo{}))
+
+	refund, err := svc.CreateRefund(10, 500, "damaged", []RefundItemRequest{{OrderItemID: 3, Quantity: 1}})
+	if err != nil {
+		t.Fatalf("create refund: %v", err)
+	}
+	// Both confirmations read the refund while it was still pending.
+	stale, _ := refundRepo.FindByID(refund.ID)
+	if _, err := svc.ConfirmRefund(refund.ID, true, "", ""); err != nil {
+		t.Fatalf("confirm refund: %v", err)
+	}
+	if err := svc.settleRefund(stale, paymentRepo.payment, true, "", ""); !errors.Is(err, ErrRefundNotPending) {
+		t.Fatalf("expected the losing confirmation to be refused, got %v", err)
+	}
+	if productRepo.products[productID].StockQuantity != 1 {
+		t.Fatalf("expected the refunded item restocked once, got %d", productRepo.products[productID].StockQuantity)
+	}
+	succeeded := 0
+	for _, event := range eventRepo.events {
+		if event.EventType == "refund_succeeded" {
+			succeeded++
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("expected one refund_succeeded event, got %d", succeeded)
+	}
+}
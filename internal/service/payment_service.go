@@ -3,10 +3,13 @@ package service
 import (
 	"encoding/json"
 	"errors"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/meowucp/internal/domain"
 	"github.com/meowucp/internal/repository"
+	"github.com/meowucp/pkg/money"
 )
 
 type PaymentService struct {
@@ -14,6 +17,20 @@ type PaymentService struct {
 	orderRepo   repository.OrderRepository
 	refundRepo  repository.PaymentRefundRepository
 	eventRepo   repository.PaymentEventRepository
+	providers   *PaymentProviderRegistry
+	handlerRepo repository.PaymentHandlerRepository
+	inventory   *InventoryService
+	orders      *OrderService
+}
+
+// PaymentChargeRequest is a checkout payment to authorize and capture.
+type PaymentChargeRequest struct {
+	HandlerID      string
+	IdempotencyKey string
+	Reference      string
+	Amount         money.Amount
+	Currency       string
+	Credential     interface{}
 }
 
 func NewPaymentService(paymentRepo repository.PaymentRepository, orderRepo repository.OrderRepository) *PaymentService {
@@ -32,11 +49,29 @@ func NewPaymentServiceWithDeps(paymentRepo repository.PaymentRepository, orderRe
 	}
 }
 
+// SetProviders routes charges and refunds through the registered providers.
+// Handler ids are resolved to PaymentHandler names via handlerRepo when set.
+func (s *PaymentService) SetProviders(registry *PaymentProviderRegistry, handlerRepo repository.PaymentHandlerRepository) {
+	s.providers = registry
+	s.handlerRepo = handlerRepo
+}
+
+// SetOrders routes order status changes made by payments (full refunds)
+// through OrderService so they are validated, logged and announced.
+func (s *PaymentService) SetOrders(orders *OrderService) {
+	s.orders = orders
+}
+
+// SetInventory lets succeeded refunds put refunded items back into stock.
+func (s *PaymentService) SetInventory(inventory *InventoryService) {
+	s.inventory = inventory
+}
+
 func (s *PaymentService) CreatePayment(payment *domain.Payment) error {
 	return s.paymentRepo.Create(payment)
 }
 
-func (s *PaymentService) ProcessPayment(orderID int64, amount float64, paymentMethod string) (*domain.Payment, error) {
+func (s *PaymentService) ProcessPayment(orderID int64, amount money.Amount, paymentMethod string) (*domain.Payment, error) {
 	_, err := s.orderRepo.FindByID(orderID)
 	if err != nil {
 		return nil, err
@@ -95,70 +130,143 @@ func (s *PaymentService) MarkPaymentPaid(orderID int64, transactionID string) er
 	return s.paymentRepo.Update(payment)
 }
 
-func (s *PaymentService) CreateRefund(paymentID int64, amount float64, reason string) (*domain.PaymentRefund, error) {
-	if s == nil || s.paymentRepo == nil || s.orderRepo == nil || s.refundRepo == nil || s.eventRepo == nil {
-		return nil, errors.New("refund_dependencies_unavailable")
+// Charge authorizes the payment and captures it straight away. Declined and
+// escalated authorizations come back as results for the caller to surface; a
+// failed capture voids the authorization.
+func (s *PaymentService) Charge(req PaymentChargeRequest) (*PaymentProviderResult, error) {
+	if s == nil {
+		return nil, ErrPaymentProviderNotFound
 	}
-	if amount <= 0 {
-		return nil, errors.New("invalid_refund_amount")
+	provider, _, config, err := s.resolveProvider(req.HandlerID)
+	if err != nil {
+		return nil, err
 	}
-	payment, err := s.paymentRepo.FindByID(paymentID)
-	if err != nil || payment == nil {
-		return nil, errors.New("payment_not_found")
+	result, err := provider.Authorize(PaymentAuthorizeRequest{
+		IdempotencyKey: req.IdempotencyKey,
+		Reference:      req.Reference,
+		Amount:         req.Amount,
+		Currency:       req.Currency,
+		Credential:     normalizeCredential(req.Credential),
+		Config:         config,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Status != PaymentResultAuthorized {
+		return result, nil
 	}
-	if amount > payment.Amount {
-		return nil, errors.New("refund_amount_exceeds_payment")
+	captured, err := provider.Capture(result.TransactionID, req.Amount)
+	if err != nil {
+		_, _ = provider.Void(result.TransactionID)
+		return nil, err
 	}
+	return captured, nil
+}
 
-	refund := &domain.PaymentRefund{
-		PaymentID: paymentID,
-		Amount:    amount,
-		Status:    "completed",
-		Reason:    reason,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+// RecordCharge stores a captured charge against its order. A transaction that
+// is already recorded is returned unchanged, so a retried completion does not
+// add a second payment.
+func (s *PaymentService) RecordCharge(orderID int64, handlerID string, result *PaymentProviderResult, payload string) (*domain.Payment, error) {
+	if s == nil || s.paymentRepo == nil {
+		return nil, errors.New("payment repository unavailable")
+	}
+	if result == nil || result.Status != PaymentResultCaptured {
+		return nil, errors.New("payment_not_captured")
 	}
-	if err := s.refundRepo.Create(refund); err != nil {
+	if existing, err := s.paymentRepo.FindByTransactionID(result.TransactionID); err == nil && existing != nil {
+		return existing, nil
+	}
+	payment := &domain.Payment{
+		OrderID:        orderID,
+		Amount:         result.Amount,
+		PaymentMethod:  handlerID,
+		TransactionID:  result.TransactionID,
+		Status:         "paid",
+		PaymentPayload: payload,
+	}
+	if err := s.paymentRepo.Create(payment); err != nil {
 		return nil, err
 	}
+	if s.eventRepo != nil {
+		eventPayload, _ := json.Marshal(map[string]interface{}{
+			"transaction_id": result.TransactionID,
+			"amount":         result.Amount,
+		})
+		payloadText := string(eventPayload)
+		_ = s.eventRepo.Create(&domain.PaymentEvent{
+			PaymentID: payment.ID,
+			EventType: "payment_captured",
+			Payload:   &payloadText,
+			CreatedAt: time.Now(),
+		})
+	}
+	return payment, nil
+}
 
-	status := "partially_refunded"
-	if amount == payment.Amount {
-		status = "refunded"
+// ReverseCharge refunds a captured charge in full, for completions that fail
+// after the money was taken.
+func (s *PaymentService) ReverseCharge(handlerID string, result *PaymentProviderResult) error {
+	if result == nil || result.Status != PaymentResultCaptured {
+		return nil
 	}
-	payment.Status = status
-	if err := s.paymentRepo.Update(payment); err != nil {
-		return nil, err
+	provider, _, _, err := s.resolveProvider(handlerID)
+	if err != nil {
+		return err
 	}
+	_, err = provider.Refund(result.TransactionID, result.Amount)
+	return err
+}
 
-	if status == "refunded" {
-		order, err := s.orderRepo.FindByID(payment.OrderID)
-		if err != nil || order == nil {
-			return nil, errors.New("order_not_found")
+// resolveProvider maps a handler id (numeric id or name) to the provider
+// registered under the handler's name, along with the handler's config. A
+// published handler without a provider yields ErrPaymentDeferred.
+func (s *PaymentService) resolveProvider(handlerID string) (PaymentProvider, string, map[string]interface{}, error) {
+	handlerID = strings.TrimSpace(handlerID)
+	name := handlerID
+	var config map[string]interface{}
+	published := false
+	if s.handlerRepo != nil && handlerID != "" {
+		var handler *domain.PaymentHandler
+		if id, err := strconv.ParseInt(handlerID, 10, 64); err == nil {
+			handler, _ = s.handlerRepo.FindByID(id)
+		}
+		if handler == nil {
+			handler, _ = s.handlerRepo.FindByName(handlerID)
 		}
-		now := time.Now()
-		order.Status = "refunded"
-		order.PaymentStatus = "refunded"
-		order.RefundedAt = &now
-		if err := s.orderRepo.Update(order); err != nil {
-			return nil, err
+		// Only handlers published in the profile can take payments.
+		if handler == nil {
+			return nil, "", nil, ErrPaymentProviderNotFound
+		}
+		name = handler.Name
+		published = true
+		if handler.Config != "" {
+			_ = json.Unmarshal([]byte(handler.Config), &config)
 		}
 	}
-
-	payload, _ := json.Marshal(map[string]interface{}{
-		"payment_id": paymentID,
-		"amount":     amount,
-		"reason":     reason,
-	})
-	payloadText := string(payload)
-	if err := s.eventRepo.Create(&domain.PaymentEvent{
-		PaymentID: paymentID,
-		EventType: "refund_created",
-		Payload:   &payloadText,
-		CreatedAt: time.Now(),
-	}); err != nil {
-		return nil, err
+	provider, ok := s.providers.Lookup(name)
+	if !ok {
+		if published {
+			return nil, "", nil, ErrPaymentDeferred
+		}
+		return nil, "", nil, ErrPaymentProviderNotFound
 	}
+	return provider, name, config, nil
+}
 
-	return refund, nil
+func normalizeCredential(credential interface{}) map[string]interface{} {
+	switch value := credential.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		return value
+	}
+	raw, err := json.Marshal(credential)
+	if err != nil {
+		return nil
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil
+	}
+	return result
 }
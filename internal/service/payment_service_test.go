@@ -5,6 +5,8 @@ import (
 	"testing"
 
 	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/repository"
+	"github.com/meowucp/pkg/money"
 )
 
 type fakePaymentRepo struct {
@@ -65,19 +67,84 @@ func (f *fakePaymentOrderRepo) CreateOrderItem(item *domain.OrderItem) error { r
 
 type fakePaymentRefundRepo struct {
 	created *domain.PaymentRefund
+	items   []*domain.PaymentRefund
 }
 
+// Create stores a copy, so only Settle and Update change what later reads see.
 func (f *fakePaymentRefundRepo) Create(refund *domain.PaymentRefund) error {
-	f.created = refund
+	refund.ID = int64(len(f.items) + 1)
+	stored := *refund
+	f.created = &stored
+	f.items = append(f.items, &stored)
 	return nil
 }
+func (f *fakePaymentRefundRepo) CreateWithinLimit(refund *domain.PaymentRefund, limit money.Amount) error {
+	committed := money.Amount(0)
+	for _, item := range f.items {
+		if item.PaymentID == refund.PaymentID && item.Status != RefundStatusFailed {
+			committed += item.Amount
+		}
+	}
+	if committed+refund.Amount > limit {
+		return repository.ErrRefundLimitExceeded
+	}
+	return f.Create(refund)
+}
+func (f *fakePaymentRefundRepo) Update(refund *domain.PaymentRefund) error {
+	for i, item := range f.items {
+		if item.ID == refund.ID {
+			stored := *refund
+			f.items[i] = &stored
+		}
+	}
+	return nil
+}
+func (f *fakePaymentRefundRepo) Settle(refund *domain.PaymentRefund) (bool, error) {
+	for i, item := range f.items {
+		if item.ID == refund.ID && item.Status == RefundStatusPending {
+			stored := *refund
+			f.items[i] = &stored
+			return true, nil
+		}
+	}
+	return false, nil
+}
+func (f *fakePaymentRefundRepo) FindByID(id int64) (*domain.PaymentRefund, error) {
+	for _, item := range f.items {
+		if item.ID == id {
+			found := *item
+			return &found, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+func (f *fakePaymentRefundRepo) ListByPaymentID(paymentID int64) ([]*domain.PaymentRefund, error) {
+	var result []*domain.PaymentRefund
+	for _, item := range f.items {
+		if item.PaymentID == paymentID {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+func (f *fakePaymentRefundRepo) ListByOrderID(orderID int64) ([]*domain.PaymentRefund, error) {
+	var result []*domain.PaymentRefund
+	for _, item := range f.items {
+		if item.OrderID == orderID {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
 
 type fakePaymentEventRepo struct {
 	created *domain.PaymentEvent
+	events  []*domain.PaymentEvent
 }
 
 func (f *fakePaymentEventRepo) Create(event *domain.PaymentEvent) error {
 	f.created = event
+	f.events = append(f.events, event)
 	return nil
 }
 
@@ -104,12 +171,18 @@ func TestPaymentServiceCreateRefundUpdatesPaymentAndOrder(t *testing.T) {
 	eventRepo := &fakePaymentEventRepo{}
 
 	service := NewPaymentServiceWithDeps(paymentRepo, orderRepo, refundRepo, eventRepo)
-	refund, err := service.CreateRefund(10, 40, "customer_request")
+	refund, err := service.CreateRefund(10, 40, "customer_request", nil)
 	if err != nil {
 		t.Fatalf("create refund: %v", err)
 	}
-	if refund == nil || refund.PaymentID != 10 {
-		t.Fatalf("expected refund record for payment")
+	if refund == nil || refund.PaymentID != 10 || refund.Status != RefundStatusPending {
+		t.Fatalf("expected pending refund record for payment")
+	}
+	if paymentRepo.payment.Status != "paid" {
+		t.Fatalf("expected payment to stay paid until the refund is confirmed")
+	}
+	if _, err := service.ConfirmRefund(refund.ID, true, "rf_1", ""); err != nil {
+		t.Fatalf("confirm refund: %v", err)
 	}
 	if paymentRepo.payment.Status != "partially_refunded" {
 		t.Fatalf("expected payment status partially_refunded")
@@ -124,3 +197,38 @@ func TestPaymentServiceCreateRefundUpdatesPaymentAndOrder(t *testing.T) {
 		t.Fatalf("expected payment event to be recorded")
 	}
 }
+
+func TestPaymentServiceChargeAndRefundGoThroughProvider(t *testing.T) {
+	registry := NewPaymentProviderRegistry()
+	registry.Register(SandboxProviderName, NewSandboxPaymentProvider())
+	paymentRepo := &fakePaymentRepo{}
+	orderRepo := &fakePaymentOrderRepo{order: &domain.Order{ID: 20, Status: "paid", PaymentStatus: "paid"}}
+	refundRepo := &fakePaymentRefundRepo{}
+	service := NewPaymentServiceWithDeps(paymentRepo, orderRepo, refundRepo, &fakePaymentEventRepo{})
+	service.SetProviders(registry, nil)
+
+	declined, err := service.Charge(PaymentChargeRequest{HandlerID: SandboxProviderName, Reference: "chk_1", Amount: 1000, Credential: map[string]string{"number": SandboxCardDeclined}})
+	if err != nil || declined.Status != PaymentResultDeclined {
+		t.Fatalf("expected decline, got %+v %v", declined, err)
+	}
+	if _, err := service.Charge(PaymentChargeRequest{HandlerID: "com.unknown", Amount: 1000}); !errors.Is(err, ErrPaymentProviderNotFound) {
+		t.Fatalf("expected unknown handler to be rejected, got %v", err)
+	}
+
+	charge, err := service.Charge(PaymentChargeRequest{HandlerID: SandboxProviderName, Reference: "chk_2", Amount: 1000})
+	if err != nil || charge.Status != PaymentResultCaptured {
+		t.Fatalf("expected capture, got %+v %v", charge, err)
+	}
+	paymentRepo.payment = &domain.Payment{ID: 10, OrderID: 20, Amount: 1000, Status: "paid", PaymentMethod: SandboxProviderName, TransactionID: charge.TransactionID}
+
+	refund, err := service.CreateRefund(10, 400, "customer_request", nil)
+	if err != nil {
+		t.Fatalf("create refund: %v", err)
+	}
+	if refund.ExternalRef == nil || *refund.ExternalRef == "" || refund.Status != RefundStatusSucceeded {
+		t.Fatalf("expected provider to settle the refund, got %+v", refund)
+	}
+	if _, err := service.CreateRefund(10, 2000, "too_much", nil); err == nil {
+		t.Fatalf("expected refund over payment to fail")
+	}
+}
@@ -2,12 +2,12 @@ package service
 
 import (
 	"errors"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/meowucp/internal/domain"
 	"github.com/meowucp/internal/repository"
+	"github.com/meowucp/pkg/money"
 )
 
 type PromotionService struct {
@@ -18,7 +18,7 @@ func NewPromotionService(repo repository.CouponRepository) *PromotionService {
 	return &PromotionService{couponRepo: repo}
 }
 
-func (s *PromotionService) ValidateCoupon(code string, subtotal float64) (*domain.Coupon, error) {
+func (s *PromotionService) ValidateCoupon(code string, subtotal money.Amount) (*domain.Coupon, error) {
 	if s == nil || s.couponRepo == nil {
 		return nil, errors.New("coupon_repository_unavailable")
 	}
@@ -45,12 +45,32 @@ func (s *PromotionService) ValidateCoupon(code string, subtotal float64) (*domai
 	return coupon, nil
 }
 
-func (s *PromotionService) ApplyPromotions(subtotal float64, promotions []domain.Promotion) (float64, error) {
+// CouponDiscount returns what the coupon takes off the subtotal, capped at the
+// subtotal itself.
+func (s *PromotionService) CouponDiscount(coupon *domain.Coupon, subtotal money.Amount) money.Amount {
+	if coupon == nil || subtotal <= 0 {
+		return 0
+	}
+	var discount money.Amount
+	if coupon.Type == "percent" {
+		discount = subtotal.Percent(coupon.Value)
+	} else {
+		discount = money.Amount(coupon.Value)
+	}
+	if discount < 0 {
+		return 0
+	}
+	return money.Min(discount, subtotal)
+}
+
+// ApplyPromotions applies "fixed:<amount>" rules, where the amount is written
+// in major units of the default currency (e.g. "fixed:10.50").
+func (s *PromotionService) ApplyPromotions(subtotal money.Amount, promotions []domain.Promotion) (money.Amount, error) {
 	newTotal := subtotal
 	for _, promo := range promotions {
 		value := strings.TrimSpace(promo.Rules)
 		if strings.HasPrefix(value, "fixed:") {
-			off, err := strconv.ParseFloat(strings.TrimPrefix(value, "fixed:"), 64)
+			off, err := money.Parse(strings.TrimPrefix(value, "fixed:"), money.DefaultCurrency)
 			if err != nil {
 				return subtotal, err
 			}
@@ -18,10 +18,10 @@ func (f *fakeCouponRepo) FindByCode(code string) (*domain.Coupon, error) {
 func TestCouponValidation(t *testing.T) {
 	start := time.Now().Add(-time.Hour)
 	end := time.Now().Add(time.Hour)
-	repo := &fakeCouponRepo{coupon: &domain.Coupon{Code: "SAVE10", Type: "fixed", Value: 10, MinSpend: 50, StartsAt: &start, EndsAt: &end}}
+	repo := &fakeCouponRepo{coupon: &domain.Coupon{Code: "SAVE10", Type: "fixed", Value: 1000, MinSpend: 5000, StartsAt: &start, EndsAt: &end}}
 	service := NewPromotionService(repo)
 
-	coupon, err := service.ValidateCoupon("SAVE10", 100)
+	coupon, err := service.ValidateCoupon("SAVE10", 10000)
 	if err != nil {
 		t.Fatalf("validate coupon: %v", err)
 	}
@@ -32,11 +32,11 @@ func TestCouponValidation(t *testing.T) {
 
 func TestPromotionAppliesToTotals(t *testing.T) {
 	service := NewPromotionService(nil)
-	newTotal, err := service.ApplyPromotions(100, []domain.Promotion{{Name: "ten-off", Rules: "fixed:10"}})
+	newTotal, err := service.ApplyPromotions(10000, []domain.Promotion{{Name: "ten-off", Rules: "fixed:10"}})
 	if err != nil {
 		t.Fatalf("apply promotions: %v", err)
 	}
-	if newTotal != 90 {
-		t.Fatalf("expected total 90, got %v", newTotal)
+	if newTotal != 9000 {
+		t.Fatalf("expected total 9000, got %v", newTotal)
 	}
 }
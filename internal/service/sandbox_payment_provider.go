@@ -0,0 +1,221 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/meowucp/pkg/money"
+)
+
+// SandboxProviderName is the payment handler name served by the sandbox.
+const SandboxProviderName = "com.meowucp.sandbox"
+
+// Sandbox test cards. Any other card number or token authorizes.
+const (
+	SandboxCardApproved          = "4242424242424242"
+	SandboxCardDeclined          = "4000000000000002"
+	SandboxCardInsufficientFunds = "4000000000009995"
+	SandboxCardExpired           = "4000000000000069"
+	SandboxCardRequires3DS       = "4000000000003220"
+	SandboxCardTimeout           = "4000000000000119"
+)
+
+type sandboxTransaction struct {
+	id         string
+	reference  string
+	currency   string
+	authorized money.Amount
+	captured   money.Amount
+	refunded   money.Amount
+	status     string
+	refunds    int
+}
+
+// SandboxPaymentProvider is a deterministic in-process provider for local
+// development and tests. Outcomes depend only on the card number, so the same
+// request always produces the same result.
+type SandboxPaymentProvider struct {
+	mu           sync.Mutex
+	transactions map[string]*sandboxTransaction
+}
+
+func NewSandboxPaymentProvider() *SandboxPaymentProvider {
+	return &SandboxPaymentProvider{transactions: map[string]*sandboxTransaction{}}
+}
+
+func (p *SandboxPaymentProvider) Authorize(req PaymentAuthorizeRequest) (*PaymentProviderResult, error) {
+	if req.Amount <= 0 {
+		return nil, errors.New("invalid_payment_amount")
+	}
+	card := sandboxCardNumber(req.Credential)
+	if card == SandboxCardTimeout {
+		return nil, ErrPaymentTimeout
+	}
+
+	key := req.IdempotencyKey
+	if key == "" {
+		key = fmt.Sprintf("%s:%d:%s", req.Reference, req.Amount, card)
+	}
+	id := sandboxID("sbx_", key)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if txn, ok := p.transactions[id]; ok && txn.status != PaymentResultDeclined && txn.status != PaymentResultActionRequired {
+		return txn.result(), nil
+	}
+
+	result := &PaymentProviderResult{TransactionID: id, Amount: req.Amount}
+	switch card {
+	case SandboxCardDeclined:
+		result.Status = PaymentResultDeclined
+		result.DeclineCode = "card_declined"
+	case SandboxCardInsufficientFunds:
+		result.Status = PaymentResultDeclined
+		result.DeclineCode = "insufficient_funds"
+	case SandboxCardExpired:
+		result.Status = PaymentResultDeclined
+		result.DeclineCode = "expired_card"
+	case SandboxCardRequires3DS:
+		if credentialString(req.Credential, "three_ds") == "authenticated" {
+			result.Status = PaymentResultAuthorized
+		} else {
+			result.Status = PaymentResultActionRequired
+			result.ActionURL = "https://sandbox.meowucp.local/3ds/" + id
+		}
+	default:
+		result.Status = PaymentResultAuthorized
+	}
+
+	p.transactions[id] = &sandboxTransaction{
+		id:         id,
+		reference:  req.Reference,
+		currency:   req.Currency,
+		authorized: req.Amount,
+		status:     result.Status,
+	}
+	return result, nil
+}
+
+func (p *SandboxPaymentProvider) Capture(transactionID string, amount money.Amount) (*PaymentProviderResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	txn, ok := p.transactions[transactionID]
+	if !ok {
+		return nil, ErrPaymentTransactionNotFound
+	}
+	switch txn.status {
+	case PaymentResultCaptured, PaymentResultRefunded:
+		return txn.result(), nil
+	case PaymentResultAuthorized:
+	default:
+		return nil, ErrPaymentInvalidState
+	}
+	if amount <= 0 || amount > txn.authorized {
+		return nil, ErrPaymentAmountExceeded
+	}
+	txn.captured = amount
+	txn.status = PaymentResultCaptured
+	return txn.result(), nil
+}
+
+func (p *SandboxPaymentProvider) Void(transactionID string) (*PaymentProviderResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	txn, ok := p.transactions[transactionID]
+	if !ok {
+		return nil, ErrPaymentTransactionNotFound
+	}
+	switch txn.status {
+	case PaymentResultVoided:
+	case PaymentResultAuthorized, PaymentResultActionRequired:
+		txn.status = PaymentResultVoided
+	default:
+		return nil, ErrPaymentInvalidState
+	}
+	return txn.result(), nil
+}
+
+func (p *SandboxPaymentProvider) Refund(transactionID string, amount money.Amount) (*PaymentProviderResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	txn, ok := p.transactions[transactionID]
+	if !ok {
+		return nil, ErrPaymentTransactionNotFound
+	}
+	if txn.status != PaymentResultCaptured && txn.status != PaymentResultRefunded {
+		return nil, ErrPaymentInvalidState
+	}
+	if amount <= 0 || txn.refunded+amount > txn.captured {
+		return nil, ErrPaymentAmountExceeded
+	}
+	txn.refunded += amount
+	txn.refunds++
+	if txn.refunded == txn.captured {
+		txn.status = PaymentResultRefunded
+	}
+	return &PaymentProviderResult{
+		Status:        PaymentResultRefunded,
+		TransactionID: sandboxID("sbx_rf_", fmt.Sprintf("%s:%d", txn.id, txn.refunds)),
+		Amount:        amount,
+	}, nil
+}
+
+// ParseWebhook reads the sandbox's plain JSON notification:
+// {"type","transaction_id","reference","amount","currency"}.
+func (p *SandboxPaymentProvider) ParseWebhook(header http.Header, body []byte) (*PaymentWebhookEvent, error) {
+	var payload struct {
+		Type          string       `json:"type"`
+		TransactionID string       `json:"transaction_id"`
+		Reference     string       `json:"reference"`
+		Amount        money.Amount `json:"amount"`
+		Currency      string       `json:"currency"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	if payload.TransactionID == "" || payload.Type == "" {
+		return nil, errors.New("invalid_payment_webhook")
+	}
+	return &PaymentWebhookEvent{
+		Type:          payload.Type,
+		TransactionID: payload.TransactionID,
+		Reference:     payload.Reference,
+		Amount:        payload.Amount,
+		Currency:      payload.Currency,
+	}, nil
+}
+
+func (t *sandboxTransaction) result() *PaymentProviderResult {
+	amount := t.authorized
+	if t.captured > 0 {
+		amount = t.captured
+	}
+	return &PaymentProviderResult{Status: t.status, TransactionID: t.id, Amount: amount}
+}
+
+// sandboxCardNumber accepts {"number": "..."} or a "tok_<number>" token.
+func sandboxCardNumber(credential map[string]interface{}) string {
+	if number := credentialString(credential, "number"); number != "" {
+		return strings.ReplaceAll(number, " ", "")
+	}
+	return strings.TrimPrefix(credentialString(credential, "token"), "tok_")
+}
+
+func credentialString(credential map[string]interface{}, key string) string {
+	if credential == nil {
+		return ""
+	}
+	value, _ := credential[key].(string)
+	return strings.TrimSpace(value)
+}
+
+func sandboxID(prefix, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return prefix + hex.EncodeToString(sum[:])[:24]
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSandboxProviderTestCards(t *testing.T) {
+	provider := NewSandboxPaymentProvider()
+	authorize := func(card string, extra map[string]interface{}) (*PaymentProviderResult, error) {
+		credential := map[string]interface{}{"number": card}
+		for key, value := range extra {
+			credential[key] = value
+		}
+		return provider.Authorize(PaymentAuthorizeRequest{Reference: "chk_" + card, Amount: 1000, Currency: "CNY", Credential: credential})
+	}
+
+	result, err := authorize(SandboxCardApproved, nil)
+	if err != nil || result.Status != PaymentResultAuthorized {
+		t.Fatalf("expected authorization, got %+v %v", result, err)
+	}
+	result, err = authorize(SandboxCardInsufficientFunds, nil)
+	if err != nil || result.Status != PaymentResultDeclined || result.DeclineCode != "insufficient_funds" {
+		t.Fatalf("expected insufficient funds decline, got %+v %v", result, err)
+	}
+	result, err = authorize(SandboxCardRequires3DS, nil)
+	if err != nil || result.Status != PaymentResultActionRequired || result.ActionURL == "" {
+		t.Fatalf("expected 3DS escalation, got %+v %v", result, err)
+	}
+	result, err = authorize(SandboxCardRequires3DS, map[string]interface{}{"three_ds": "authenticated"})
+	if err != nil || result.Status != PaymentResultAuthorized {
+		t.Fatalf("expected authenticated card to authorize, got %+v %v", result, err)
+	}
+	if _, err := authorize(SandboxCardTimeout, nil); !errors.Is(err, ErrPaymentTimeout) {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+}
+
+func TestSandboxProviderCaptureAndRefundLimits(t *testing.T) {
+	provider := NewSandboxPaymentProvider()
+	auth, err := provider.Authorize(PaymentAuthorizeRequest{IdempotencyKey: "checkout:1", Amount: 1000, Credential: map[string]interface{}{"token": "tok_" + SandboxCardApproved}})
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	again, _ := provider.Authorize(PaymentAuthorizeRequest{IdempotencyKey: "checkout:1", Amount: 1000})
+	if again.TransactionID != auth.TransactionID {
+		t.Fatalf("expected idempotent authorization")
+	}
+	if _, err := provider.Refund(auth.TransactionID, 100); !errors.Is(err, ErrPaymentInvalidState) {
+		t.Fatalf("expected refund before capture to fail, got %v", err)
+	}
+	if _, err := provider.Capture(auth.TransactionID, 1000); err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+	if _, err := provider.Void(auth.TransactionID); !errors.Is(err, ErrPaymentInvalidState) {
+		t.Fatalf("expected void after capture to fail, got %v", err)
+	}
+	if _, err := provider.Refund(auth.TransactionID, 600); err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	if _, err := provider.Refund(auth.TransactionID, 500); !errors.Is(err, ErrPaymentAmountExceeded) {
+		t.Fatalf("expected refund over capture to fail, got %v", err)
+	}
+}
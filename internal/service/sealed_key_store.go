@@ -0,0 +1,309 @@
+package service
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/repository"
+	"github.com/meowucp/internal/ucp/security"
+)
+
+// sealedKey is the row shared by the webhook and access token key tables.
+// Pointers convert to *domain.UCPSigningKey and *domain.JWTSigningKey, so
+// rows handed back to callers are the ones the store wrote.
+type sealedKey domain.UCPSigningKey
+
+type sealedKeyRepository interface {
+	Create(key *sealedKey) error
+	Update(key *sealedKey) error
+	List() ([]*sealedKey, error)
+	WithRotationLock(fn func(repo sealedKeyRepository) error) error
+}
+
+// sealedKeyStore keeps private keys of one algorithm in a key table, sealed
+// with AES-256-GCM under a key from config. The newest active, open-ended key
+// signs; keys rotated out stay published until their ExpiresAt.
+type sealedKeyStore struct {
+	repo          sealedKeyRepository
+	encryptionKey []byte
+	algorithm     string
+	overlap       time.Duration
+}
+
+// sealedKeyRotation is the outcome of rotate: the new key, its private half,
+// and the keys it put on an overlap expiry.
+type sealedKeyRotation struct {
+	key       *sealedKey
+	private   crypto.PrivateKey
+	previous  []string
+	expiresAt time.Time
+}
+
+// rotate generates a key and, holding the table's rotation lock, makes it the
+// signing key if due still holds for the current signing key (nil when there
+// is none). Active keys that were still open-ended are given
+// ExpiresAt = now + overlap. When another process rotated first, due no
+// longer holds, the generated key is dropped and rotate returns nil.
+func (s *sealedKeyStore) rotate(due func(current *sealedKey) bool) (*sealedKeyRotation, error) {
+	// Generating (RSA in particular) is slow, so it happens before the lock.
+	private, jwk, err := generateSigningKey(s.algorithm)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := sealPrivateKey(s.encryptionKey, der)
+	if err != nil {
+		return nil, err
+	}
+	jwk.KID = security.JWKThumbprint(jwk)
+	publicKey, _ := json.Marshal(jwk)
+
+	var rotation *sealedKeyRotation
+	err = s.repo.WithRotationLock(func(repo sealedKeyRepository) error {
+		keys, err := repo.List()
+		if err != nil {
+			return err
+		}
+		if !due(activeSealedKey(keys)) {
+			return nil
+		}
+		now := time.Now()
+		key := &sealedKey{
+			KID:                 jwk.KID,
+			Algorithm:           jwk.Alg,
+			PublicKey:           string(publicKey),
+			EncryptedPrivateKey: sealed,
+			Status:              SigningKeyStatusActive,
+			CreatedAt:           now,
+			UpdatedAt:           now,
+		}
+		if err := repo.Create(key); err != nil {
+			return err
+		}
+
+		expiresAt := now.Add(s.overlap)
+		previous := []string{}
+		for _, old := range keys {
+			if old.Status != SigningKeyStatusActive || old.ExpiresAt != nil {
+				continue
+			}
+			old.ExpiresAt = &expiresAt
+			old.UpdatedAt = now
+			if err := repo.Update(old); err != nil {
+				return err
+			}
+			previous = append(previous, old.KID)
+		}
+		rotation = &sealedKeyRotation{key: key, private: private, previous: previous, expiresAt: expiresAt}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rotation, nil
+}
+
+// alwaysRotate is the due check for rotations asked for explicitly.
+func alwaysRotate(*sealedKey) bool {
+	return true
+}
+
+// signingKey returns the key that currently signs, or nil when there is none.
+func (s *sealedKeyStore) signingKey() (*sealedKey, error) {
+	keys, err := s.repo.List()
+	if err != nil {
+		return nil, err
+	}
+	return activeSealedKey(keys), nil
+}
+
+// open decrypts key's private half. Webhook keys sealed before the stores
+// were shared hold SEC1 rather than PKCS#8 DER.
+func (s *sealedKeyStore) open(key *sealedKey) (crypto.PrivateKey, error) {
+	der, err := openPrivateKey(s.encryptionKey, key.EncryptedPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if private, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return private, nil
+	}
+	return x509.ParseECPrivateKey(der)
+}
+
+// published lists the active keys still inside their overlap window, newest
+// first.
+func (s *sealedKeyStore) published(now time.Time) ([]*sealedKey, error) {
+	keys, err := s.repo.List()
+	if err != nil {
+		return nil, err
+	}
+	result := []*sealedKey{}
+	for _, key := range keys {
+		if key.Status != SigningKeyStatusActive || (key.ExpiresAt != nil && !now.Before(*key.ExpiresAt)) {
+			continue
+		}
+		result = append(result, key)
+	}
+	return result, nil
+}
+
+// publicKeys returns the published keys as JWKs.
+func (s *sealedKeyStore) publicKeys() []security.JWK {
+	keys, err := s.published(time.Now())
+	if err != nil {
+		return nil
+	}
+	result := []security.JWK{}
+	for _, key := range keys {
+		var jwk security.JWK
+		if err := json.Unmarshal([]byte(key.PublicKey), &jwk); err != nil {
+			continue
+		}
+		result = append(result, jwk)
+	}
+	return result
+}
+
+// activeSealedKey picks the newest active, open-ended key; keys listed newest
+// first.
+func activeSealedKey(keys []*sealedKey) *sealedKey {
+	for _, key := range keys {
+		if key.Status == SigningKeyStatusActive && key.ExpiresAt == nil {
+			return key
+		}
+	}
+	return nil
+}
+
+func generateSigningKey(algorithm string) (crypto.PrivateKey, security.JWK, error) {
+	switch algorithm {
+	case "ES256":
+		private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, security.JWK{}, err
+		}
+		return private, security.PublicJWK(&private.PublicKey, ""), nil
+	case "RS256":
+		private, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, security.JWK{}, err
+		}
+		return private, security.PublicRSAJWK(&private.PublicKey, ""), nil
+	}
+	return nil, security.JWK{}, ErrTokenSigningAlgorithm
+}
+
+// sealPrivateKey encrypts a DER encoded private key with AES-256-GCM under
+// encryptionKey, prefixing the nonce.
+func sealPrivateKey(encryptionKey, plain []byte) (string, error) {
+	gcm, err := privateKeyCipher(encryptionKey)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plain, nil)), nil
+}
+
+func openPrivateKey(encryptionKey []byte, sealed string) ([]byte, error) {
+	gcm, err := privateKeyCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(raw) < gcm.NonceSize() {
+		return nil, errors.New("signing_key_corrupt")
+	}
+	plain, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("signing_key_decrypt_failed")
+	}
+	return plain, nil
+}
+
+func privateKeyCipher(encryptionKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ucpSealedKeyRepository stores sealed keys in the webhook key table.
+type ucpSealedKeyRepository struct {
+	repo repository.UCPSigningKeyRepository
+}
+
+func (r ucpSealedKeyRepository) Create(key *sealedKey) error {
+	return r.repo.Create((*domain.UCPSigningKey)(key))
+}
+
+func (r ucpSealedKeyRepository) Update(key *sealedKey) error {
+	return r.repo.Update((*domain.UCPSigningKey)(key))
+}
+
+func (r ucpSealedKeyRepository) WithRotationLock(fn func(repo sealedKeyRepository) error) error {
+	return r.repo.WithRotationLock(func(repo repository.UCPSigningKeyRepository) error {
+		return fn(ucpSealedKeyRepository{repo: repo})
+	})
+}
+
+func (r ucpSealedKeyRepository) List() ([]*sealedKey, error) {
+	keys, err := r.repo.List()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*sealedKey, len(keys))
+	for i, key := range keys {
+		result[i] = (*sealedKey)(key)
+	}
+	return result, nil
+}
+
+// jwtSealedKeyRepository stores sealed keys in the access token key table.
+type jwtSealedKeyRepository struct {
+	repo repository.JWTSigningKeyRepository
+}
+
+func (r jwtSealedKeyRepository) Create(key *sealedKey) error {
+	return r.repo.Create((*domain.JWTSigningKey)(key))
+}
+
+func (r jwtSealedKeyRepository) Update(key *sealedKey) error {
+	return r.repo.Update((*domain.JWTSigningKey)(key))
+}
+
+func (r jwtSealedKeyRepository) WithRotationLock(fn func(repo sealedKeyRepository) error) error {
+	return r.repo.WithRotationLock(func(repo repository.JWTSigningKeyRepository) error {
+		return fn(jwtSealedKeyRepository{repo: repo})
+	})
+}
+
+func (r jwtSealedKeyRepository) List() ([]*sealedKey, error) {
+	keys, err := r.repo.List()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*sealedKey, len(keys))
+	for i, key := range keys {
+		result[i] = (*sealedKey)(key)
+	}
+	return result, nil
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"testing"
+	"time"
+)
+
+func TestSealedKeyStoreOpensLegacySEC1Keys(t *testing.T) {
+	encryptionKey := make([]byte, 32)
+	repo := &fakeSigningKeyRepo{}
+	svc, err := NewSigningKeyService(repo, encryptionKey, time.Hour)
+	if err != nil {
+		t.Fatalf("new service: %v", err)
+	}
+
+	legacy, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalECPrivateKey(legacy)
+	sealed, err := sealPrivateKey(encryptionKey, der)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	private, err := svc.keys.open(&sealedKey{EncryptedPrivateKey: sealed})
+	if err != nil || !legacy.Equal(private) {
+		t.Fatalf("expected SEC1 sealed key to open, got %v", err)
+	}
+
+	key, err := svc.Rotate("system")
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if _, err := svc.keys.open((*sealedKey)(key)); err != nil {
+		t.Fatalf("expected PKCS#8 sealed key to open, got %v", err)
+	}
+}
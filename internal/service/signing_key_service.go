@@ -0,0 +1,205 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/repository"
+	"github.com/meowucp/internal/ucp/security"
+)
+
+const (
+	SigningKeyStatusActive  = "active"
+	SigningKeyStatusRetired = "retired"
+
+	// DefaultSigningKeyOverlap keeps a rotated-out key published long enough
+	// for partners' JWKS caches and queued retries to move over.
+	DefaultSigningKeyOverlap = 24 * time.Hour
+
+	signingKeyCacheTTL = 30 * time.Second
+)
+
+var (
+	ErrSigningKeyNotFound      = errors.New("signing_key_not_found")
+	ErrSigningKeyInUse         = errors.New("signing_key_in_use")
+	ErrNoActiveSigningKey      = errors.New("no_active_signing_key")
+	ErrSigningKeyEncryptionKey = errors.New("signing_key_encryption_key_invalid")
+)
+
+// SigningKeyService stores our ES256 webhook signing keys in a sealedKeyStore.
+// The newest active key signs; keys rotated out stay published until their
+// ExpiresAt.
+type SigningKeyService struct {
+	repo     repository.UCPSigningKeyRepository
+	keys     *sealedKeyStore
+	auditLog *AuditLogService
+
+	mu       sync.Mutex
+	current  *ecdsa.PrivateKey
+	kid      string
+	loadedAt time.Time
+}
+
+// ParseSigningKeyEncryptionKey decodes the base64 encoded 32 byte key from
+// config.
+func ParseSigningKeyEncryptionKey(value string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil || len(key) != 32 {
+		return nil, ErrSigningKeyEncryptionKey
+	}
+	return key, nil
+}
+
+func NewSigningKeyService(repo repository.UCPSigningKeyRepository, encryptionKey []byte, overlap time.Duration) (*SigningKeyService, error) {
+	if len(encryptionKey) != 32 {
+		return nil, ErrSigningKeyEncryptionKey
+	}
+	if overlap <= 0 {
+		overlap = DefaultSigningKeyOverlap
+	}
+	return &SigningKeyService{
+		repo: repo,
+		keys: &sealedKeyStore{
+			repo:          ucpSealedKeyRepository{repo: repo},
+			encryptionKey: encryptionKey,
+			algorithm:     "ES256",
+			overlap:       overlap,
+		},
+	}, nil
+}
+
+func (s *SigningKeyService) SetAuditLog(auditLog *AuditLogService) {
+	s.auditLog = auditLog
+}
+
+func (s *SigningKeyService) List() ([]*domain.UCPSigningKey, error) {
+	return s.repo.List()
+}
+
+// EnsureActiveKey creates the first key when none can sign yet. Processes
+// starting together create one between them.
+func (s *SigningKeyService) EnsureActiveKey(actor string) error {
+	key, err := s.keys.signingKey()
+	if err != nil || key != nil {
+		return err
+	}
+	_, err = s.rotate(actor, func(current *sealedKey) bool { return current == nil })
+	return err
+}
+
+// Rotate generates a new P-256 key and makes it the signing key. Active keys
+// that were still open-ended are given ExpiresAt = now + overlap.
+func (s *SigningKeyService) Rotate(actor string) (*domain.UCPSigningKey, error) {
+	return s.rotate(actor, alwaysRotate)
+}
+
+// rotate returns nil when due no longer held once the rotation lock was taken.
+func (s *SigningKeyService) rotate(actor string, due func(current *sealedKey) bool) (*domain.UCPSigningKey, error) {
+	rotation, err := s.keys.rotate(due)
+	if err != nil || rotation == nil {
+		return nil, err
+	}
+	key := (*domain.UCPSigningKey)(rotation.key)
+
+	s.mu.Lock()
+	s.current, _ = rotation.private.(*ecdsa.PrivateKey)
+	s.kid, s.loadedAt = key.KID, key.CreatedAt
+	s.mu.Unlock()
+
+	s.audit(actor, "signing_key_rotated", key.KID, map[string]interface{}{
+		"kid":                 key.KID,
+		"previous_kids":       rotation.previous,
+		"previous_expires_at": rotation.expiresAt,
+	})
+	return key, nil
+}
+
+// Retire stops publishing a key straight away. The key currently signing
+// cannot be retired; rotate first.
+func (s *SigningKeyService) Retire(kid, actor string) (*domain.UCPSigningKey, error) {
+	key, err := s.repo.FindByKID(kid)
+	if err != nil || key == nil {
+		return nil, ErrSigningKeyNotFound
+	}
+	if key.Status == SigningKeyStatusRetired {
+		return key, nil
+	}
+	current, err := s.keys.signingKey()
+	if err != nil {
+		return nil, err
+	}
+	if current != nil && current.KID == key.KID {
+		return nil, ErrSigningKeyInUse
+	}
+	now := time.Now()
+	key.Status = SigningKeyStatusRetired
+	key.RetiredAt = &now
+	key.UpdatedAt = now
+	if err := s.repo.Update(key); err != nil {
+		return nil, err
+	}
+	s.audit(actor, "signing_key_retired", key.KID, map[string]interface{}{"kid": key.KID})
+	return key, nil
+}
+
+// PublicKeys lists the active keys that are still inside their overlap
+// window, newest first.
+func (s *SigningKeyService) PublicKeys() []security.JWK {
+	return s.keys.publicKeys()
+}
+
+// Sign signs body with the newest active key. The decrypted key is cached
+// briefly so rotations made by another process are picked up.
+func (s *SigningKeyService) Sign(body []byte, at time.Time) (string, string, error) {
+	private, kid, err := s.signingPrivateKey()
+	if err != nil {
+		return "", "", err
+	}
+	header, err := security.SignWebhookPayload(private, body, at)
+	if err != nil {
+		return "", "", err
+	}
+	return header, kid, nil
+}
+
+func (s *SigningKeyService) signingPrivateKey() (*ecdsa.PrivateKey, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current != nil && time.Since(s.loadedAt) < signingKeyCacheTTL {
+		return s.current, s.kid, nil
+	}
+	key, err := s.keys.signingKey()
+	if err != nil {
+		return nil, "", err
+	}
+	if key == nil {
+		return nil, "", ErrNoActiveSigningKey
+	}
+	opened, err := s.keys.open(key)
+	if err != nil {
+		return nil, "", err
+	}
+	private, ok := opened.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, "", errors.New("signing_key_not_ecdsa")
+	}
+	s.current, s.kid, s.loadedAt = private, key.KID, time.Now()
+	return private, key.KID, nil
+}
+
+func (s *SigningKeyService) audit(actor, action, kid string, payload map[string]interface{}) {
+	if s.auditLog == nil {
+		return
+	}
+	if actor == "" {
+		actor = "system"
+	}
+	body, _ := json.Marshal(payload)
+	_ = s.auditLog.Record(actor, action, "ucp_signing_key:"+kid, string(body))
+}
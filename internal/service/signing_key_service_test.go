@@ -0,0 +1,149 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/repository"
+	"github.com/meowucp/internal/ucp/security"
+)
+
+type fakeSigningKeyRepo struct {
+	keys []*domain.UCPSigningKey
+}
+
+func (f *fakeSigningKeyRepo) Create(key *domain.UCPSigningKey) error {
+	key.ID = int64(len(f.keys) + 1)
+	f.keys = append([]*domain.UCPSigningKey{key}, f.keys...)
+	return nil
+}
+func (f *fakeSigningKeyRepo) Update(key *domain.UCPSigningKey) error { return nil }
+func (f *fakeSigningKeyRepo) FindByKID(kid string) (*domain.UCPSigningKey, error) {
+	for _, key := range f.keys {
+		if key.KID == kid {
+			return key, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+func (f *fakeSigningKeyRepo) List() ([]*domain.UCPSigningKey, error) { return f.keys, nil }
+func (f *fakeSigningKeyRepo) WithRotationLock(fn func(repo repository.UCPSigningKeyRepository) error) error {
+	return fn(f)
+}
+
+type collectingAuditLogRepo struct {
+	logs []*domain.AuditLog
+}
+
+func (f *collectingAuditLogRepo) Create(log *domain.AuditLog) error {
+	f.logs = append(f.logs, log)
+	return nil
+}
+func (f *collectingAuditLogRepo) List(offset, limit int) ([]*domain.AuditLog, error) {
+	return f.logs, nil
+}
+func (f *collectingAuditLogRepo) Count() (int64, error) { return int64(len(f.logs)), nil }
+
+func verifyWithJWK(t *testing.T, jwk security.JWK, header string, body []byte) bool {
+	t.Helper()
+	var stamp int64
+	var sig string
+	if _, err := fmt.Sscanf(strings.Replace(header, ",v1=", " ", 1), "t=%d %s", &stamp, &sig); err != nil {
+		t.Fatalf("parse signature header %q: %v", header, err)
+	}
+	x, _ := base64.RawURLEncoding.DecodeString(jwk.X)
+	y, _ := base64.RawURLEncoding.DecodeString(jwk.Y)
+	raw, _ := base64.RawURLEncoding.DecodeString(sig)
+	public := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%d.%s", stamp, body)))
+	return ecdsa.VerifyASN1(public, hash[:], raw)
+}
+
+func TestSigningKeyServiceRotatesWithOverlapAndAudits(t *testing.T) {
+	repo := &fakeSigningKeyRepo{}
+	auditRepo := &collectingAuditLogRepo{}
+	encryptionKey := make([]byte, 32)
+	svc, err := NewSigningKeyService(repo, encryptionKey, time.Hour)
+	if err != nil {
+		t.Fatalf("new service: %v", err)
+	}
+	svc.SetAuditLog(NewAuditLogService(auditRepo))
+
+	if err := svc.EnsureActiveKey("system"); err != nil {
+		t.Fatalf("ensure key: %v", err)
+	}
+	if err := svc.EnsureActiveKey("system"); err != nil || len(repo.keys) != 1 {
+		t.Fatalf("expected a single bootstrap key, got %d %v", len(repo.keys), err)
+	}
+	first := repo.keys[0]
+	if strings.Contains(first.EncryptedPrivateKey, "PRIVATE") || first.EncryptedPrivateKey == "" {
+		t.Fatalf("expected private key to be sealed")
+	}
+
+	second, err := svc.Rotate("admin:1")
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if first.ExpiresAt == nil || second.ExpiresAt != nil {
+		t.Fatalf("expected old key to get an overlap window and the new key to stay open-ended")
+	}
+	published := svc.PublicKeys()
+	if len(published) != 2 || published[0].KID != second.KID {
+		t.Fatalf("expected both keys published with the newest first, got %+v", published)
+	}
+
+	body := []byte(`{"event_id":"evt_1"}`)
+	header, kid, err := svc.Sign(body, time.Now())
+	if err != nil || kid != second.KID {
+		t.Fatalf("expected newest key to sign, got %q %v", kid, err)
+	}
+	if !verifyWithJWK(t, published[0], header, body) {
+		t.Fatalf("expected signature to verify against the published key")
+	}
+
+	// A fresh process decrypts the stored key rather than using the cache.
+	reopened, _ := NewSigningKeyService(repo, encryptionKey, time.Hour)
+	if header, kid, err := reopened.Sign(body, time.Now()); err != nil || kid != second.KID || !verifyWithJWK(t, published[0], header, body) {
+		t.Fatalf("expected stored key to decrypt and sign, got %q %v", kid, err)
+	}
+	wrongKey := make([]byte, 32)
+	wrongKey[0] = 1
+	wrong, _ := NewSigningKeyService(repo, wrongKey, time.Hour)
+	if _, _, err := wrong.Sign(body, time.Now()); err == nil {
+		t.Fatalf("expected a different encryption key to fail")
+	}
+
+	if _, err := svc.Retire(second.KID, "admin:1"); !errors.Is(err, ErrSigningKeyInUse) {
+		t.Fatalf("expected signing key to be protected, got %v", err)
+	}
+	if _, err := svc.Retire(first.KID, "admin:1"); err != nil {
+		t.Fatalf("retire: %v", err)
+	}
+	if keys := svc.PublicKeys(); len(keys) != 1 || keys[0].KID != second.KID {
+		t.Fatalf("expected retired key to be unpublished, got %+v", keys)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	second.ExpiresAt = &past
+	if keys := svc.PublicKeys(); len(keys) != 0 {
+		t.Fatalf("expected keys past their overlap window to be unpublished")
+	}
+
+	var actions []string
+	for _, log := range auditRepo.logs {
+		actions = append(actions, log.Actor+" "+log.Action)
+	}
+	want := "system signing_key_rotated,admin:1 signing_key_rotated,admin:1 signing_key_retired"
+	if strings.Join(actions, ",") != want {
+		t.Fatalf("expected audit trail %q, got %q", want, strings.Join(actions, ","))
+	}
+}
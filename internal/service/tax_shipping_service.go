@@ -2,10 +2,12 @@ package service
 
 import (
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/meowucp/internal/domain"
 	"github.com/meowucp/internal/repository"
+	"github.com/meowucp/pkg/money"
 )
 
 type TaxShippingService struct {
@@ -17,51 +19,81 @@ func NewTaxShippingService(taxRepo repository.TaxRuleRepository, shippingRepo re
 	return &TaxShippingService{taxRepo: taxRepo, shippingRepo: shippingRepo}
 }
 
-func (s *TaxShippingService) Quote(region string, items []domain.OrderItem) (float64, float64, error) {
+func (s *TaxShippingService) Quote(region string, items []domain.OrderItem) (money.Amount, money.Amount, error) {
 	if s == nil {
 		return 0, 0, errors.New("service_unavailable")
 	}
 	if region == "" {
 		return 0, 0, errors.New("region_required")
 	}
-	subtotal := 0.0
+	var subtotal money.Amount
 	quantity := 0
 	for _, item := range items {
 		if item.TotalPrice > 0 {
 			subtotal += item.TotalPrice
 		} else {
-			subtotal += item.UnitPrice * float64(item.Quantity)
+			subtotal += item.UnitPrice.Mul(item.Quantity)
 		}
 		quantity += item.Quantity
 	}
 
-	taxRate := 0.0
-	if s.taxRepo != nil {
-		rules, err := s.taxRepo.ListByRegion(region)
+	taxRate, err := s.TaxRate(region)
+	if err != nil {
+		return 0, 0, err
+	}
+	shipping, err := s.ShippingFee(region, quantity)
+	if err != nil {
+		return 0, 0, err
+	}
+	return subtotal.MulRate(taxRate), shipping, nil
+}
+
+// TaxRate returns the latest effective tax rate for the region, or zero. A
+// subdivision such as "CN-SH" without a rule of its own falls back to its
+// country's rule.
+func (s *TaxShippingService) TaxRate(region string) (float64, error) {
+	if s == nil || s.taxRepo == nil {
+		return 0, nil
+	}
+	for _, candidate := range ruleRegions(region) {
+		rules, err := s.taxRepo.ListByRegion(candidate)
 		if err != nil {
-			return 0, 0, err
+			return 0, err
 		}
-		if len(rules) > 0 {
-			selected := selectLatestTaxRule(rules)
-			if selected != nil {
-				taxRate = selected.Rate
-			}
+		if selected := selectLatestTaxRule(rules); selected != nil {
+			return selected.Rate, nil
 		}
 	}
+	return 0, nil
+}
 
-	shipping := 0.0
-	if s.shippingRepo != nil {
-		rules, err := s.shippingRepo.ListByRegion(region)
+// ShippingFee returns the region's shipping charge for the given number of
+// units, or zero when no rule applies. Subdivisions fall back to their
+// country as TaxRate does.
+func (s *TaxShippingService) ShippingFee(region string, quantity int) (money.Amount, error) {
+	if s == nil || s.shippingRepo == nil {
+		return 0, nil
+	}
+	for _, candidate := range ruleRegions(region) {
+		rules, err := s.shippingRepo.ListByRegion(candidate)
 		if err != nil {
-			return 0, 0, err
+			return 0, err
 		}
 		if len(rules) > 0 {
 			rule := rules[0]
-			shipping = rule.BaseAmount + rule.PerItemAmount*float64(quantity)
+			return rule.BaseAmount + rule.PerItemAmount.Mul(quantity), nil
 		}
 	}
+	return 0, nil
+}
 
-	return subtotal * taxRate, shipping, nil
+// ruleRegions lists the regions to match rules on, most specific first: an
+// ISO 3166-2 subdivision ("CN-SH"), then its country ("CN").
+func ruleRegions(region string) []string {
+	if country, _, ok := strings.Cut(region, "-"); ok && country != "" {
+		return []string{region, country}
+	}
+	return []string{region}
 }
 
 func selectLatestTaxRule(rules []*domain.TaxRule) *domain.TaxRule {
@@ -12,7 +12,13 @@ type fakeTaxRuleRepo struct {
 }
 
 func (f *fakeTaxRuleRepo) ListByRegion(region string) ([]*domain.TaxRule, error) {
-	return f.rules, nil
+	var rules []*domain.TaxRule
+	for _, rule := range f.rules {
+		if rule.Region == region {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
 }
 
 type fakeShippingRuleRepo struct {
@@ -20,7 +26,13 @@ type fakeShippingRuleRepo struct {
 }
 
 func (f *fakeShippingRuleRepo) ListByRegion(region string) ([]*domain.ShippingRule, error) {
-	return f.rules, nil
+	var rules []*domain.ShippingRule
+	for _, rule := range f.rules {
+		if rule.Region == region {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
 }
 
 func TestTaxRateAppliedByRegion(t *testing.T) {
@@ -28,27 +40,46 @@ func TestTaxRateAppliedByRegion(t *testing.T) {
 	shippingRepo := &fakeShippingRuleRepo{}
 	service := NewTaxShippingService(taxRepo, shippingRepo)
 
-	items := []domain.OrderItem{{Quantity: 2, UnitPrice: 50, TotalPrice: 100}}
+	items := []domain.OrderItem{{Quantity: 2, UnitPrice: 5000, TotalPrice: 10000}}
 	tax, _, err := service.Quote("CN", items)
 	if err != nil {
 		t.Fatalf("quote: %v", err)
 	}
-	if tax != 10 {
-		t.Fatalf("expected tax 10, got %v", tax)
+	if tax != 1000 {
+		t.Fatalf("expected tax 1000, got %v", tax)
 	}
 }
 
 func TestShippingRateByItems(t *testing.T) {
 	taxRepo := &fakeTaxRuleRepo{}
-	shippingRepo := &fakeShippingRuleRepo{rules: []*domain.ShippingRule{{Region: "CN", BaseAmount: 5, PerItemAmount: 2}}}
+	shippingRepo := &fakeShippingRuleRepo{rules: []*domain.ShippingRule{{Region: "CN", BaseAmount: 500, PerItemAmount: 200}}}
 	service := NewTaxShippingService(taxRepo, shippingRepo)
 
-	items := []domain.OrderItem{{Quantity: 3, UnitPrice: 10, TotalPrice: 30}}
+	items := []domain.OrderItem{{Quantity: 3, UnitPrice: 1000, TotalPrice: 3000}}
 	_, shipping, err := service.Quote("CN", items)
 	if err != nil {
 		t.Fatalf("quote: %v", err)
 	}
-	if shipping != 11 {
-		t.Fatalf("expected shipping 11, got %v", shipping)
+	if shipping != 1100 {
+		t.Fatalf("expected shipping 1100, got %v", shipping)
+	}
+}
+
+func TestSubdivisionFallsBackToCountryRules(t *testing.T) {
+	taxRepo := &fakeTaxRuleRepo{rules: []*domain.TaxRule{
+		{Region: "CN", Rate: 0.1, EffectiveAt: time.Now().Add(-time.Hour)},
+		{Region: "CN-SH", Rate: 0.06, EffectiveAt: time.Now().Add(-time.Hour)},
+	}}
+	shippingRepo := &fakeShippingRuleRepo{rules: []*domain.ShippingRule{{Region: "CN", BaseAmount: 500}}}
+	service := NewTaxShippingService(taxRepo, shippingRepo)
+	items := []domain.OrderItem{{Quantity: 1, UnitPrice: 10000, TotalPrice: 10000}}
+
+	tax, shipping, err := service.Quote("CN-SH", items)
+	if err != nil || tax != 600 || shipping != 500 {
+		t.Fatalf("expected the subdivision's tax and the country's shipping, got %v %v %v", tax, shipping, err)
+	}
+	tax, _, err = service.Quote("CN-BJ", items)
+	if err != nil || tax != 1000 {
+		t.Fatalf("expected a subdivision without rules to use the country's, got %v %v", tax, err)
 	}
 }
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/repository"
+	"github.com/meowucp/internal/ucp/security"
+)
+
+const (
+	// DefaultTokenKeyRotation is how long a key signs before it is replaced.
+	DefaultTokenKeyRotation = 30 * 24 * time.Hour
+	// DefaultTokenKeyOverlap keeps a replaced key published well past the
+	// longest access token lifetime so tokens it signed still verify.
+	DefaultTokenKeyOverlap = 48 * time.Hour
+
+	// tokenKeyReloadInterval bounds reloads forced by unknown kids.
+	tokenKeyReloadInterval = time.Second
+)
+
+var (
+	ErrTokenSigningAlgorithm = errors.New("token_signing_algorithm_unsupported")
+	ErrTokenKeyNotFound      = errors.New("token_key_not_found")
+)
+
+type tokenVerificationKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+// TokenSigningKeyService signs access tokens with RS256 or ES256 keys kept in
+// a sealedKeyStore, like the webhook signing keys. The newest active key
+// signs and is replaced once it is older than the rotation interval; keys
+// rotated out stay published until their ExpiresAt.
+type TokenSigningKeyService struct {
+	keys     *sealedKeyStore
+	auditLog *AuditLogService
+	rotation time.Duration
+
+	mu          sync.Mutex
+	current     crypto.PrivateKey
+	currentKey  *domain.JWTSigningKey
+	loadedAt    time.Time
+	published   map[string]tokenVerificationKey
+	publishedAt time.Time
+}
+
+func NewTokenSigningKeyService(repo repository.JWTSigningKeyRepository, encryptionKey []byte, algorithm string, rotation, overlap time.Duration) (*TokenSigningKeyService, error) {
+	if len(encryptionKey) != 32 {
+		return nil, ErrSigningKeyEncryptionKey
+	}
+	if algorithm != "RS256" && algorithm != "ES256" {
+		return nil, ErrTokenSigningAlgorithm
+	}
+	if rotation <= 0 {
+		rotation = DefaultTokenKeyRotation
+	}
+	if overlap <= 0 {
+		overlap = DefaultTokenKeyOverlap
+	}
+	return &TokenSigningKeyService{
+		keys: &sealedKeyStore{
+			repo:          jwtSealedKeyRepository{repo: repo},
+			encryptionKey: encryptionKey,
+			algorithm:     algorithm,
+			overlap:       overlap,
+		},
+		rotation: rotation,
+	}, nil
+}
+
+func (s *TokenSigningKeyService) SetAuditLog(auditLog *AuditLogService) {
+	s.auditLog = auditLog
+}
+
+// EnsureActiveKey creates a key when none can sign with the configured
+// algorithm yet. Processes starting together create one between them.
+func (s *TokenSigningKeyService) EnsureActiveKey(actor string) error {
+	key, err := s.keys.signingKey()
+	if err != nil {
+		return err
+	}
+	if key != nil && key.Algorithm == s.keys.algorithm {
+		return nil
+	}
+	_, err = s.rotate(actor, func(current *sealedKey) bool {
+		return current == nil || current.Algorithm != s.keys.algorithm
+	})
+	return err
+}
+
+// Rotate generates a key with the configured algorithm and makes it the
+// signing key. Active keys that were still open-ended are given
+// ExpiresAt = now + overlap.
+func (s *TokenSigningKeyService) Rotate(actor string) (*domain.JWTSigningKey, error) {
+	return s.rotate(actor, alwaysRotate)
+}
+
+// rotate runs without s.mu so signing and verification carry on while a key
+// is generated. It returns nil when due no longer held once the rotation lock
+// was taken; the cached key is then dropped so the other process's key is
+// loaded.
+func (s *TokenSigningKeyService) rotate(actor string, due func(current *sealedKey) bool) (*domain.JWTSigningKey, error) {
+	rotation, err := s.keys.rotate(due)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	if rotation == nil {
+		s.current = nil
+		s.mu.Unlock()
+		return nil, nil
+	}
+	key := (*domain.JWTSigningKey)(rotation.key)
+	s.current, s.currentKey, s.loadedAt = rotation.private, key, key.CreatedAt
+	s.publishedAt = time.Time{}
+	s.mu.Unlock()
+
+	s.audit(actor, "token_signing_key_rotated", key.KID, map[string]interface{}{
+		"kid":                 key.KID,
+		"algorithm":           key.Algorithm,
+		"previous_kids":       rotation.previous,
+		"previous_expires_at": rotation.expiresAt,
+	})
+	return key, nil
+}
+
+// rotationDue reports whether current should be replaced: it is missing, uses
+// another algorithm, or is older than the rotation interval.
+func (s *TokenSigningKeyService) rotationDue(current *sealedKey) bool {
+	return current == nil || current.Algorithm != s.keys.algorithm || time.Since(current.CreatedAt) >= s.rotation
+}
+
+// PublicKeys lists the active keys that are still inside their overlap
+// window, newest first, for /oauth2/jwks.
+func (s *TokenSigningKeyService) PublicKeys() []security.JWK {
+	return s.keys.publicKeys()
+}
+
+// SignToken signs claims with the current key and names it in the kid
+// header. A key past the rotation interval is rotated first.
+func (s *TokenSigningKeyService) SignToken(claims jwt.MapClaims) (string, error) {
+	private, key, err := s.signingPrivateKey()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.KID
+	return token.SignedString(private)
+}
+
+// VerificationKey returns the published key kid and its algorithm. Unknown
+// kids reload the key list, at most once per tokenKeyReloadInterval, so keys
+// rotated by another process verify straight away.
+func (s *TokenSigningKeyService) VerificationKey(kid string) (crypto.PublicKey, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	key, ok := s.published[kid]
+	stale := now.Sub(s.publishedAt) >= signingKeyCacheTTL
+	if stale || (!ok && now.Sub(s.publishedAt) >= tokenKeyReloadInterval) {
+		if err := s.loadPublishedLocked(now); err != nil {
+			return nil, "", err
+		}
+		key, ok = s.published[kid]
+	}
+	if !ok {
+		return nil, "", ErrTokenKeyNotFound
+	}
+	return key.key, key.alg, nil
+}
+
+func (s *TokenSigningKeyService) loadPublishedLocked(now time.Time) error {
+	keys, err := s.keys.published(now)
+	if err != nil {
+		return err
+	}
+	published := map[string]tokenVerificationKey{}
+	for _, key := range keys {
+		var jwk security.JWK
+		if err := json.Unmarshal([]byte(key.PublicKey), &jwk); err != nil {
+			continue
+		}
+		public, alg, err := security.PublicKeyFromJWK(jwk)
+		if err != nil {
+			continue
+		}
+		published[key.KID] = tokenVerificationKey{alg: alg, key: public}
+	}
+	s.published, s.publishedAt = published, now
+	return nil
+}
+
+// signingPrivateKey returns the signing key, rotating it first once it is
+// due. Replicas finding it due together rotate once between them.
+func (s *TokenSigningKeyService) signingPrivateKey() (crypto.PrivateKey, *domain.JWTSigningKey, error) {
+	private, key, err := s.cachedSigningKey()
+	if err != nil || !s.rotationDue((*sealedKey)(key)) {
+		return private, key, err
+	}
+	if _, err := s.rotate("system", s.rotationDue); err != nil {
+		return nil, nil, err
+	}
+	return s.cachedSigningKey()
+}
+
+// cachedSigningKey returns the decrypted signing key, cached briefly so
+// rotations made by another process are picked up.
+func (s *TokenSigningKeyService) cachedSigningKey() (crypto.PrivateKey, *domain.JWTSigningKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.current == nil || now.Sub(s.loadedAt) >= signingKeyCacheTTL {
+		key, err := s.keys.signingKey()
+		if err != nil {
+			return nil, nil, err
+		}
+		if key == nil {
+			return nil, nil, ErrNoActiveSigningKey
+		}
+		private, err := s.keys.open(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		s.current, s.currentKey, s.loadedAt = private, (*domain.JWTSigningKey)(key), now
+	}
+	return s.current, s.currentKey, nil
+}
+
+func (s *TokenSigningKeyService) audit(actor, action, kid string, payload map[string]interface{}) {
+	if s.auditLog == nil {
+		return
+	}
+	if actor == "" {
+		actor = "system"
+	}
+	body, _ := json.Marshal(payload)
+	_ = s.auditLog.Record(actor, action, "jwt_signing_key:"+kid, string(body))
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/repository"
+	"github.com/meowucp/internal/ucp/security"
+)
+
+type fakeJWTSigningKeyRepo struct {
+	keys []*domain.JWTSigningKey
+}
+
+func (f *fakeJWTSigningKeyRepo) Create(key *domain.JWTSigningKey) error {
+	key.ID = int64(len(f.keys) + 1)
+	f.keys = append([]*domain.JWTSigningKey{key}, f.keys...)
+	return nil
+}
+func (f *fakeJWTSigningKeyRepo) Update(key *domain.JWTSigningKey) error { return nil }
+func (f *fakeJWTSigningKeyRepo) List() ([]*domain.JWTSigningKey, error) { return f.keys, nil }
+func (f *fakeJWTSigningKeyRepo) WithRotationLock(fn func(repo repository.JWTSigningKeyRepository) error) error {
+	return fn(f)
+}
+
+// verifyToken checks token only against the published JWKS, as an edge proxy
+// would.
+func verifyToken(t *testing.T, jwks []security.JWK, token string) (jwt.MapClaims, string) {
+	t.Helper()
+	claims := jwt.MapClaims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		for _, jwk := range jwks {
+			if jwk.KID == token.Header["kid"] {
+				key, _, err := security.PublicKeyFromJWK(jwk)
+				return key, err
+			}
+		}
+		return nil, ErrTokenKeyNotFound
+	})
+	if err != nil || !parsed.Valid {
+		t.Fatalf("verify token against jwks: %v", err)
+	}
+	return claims, parsed.Method.Alg()
+}
+
+func TestTokenSigningKeysSignVerifiableTokens(t *testing.T) {
+	for _, algorithm := range []string{"RS256", "ES256"} {
+		repo := &fakeJWTSigningKeyRepo{}
+		store, err := NewTokenSigningKeyService(repo, bytes.Repeat([]byte{2}, 32), algorithm, 0, 0)
+		if err != nil {
+			t.Fatalf("%s: new store: %v", algorithm, err)
+		}
+		if err := store.EnsureActiveKey("system"); err != nil {
+			t.Fatalf("%s: ensure key: %v", algorithm, err)
+		}
+
+		token, err := store.SignToken(jwt.MapClaims{"sub": "agent-a", "exp": time.Now().Add(time.Hour).Unix()})
+		if err != nil {
+			t.Fatalf("%s: sign: %v", algorithm, err)
+		}
+		claims, alg := verifyToken(t, store.PublicKeys(), token)
+		if alg != algorithm || claims["sub"] != "agent-a" {
+			t.Fatalf("%s: expected %s token for agent-a, got %s %v", algorithm, algorithm, alg, claims)
+		}
+
+		key, keyAlg, err := store.VerificationKey(repo.keys[0].KID)
+		if err != nil || key == nil || keyAlg != algorithm {
+			t.Fatalf("%s: expected verification key, got %v %q %v", algorithm, key, keyAlg, err)
+		}
+		if _, _, err := store.VerificationKey("unknown"); err != ErrTokenKeyNotFound {
+			t.Fatalf("%s: expected unknown kid to be refused, got %v", algorithm, err)
+		}
+	}
+}
+
+func TestTokenSigningKeysRotateOnSchedule(t *testing.T) {
+	repo := &fakeJWTSigningKeyRepo{}
+	store, err := NewTokenSigningKeyService(repo, bytes.Repeat([]byte{2}, 32), "ES256", time.Hour, 2*time.Hour)
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+	if err := store.EnsureActiveKey("system"); err != nil {
+		t.Fatalf("ensure key: %v", err)
+	}
+	first, err := store.SignToken(jwt.MapClaims{"sub": "user"})
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	oldKID := repo.keys[0].KID
+
+	repo.keys[0].CreatedAt = time.Now().Add(-2 * time.Hour)
+	second, err := store.SignToken(jwt.MapClaims{"sub": "user"})
+	if err != nil {
+		t.Fatalf("sign after rotation interval: %v", err)
+	}
+	if len(repo.keys) != 2 || repo.keys[0].KID == oldKID {
+		t.Fatalf("expected an overdue key to be rotated, got %d keys", len(repo.keys))
+	}
+	if repo.keys[1].ExpiresAt == nil {
+		t.Fatalf("expected the rotated-out key to get an overlap expiry")
+	}
+
+	published := store.PublicKeys()
+	if len(published) != 2 {
+		t.Fatalf("expected both keys published during the overlap, got %d", len(published))
+	}
+	verifyToken(t, published, first)
+	verifyToken(t, published, second)
+
+	expired := time.Now().Add(-time.Second)
+	repo.keys[1].ExpiresAt = &expired
+	if len(store.PublicKeys()) != 1 {
+		t.Fatalf("expected the old key to be withdrawn after the overlap")
+	}
+}
+
+func TestTokenSigningKeysRotateOnceAcrossReplicas(t *testing.T) {
+	repo := &fakeJWTSigningKeyRepo{}
+	first, err := NewTokenSigningKeyService(repo, bytes.Repeat([]byte{2}, 32), "ES256", time.Hour, 2*time.Hour)
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+	second, _ := NewTokenSigningKeyService(repo, bytes.Repeat([]byte{2}, 32), "ES256", time.Hour, 2*time.Hour)
+	if err := first.EnsureActiveKey("system"); err != nil {
+		t.Fatalf("ensure key: %v", err)
+	}
+	if err := second.EnsureActiveKey("system"); err != nil {
+		t.Fatalf("ensure key on second replica: %v", err)
+	}
+	if len(repo.keys) != 1 {
+		t.Fatalf("expected replicas starting together to create one key, got %d", len(repo.keys))
+	}
+	for _, store := range []*TokenSigningKeyService{first, second} {
+		if _, err := store.SignToken(jwt.MapClaims{"sub": "user"}); err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+	}
+
+	repo.keys[0].CreatedAt = time.Now().Add(-2 * time.Hour)
+	tokens := []string{}
+	for _, store := range []*TokenSigningKeyService{first, second} {
+		token, err := store.SignToken(jwt.MapClaims{"sub": "user"})
+		if err != nil {
+			t.Fatalf("sign after rotation interval: %v", err)
+		}
+		tokens = append(tokens, token)
+	}
+	if len(repo.keys) != 2 {
+		t.Fatalf("expected one rotation between the replicas, got %d keys", len(repo.keys))
+	}
+	if repo.keys[0].ExpiresAt != nil {
+		t.Fatalf("expected the new key to stay open-ended")
+	}
+	for _, token := range tokens {
+		verifyToken(t, first.PublicKeys(), token)
+		parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+		if err != nil {
+			t.Fatalf("parse token: %v", err)
+		}
+		if kid := parsed.Header["kid"]; kid != repo.keys[0].KID {
+			t.Fatalf("expected both replicas to sign with the new key, got %v", kid)
+		}
+	}
+}
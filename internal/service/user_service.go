@@ -8,72 +8,97 @@ import (
 )
 
 type Services struct {
-	User            *UserService
-	Product         *ProductService
-	Category        *CategoryService
-	Cart            *CartService
-	Order           *OrderService
-	Payment         *PaymentService
-	Inventory       *InventoryService
-	Checkout        *CheckoutSessionService
-	Handler         *PaymentHandlerService
-	Webhook         *WebhookEventService
-	UCPOrder        *UCPOrderService
-	WebhookAudit    *WebhookAuditService
-	WebhookReplay   *WebhookReplayService
-	WebhookQueue    *WebhookQueueService
-	WebhookDLQ      *WebhookDLQService
-	WebhookAlert    *WebhookAlertService
-	OAuthClient     *OAuthClientService
-	OAuthToken      *OAuthTokenService
-	OAuthClientRepo repository.OAuthClientRepository
-	OAuthTokenRepo  repository.OAuthTokenRepository
-	Promotion       *PromotionService
-	AuditLog        *AuditLogService
-	Localization    *LocalizationService
+	User                *UserService
+	UserSession         *UserSessionService
+	Product             *ProductService
+	Category            *CategoryService
+	Cart                *CartService
+	Order               *OrderService
+	Payment             *PaymentService
+	PaymentProvider     *PaymentProviderRegistry
+	Inventory           *InventoryService
+	Checkout            *CheckoutSessionService
+	Handler             *PaymentHandlerService
+	Webhook             *WebhookEventService
+	UCPOrder            *UCPOrderService
+	WebhookAudit        *WebhookAuditService
+	WebhookReplay       *WebhookReplayService
+	WebhookQueue        *WebhookQueueService
+	WebhookSubscription *WebhookSubscriptionService
+	WebhookDLQ          *WebhookDLQService
+	WebhookAlert        *WebhookAlertService
+	WebhookBreaker      *WebhookBreakerService
+	OAuthClient         *OAuthClientService
+	OAuthToken          *OAuthTokenService
+	OAuthAuthorization  *OAuthAuthorizationService
+	OAuthClientRepo     repository.OAuthClientRepository
+	OAuthTokenRepo      repository.OAuthTokenRepository
+	Promotion           *PromotionService
+	AuditLog            *AuditLogService
+	Localization        *LocalizationService
 }
 
 func NewServices(repos *repository.Repositories, redis *redis.Client) *Services {
 	orderService := NewOrderService(repos.Order, repos.Cart, repos.Product, repos.Inventory, repos.OrderIdempotency)
 	webhookQueue := NewWebhookQueueService(repos.WebhookQueue)
+	webhookQueue.SetSubscriptions(repos.WebhookSubscription)
+	webhookQueue.SetCheckoutSessions(repos.Checkout)
+	webhookQueue.SetDLQ(repos.WebhookDLQ, repos.WebhookReplayLog)
+	webhookQueue.SetShipments(repos.Shipment)
 	orderService.SetWebhookQueue(webhookQueue)
 	orderService.SetShipmentRepo(repos.Shipment)
 	orderService.SetStatusLogRepo(repos.OrderStatusLog)
+	orderService.SetReservationRepo(repos.StockReservation)
+	inventoryService := NewInventoryService(repos.Product, repos.Inventory)
+	inventoryService.SetReservationRepo(repos.StockReservation)
 	paymentService := NewPaymentServiceWithDeps(repos.Payment, repos.Order, repos.PaymentRefund, repos.PaymentEvent)
+	paymentProviders := NewPaymentProviderRegistry()
+	paymentService.SetProviders(paymentProviders, repos.Handler)
+	paymentService.SetInventory(inventoryService)
+	paymentService.SetOrders(orderService)
 	webhookDLQ := NewWebhookDLQService(webhookQueue, repos.WebhookDLQ)
 	oauthClient := NewOAuthClientService(repos.OAuthClient)
 	oauthToken := NewOAuthTokenService(repos.OAuthClient, repos.OAuthToken)
+	oauthToken.SetRefreshTokens(repos.OAuthRefresh)
 	taxShipping := NewTaxShippingService(repos.TaxRule, repos.ShippingRule)
 	checkoutService := NewCheckoutSessionService(repos.Checkout)
 	checkoutService.SetTaxShippingService(taxShipping)
 	promotionService := NewPromotionService(repos.Coupon)
+	checkoutService.SetPromotionService(promotionService)
 	auditLogService := NewAuditLogService(repos.AuditLog)
 	localizationService := NewLocalizationService(repos.CurrencyRate, repos.I18nString)
+	userSession := NewUserSessionService(repos.UserSession)
+	userSession.SetAuditLog(auditLogService)
 
 	return &Services{
-		User:            NewUserService(repos.User),
-		Product:         NewProductService(repos.Product, repos.Inventory, redis),
-		Category:        NewCategoryService(repos.Category),
-		Cart:            NewCartService(repos.Cart, repos.Product),
-		Order:           orderService,
-		Payment:         paymentService,
-		Inventory:       NewInventoryService(repos.Product, repos.Inventory),
-		Checkout:        checkoutService,
-		Promotion:       promotionService,
-		AuditLog:        auditLogService,
-		Localization:    localizationService,
-		Handler:         NewPaymentHandlerService(repos.Handler),
-		Webhook:         NewWebhookEventService(repos.Webhook),
-		UCPOrder:        NewUCPOrderService(repos.Order, repos.Payment),
-		WebhookAudit:    NewWebhookAuditService(repos.WebhookAudit),
-		WebhookReplay:   NewWebhookReplayService(repos.WebhookReplay),
-		WebhookQueue:    webhookQueue,
-		WebhookDLQ:      webhookDLQ,
-		WebhookAlert:    NewWebhookAlertService(repos.WebhookAlert, repos.Webhook),
-		OAuthClient:     oauthClient,
-		OAuthToken:      oauthToken,
-		OAuthClientRepo: repos.OAuthClient,
-		OAuthTokenRepo:  repos.OAuthToken,
+		User:                NewUserService(repos.User),
+		UserSession:         userSession,
+		Product:             NewProductService(repos.Product, repos.Inventory, redis),
+		Category:            NewCategoryService(repos.Category),
+		Cart:                NewCartService(repos.Cart, repos.Product),
+		Order:               orderService,
+		Payment:             paymentService,
+		PaymentProvider:     paymentProviders,
+		Inventory:           inventoryService,
+		Checkout:            checkoutService,
+		Promotion:           promotionService,
+		AuditLog:            auditLogService,
+		Localization:        localizationService,
+		Handler:             NewPaymentHandlerService(repos.Handler),
+		Webhook:             NewWebhookEventService(repos.Webhook),
+		UCPOrder:            NewUCPOrderService(repos.Order, repos.Payment),
+		WebhookAudit:        NewWebhookAuditService(repos.WebhookAudit),
+		WebhookReplay:       NewWebhookReplayService(repos.WebhookReplay),
+		WebhookQueue:        webhookQueue,
+		WebhookSubscription: NewWebhookSubscriptionService(repos.WebhookSubscription, repos.OAuthClient),
+		WebhookDLQ:          webhookDLQ,
+		WebhookAlert:        NewWebhookAlertService(repos.WebhookAlert, repos.Webhook),
+		WebhookBreaker:      NewWebhookBreakerService(repos.WebhookBreaker),
+		OAuthClient:         oauthClient,
+		OAuthToken:          oauthToken,
+		OAuthAuthorization:  NewOAuthAuthorizationService(repos.OAuthClient, repos.OAuthCode),
+		OAuthClientRepo:     repos.OAuthClient,
+		OAuthTokenRepo:      repos.OAuthToken,
 	}
 }
 
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/repository"
+)
+
+const (
+	// UserSessionTTL is how long a session survives without a refresh; every
+	// refresh extends it.
+	UserSessionTTL = 30 * 24 * time.Hour
+
+	// userSessionTouchInterval throttles last-seen writes from authenticated
+	// requests.
+	userSessionTouchInterval = time.Minute
+)
+
+var (
+	ErrUserSessionInvalid  = errors.New("session_invalid")
+	ErrUserSessionNotFound = errors.New("session_not_found")
+)
+
+// UserSessionService tracks signed-in devices so shoppers can be logged out
+// and stolen tokens revoked. Refresh tokens rotate on use; presenting one
+// that was already rotated revokes the session.
+type UserSessionService struct {
+	repo     repository.UserSessionRepository
+	auditLog *AuditLogService
+}
+
+func NewUserSessionService(repo repository.UserSessionRepository) *UserSessionService {
+	return &UserSessionService{repo: repo}
+}
+
+func (s *UserSessionService) SetAuditLog(auditLog *AuditLogService) {
+	s.auditLog = auditLog
+}
+
+// Start opens a session for userID and returns it with its refresh token,
+// which is only stored hashed.
+func (s *UserSessionService) Start(userID int64, ip, userAgent string) (*domain.UserSession, string, error) {
+	if s == nil || s.repo == nil {
+		return nil, "", errors.New("user_session_repo_unavailable")
+	}
+	sessionID, err := randomOAuthCode()
+	if err != nil {
+		return nil, "", err
+	}
+	refreshToken, err := randomOAuthCode()
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	session := &domain.UserSession{
+		SessionID:        sessionID,
+		UserID:           userID,
+		RefreshTokenHash: hashOAuthToken(refreshToken),
+		UserAgent:        userAgent,
+		IP:               ip,
+		LastSeenAt:       now,
+		ExpiresAt:        now.Add(UserSessionTTL),
+		CreatedAt:        now,
+	}
+	if err := s.repo.Create(session); err != nil {
+		return nil, "", err
+	}
+	return session, refreshToken, nil
+}
+
+// Refresh exchanges refreshToken for a new one on the same session. Unknown,
+// expired or revoked tokens are ErrUserSessionInvalid; so is a token that was
+// already rotated, which also revokes the session.
+func (s *UserSessionService) Refresh(refreshToken, ip, userAgent string) (*domain.UserSession, string, error) {
+	if s == nil || s.repo == nil {
+		return nil, "", errors.New("user_session_repo_unavailable")
+	}
+	hash := hashOAuthToken(refreshToken)
+	session, err := s.repo.FindByRefreshHash(hash)
+	if err != nil || session == nil {
+		return nil, "", ErrUserSessionInvalid
+	}
+	now := time.Now()
+	if session.RevokedAt != nil || !now.Before(session.ExpiresAt) {
+		return nil, "", ErrUserSessionInvalid
+	}
+	if session.RefreshTokenHash != hash {
+		if err := s.repo.Revoke(session.ID, now); err != nil {
+			return nil, "", err
+		}
+		return nil, "", ErrUserSessionInvalid
+	}
+
+	next, err := randomOAuthCode()
+	if err != nil {
+		return nil, "", err
+	}
+	nextHash := hashOAuthToken(next)
+	expiresAt := now.Add(UserSessionTTL)
+	rotated, err := s.repo.RotateRefresh(session.ID, hash, nextHash, expiresAt, now)
+	if err != nil {
+		return nil, "", err
+	}
+	if !rotated {
+		if err := s.repo.Revoke(session.ID, now); err != nil {
+			return nil, "", err
+		}
+		return nil, "", ErrUserSessionInvalid
+	}
+	if ip != session.IP || userAgent != session.UserAgent {
+		_ = s.repo.Touch(session.ID, ip, userAgent, now)
+		session.IP, session.UserAgent = ip, userAgent
+	}
+	session.PreviousRefreshTokenHash, session.RefreshTokenHash = hash, nextHash
+	session.ExpiresAt, session.LastSeenAt = expiresAt, now
+	return session, next, nil
+}
+
+// Active reports whether sessionID is a live session of userID, recording
+// the device's address and last-seen time at most once a minute.
+func (s *UserSessionService) Active(sessionID string, userID int64, ip, userAgent string) bool {
+	if s == nil || s.repo == nil || sessionID == "" {
+		return false
+	}
+	session, err := s.repo.FindBySessionID(sessionID)
+	if err != nil || session == nil || session.UserID != userID {
+		return false
+	}
+	now := time.Now()
+	if session.RevokedAt != nil || !now.Before(session.ExpiresAt) {
+		return false
+	}
+	if now.Sub(session.LastSeenAt) >= userSessionTouchInterval || ip != session.IP || userAgent != session.UserAgent {
+		_ = s.repo.Touch(session.ID, ip, userAgent, now)
+	}
+	return true
+}
+
+// List returns the user's live sessions, most recently seen first.
+func (s *UserSessionService) List(userID int64) ([]*domain.UserSession, error) {
+	if s == nil || s.repo == nil {
+		return nil, errors.New("user_session_repo_unavailable")
+	}
+	return s.repo.ListActiveByUser(userID, time.Now())
+}
+
+// Revoke ends one of userID's sessions. Other users' sessions are
+// ErrUserSessionNotFound.
+func (s *UserSessionService) Revoke(userID int64, sessionID string) error {
+	if s == nil || s.repo == nil {
+		return errors.New("user_session_repo_unavailable")
+	}
+	session, err := s.repo.FindBySessionID(sessionID)
+	if err != nil || session == nil || session.UserID != userID {
+		return ErrUserSessionNotFound
+	}
+	return s.repo.Revoke(session.ID, time.Now())
+}
+
+// RevokeAll ends every session of userID and returns how many were live.
+// actor is recorded in the audit log when it is not the user themselves.
+func (s *UserSessionService) RevokeAll(userID int64, actor string) (int64, error) {
+	if s == nil || s.repo == nil {
+		return 0, errors.New("user_session_repo_unavailable")
+	}
+	count, err := s.repo.RevokeAllByUser(userID, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	if actor != "" && s.auditLog != nil {
+		body, _ := json.Marshal(map[string]interface{}{"user_id": userID, "revoked": count})
+		_ = s.auditLog.Record(actor, "user_sessions_revoked", "user:"+strconv.FormatInt(userID, 10), string(body))
+	}
+	return count, nil
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/meowucp/internal/domain"
+)
+
+type fakeUserSessionRepo struct {
+	sessions []*domain.UserSession
+}
+
+func (f *fakeUserSessionRepo) Create(session *domain.UserSession) error {
+	session.ID = int64(len(f.sessions) + 1)
+	f.sessions = append(f.sessions, session)
+	return nil
+}
+
+func (f *fakeUserSessionRepo) FindBySessionID(sessionID string) (*domain.UserSession, error) {
+	for _, session := range f.sessions {
+		if session.SessionID == sessionID {
+			copied := *session
+			return &copied, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+func (f *fakeUserSessionRepo) FindByRefreshHash(tokenHash string) (*domain.UserSession, error) {
+	for _, session := range f.sessions {
+		if session.RefreshTokenHash == tokenHash || session.PreviousRefreshTokenHash == tokenHash {
+			copied := *session
+			return &copied, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+func (f *fakeUserSessionRepo) RotateRefresh(id int64, fromHash, toHash string, expiresAt, seenAt time.Time) (bool, error) {
+	session := f.byID(id)
+	if session == nil || session.RefreshTokenHash != fromHash || session.RevokedAt != nil {
+		return false, nil
+	}
+	session.PreviousRefreshTokenHash, session.RefreshTokenHash = fromHash, toHash
+	session.ExpiresAt, session.LastSeenAt = expiresAt, seenAt
+	return true, nil
+}
+
+func (f *fakeUserSessionRepo) Touch(id int64, ip, userAgent string, seenAt time.Time) error {
+	if session := f.byID(id); session != nil {
+		session.IP, session.UserAgent, session.LastSeenAt = ip, userAgent, seenAt
+	}
+	return nil
+}
+
+func (f *fakeUserSessionRepo) ListActiveByUser(userID int64, now time.Time) ([]*domain.UserSession, error) {
+	result := []*domain.UserSession{}
+	for _, session := range f.sessions {
+		if session.UserID == userID && session.RevokedAt == nil && session.ExpiresAt.After(now) {
+			result = append(result, session)
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeUserSessionRepo) Revoke(id int64, revokedAt time.Time) error {
+	if session := f.byID(id); session != nil && session.RevokedAt == nil {
+		session.RevokedAt = &revokedAt
+	}
+	return nil
+}
+
+func (f *fakeUserSessionRepo) RevokeAllByUser(userID int64, revokedAt time.Time) (int64, error) {
+	var count int64
+	for _, session := range f.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			session.RevokedAt = &revokedAt
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (f *fakeUserSessionRepo) byID(id int64) *domain.UserSession {
+	for _, session := range f.sessions {
+		if session.ID == id {
+			return session
+		}
+	}
+	return nil
+}
+
+func TestUserSessionRefreshRotatesAndDetectsReuse(t *testing.T) {
+	repo := &fakeUserSessionRepo{}
+	sessions := NewUserSessionService(repo)
+
+	session, first, err := sessions.Start(7, "10.0.0.1", "phone")
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if !sessions.Active(session.SessionID, 7, "10.0.0.1", "phone") {
+		t.Fatalf("expected a new session to be active")
+	}
+	if sessions.Active(session.SessionID, 8, "10.0.0.1", "phone") {
+		t.Fatalf("expected another user's session to be refused")
+	}
+
+	refreshed, second, err := sessions.Refresh(first, "10.0.0.2", "phone")
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if second == first || refreshed.SessionID != session.SessionID {
+		t.Fatalf("expected a new refresh token on the same session")
+	}
+	if repo.sessions[0].IP != "10.0.0.2" {
+		t.Fatalf("expected refresh to record the new address, got %q", repo.sessions[0].IP)
+	}
+
+	if _, _, err := sessions.Refresh(first, "10.0.0.3", "laptop"); !errors.Is(err, ErrUserSessionInvalid) {
+		t.Fatalf("expected a reused refresh token to be refused, got %v", err)
+	}
+	if sessions.Active(session.SessionID, 7, "10.0.0.2", "phone") {
+		t.Fatalf("expected refresh token reuse to revoke the session")
+	}
+	if _, _, err := sessions.Refresh(second, "10.0.0.2", "phone"); !errors.Is(err, ErrUserSessionInvalid) {
+		t.Fatalf("expected the current token of a revoked session to be refused, got %v", err)
+	}
+}
+
+func TestUserSessionRevokeAndRevokeAll(t *testing.T) {
+	repo := &fakeUserSessionRepo{}
+	sessions := NewUserSessionService(repo)
+
+	phone, _, _ := sessions.Start(7, "10.0.0.1", "phone")
+	laptop, _, _ := sessions.Start(7, "10.0.0.2", "laptop")
+	other, _, _ := sessions.Start(8, "10.0.0.3", "tablet")
+
+	if err := sessions.Revoke(7, other.SessionID); !errors.Is(err, ErrUserSessionNotFound) {
+		t.Fatalf("expected another user's session to be not found, got %v", err)
+	}
+	if err := sessions.Revoke(7, phone.SessionID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if sessions.Active(phone.SessionID, 7, "10.0.0.1", "phone") {
+		t.Fatalf("expected the revoked session to be inactive")
+	}
+	active, _ := sessions.List(7)
+	if len(active) != 1 || active[0].SessionID != laptop.SessionID {
+		t.Fatalf("expected only the laptop session to be listed, got %d", len(active))
+	}
+
+	count, err := sessions.RevokeAll(7, "admin:1")
+	if err != nil || count != 1 {
+		t.Fatalf("expected one live session revoked, got %d %v", count, err)
+	}
+	if !sessions.Active(other.SessionID, 8, "10.0.0.3", "tablet") {
+		t.Fatalf("expected other users' sessions to survive")
+	}
+}
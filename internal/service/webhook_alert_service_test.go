@@ -63,6 +63,16 @@ func (f *fakeWebhookEventRepo) UpdateStatus(eventID string, status string) error
 func (f *fakeWebhookEventRepo) MarkProcessed(eventID string) error {
 	if event, ok := f.items[eventID]; ok {
 		now := time.Now()
+		event.Status = "processed"
+		event.ProcessedAt = &now
+	}
+	return nil
+}
+
+func (f *fakeWebhookEventRepo) MarkFailed(eventID string) error {
+	if event, ok := f.items[eventID]; ok {
+		now := time.Now()
+		event.Status = "failed"
 		event.ProcessedAt = &now
 	}
 	return nil
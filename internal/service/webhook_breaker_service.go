@@ -0,0 +1,23 @@
+package service
+
+import (
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/repository"
+)
+
+// WebhookBreakerService reports the per-destination circuit breaker state
+// the webhook worker last persisted.
+type WebhookBreakerService struct {
+	repo repository.UCPWebhookBreakerRepository
+}
+
+func NewWebhookBreakerService(repo repository.UCPWebhookBreakerRepository) *WebhookBreakerService {
+	return &WebhookBreakerService{repo: repo}
+}
+
+func (s *WebhookBreakerService) List() ([]*domain.UCPWebhookBreaker, error) {
+	if s == nil || s.repo == nil {
+		return []*domain.UCPWebhookBreaker{}, nil
+	}
+	return s.repo.List()
+}
@@ -28,3 +28,7 @@ func (s *WebhookEventService) UpdateStatus(eventID string, status string) error
 func (s *WebhookEventService) MarkProcessed(eventID string) error {
 	return s.repo.MarkProcessed(eventID)
 }
+
+func (s *WebhookEventService) MarkFailed(eventID string) error {
+	return s.repo.MarkFailed(eventID)
+}
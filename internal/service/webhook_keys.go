@@ -0,0 +1,49 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/meowucp/internal/repository"
+	"github.com/meowucp/internal/ucp/security"
+	"github.com/meowucp/internal/ucp/worker"
+	"github.com/meowucp/pkg/config"
+)
+
+// WebhookKeyring signs outbound webhooks and lists the keys partners should
+// accept them under.
+type WebhookKeyring interface {
+	worker.PayloadSigner
+	PublicKeys() []security.JWK
+}
+
+// LoadWebhookKeys opens the database key store when an encryption key is
+// configured, and the single key file otherwise; the store is nil in the
+// latter case. Only the API, which publishes the key, passes createKeyFile:
+// a worker that made its own key would sign with one partners never see.
+func LoadWebhookKeys(cfg config.UCPWebhookConfig, repo repository.UCPSigningKeyRepository, auditLog *AuditLogService, createKeyFile bool) (WebhookKeyring, *SigningKeyService, error) {
+	if cfg.SigningKeyEncryptionKey == "" {
+		load := security.OpenWebhookSigner
+		if createKeyFile {
+			load = security.LoadWebhookSigner
+		}
+		signer, err := load(cfg.SigningKeyFile, cfg.SigningKeyID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("load webhook signing key: %w", err)
+		}
+		return signer, nil, nil
+	}
+	encryptionKey, err := ParseSigningKeyEncryptionKey(cfg.SigningKeyEncryptionKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	store, err := NewSigningKeyService(repo, encryptionKey, time.Duration(cfg.SigningKeyOverlapHours)*time.Hour)
+	if err != nil {
+		return nil, nil, err
+	}
+	store.SetAuditLog(auditLog)
+	if err := store.EnsureActiveKey("system"); err != nil {
+		return nil, nil, fmt.Errorf("create webhook signing key: %w", err)
+	}
+	return store, store, nil
+}
@@ -5,25 +5,25 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/jinzhu/gorm"
 	"github.com/meowucp/internal/domain"
 	"github.com/meowucp/internal/repository"
 	"github.com/meowucp/internal/ucp/model"
 	"github.com/meowucp/internal/ucp/worker"
+	"github.com/meowucp/pkg/money"
 )
 
 type WebhookQueueService struct {
 	repo          repository.UCPWebhookQueueRepository
 	dlqRepo       repository.WebhookDLQRepository
 	replayLogRepo repository.WebhookReplayLogRepository
-}
-
-type orderWebhookPayload struct {
-	EventType string    `json:"event_type"`
-	OrderNo   string    `json:"order_no"`
-	Status    string    `json:"status"`
-	CreatedAt time.Time `json:"created_at"`
+	subRepo       repository.UCPWebhookSubscriptionRepository
+	checkoutRepo  repository.CheckoutSessionRepository
+	shipmentRepo  repository.ShipmentRepository
+	signer        worker.PayloadSigner
 }
 
 func NewWebhookQueueService(repo repository.UCPWebhookQueueRepository) *WebhookQueueService {
@@ -34,74 +34,151 @@ func NewWebhookQueueServiceWithDeps(repo repository.UCPWebhookQueueRepository, d
 	return &WebhookQueueService{repo: repo, dlqRepo: dlqRepo, replayLogRepo: replayLogRepo}
 }
 
+// SetSigner signs events delivered directly through DeliverOrderEvent.
+func (s *WebhookQueueService) SetSigner(signer worker.PayloadSigner) {
+	s.signer = signer
+}
+
+// SetShipments adds fulfillment and tracking details to order events.
+func (s *WebhookQueueService) SetShipments(repo repository.ShipmentRepository) {
+	s.shipmentRepo = repo
+}
+
+// SetSubscriptions fans client events out to one job per matching
+// subscription of that client.
+func (s *WebhookQueueService) SetSubscriptions(repo repository.UCPWebhookSubscriptionRepository) {
+	s.subRepo = repo
+}
+
+// SetCheckoutSessions attributes order events to the OAuth client whose
+// checkout session placed the order. Without it every order event is treated
+// as client-less and goes to the configured delivery_url.
+func (s *WebhookQueueService) SetCheckoutSessions(repo repository.CheckoutSessionRepository) {
+	s.checkoutRepo = repo
+}
+
 func (s *WebhookQueueService) Enqueue(eventID string, payload string) error {
+	return s.EnqueueEvent(eventID, "", "", payload)
+}
+
+// EnqueueEvent queues payload for clientID's active subscriptions whose
+// filter matches eventType; other clients' subscriptions never see it.
+// Events without a client, such as storefront orders, are queued once
+// without a subscription and go to the configured delivery_url.
+func (s *WebhookQueueService) EnqueueEvent(eventID, eventType, clientID, payload string) error {
 	if s == nil || s.repo == nil {
 		return nil
 	}
-	job := &domain.UCPWebhookJob{
+	if clientID == "" {
+		return s.createJob(eventID, nil, payload)
+	}
+	if s.subRepo == nil {
+		return nil
+	}
+	subscriptions, err := s.subRepo.ListActive()
+	if err != nil {
+		return err
+	}
+	for _, subscription := range subscriptions {
+		if subscription.ClientID != clientID || !WebhookSubscriptionMatches(subscription, eventType) {
+			continue
+		}
+		subscriptionID := subscription.ID
+		if err := s.createJob(eventID, &subscriptionID, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnqueueInbound queues a verified partner event for the worker to apply to
+// local orders on behalf of sender. Inbound events are not fanned out to
+// subscriptions.
+func (s *WebhookQueueService) EnqueueInbound(eventID, sender, payload string) error {
+	if s == nil || s.repo == nil {
+		return nil
+	}
+	return s.repo.Create(&domain.UCPWebhookJob{
 		EventID:     eventID,
 		Payload:     payload,
 		Status:      "pending",
-		Attempts:    0,
+		Kind:        worker.JobKindInbound,
+		Sender:      sender,
 		NextRetryAt: time.Now(),
 		CreatedAt:   time.Now(),
+	})
+}
+
+func (s *WebhookQueueService) createJob(eventID string, subscriptionID *int64, payload string) error {
+	job := &domain.UCPWebhookJob{
+		EventID:        eventID,
+		SubscriptionID: subscriptionID,
+		Payload:        payload,
+		Status:         "pending",
+		Attempts:       0,
+		NextRetryAt:    time.Now(),
+		CreatedAt:      time.Now(),
 	}
 	return s.repo.Create(job)
 }
 
-func (s *WebhookQueueService) EnqueuePaidEvent(order *domain.Order) (string, error) {
+// EnqueueOrderEvent queues an order snapshot for eventType. A bare status
+// such as "paid" is sent as "order.paid".
+func (s *WebhookQueueService) EnqueueOrderEvent(order *domain.Order, eventType string) error {
 	if s == nil || s.repo == nil {
-		return "", nil
+		return nil
 	}
-	if order == nil {
-		return "", errors.New("order required")
-	}
-	eventID := "evt_" + strconv.FormatInt(time.Now().UnixNano(), 10)
-	status := order.Status
-	if status == "" {
-		status = "paid"
-	}
-	payload := model.OrderWebhookEvent{
-		EventID:   eventID,
-		EventType: "order.paid",
-		Timestamp: time.Now().UTC().Format(time.RFC3339),
-		Order: model.OrderWebhookOrder{
-			ID:     strconv.FormatInt(order.ID, 10),
-			Status: status,
-		},
+	event, err := s.buildOrderWebhookEvent(order, eventType)
+	if err != nil {
+		return err
 	}
-
-	body, err := json.Marshal(payload)
+	payload, err := json.Marshal(event)
 	if err != nil {
-		return "", err
+		return err
 	}
-	if err := s.Enqueue(eventID, string(body)); err != nil {
-		return "", err
+	clientID, err := s.orderClientID(order)
+	if err != nil {
+		return err
 	}
-	return eventID, nil
+	return s.EnqueueEvent(event.EventID, event.EventType, clientID, string(payload))
 }
 
-func (s *WebhookQueueService) EnqueueOrderEvent(order *domain.Order, eventType string) error {
-	if s == nil || s.repo == nil {
-		return nil
+// orderClientID returns the OAuth client that created order's checkout
+// session, or "" for orders placed without one.
+func (s *WebhookQueueService) orderClientID(order *domain.Order) (string, error) {
+	if s.checkoutRepo == nil || order.CheckoutSessionID == "" {
+		return "", nil
 	}
-	payload, err := buildOrderWebhookPayload(order, eventType)
+	session, err := s.checkoutRepo.FindByID(order.CheckoutSessionID)
 	if err != nil {
-		return err
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil
+		}
+		return "", err
 	}
-	return s.Enqueue(buildOrderWebhookEventID(order, eventType), string(payload))
+	if session == nil {
+		return "", nil
+	}
+	return session.ClientID, nil
 }
 
 func (s *WebhookQueueService) DeliverOrderEvent(order *domain.Order, eventType string, deliveryURL string, timeout time.Duration) error {
-	payload, err := buildOrderWebhookPayload(order, eventType)
+	event, err := s.buildOrderWebhookEvent(order, eventType)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(event)
 	if err != nil {
 		return err
 	}
 	job := &domain.UCPWebhookJob{
-		EventID: buildOrderWebhookEventID(order, eventType),
+		EventID: event.EventID,
 		Payload: string(payload),
 	}
 	sender := worker.NewDeliverySender(deliveryURL, timeout)
+	if s != nil && s.signer != nil {
+		sender.SetSigner(s.signer)
+	}
 	return sender.Send(job)
 }
 
@@ -133,56 +210,130 @@ func (s *WebhookQueueService) RescheduleNow(id int64) error {
 	return s.repo.Update(job)
 }
 
+// SetDLQ wires the dead-letter and replay-log stores used by MoveToDLQ and
+// ReplayJob.
+func (s *WebhookQueueService) SetDLQ(dlqRepo repository.WebhookDLQRepository, replayLogRepo repository.WebhookReplayLogRepository) {
+	s.dlqRepo = dlqRepo
+	s.replayLogRepo = replayLogRepo
+}
+
+// MoveToDLQ records an exhausted job as a dead letter. The processor calls it
+// once a job has used up its attempts.
 func (s *WebhookQueueService) MoveToDLQ(job *domain.UCPWebhookJob, reason string) error {
 	if s == nil || s.dlqRepo == nil || job == nil {
 		return nil
 	}
 	return s.dlqRepo.Create(&domain.WebhookDLQ{
 		JobID:     job.ID,
+		EventID:   job.EventID,
+		EventType: webhookPayloadEventType(job.Payload),
 		Reason:    reason,
 		Payload:   job.Payload,
 		CreatedAt: time.Now(),
 	})
 }
 
+// ReplayJob puts a job back in the queue with a fresh attempt budget and
+// records the outcome in the replay log.
 func (s *WebhookQueueService) ReplayJob(jobID int64) error {
 	if s == nil || s.repo == nil || s.replayLogRepo == nil {
 		return nil
 	}
 	job, err := s.repo.FindByID(jobID)
-	if err != nil {
-		return err
+	if err == nil {
+		resetReplayedJob(job)
+		err = s.repo.Update(job)
 	}
+	return s.logReplay(jobID, err)
+}
+
+// ReplayDeadLetter requeues the dead letter's job like ReplayJob, stamping
+// the dead letter replayed in the same transaction. A dead letter that was
+// already replayed returns ErrDLQAlreadyReplayed and is left alone.
+func (s *WebhookQueueService) ReplayDeadLetter(item *domain.WebhookDLQ) error {
+	if s == nil || s.repo == nil || s.dlqRepo == nil || s.replayLogRepo == nil || item == nil {
+		return nil
+	}
+	if item.ReplayedAt != nil {
+		return ErrDLQAlreadyReplayed
+	}
+	job, err := s.repo.FindByID(item.JobID)
+	if err == nil {
+		resetReplayedJob(job)
+		var replayed bool
+		replayed, err = s.dlqRepo.MarkReplayed(item.ID, job, time.Now())
+		if err == nil && !replayed {
+			return ErrDLQAlreadyReplayed
+		}
+	}
+	return s.logReplay(item.JobID, err)
+}
+
+func resetReplayedJob(job *domain.UCPWebhookJob) {
 	job.Status = "retrying"
+	job.Attempts = 0
 	job.NextRetryAt = time.Now()
-	if err := s.repo.Update(job); err != nil {
-		return err
+	job.LeaseOwner = ""
+	job.LeaseExpiresAt = nil
+}
+
+func (s *WebhookQueueService) logReplay(jobID int64, err error) error {
+	result := "scheduled"
+	if err != nil {
+		result = "failed: " + err.Error()
 	}
-	return s.replayLogRepo.Create(&domain.WebhookReplayLog{
-		JobID:    job.ID,
+	if logErr := s.replayLogRepo.Create(&domain.WebhookReplayLog{
+		JobID:    jobID,
 		ReplayAt: time.Now(),
-		Result:   "scheduled",
-	})
+		Result:   result,
+	}); logErr != nil && err == nil {
+		return logErr
+	}
+	return err
 }
 
+// maxDLQBulkReplay caps how many dead letters one bulk replay touches.
+const maxDLQBulkReplay = 500
+
+// dlqNotReplayedFilter limits a List or Count to dead letters not yet
+// replayed.
+const dlqNotReplayedFilter = "(replayed_at IS NULL) = ?"
+
+var ErrDLQAlreadyReplayed = errors.New("dlq_already_replayed")
+
 type WebhookDLQService struct {
 	queue *WebhookQueueService
 	repo  repository.WebhookDLQRepository
 }
 
+// DLQReplayItem is the outcome of replaying one dead letter.
+type DLQReplayItem struct {
+	ID     int64  `json:"id"`
+	JobID  int64  `json:"job_id"`
+	Result string `json:"result"`
+}
+
+// DLQBulkReplayResult reports how many dead letters matched the filters and,
+// unless DryRun is set, what happened to each replayed item.
+type DLQBulkReplayResult struct {
+	DryRun  bool            `json:"dry_run"`
+	Matched int64           `json:"matched"`
+	Items   []DLQReplayItem `json:"items"`
+}
+
 func NewWebhookDLQService(queue *WebhookQueueService, repo repository.WebhookDLQRepository) *WebhookDLQService {
 	return &WebhookDLQService{queue: queue, repo: repo}
 }
 
-func (s *WebhookDLQService) ListDLQ(offset, limit int) ([]*domain.WebhookDLQ, int64, error) {
+func (s *WebhookDLQService) ListDLQ(offset, limit int, filters map[string]interface{}) ([]*domain.WebhookDLQ, int64, error) {
 	if s == nil || s.repo == nil {
 		return []*domain.WebhookDLQ{}, 0, nil
 	}
-	items, err := s.repo.List(offset, limit)
+	items, err := s.repo.List(offset, limit, filters)
 	if err != nil {
 		return nil, 0, err
 	}
-	count, err := s.repo.Count()
+	count, err := s.repo.Count(filters)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -197,29 +348,157 @@ func (s *WebhookDLQService) ReplayDLQ(id int64) error {
 	if err != nil {
 		return err
 	}
-	return s.queue.ReplayJob(item.JobID)
+	return s.queue.ReplayDeadLetter(item)
+}
+
+// ReplayDLQBulk replays up to limit dead letters matching filters that were
+// not replayed before, newest first. A failed item is reported and logged but
+// does not stop the batch.
+func (s *WebhookDLQService) ReplayDLQBulk(filters map[string]interface{}, limit int, dryRun bool) (*DLQBulkReplayResult, error) {
+	result := &DLQBulkReplayResult{DryRun: dryRun, Items: []DLQReplayItem{}}
+	if s == nil || s.queue == nil || s.repo == nil {
+		return result, nil
+	}
+	pending := map[string]interface{}{dlqNotReplayedFilter: true}
+	for key, value := range filters {
+		pending[key] = value
+	}
+	filters = pending
+	matched, err := s.repo.Count(filters)
+	if err != nil {
+		return nil, err
+	}
+	result.Matched = matched
+	if dryRun {
+		return result, nil
+	}
+	if limit <= 0 || limit > maxDLQBulkReplay {
+		limit = maxDLQBulkReplay
+	}
+	items, err := s.repo.List(0, limit, filters)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		outcome := "scheduled"
+		if err := s.queue.ReplayDeadLetter(item); err != nil {
+			outcome = "failed: " + err.Error()
+		}
+		result.Items = append(result.Items, DLQReplayItem{ID: item.ID, JobID: item.JobID, Result: outcome})
+	}
+	return result, nil
+}
+
+// PurgeDLQ deletes dead letters older than the given number of days.
+func (s *WebhookDLQService) PurgeDLQ(olderThanDays int) (int64, error) {
+	if s == nil || s.repo == nil {
+		return 0, nil
+	}
+	if olderThanDays <= 0 {
+		return 0, errors.New("older_than_days must be positive")
+	}
+	return s.repo.DeleteBefore(time.Now().AddDate(0, 0, -olderThanDays))
+}
+
+// webhookPayloadEventType reads event_type from a queued payload; payloads
+// without one yield "".
+func webhookPayloadEventType(payload string) string {
+	var envelope struct {
+		EventType string `json:"event_type"`
+	}
+	if err := json.Unmarshal([]byte(payload), &envelope); err != nil {
+		return ""
+	}
+	return envelope.EventType
 }
 
-func buildOrderWebhookPayload(order *domain.Order, eventType string) ([]byte, error) {
+func (s *WebhookQueueService) buildOrderWebhookEvent(order *domain.Order, eventType string) (*model.OrderWebhookEvent, error) {
 	if order == nil {
 		return nil, errors.New("order_missing")
 	}
-	createdAt := order.CreatedAt
-	if createdAt.IsZero() {
-		createdAt = time.Now().UTC()
+	var shipment *domain.Shipment
+	if s != nil && s.shipmentRepo != nil && order.ID != 0 {
+		found, err := s.shipmentRepo.FindByOrderID(order.ID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		shipment = found
 	}
-	payload := orderWebhookPayload{
+	return buildOrderWebhookEvent(order, shipment, eventType, time.Now()), nil
+}
+
+// OrderWebhookEventType maps an order status to its event type.
+func OrderWebhookEventType(status string) string {
+	if strings.Contains(status, ".") {
+		return status
+	}
+	return "order." + status
+}
+
+// OrderWebhookEventID is deterministic per order and event type. The status
+// table never re-enters a status, so each transition gets exactly one ID.
+func OrderWebhookEventID(order *domain.Order, eventType string) string {
+	ref := order.OrderNo
+	if order.ID != 0 {
+		ref = strconv.FormatInt(order.ID, 10)
+	}
+	return fmt.Sprintf("order_%s_%s", ref, OrderWebhookEventType(eventType))
+}
+
+func buildOrderWebhookEvent(order *domain.Order, shipment *domain.Shipment, eventType string, at time.Time) *model.OrderWebhookEvent {
+	eventType = OrderWebhookEventType(eventType)
+	currency := order.Currency
+	if currency == "" {
+		currency = money.DefaultCurrency
+	}
+	snapshot := model.OrderWebhookOrder{
+		ID:                strconv.FormatInt(order.ID, 10),
+		OrderNo:           order.OrderNo,
+		Status:            order.Status,
+		PaymentStatus:     order.PaymentStatus,
+		CheckoutSessionID: order.CheckoutSessionID,
+		Currency:          currency,
+		LineItems:         make([]model.OrderWebhookLineItem, 0, len(order.Items)),
+		Totals: []model.Total{
+			{Type: "subtotal", Amount: int64(order.Subtotal)},
+			{Type: "discount", Amount: int64(order.Discount)},
+			{Type: "shipping", Amount: int64(order.ShippingFee)},
+			{Type: "tax", Amount: int64(order.Tax)},
+			{Type: "total", Amount: int64(order.Total)},
+		},
+		CreatedAt: formatWebhookTime(&order.CreatedAt),
+		UpdatedAt: formatWebhookTime(&order.UpdatedAt),
+	}
+	for _, item := range order.Items {
+		snapshot.LineItems = append(snapshot.LineItems, model.OrderWebhookLineItem{
+			ID:        item.SKU,
+			Title:     item.ProductName,
+			Quantity:  item.Quantity,
+			UnitPrice: int64(item.UnitPrice),
+			Total:     int64(item.TotalPrice),
+		})
+	}
+	if shipment != nil {
+		snapshot.Fulfillment = &model.OrderWebhookFulfillment{
+			Status:         shipment.Status,
+			Carrier:        shipment.Carrier,
+			TrackingNumber: shipment.TrackingNo,
+			ShippedAt:      formatWebhookTime(shipment.ShippedAt),
+			DeliveredAt:    formatWebhookTime(shipment.DeliveredAt),
+		}
+	}
+	return &model.OrderWebhookEvent{
+		Version:   model.OrderWebhookVersion,
+		EventID:   OrderWebhookEventID(order, eventType),
 		EventType: eventType,
-		OrderNo:   order.OrderNo,
-		Status:    order.Status,
-		CreatedAt: createdAt,
+		Timestamp: at.UTC().Format(time.RFC3339),
+		Order:     snapshot,
 	}
-	return json.Marshal(payload)
 }
 
-func buildOrderWebhookEventID(order *domain.Order, eventType string) string {
-	if order == nil {
-		return fmt.Sprintf("order_unknown_%s_%d", eventType, time.Now().UnixNano())
+func formatWebhookTime(value *time.Time) string {
+	if value == nil || value.IsZero() {
+		return ""
 	}
-	return fmt.Sprintf("order_%s_%s_%d", order.OrderNo, eventType, time.Now().UnixNano())
+	return value.UTC().Format(time.RFC3339)
 }
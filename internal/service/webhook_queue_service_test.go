@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/ucp/model"
 )
 
 type fakeQueueRepo struct {
@@ -26,12 +27,19 @@ func (f *fakeQueueRepo) Create(job *domain.UCPWebhookJob) error {
 func (f *fakeQueueRepo) ListDue(limit int) ([]*domain.UCPWebhookJob, error) {
 	return []*domain.UCPWebhookJob{}, nil
 }
+func (f *fakeQueueRepo) ClaimDue(owner string, limit int, lease time.Duration) ([]*domain.UCPWebhookJob, error) {
+	return f.ListDue(limit)
+}
 
 func (f *fakeQueueRepo) Update(job *domain.UCPWebhookJob) error {
 	f.updated = job
 	return nil
 }
 
+func (f *fakeQueueRepo) Release(job *domain.UCPWebhookJob) (bool, error) {
+	return true, f.Update(job)
+}
+
 func (f *fakeQueueRepo) List(offset, limit int) ([]*domain.UCPWebhookJob, error) {
 	return []*domain.UCPWebhookJob{}, nil
 }
@@ -51,6 +59,7 @@ func (f *fakeQueueRepo) FindByID(id int64) (*domain.UCPWebhookJob, error) {
 type fakeWebhookDLQRepo struct {
 	created *domain.WebhookDLQ
 	items   []*domain.WebhookDLQ
+	saved   []*domain.UCPWebhookJob
 }
 
 func (f *fakeWebhookDLQRepo) Create(item *domain.WebhookDLQ) error {
@@ -68,51 +77,122 @@ func (f *fakeWebhookDLQRepo) FindByID(id int64) (*domain.WebhookDLQ, error) {
 	return nil, errors.New("not found")
 }
 
-func (f *fakeWebhookDLQRepo) List(offset, limit int) ([]*domain.WebhookDLQ, error) {
-	if offset >= len(f.items) {
+func (f *fakeWebhookDLQRepo) filtered(filters map[string]interface{}) []*domain.WebhookDLQ {
+	if _, ok := filters[dlqNotReplayedFilter]; !ok {
+		return f.items
+	}
+	var items []*domain.WebhookDLQ
+	for _, item := range f.items {
+		if item.ReplayedAt == nil {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (f *fakeWebhookDLQRepo) List(offset, limit int, filters map[string]interface{}) ([]*domain.WebhookDLQ, error) {
+	items := f.filtered(filters)
+	if offset >= len(items) {
 		return []*domain.WebhookDLQ{}, nil
 	}
 	end := offset + limit
-	if end > len(f.items) {
-		end = len(f.items)
+	if end > len(items) {
+		end = len(items)
 	}
-	return f.items[offset:end], nil
+	return items[offset:end], nil
+}
+
+func (f *fakeWebhookDLQRepo) Count(filters map[string]interface{}) (int64, error) {
+	return int64(len(f.filtered(filters))), nil
 }
 
-func (f *fakeWebhookDLQRepo) Count() (int64, error) {
-	return int64(len(f.items)), nil
+func (f *fakeWebhookDLQRepo) DeleteBefore(cutoff time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (f *fakeWebhookDLQRepo) MarkReplayed(id int64, job *domain.UCPWebhookJob, replayedAt time.Time) (bool, error) {
+	for _, item := range f.items {
+		if item.ID == id && item.ReplayedAt == nil {
+			item.ReplayedAt = &replayedAt
+			f.saved = append(f.saved, job)
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 type fakeWebhookReplayLogRepo struct {
 	created *domain.WebhookReplayLog
+	logs    []*domain.WebhookReplayLog
 }
 
 func (f *fakeWebhookReplayLogRepo) Create(item *domain.WebhookReplayLog) error {
 	f.created = item
+	f.logs = append(f.logs, item)
 	return nil
 }
 
-func TestBuildOrderWebhookPayload(t *testing.T) {
-	order := &domain.Order{OrderNo: "ORD-1", Status: "paid", CreatedAt: time.Unix(1000, 0).UTC()}
-	payload, err := buildOrderWebhookPayload(order, "paid")
+func TestBuildOrderWebhookEventSnapshot(t *testing.T) {
+	shippedAt := time.Unix(2000, 0).UTC()
+	order := &domain.Order{
+		ID:                7,
+		OrderNo:           "ORD-chk_1",
+		CheckoutSessionID: "chk_1",
+		Status:            "shipped",
+		Currency:          "USD",
+		Subtotal:          2000,
+		ShippingFee:       500,
+		Tax:               200,
+		Total:             2700,
+		CreatedAt:         time.Unix(1000, 0).UTC(),
+		Items: []domain.OrderItem{
+			{SKU: "CAT-1", ProductName: "Cat Toy", Quantity: 2, UnitPrice: 1000, TotalPrice: 2000},
+		},
+	}
+	shipment := &domain.Shipment{Status: "shipped", Carrier: "SF", TrackingNo: "SF123", ShippedAt: &shippedAt}
+
+	event := buildOrderWebhookEvent(order, shipment, "shipped", time.Unix(3000, 0))
+	body, err := json.Marshal(event)
 	if err != nil {
-		t.Fatalf("build payload: %v", err)
+		t.Fatalf("encode event: %v", err)
+	}
+	var decoded model.OrderWebhookEvent
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("decode event: %v", err)
+	}
+	if decoded.Version != model.OrderWebhookVersion || decoded.EventType != "order.shipped" {
+		t.Fatalf("expected versioned order.shipped event, got %s %s", decoded.Version, decoded.EventType)
+	}
+	if decoded.Order.ID != "7" || decoded.Order.CheckoutSessionID != "chk_1" || decoded.Order.Currency != "USD" {
+		t.Fatalf("unexpected order snapshot: %+v", decoded.Order)
 	}
-	var decoded orderWebhookPayload
-	if err := json.Unmarshal(payload, &decoded); err != nil {
-		t.Fatalf("decode payload: %v", err)
+	if len(decoded.Order.LineItems) != 1 || decoded.Order.LineItems[0].ID != "CAT-1" || decoded.Order.LineItems[0].Total != 2000 {
+		t.Fatalf("expected line items in snapshot, got %+v", decoded.Order.LineItems)
 	}
-	if decoded.EventType != "paid" {
-		t.Fatalf("expected event_type paid, got %s", decoded.EventType)
+	total := int64(0)
+	for _, item := range decoded.Order.Totals {
+		if item.Type == "total" {
+			total = item.Amount
+		}
+	}
+	if total != 2700 {
+		t.Fatalf("expected total 2700, got %d", total)
 	}
-	if decoded.OrderNo != "ORD-1" {
-		t.Fatalf("expected order_no ORD-1, got %s", decoded.OrderNo)
+	if decoded.Order.Fulfillment == nil || decoded.Order.Fulfillment.TrackingNumber != "SF123" || decoded.Order.Fulfillment.ShippedAt == "" {
+		t.Fatalf("expected shipment tracking, got %+v", decoded.Order.Fulfillment)
 	}
-	if decoded.Status != "paid" {
-		t.Fatalf("expected status paid, got %s", decoded.Status)
+}
+
+func TestOrderWebhookEventIDIsStablePerTransition(t *testing.T) {
+	order := &domain.Order{ID: 7, OrderNo: "ORD-1"}
+	first := buildOrderWebhookEvent(order, nil, "paid", time.Unix(1000, 0))
+	retry := buildOrderWebhookEvent(order, nil, "order.paid", time.Unix(5000, 0))
+	if first.EventID != retry.EventID {
+		t.Fatalf("expected the same event id for one transition, got %s and %s", first.EventID, retry.EventID)
 	}
-	if decoded.CreatedAt.IsZero() {
-		t.Fatalf("expected created_at to be set")
+	shipped := buildOrderWebhookEvent(order, nil, "shipped", time.Unix(1000, 0))
+	if shipped.EventID == first.EventID {
+		t.Fatalf("expected a different event id per transition")
 	}
 }
 
@@ -151,6 +231,73 @@ func TestWebhookQueueMovesToDLQAfterMaxAttempts(t *testing.T) {
 	if dlqRepo.created == nil {
 		t.Fatalf("expected dlq record")
 	}
+	if dlqRepo.created.EventID != "evt_1" || dlqRepo.created.Reason != "max_attempts" {
+		t.Fatalf("expected dlq record to carry event and reason, got %+v", dlqRepo.created)
+	}
+}
+
+func TestWebhookDLQRecordsPayloadEventType(t *testing.T) {
+	dlqRepo := &fakeWebhookDLQRepo{}
+	service := NewWebhookQueueServiceWithDeps(newFakeQueueRepo(), dlqRepo, &fakeWebhookReplayLogRepo{})
+
+	job := &domain.UCPWebhookJob{ID: 12, EventID: "evt_3", Payload: `{"event_type":"order.paid"}`}
+	if err := service.MoveToDLQ(job, "max_attempts"); err != nil {
+		t.Fatalf("move to dlq: %v", err)
+	}
+	if dlqRepo.created.EventType != "order.paid" {
+		t.Fatalf("expected event_type order.paid, got %q", dlqRepo.created.EventType)
+	}
+}
+
+func TestWebhookDLQBulkReplayLogsEachItem(t *testing.T) {
+	repo := newFakeQueueRepo()
+	repo.jobs[21] = &domain.UCPWebhookJob{ID: 21, Status: "failed", Attempts: 5}
+	dlqRepo := &fakeWebhookDLQRepo{items: []*domain.WebhookDLQ{
+		{ID: 1, JobID: 21},
+		{ID: 2, JobID: 99},
+	}}
+	replayRepo := &fakeWebhookReplayLogRepo{}
+	queue := NewWebhookQueueServiceWithDeps(repo, dlqRepo, replayRepo)
+	dlq := NewWebhookDLQService(queue, dlqRepo)
+
+	preview, err := dlq.ReplayDLQBulk(map[string]interface{}{}, 0, true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if preview.Matched != 2 || len(preview.Items) != 0 || len(replayRepo.logs) != 0 {
+		t.Fatalf("expected dry run to count without replaying, got %+v", preview)
+	}
+
+	result, err := dlq.ReplayDLQBulk(map[string]interface{}{}, 0, false)
+	if err != nil {
+		t.Fatalf("bulk replay: %v", err)
+	}
+	if len(result.Items) != 2 || result.Items[0].Result != "scheduled" || result.Items[1].Result == "scheduled" {
+		t.Fatalf("expected one scheduled and one failed item, got %+v", result.Items)
+	}
+	if len(replayRepo.logs) != 2 {
+		t.Fatalf("expected a replay log per item, got %d", len(replayRepo.logs))
+	}
+	if replayed := repo.jobs[21]; replayed.Status != "retrying" || replayed.Attempts != 0 || len(dlqRepo.saved) != 1 {
+		t.Fatalf("expected job requeued with a fresh attempt budget, got %+v", replayed)
+	}
+	if dlqRepo.items[0].ReplayedAt == nil || dlqRepo.items[1].ReplayedAt != nil {
+		t.Fatalf("expected only the requeued dead letter to be marked replayed")
+	}
+
+	again, err := dlq.ReplayDLQBulk(map[string]interface{}{}, 0, false)
+	if err != nil {
+		t.Fatalf("second bulk replay: %v", err)
+	}
+	if again.Matched != 1 || len(again.Items) != 1 || again.Items[0].ID != 2 {
+		t.Fatalf("expected the replayed dead letter to be skipped, got %+v", again)
+	}
+	if err := dlq.ReplayDLQ(1); !errors.Is(err, ErrDLQAlreadyReplayed) {
+		t.Fatalf("expected a single replay of a replayed dead letter to be refused, got %v", err)
+	}
+	if len(dlqRepo.saved) != 1 {
+		t.Fatalf("expected the job not to be requeued again")
+	}
 }
 
 func TestWebhookReplayLogsResult(t *testing.T) {
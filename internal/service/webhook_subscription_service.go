@@ -0,0 +1,181 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/repository"
+)
+
+var (
+	ErrWebhookSubscriptionNotFound   = errors.New("webhook_subscription_not_found")
+	ErrWebhookSubscriptionInvalidURL = errors.New("webhook_subscription_invalid_url")
+	ErrWebhookSubscriptionClient     = errors.New("webhook_subscription_client_not_found")
+)
+
+// WebhookSubscriptionInput carries the admin-editable subscription fields.
+// A nil Active leaves the flag unchanged on update and defaults to true on
+// create.
+type WebhookSubscriptionInput struct {
+	ClientID   string
+	URL        string
+	Secret     string
+	EventTypes []string
+	Active     *bool
+}
+
+type WebhookSubscriptionService struct {
+	repo       repository.UCPWebhookSubscriptionRepository
+	clientRepo repository.OAuthClientRepository
+}
+
+func NewWebhookSubscriptionService(repo repository.UCPWebhookSubscriptionRepository, clientRepo repository.OAuthClientRepository) *WebhookSubscriptionService {
+	return &WebhookSubscriptionService{repo: repo, clientRepo: clientRepo}
+}
+
+func (s *WebhookSubscriptionService) Create(input WebhookSubscriptionInput) (*domain.UCPWebhookSubscription, error) {
+	if s == nil || s.repo == nil {
+		return nil, errors.New("webhook_subscription_repo_unavailable")
+	}
+	subscription := &domain.UCPWebhookSubscription{Active: true, CreatedAt: time.Now()}
+	if err := s.apply(subscription, input); err != nil {
+		return nil, err
+	}
+	subscription.UpdatedAt = subscription.CreatedAt
+	if err := s.repo.Create(subscription); err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+func (s *WebhookSubscriptionService) Update(id int64, input WebhookSubscriptionInput) (*domain.UCPWebhookSubscription, error) {
+	subscription, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if input.ClientID == "" {
+		input.ClientID = subscription.ClientID
+	}
+	if input.URL == "" {
+		input.URL = subscription.URL
+	}
+	if input.Secret == "" {
+		input.Secret = subscription.Secret
+	}
+	if input.EventTypes == nil {
+		input.EventTypes = splitEventTypes(subscription.EventTypes)
+	}
+	if err := s.apply(subscription, input); err != nil {
+		return nil, err
+	}
+	subscription.UpdatedAt = time.Now()
+	if err := s.repo.Update(subscription); err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+// Delete removes the subscription. Jobs already queued for it fail instead of
+// falling back to another endpoint.
+func (s *WebhookSubscriptionService) Delete(id int64) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	return s.repo.Delete(id)
+}
+
+func (s *WebhookSubscriptionService) Get(id int64) (*domain.UCPWebhookSubscription, error) {
+	if s == nil || s.repo == nil {
+		return nil, errors.New("webhook_subscription_repo_unavailable")
+	}
+	subscription, err := s.repo.FindByID(id)
+	if err != nil || subscription == nil {
+		return nil, ErrWebhookSubscriptionNotFound
+	}
+	return subscription, nil
+}
+
+func (s *WebhookSubscriptionService) List(offset, limit int) ([]*domain.UCPWebhookSubscription, int64, error) {
+	if s == nil || s.repo == nil {
+		return []*domain.UCPWebhookSubscription{}, 0, nil
+	}
+	items, err := s.repo.List(offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	count, err := s.repo.Count()
+	if err != nil {
+		return nil, 0, err
+	}
+	return items, count, nil
+}
+
+func (s *WebhookSubscriptionService) apply(subscription *domain.UCPWebhookSubscription, input WebhookSubscriptionInput) error {
+	clientID := strings.TrimSpace(input.ClientID)
+	if clientID == "" {
+		return ErrWebhookSubscriptionClient
+	}
+	if s.clientRepo != nil && clientID != subscription.ClientID {
+		if client, err := s.clientRepo.FindByClientID(clientID); err != nil || client == nil {
+			return ErrWebhookSubscriptionClient
+		}
+	}
+	endpoint := strings.TrimSpace(input.URL)
+	parsed, err := url.Parse(endpoint)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return ErrWebhookSubscriptionInvalidURL
+	}
+	subscription.ClientID = clientID
+	subscription.URL = endpoint
+	subscription.Secret = strings.TrimSpace(input.Secret)
+	subscription.EventTypes = strings.Join(normalizeEventTypes(input.EventTypes), ",")
+	if input.Active != nil {
+		subscription.Active = *input.Active
+	}
+	return nil
+}
+
+// WebhookSubscriptionMatches reports whether the subscription's event filter
+// accepts eventType.
+func WebhookSubscriptionMatches(subscription *domain.UCPWebhookSubscription, eventType string) bool {
+	if subscription == nil || !subscription.Active {
+		return false
+	}
+	filters := splitEventTypes(subscription.EventTypes)
+	if len(filters) == 0 {
+		return true
+	}
+	for _, filter := range filters {
+		switch {
+		case filter == "*" || filter == eventType:
+			return true
+		case strings.HasSuffix(filter, ".*") && strings.HasPrefix(eventType, strings.TrimSuffix(filter, "*")):
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeEventTypes(values []string) []string {
+	result := make([]string, 0, len(values))
+	seen := map[string]bool{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		result = append(result, value)
+	}
+	return result
+}
+
+func splitEventTypes(value string) []string {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	return normalizeEventTypes(strings.Split(value, ","))
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/meowucp/internal/domain"
+)
+
+type fakeWebhookSubscriptionRepo struct {
+	items []*domain.UCPWebhookSubscription
+}
+
+func (f *fakeWebhookSubscriptionRepo) Create(subscription *domain.UCPWebhookSubscription) error {
+	subscription.ID = int64(len(f.items) + 1)
+	f.items = append(f.items, subscription)
+	return nil
+}
+func (f *fakeWebhookSubscriptionRepo) Update(subscription *domain.UCPWebhookSubscription) error {
+	return nil
+}
+func (f *fakeWebhookSubscriptionRepo) Delete(id int64) error {
+	for i, item := range f.items {
+		if item.ID == id {
+			f.items = append(f.items[:i], f.items[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("not found")
+}
+func (f *fakeWebhookSubscriptionRepo) FindByID(id int64) (*domain.UCPWebhookSubscription, error) {
+	for _, item := range f.items {
+		if item.ID == id {
+			return item, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+func (f *fakeWebhookSubscriptionRepo) List(offset, limit int) ([]*domain.UCPWebhookSubscription, error) {
+	return f.items, nil
+}
+func (f *fakeWebhookSubscriptionRepo) Count() (int64, error) { return int64(len(f.items)), nil }
+func (f *fakeWebhookSubscriptionRepo) ListActive() ([]*domain.UCPWebhookSubscription, error) {
+	var result []*domain.UCPWebhookSubscription
+	for _, item := range f.items {
+		if item.Active {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+type fakeSubscriptionClientRepo struct{}
+
+func (fakeSubscriptionClientRepo) Create(client *domain.OAuthClient) error { return nil }
+func (fakeSubscriptionClientRepo) FindByClientID(clientID string) (*domain.OAuthClient, error) {
+	if clientID == "agent-a" || clientID == "agent-b" {
+		return &domain.OAuthClient{ClientID: clientID}, nil
+	}
+	return nil, errors.New("not found")
+}
+func (fakeSubscriptionClientRepo) Update(client *domain.OAuthClient) error { return nil }
+func (fakeSubscriptionClientRepo) List(offset, limit int) ([]*domain.OAuthClient, error) {
+	return nil, nil
+}
+func (fakeSubscriptionClientRepo) Count() (int64, error) { return 0, nil }
+
+func TestWebhookSubscriptionServiceValidates(t *testing.T) {
+	svc := NewWebhookSubscriptionService(&fakeWebhookSubscriptionRepo{}, fakeSubscriptionClientRepo{})
+
+	if _, err := svc.Create(WebhookSubscriptionInput{ClientID: "unknown", URL: "https://a.example/hook"}); !errors.Is(err, ErrWebhookSubscriptionClient) {
+		t.Fatalf("expected unknown client to be rejected, got %v", err)
+	}
+	if _, err := svc.Create(WebhookSubscriptionInput{ClientID: "agent-a", URL: "ftp://a.example"}); !errors.Is(err, ErrWebhookSubscriptionInvalidURL) {
+		t.Fatalf("expected invalid url to be rejected, got %v", err)
+	}
+
+	created, err := svc.Create(WebhookSubscriptionInput{ClientID: "agent-a", URL: "https://a.example/hook", EventTypes: []string{" order.* ", "order.*"}})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if !created.Active || created.EventTypes != "order.*" {
+		t.Fatalf("expected active subscription with normalized filters, got %+v", created)
+	}
+
+	inactive := false
+	updated, err := svc.Update(created.ID, WebhookSubscriptionInput{Active: &inactive})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if updated.Active || updated.URL != "https://a.example/hook" || updated.EventTypes != "order.*" {
+		t.Fatalf("expected partial update to keep other fields, got %+v", updated)
+	}
+	if _, err := svc.Get(99); !errors.Is(err, ErrWebhookSubscriptionNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestWebhookQueueFansOutToMatchingSubscriptions(t *testing.T) {
+	queueRepo := &fakeWebhookQueueRepo{}
+	subRepo := &fakeWebhookSubscriptionRepo{}
+	queue := NewWebhookQueueService(queueRepo)
+	queue.SetSubscriptions(subRepo)
+	queue.SetCheckoutSessions(&fakeInboundCheckoutRepo{sessions: map[string]*domain.CheckoutSession{
+		"cs_a": {ID: "cs_a", ClientID: "agent-a"},
+		"cs_b": {ID: "cs_b", ClientID: "agent-b"},
+	}})
+
+	subs := NewWebhookSubscriptionService(subRepo, fakeSubscriptionClientRepo{})
+	paidOnly, _ := subs.Create(WebhookSubscriptionInput{ClientID: "agent-a", URL: "https://a.example/hook", EventTypes: []string{"order.paid"}})
+	everythingA, _ := subs.Create(WebhookSubscriptionInput{ClientID: "agent-a", URL: "https://a.example/all"})
+	everythingB, _ := subs.Create(WebhookSubscriptionInput{ClientID: "agent-b", URL: "https://b.example/hook"})
+	disabled := false
+	_, _ = subs.Create(WebhookSubscriptionInput{ClientID: "agent-b", URL: "https://c.example/hook", Active: &disabled})
+
+	if err := queue.EnqueueOrderEvent(&domain.Order{OrderNo: "ORD1", Status: "paid", CheckoutSessionID: "cs_a"}, "order.paid"); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if len(queueRepo.jobs) != 2 || *queueRepo.jobs[0].SubscriptionID != paidOnly.ID || *queueRepo.jobs[1].SubscriptionID != everythingA.ID {
+		t.Fatalf("expected one job per matching subscription of agent-a, got %d", len(queueRepo.jobs))
+	}
+
+	queueRepo.jobs = nil
+	if err := queue.EnqueueOrderEvent(&domain.Order{OrderNo: "ORD1", Status: "shipped", CheckoutSessionID: "cs_a"}, "order.shipped"); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if len(queueRepo.jobs) != 1 || *queueRepo.jobs[0].SubscriptionID != everythingA.ID {
+		t.Fatalf("expected filtered subscription to be skipped")
+	}
+
+	queueRepo.jobs = nil
+	if err := queue.EnqueueOrderEvent(&domain.Order{OrderNo: "ORD2", Status: "paid", CheckoutSessionID: "cs_b"}, "order.paid"); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if len(queueRepo.jobs) != 1 || *queueRepo.jobs[0].SubscriptionID != everythingB.ID {
+		t.Fatalf("expected agent-b's order to reach only agent-b's subscription, got %d jobs", len(queueRepo.jobs))
+	}
+
+	queueRepo.jobs = nil
+	if err := queue.EnqueueOrderEvent(&domain.Order{OrderNo: "ORD3", Status: "paid"}, "order.paid"); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if len(queueRepo.jobs) != 1 || queueRepo.jobs[0].SubscriptionID != nil {
+		t.Fatalf("expected a client-less order to go only to the delivery_url")
+	}
+}
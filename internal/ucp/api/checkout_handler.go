@@ -10,8 +10,11 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/middleware"
+	"github.com/meowucp/internal/repository"
 	"github.com/meowucp/internal/service"
 	"github.com/meowucp/internal/ucp/model"
+	"github.com/meowucp/pkg/money"
 )
 
 type CheckoutHandler struct {
@@ -23,8 +26,11 @@ type CheckoutHandler struct {
 type CheckoutHandlerConfig struct {
 	Links           []model.Link
 	ContinueURLBase string
+	ReservationTTL  time.Duration
 }
 
+const defaultReservationTTL = 15 * time.Minute
+
 func NewCheckoutHandler(services *service.Services) *CheckoutHandler {
 	return NewCheckoutHandlerWithConfig(services, CheckoutHandlerConfig{})
 }
@@ -68,12 +74,21 @@ func (h *CheckoutHandler) Create(c *gin.Context) {
 		return
 	}
 
-	totals := computeTotals(req.LineItems)
+	totals, discounts, pricingMessages, err := h.priceCheckout(req.LineItems, req.Buyer, req.FulfillmentAddress, req.Discounts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "pricing_failed"})
+		return
+	}
 	totalsJSON, err := json.Marshal(totals)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "encode_failed"})
 		return
 	}
+	buyerJSON, fulfillmentJSON, discountsJSON, err := encodeCheckoutInputs(req.Buyer, req.FulfillmentAddress, discounts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "encode_failed"})
+		return
+	}
 
 	links := resolvedLinks(resolveBaseURL(c), h.config.Links)
 	linksJSON, err := json.Marshal(links)
@@ -82,30 +97,41 @@ func (h *CheckoutHandler) Create(c *gin.Context) {
 		return
 	}
 
+	checkoutID := h.idGenerator()
+	stockMessages, err := h.holdStock(checkoutID, req.LineItems)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "reservation_failed"})
+		return
+	}
+	recoverableMessages = append(recoverableMessages, stockMessages...)
+
 	paymentHandlers := loadPaymentHandlers(h.services)
 	status, messages := resolveMessagesAndStatus(len(paymentHandlers) > 0, recoverableMessages, nil)
+	messages = append(messages, pricingMessages...)
 	continueURL := ""
-	checkoutID := ""
 	if status == "requires_escalation" {
-		continueURL = buildContinueURL(resolveBaseURL(c), h.config.ContinueURLBase, "", h.idGenerator)
-		checkoutID = extractCheckoutID(continueURL, h.idGenerator)
-	} else {
-		checkoutID = h.idGenerator()
+		continueURL = buildContinueURL(resolveBaseURL(c), h.config.ContinueURLBase, checkoutID, h.idGenerator)
 	}
 	messagesJSON, err := json.Marshal(messages)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "encode_failed"})
 		return
 	}
+	expiresAt := time.Now().Add(h.reservationTTL())
 	session := &domain.CheckoutSession{
 		ID:          checkoutID,
 		Status:      status,
 		Currency:    req.Currency,
 		LineItems:   string(lineItemsJSON),
 		Totals:      string(totalsJSON),
+		Buyer:       buyerJSON,
+		Fulfillment: fulfillmentJSON,
+		Discounts:   discountsJSON,
 		Links:       string(linksJSON),
 		Messages:    string(messagesJSON),
 		ContinueURL: continueURL,
+		ExpiresAt:   &expiresAt,
+		ClientID:    checkoutClientID(c),
 	}
 
 	if h.services == nil || h.services.Checkout == nil {
@@ -114,19 +140,23 @@ func (h *CheckoutHandler) Create(c *gin.Context) {
 	}
 
 	if err := h.services.Checkout.Create(session); err != nil {
+		h.releaseStock(checkoutID)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "create_failed"})
 		return
 	}
 
 	response := model.CheckoutSession{
-		ID:          checkoutID,
-		LineItems:   req.LineItems,
-		Status:      status,
-		Currency:    req.Currency,
-		Totals:      totals,
-		Messages:    messages,
-		Links:       links,
-		ContinueURL: continueURL,
+		ID:                 checkoutID,
+		LineItems:          req.LineItems,
+		Status:             status,
+		Currency:           req.Currency,
+		Buyer:              req.Buyer,
+		FulfillmentAddress: req.FulfillmentAddress,
+		Discounts:          discounts,
+		Totals:             totals,
+		Messages:           messages,
+		Links:              links,
+		ContinueURL:        continueURL,
 		Payment: model.Payment{
 			Handlers: paymentHandlers,
 		},
@@ -148,7 +178,7 @@ func (h *CheckoutHandler) Get(c *gin.Context) {
 	}
 
 	session, err := h.services.Checkout.GetByID(checkoutID)
-	if err != nil {
+	if err != nil || !ownsCheckout(c, session) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
 		return
 	}
@@ -181,15 +211,19 @@ func (h *CheckoutHandler) Get(c *gin.Context) {
 		}
 	}
 
+	buyer, fulfillment, discounts := decodeCheckoutInputs(session)
 	response := model.CheckoutSession{
-		ID:          session.ID,
-		LineItems:   lineItems,
-		Status:      session.Status,
-		Currency:    session.Currency,
-		Totals:      totals,
-		Messages:    messages,
-		Links:       links,
-		ContinueURL: session.ContinueURL,
+		ID:                 session.ID,
+		LineItems:          lineItems,
+		Status:             session.Status,
+		Currency:           session.Currency,
+		Buyer:              buyer,
+		FulfillmentAddress: fulfillment,
+		Discounts:          discounts,
+		Totals:             totals,
+		Messages:           messages,
+		Links:              links,
+		ContinueURL:        session.ContinueURL,
 		Payment: model.Payment{
 			Handlers: loadPaymentHandlers(h.services),
 		},
@@ -216,6 +250,15 @@ func (h *CheckoutHandler) Update(c *gin.Context) {
 		return
 	}
 
+	existing, err := h.services.Checkout.GetByID(checkoutID)
+	if err != nil || !ownsCheckout(c, existing) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+		return
+	}
+	if checkoutClosed(c, existing) {
+		return
+	}
+
 	recoverableMessages := make([]model.Message, 0, 2)
 	if req.Currency == "" {
 		recoverableMessages = append(recoverableMessages, model.Message{
@@ -250,12 +293,21 @@ func (h *CheckoutHandler) Update(c *gin.Context) {
 		return
 	}
 
-	totals := computeTotals(req.LineItems)
+	totals, discounts, pricingMessages, err := h.priceCheckout(req.LineItems, req.Buyer, req.FulfillmentAddress, req.Discounts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "pricing_failed"})
+		return
+	}
 	totalsJSON, err := json.Marshal(totals)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "encode_failed"})
 		return
 	}
+	buyerJSON, fulfillmentJSON, discountsJSON, err := encodeCheckoutInputs(req.Buyer, req.FulfillmentAddress, discounts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "encode_failed"})
+		return
+	}
 
 	links := resolvedLinks(resolveBaseURL(c), h.config.Links)
 	linksJSON, err := json.Marshal(links)
@@ -264,8 +316,16 @@ func (h *CheckoutHandler) Update(c *gin.Context) {
 		return
 	}
 
+	stockMessages, err := h.holdStock(checkoutID, req.LineItems)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "reservation_failed"})
+		return
+	}
+	recoverableMessages = append(recoverableMessages, stockMessages...)
+
 	paymentHandlers := loadPaymentHandlers(h.services)
 	status, messages := resolveMessagesAndStatus(len(paymentHandlers) > 0, recoverableMessages, buyerInputMessages)
+	messages = append(messages, pricingMessages...)
 	continueURL := ""
 	if status == "requires_escalation" {
 		continueURL = buildContinueURL(resolveBaseURL(c), h.config.ContinueURLBase, checkoutID, h.idGenerator)
@@ -276,15 +336,21 @@ func (h *CheckoutHandler) Update(c *gin.Context) {
 		return
 	}
 
+	expiresAt := time.Now().Add(h.reservationTTL())
 	session := &domain.CheckoutSession{
 		ID:          checkoutID,
 		Status:      status,
 		Currency:    req.Currency,
 		LineItems:   string(lineItemsJSON),
 		Totals:      string(totalsJSON),
+		Buyer:       buyerJSON,
+		Fulfillment: fulfillmentJSON,
+		Discounts:   discountsJSON,
 		Links:       string(linksJSON),
 		Messages:    string(messagesJSON),
 		ContinueURL: continueURL,
+		ExpiresAt:   &expiresAt,
+		ClientID:    existing.ClientID,
 	}
 
 	if err := h.services.Checkout.Update(session); err != nil {
@@ -293,14 +359,17 @@ func (h *CheckoutHandler) Update(c *gin.Context) {
 	}
 
 	response := model.CheckoutSession{
-		ID:          checkoutID,
-		LineItems:   req.LineItems,
-		Status:      status,
-		Currency:    req.Currency,
-		Totals:      totals,
-		Messages:    messages,
-		Links:       links,
-		ContinueURL: continueURL,
+		ID:                 checkoutID,
+		LineItems:          req.LineItems,
+		Status:             status,
+		Currency:           req.Currency,
+		Buyer:              req.Buyer,
+		FulfillmentAddress: req.FulfillmentAddress,
+		Discounts:          discounts,
+		Totals:             totals,
+		Messages:           messages,
+		Links:              links,
+		ContinueURL:        continueURL,
 		Payment: model.Payment{
 			Handlers: paymentHandlers,
 		},
@@ -328,10 +397,19 @@ func (h *CheckoutHandler) Complete(c *gin.Context) {
 	}
 
 	session, err := h.services.Checkout.GetByID(checkoutID)
-	if err != nil {
+	if err != nil || !ownsCheckout(c, session) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
 		return
 	}
+	// A retried completion gets the stored result; its stock was already
+	// converted to the order and must not be held again.
+	if session.Status == "completed" {
+		h.replayCompleted(c, session)
+		return
+	}
+	if checkoutClosed(c, session) {
+		return
+	}
 
 	var lineItems []model.LineItem
 	if err := json.Unmarshal([]byte(session.LineItems), &lineItems); err != nil {
@@ -339,33 +417,116 @@ func (h *CheckoutHandler) Complete(c *gin.Context) {
 		return
 	}
 
-	totals := computeTotals(lineItems)
+	buyer, fulfillment, storedDiscounts := decodeCheckoutInputs(session)
+	totals, discounts, _, err := h.priceCheckout(lineItems, buyer, fulfillment, storedDiscounts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "pricing_failed"})
+		return
+	}
+
+	// Re-taking the hold refreshes an expired reservation and rejects the
+	// completion when another session has since claimed the stock.
+	stockMessages, err := h.holdStock(checkoutID, lineItems)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "reservation_failed"})
+		return
+	}
+	if len(stockMessages) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "insufficient_stock", "messages": stockMessages})
+		return
+	}
+
+	handlerID := req.PaymentData.HandlerID
+	var charge *service.PaymentProviderResult
+	if handlerID != "" {
+		if h.services.Payment == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "service_unavailable"})
+			return
+		}
+		charge, err = h.services.Payment.Charge(service.PaymentChargeRequest{
+			HandlerID:      handlerID,
+			IdempotencyKey: "checkout:" + checkoutID,
+			Reference:      checkoutID,
+			Amount:         checkoutTotal(totals),
+			Currency:       session.Currency,
+			Credential:     req.PaymentData.Credential,
+		})
+		switch {
+		case errors.Is(err, service.ErrPaymentDeferred):
+			// Handlers settled by callback (NOWPayments) take no charge here;
+			// the order stays pending until the callback confirms payment.
+			charge = nil
+		case err != nil:
+			respondPaymentError(c, err)
+			return
+		}
+		switch {
+		case charge == nil:
+		case charge.Status == service.PaymentResultCaptured:
+		case charge.Status == service.PaymentResultActionRequired:
+			session.Status = "requires_escalation"
+			_ = h.services.Checkout.Update(session)
+			c.JSON(http.StatusOK, model.CheckoutSession{
+				ID:                 session.ID,
+				LineItems:          lineItems,
+				Status:             "requires_escalation",
+				Currency:           session.Currency,
+				Buyer:              buyer,
+				FulfillmentAddress: fulfillment,
+				Discounts:          discounts,
+				Totals:             totals,
+				Messages: []model.Message{{
+					Type:     "error",
+					Code:     "payment_requires_action",
+					Content:  "Payment requires additional authentication",
+					Severity: "requires_buyer_input",
+				}},
+				Links:       resolvedLinks(resolveBaseURL(c), h.config.Links),
+				ContinueURL: charge.ActionURL,
+				Payment: model.Payment{
+					Handlers: loadPaymentHandlers(h.services),
+				},
+			})
+			return
+		default:
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": "payment_declined", "messages": []model.Message{{
+				Type:     "error",
+				Code:     "payment_declined",
+				Content:  "Payment was declined: " + charge.DeclineCode,
+				Severity: "recoverable",
+			}}})
+			return
+		}
+	}
 
-	order, orderItems, err := buildOrderFromCheckout(session, lineItems, req.PaymentData, true)
+	order, orderItems, err := buildOrderFromCheckout(session, lineItems, totals, checkoutShippingAddress(buyer, fulfillment), req.PaymentData, charge != nil)
 	if err != nil {
+		_ = h.services.Payment.ReverseCharge(handlerID, charge)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "order_build_failed"})
 		return
 	}
 	createdOrder, err := h.services.Order.CreateOrderFromCheckout(order, orderItems, "checkout:"+checkoutID)
 	if err != nil {
+		_ = h.services.Payment.ReverseCharge(handlerID, charge)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "complete_failed"})
 		return
 	}
+	// From here on a failure leaves the session open; a retry takes the same
+	// charge and order by their idempotency keys and finishes the job.
+	if h.services.Inventory != nil {
+		if err := h.services.Inventory.ConvertReservations(checkoutID, createdOrder.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "reservation_failed"})
+			return
+		}
+	}
 
-	if h.services.Payment != nil && req.PaymentData.HandlerID != "" {
+	if charge != nil {
 		paymentPayload, err := json.Marshal(req.PaymentData)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "encode_failed"})
 			return
 		}
-		payment := &domain.Payment{
-			OrderID:        createdOrder.ID,
-			Amount:         createdOrder.Total,
-			PaymentMethod:  req.PaymentData.HandlerID,
-			Status:         "paid",
-			PaymentPayload: string(paymentPayload),
-		}
-		if err := h.services.Payment.CreatePayment(payment); err != nil {
+		if _, err := h.services.Payment.RecordCharge(createdOrder.ID, handlerID, charge, string(paymentPayload)); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "payment_create_failed"})
 			return
 		}
@@ -376,16 +537,22 @@ func (h *CheckoutHandler) Complete(c *gin.Context) {
 	if err == nil {
 		session.Totals = string(sessionTotals)
 	}
-	_ = h.services.Checkout.Update(session)
+	if err := h.services.Checkout.Update(session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "complete_failed"})
+		return
+	}
 
 	response := model.CheckoutSession{
-		ID:          session.ID,
-		LineItems:   lineItems,
-		Status:      "completed",
-		Currency:    session.Currency,
-		Totals:      totals,
-		Links:       resolvedLinks(resolveBaseURL(c), h.config.Links),
-		ContinueURL: session.ContinueURL,
+		ID:                 session.ID,
+		LineItems:          lineItems,
+		Status:             "completed",
+		Currency:           session.Currency,
+		Buyer:              buyer,
+		FulfillmentAddress: fulfillment,
+		Discounts:          discounts,
+		Totals:             totals,
+		Links:              resolvedLinks(resolveBaseURL(c), h.config.Links),
+		ContinueURL:        session.ContinueURL,
 		Payment: model.Payment{
 			Handlers: loadPaymentHandlers(h.services),
 		},
@@ -397,6 +564,53 @@ func (h *CheckoutHandler) Complete(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// replayCompleted answers a repeated Complete with the session as stored
+// and the order it produced.
+func (h *CheckoutHandler) replayCompleted(c *gin.Context, session *domain.CheckoutSession) {
+	order, err := h.services.Order.GetOrderByCheckoutSession(session.ID)
+	if err != nil || order == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "order_lookup_failed"})
+		return
+	}
+	var lineItems []model.LineItem
+	_ = json.Unmarshal([]byte(session.LineItems), &lineItems)
+	var totals []model.Total
+	_ = json.Unmarshal([]byte(session.Totals), &totals)
+	var links []model.Link
+	_ = json.Unmarshal([]byte(session.Links), &links)
+
+	buyer, fulfillment, discounts := decodeCheckoutInputs(session)
+	c.JSON(http.StatusOK, model.CheckoutSession{
+		ID:                 session.ID,
+		LineItems:          lineItems,
+		Status:             "completed",
+		Currency:           session.Currency,
+		Buyer:              buyer,
+		FulfillmentAddress: fulfillment,
+		Discounts:          discounts,
+		Totals:             totals,
+		Links:              links,
+		ContinueURL:        session.ContinueURL,
+		Payment: model.Payment{
+			Handlers: loadPaymentHandlers(h.services),
+		},
+		Order: &model.OrderRef{
+			ID: strconv.FormatInt(order.ID, 10),
+		},
+	})
+}
+
+// checkoutClosed rejects changes to completed or canceled sessions and
+// reports whether it did.
+func checkoutClosed(c *gin.Context, session *domain.CheckoutSession) bool {
+	switch session.Status {
+	case "completed", "canceled":
+		c.JSON(http.StatusConflict, gin.H{"error": "checkout_" + session.Status})
+		return true
+	}
+	return false
+}
+
 func (h *CheckoutHandler) Cancel(c *gin.Context) {
 	if h.services == nil || h.services.Checkout == nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "service_unavailable"})
@@ -410,16 +624,20 @@ func (h *CheckoutHandler) Cancel(c *gin.Context) {
 	}
 
 	session, err := h.services.Checkout.GetByID(checkoutID)
-	if err != nil {
+	if err != nil || !ownsCheckout(c, session) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
 		return
 	}
+	if checkoutClosed(c, session) {
+		return
+	}
 
 	session.Status = "canceled"
 	if err := h.services.Checkout.Update(session); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "cancel_failed"})
 		return
 	}
+	h.releaseStock(checkoutID)
 
 	var lineItems []model.LineItem
 	_ = json.Unmarshal([]byte(session.LineItems), &lineItems)
@@ -430,15 +648,19 @@ func (h *CheckoutHandler) Cancel(c *gin.Context) {
 	var messages []model.Message
 	_ = json.Unmarshal([]byte(session.Messages), &messages)
 
+	buyer, fulfillment, discounts := decodeCheckoutInputs(session)
 	response := model.CheckoutSession{
-		ID:          session.ID,
-		LineItems:   lineItems,
-		Status:      "canceled",
-		Currency:    session.Currency,
-		Totals:      totals,
-		Messages:    messages,
-		Links:       links,
-		ContinueURL: session.ContinueURL,
+		ID:                 session.ID,
+		LineItems:          lineItems,
+		Status:             "canceled",
+		Currency:           session.Currency,
+		Buyer:              buyer,
+		FulfillmentAddress: fulfillment,
+		Discounts:          discounts,
+		Totals:             totals,
+		Messages:           messages,
+		Links:              links,
+		ContinueURL:        session.ContinueURL,
 		Payment: model.Payment{
 			Handlers: loadPaymentHandlers(h.services),
 		},
@@ -447,16 +669,176 @@ func (h *CheckoutHandler) Cancel(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
-func computeTotals(items []model.LineItem) []model.Total {
-	var subtotal int64
-	for _, item := range items {
-		subtotal += item.Item.Price * int64(item.Quantity)
+// priceCheckout builds the subtotal, discount, shipping, tax and total
+// entries for the line items. Discount codes that cannot be applied come back
+// as warnings.
+func (h *CheckoutHandler) priceCheckout(lineItems []model.LineItem, buyer *model.Buyer, fulfillment *model.PostalAddress, discounts *model.Discounts) ([]model.Total, *model.Discounts, []model.Message, error) {
+	var checkout *service.CheckoutSessionService
+	if h.services != nil {
+		checkout = h.services.Checkout
+	}
+	lines := make([]service.CheckoutPriceLine, 0, len(lineItems))
+	for _, item := range lineItems {
+		lines = append(lines, service.CheckoutPriceLine{UnitPrice: money.Amount(item.Item.Price), Quantity: item.Quantity})
+	}
+	var codes []string
+	if discounts != nil {
+		codes = discounts.Codes
+	}
+
+	pricing, err := checkout.Price(checkoutRegion(buyer, fulfillment), lines, codes)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	totals := []model.Total{
+		{Type: "subtotal", Amount: int64(pricing.Subtotal)},
+		{Type: "discount", Amount: int64(pricing.Discount)},
+		{Type: "shipping", Amount: int64(pricing.Shipping)},
+		{Type: "tax", Amount: int64(pricing.Tax)},
+		{Type: "total", Amount: int64(pricing.Total)},
+	}
+	var resolved *model.Discounts
+	if discounts != nil {
+		resolved = &model.Discounts{Codes: discounts.Codes, Applied: pricing.AppliedCodes}
+	}
+	warnings := make([]model.Message, 0, len(pricing.RejectedCodes))
+	for _, code := range pricing.RejectedCodes {
+		warnings = append(warnings, model.Message{
+			Type:    "warning",
+			Code:    "discount_code_rejected",
+			Content: "Discount code " + code + " cannot be applied",
+		})
+	}
+	return totals, resolved, warnings, nil
+}
+
+// checkoutRegion picks the region tax and shipping rules are matched on. The
+// fulfillment address wins over the buyer address, and a subdivision wins over
+// the country. A bare subdivision ("SH") is qualified with the country
+// ("CN-SH") so rules can fall back to the country when it has none.
+func checkoutRegion(buyer *model.Buyer, fulfillment *model.PostalAddress) string {
+	address := fulfillment
+	if address == nil && buyer != nil {
+		address = buyer.Address
+	}
+	if address == nil {
+		return ""
+	}
+	country := strings.TrimSpace(address.AddressCountry)
+	region := strings.TrimSpace(address.AddressRegion)
+	switch {
+	case region == "":
+		return country
+	case country != "" && !strings.Contains(region, "-"):
+		return country + "-" + region
+	}
+	return region
+}
+
+func checkoutShippingAddress(buyer *model.Buyer, fulfillment *model.PostalAddress) string {
+	address := fulfillment
+	if address == nil && buyer != nil {
+		address = buyer.Address
 	}
+	if address == nil {
+		return ""
+	}
+	parts := make([]string, 0, 6)
+	for _, part := range []string{address.StreetAddress, address.ExtendedAddress, address.AddressLocality, address.AddressRegion, address.PostalCode, address.AddressCountry} {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
 
-	return []model.Total{
-		{Type: "subtotal", Amount: subtotal},
-		{Type: "total", Amount: subtotal},
+func encodeCheckoutInputs(buyer *model.Buyer, fulfillment *model.PostalAddress, discounts *model.Discounts) (string, string, string, error) {
+	buyerJSON, err := json.Marshal(buyer)
+	if err != nil {
+		return "", "", "", err
+	}
+	fulfillmentJSON, err := json.Marshal(fulfillment)
+	if err != nil {
+		return "", "", "", err
+	}
+	discountsJSON, err := json.Marshal(discounts)
+	if err != nil {
+		return "", "", "", err
 	}
+	return string(buyerJSON), string(fulfillmentJSON), string(discountsJSON), nil
+}
+
+func decodeCheckoutInputs(session *domain.CheckoutSession) (*model.Buyer, *model.PostalAddress, *model.Discounts) {
+	var buyer *model.Buyer
+	var fulfillment *model.PostalAddress
+	var discounts *model.Discounts
+	if session.Buyer != "" {
+		_ = json.Unmarshal([]byte(session.Buyer), &buyer)
+	}
+	if session.Fulfillment != "" {
+		_ = json.Unmarshal([]byte(session.Fulfillment), &fulfillment)
+	}
+	if session.Discounts != "" {
+		_ = json.Unmarshal([]byte(session.Discounts), &discounts)
+	}
+	return buyer, fulfillment, discounts
+}
+
+func (h *CheckoutHandler) reservationTTL() time.Duration {
+	if h.config.ReservationTTL > 0 {
+		return h.config.ReservationTTL
+	}
+	return defaultReservationTTL
+}
+
+// holdStock reserves stock for the line items under the checkout id. A SKU
+// that cannot be held comes back as a recoverable message rather than an error.
+func (h *CheckoutHandler) holdStock(checkoutID string, lineItems []model.LineItem) ([]model.Message, error) {
+	if h.services == nil || h.services.Inventory == nil {
+		return nil, nil
+	}
+	items := make([]service.StockReservationItem, 0, len(lineItems))
+	for _, item := range lineItems {
+		items = append(items, service.StockReservationItem{SKU: item.Item.ID, Quantity: item.Quantity})
+	}
+	err := h.services.Inventory.ReserveForCheckout(checkoutID, items, h.reservationTTL())
+	if err == nil {
+		return nil, nil
+	}
+	var stockErr *repository.InsufficientStockError
+	if !errors.As(err, &stockErr) {
+		return nil, err
+	}
+	_ = h.services.Inventory.ReleaseReservations(checkoutID)
+	return []model.Message{{
+		Type:     "error",
+		Code:     "out_of_stock",
+		Content:  "Insufficient stock for item " + stockErr.SKU,
+		Severity: "recoverable",
+	}}, nil
+}
+
+func (h *CheckoutHandler) releaseStock(checkoutID string) {
+	if h.services == nil || h.services.Inventory == nil {
+		return
+	}
+	_ = h.services.Inventory.ReleaseReservations(checkoutID)
+}
+
+// checkoutClientID names the OAuth client making the request, or "" when the
+// route is not behind the bearer middleware.
+func checkoutClientID(c *gin.Context) string {
+	if client, ok := middleware.OAuthClientFromContext(c); ok {
+		return client.ClientID
+	}
+	return ""
+}
+
+// ownsCheckout reports whether the calling client created session. Sessions
+// of other clients are answered as not found.
+func ownsCheckout(c *gin.Context, session *domain.CheckoutSession) bool {
+	return session != nil && session.ClientID == checkoutClientID(c)
 }
 
 func defaultCheckoutID() string {
@@ -475,7 +857,7 @@ func loadPaymentHandlers(services *service.Services) []model.PaymentHandler {
 	result := make([]model.PaymentHandler, 0, len(handlers))
 	for _, handler := range handlers {
 		instrumentSchemas := []string{}
-		if handler.Name == nowPaymentsName {
+		if handler.Name == nowPaymentsName || handler.Name == service.SandboxProviderName {
 			instrumentSchemas = []string{cardInstrumentSchema}
 		}
 		configValue := parseHandlerConfig(handler.Config)
@@ -492,35 +874,63 @@ func loadPaymentHandlers(services *service.Services) []model.PaymentHandler {
 	return result
 }
 
+func respondPaymentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrPaymentProviderNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported_payment_handler"})
+	case errors.Is(err, service.ErrPaymentTimeout):
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "payment_timeout"})
+	default:
+		c.JSON(http.StatusBadGateway, gin.H{"error": "payment_failed"})
+	}
+}
+
+func checkoutTotal(totals []model.Total) money.Amount {
+	for _, total := range totals {
+		if total.Type == "total" {
+			return money.Amount(total.Amount)
+		}
+	}
+	return 0
+}
+
 func buildOrderNo(checkoutID string) string {
 	return "ORD-" + checkoutID
 }
 
-func buildOrderFromCheckout(session *domain.CheckoutSession, lineItems []model.LineItem, payment model.PaymentInstrument, markPaid bool) (*domain.Order, []domain.OrderItem, error) {
+func buildOrderFromCheckout(session *domain.CheckoutSession, lineItems []model.LineItem, totals []model.Total, shippingAddress string, payment model.PaymentInstrument, markPaid bool) (*domain.Order, []domain.OrderItem, error) {
 	if session == nil {
 		return nil, nil, errors.New("checkout session required")
 	}
 	orderItems := make([]domain.OrderItem, 0, len(lineItems))
-	var subtotalMinor int64
 	for _, item := range lineItems {
-		subtotalMinor += item.Item.Price * int64(item.Quantity)
-		unitPrice := float64(item.Item.Price) / 100
+		unitPrice := money.Amount(item.Item.Price)
 		orderItems = append(orderItems, domain.OrderItem{
 			ProductName: item.Item.Title,
 			SKU:         item.Item.ID,
 			Quantity:    item.Quantity,
 			UnitPrice:   unitPrice,
-			TotalPrice:  unitPrice * float64(item.Quantity),
+			TotalPrice:  unitPrice.Mul(item.Quantity),
 		})
 	}
 
-	order := &domain.Order{
-		OrderNo:  buildOrderNo(session.ID),
-		Status:   "pending",
-		Subtotal: float64(subtotalMinor) / 100,
-		Total:    float64(subtotalMinor) / 100,
-		Currency: session.Currency,
+	amounts := map[string]money.Amount{}
+	for _, total := range totals {
+		amounts[total.Type] = money.Amount(total.Amount)
 	}
+
+	order := &domain.Order{
+		OrderNo:         buildOrderNo(session.ID),
+		Status:          "pending",
+		Subtotal:        amounts["subtotal"],
+		Discount:        amounts["discount"],
+		ShippingFee:     amounts["shipping"],
+		Tax:             amounts["tax"],
+		Total:           amounts["total"],
+		Currency:        session.Currency,
+		ShippingAddress: shippingAddress,
+	}
+	order.CheckoutSessionID = session.ID
 	if payment.HandlerID != "" {
 		order.PaymentMethod = payment.HandlerID
 	}
@@ -582,14 +992,3 @@ func buildContinueURL(baseURL, configuredBase, checkoutID string, fallback func(
 	continueBase = strings.TrimRight(continueBase, "/")
 	return continueBase + "/" + checkoutID
 }
-
-func extractCheckoutID(continueURL string, fallback func() string) string {
-	if continueURL == "" {
-		return fallback()
-	}
-	parts := strings.Split(continueURL, "/")
-	if len(parts) == 0 {
-		return fallback()
-	}
-	return parts[len(parts)-1]
-}
@@ -8,16 +8,21 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jinzhu/gorm"
 	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/middleware"
+	"github.com/meowucp/internal/repository"
 	"github.com/meowucp/internal/service"
 	"github.com/meowucp/internal/ucp/model"
 )
 
 type fakeCheckoutRepo struct {
 	items map[string]*domain.CheckoutSession
+	// failUpdates makes the next Update calls fail without storing.
+	failUpdates int
 }
 
 func newFakeCheckoutRepo() *fakeCheckoutRepo {
@@ -25,12 +30,18 @@ func newFakeCheckoutRepo() *fakeCheckoutRepo {
 }
 
 func (f *fakeCheckoutRepo) Create(session *domain.CheckoutSession) error {
-	f.items[session.ID] = session
+	stored := *session
+	f.items[session.ID] = &stored
 	return nil
 }
 
 func (f *fakeCheckoutRepo) Update(session *domain.CheckoutSession) error {
-	f.items[session.ID] = session
+	if f.failUpdates > 0 {
+		f.failUpdates--
+		return errors.New("update failed")
+	}
+	stored := *session
+	f.items[session.ID] = &stored
 	return nil
 }
 
@@ -39,7 +50,8 @@ func (f *fakeCheckoutRepo) FindByID(id string) (*domain.CheckoutSession, error)
 	if !ok {
 		return nil, errors.New("not found")
 	}
-	return session, nil
+	found := *session
+	return &found, nil
 }
 
 func (f *fakeCheckoutRepo) Delete(id string) error {
@@ -90,7 +102,17 @@ func (f *fakeOrderRepo) CountByUserID(userID int64) (int64, error) {
 }
 
 func (f *fakeOrderRepo) List(offset, limit int, filters map[string]interface{}) ([]*domain.Order, error) {
-	return nil, errors.New("not implemented")
+	sessionID, ok := filters["checkout_session_id = ?"]
+	if !ok {
+		return nil, errors.New("not implemented")
+	}
+	var result []*domain.Order
+	for _, order := range f.orders {
+		if order.CheckoutSessionID == sessionID {
+			result = append(result, order)
+		}
+	}
+	return result, nil
 }
 
 func (f *fakeOrderRepo) Count(filters map[string]interface{}) (int64, error) {
@@ -140,7 +162,20 @@ func (f *fakePaymentRepo) FindByOrderID(orderID int64) ([]*domain.Payment, error
 }
 
 func (f *fakePaymentRepo) FindByTransactionID(transactionID string) (*domain.Payment, error) {
-	return nil, errors.New("not implemented")
+	for _, item := range f.items {
+		if item.TransactionID == transactionID {
+			return item, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+func newSandboxPaymentService(paymentRepo *fakePaymentRepo, orderRepo *fakeOrderRepo) *service.PaymentService {
+	registry := service.NewPaymentProviderRegistry()
+	registry.Register(service.SandboxProviderName, service.NewSandboxPaymentProvider())
+	paymentService := service.NewPaymentService(paymentRepo, orderRepo)
+	paymentService.SetProviders(registry, nil)
+	return paymentService
 }
 
 func (f *fakePaymentRepo) List(offset, limit int, filters map[string]interface{}) ([]*domain.Payment, error) {
@@ -879,11 +914,14 @@ func TestCheckoutCompleteCreatesOrder(t *testing.T) {
 	inventoryRepo := &fakeCheckoutInventoryRepo{}
 	idempotencyRepo := newFakeCheckoutIdempotencyRepo()
 
+	paymentRepo := newFakePaymentRepo()
+
 	checkoutService := service.NewCheckoutSessionService(checkoutRepo)
 	orderService := service.NewOrderService(orderRepo, nil, productRepo, inventoryRepo, idempotencyRepo)
 	services := &service.Services{
 		Checkout: checkoutService,
 		Order:    orderService,
+		Payment:  newSandboxPaymentService(paymentRepo, orderRepo),
 	}
 
 	handler := NewCheckoutHandler(services)
@@ -927,7 +965,7 @@ func TestCheckoutCompleteCreatesOrder(t *testing.T) {
 
 	completeBody := model.CheckoutCompleteRequest{
 		PaymentData: model.PaymentInstrument{
-			HandlerID: "com.nowpayments",
+			HandlerID: service.SandboxProviderName,
 			Type:      "card",
 			Credential: map[string]string{
 				"token": "tok_123",
@@ -975,7 +1013,7 @@ func TestCheckoutCompleteCreatesOrderAndPayment(t *testing.T) {
 	idempotencyRepo := newFakeCheckoutIdempotencyRepo()
 	checkoutService := service.NewCheckoutSessionService(checkoutRepo)
 	orderService := service.NewOrderService(orderRepo, nil, productRepo, inventoryRepo, idempotencyRepo)
-	paymentService := service.NewPaymentService(paymentRepo, orderRepo)
+	paymentService := newSandboxPaymentService(paymentRepo, orderRepo)
 
 	services := &service.Services{
 		Checkout: checkoutService,
@@ -1024,7 +1062,7 @@ func TestCheckoutCompleteCreatesOrderAndPayment(t *testing.T) {
 
 	completeBody := model.CheckoutCompleteRequest{
 		PaymentData: model.PaymentInstrument{
-			HandlerID: "com.nowpayments",
+			HandlerID: service.SandboxProviderName,
 			Type:      "card",
 			Credential: map[string]string{
 				"token": "tok_123",
@@ -1063,8 +1101,72 @@ func TestCheckoutCompleteCreatesOrderAndPayment(t *testing.T) {
 	if paymentRepo.createCount != 1 {
 		t.Fatalf("expected payment created once")
 	}
-	if paymentRepo.items[0].PaymentMethod != "com.nowpayments" {
-		t.Fatalf("expected payment method com.nowpayments")
+	if paymentRepo.items[0].PaymentMethod != service.SandboxProviderName || paymentRepo.items[0].TransactionID == "" {
+		t.Fatalf("expected sandbox payment with transaction id, got %+v", paymentRepo.items[0])
+	}
+}
+
+func TestCheckoutCompleteDefersPaymentForHandlerWithoutProvider(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	checkoutRepo := newFakeCheckoutRepo()
+	orderRepo := newFakeOrderRepo()
+	paymentRepo := newFakePaymentRepo()
+	productRepo := newFakeCheckoutProductRepo(map[string]*domain.Product{
+		"sku_1": {ID: 10, Name: "Test Item", SKU: "sku_1", StockQuantity: 5},
+	})
+	handlerRepo := newFakePaymentHandlerRepo()
+	_ = handlerRepo.Create(&domain.PaymentHandler{Name: nowPaymentsName, Version: "2026-01-11"})
+	paymentService := service.NewPaymentService(paymentRepo, orderRepo)
+	paymentService.SetProviders(service.NewPaymentProviderRegistry(), handlerRepo)
+
+	services := &service.Services{
+		Checkout: service.NewCheckoutSessionService(checkoutRepo),
+		Order:    service.NewOrderService(orderRepo, nil, productRepo, &fakeCheckoutInventoryRepo{}, newFakeCheckoutIdempotencyRepo()),
+		Payment:  paymentService,
+	}
+	handler := NewCheckoutHandler(services)
+
+	r := gin.New()
+	r.POST("/ucp/v1/checkout-sessions", handler.Create)
+	r.POST("/ucp/v1/checkout-sessions/:id/complete", handler.Complete)
+
+	payload, _ := json.Marshal(model.CheckoutCreateRequest{
+		Currency: "CNY",
+		LineItems: []model.LineItem{{
+			Item:     model.Item{ID: "sku_1", Title: "Test Item", Price: 19900},
+			Quantity: 1,
+		}},
+	})
+	createResp := httptest.NewRecorder()
+	createReq := httptest.NewRequest(http.MethodPost, "/ucp/v1/checkout-sessions", bytes.NewReader(payload))
+	createReq.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(createResp, createReq)
+	if createResp.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", createResp.Code)
+	}
+	var created model.CheckoutSession
+	if err := json.Unmarshal(createResp.Body.Bytes(), &created); err != nil {
+		t.Fatalf("unmarshal create response: %v", err)
+	}
+
+	completePayload, _ := json.Marshal(model.CheckoutCompleteRequest{
+		PaymentData: model.PaymentInstrument{HandlerID: nowPaymentsName, Type: "crypto"},
+	})
+	completeResp := httptest.NewRecorder()
+	completeReq := httptest.NewRequest(http.MethodPost, "/ucp/v1/checkout-sessions/"+created.ID+"/complete", bytes.NewReader(completePayload))
+	completeReq.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(completeResp, completeReq)
+
+	if completeResp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", completeResp.Code, completeResp.Body.String())
+	}
+	if paymentRepo.createCount != 0 {
+		t.Fatalf("expected no payment before the callback")
+	}
+	order := orderRepo.orders[1]
+	if order == nil || order.Status != "pending" || order.PaymentMethod != nowPaymentsName {
+		t.Fatalf("expected pending NOWPayments order, got %+v", order)
 	}
 }
 
@@ -1079,11 +1181,14 @@ func TestCheckoutCompleteIdempotent(t *testing.T) {
 	inventoryRepo := &fakeCheckoutInventoryRepo{}
 	idempotencyRepo := newFakeCheckoutIdempotencyRepo()
 
+	paymentRepo := newFakePaymentRepo()
+
 	checkoutService := service.NewCheckoutSessionService(checkoutRepo)
 	orderService := service.NewOrderService(orderRepo, nil, productRepo, inventoryRepo, idempotencyRepo)
 	services := &service.Services{
 		Checkout: checkoutService,
 		Order:    orderService,
+		Payment:  newSandboxPaymentService(paymentRepo, orderRepo),
 	}
 
 	handler := NewCheckoutHandler(services)
@@ -1127,7 +1232,7 @@ func TestCheckoutCompleteIdempotent(t *testing.T) {
 
 	completeBody := model.CheckoutCompleteRequest{
 		PaymentData: model.PaymentInstrument{
-			HandlerID: "com.nowpayments",
+			HandlerID: service.SandboxProviderName,
 			Type:      "card",
 			Credential: map[string]string{
 				"token": "tok_123",
@@ -1177,6 +1282,9 @@ func TestCheckoutCompleteIdempotent(t *testing.T) {
 	if orderRepo.createCount != 1 {
 		t.Fatalf("expected order created once")
 	}
+	if paymentRepo.createCount != 1 {
+		t.Fatalf("expected payment recorded once, got %d", paymentRepo.createCount)
+	}
 }
 
 func TestCheckoutCancel(t *testing.T) {
@@ -1251,3 +1359,557 @@ func TestCheckoutCancel(t *testing.T) {
 		t.Fatalf("expected status canceled, got %s", fetched.Status)
 	}
 }
+
+type fakeCheckoutReservationRepo struct {
+	stock    map[int64]int
+	held     map[string]map[int64]int
+	released []string
+	orderIDs map[string]int64
+}
+
+func newFakeCheckoutReservationRepo(stock map[int64]int) *fakeCheckoutReservationRepo {
+	return &fakeCheckoutReservationRepo{stock: stock, held: map[string]map[int64]int{}, orderIDs: map[string]int64{}}
+}
+
+// ReplaceForSession leaves a session alone once its holds were converted.
+func (f *fakeCheckoutReservationRepo) ReplaceForSession(sessionID string, reservations []*domain.StockReservation) error {
+	if _, converted := f.orderIDs[sessionID]; converted {
+		return nil
+	}
+	for _, reservation := range reservations {
+		reserved, _ := f.SumActiveByProduct(reservation.ProductID, sessionID)
+		if f.stock[reservation.ProductID]-reserved < reservation.Quantity {
+			return &repository.InsufficientStockError{SKU: reservation.SKU}
+		}
+	}
+	held := map[int64]int{}
+	for _, reservation := range reservations {
+		held[reservation.ProductID] += reservation.Quantity
+	}
+	f.held[sessionID] = held
+	return nil
+}
+
+func (f *fakeCheckoutReservationRepo) ListBySession(sessionID string) ([]*domain.StockReservation, error) {
+	return nil, nil
+}
+
+func (f *fakeCheckoutReservationRepo) ReleaseBySession(sessionID string) error {
+	delete(f.held, sessionID)
+	f.released = append(f.released, sessionID)
+	return nil
+}
+
+func (f *fakeCheckoutReservationRepo) ConvertBySession(sessionID string, orderID int64) error {
+	delete(f.held, sessionID)
+	f.orderIDs[sessionID] = orderID
+	return nil
+}
+
+func (f *fakeCheckoutReservationRepo) ReleaseExpired(now time.Time) (int64, error) { return 0, nil }
+
+func (f *fakeCheckoutReservationRepo) SumActiveByProduct(productID int64, excludeSessionID string) (int, error) {
+	total := 0
+	for sessionID, held := range f.held {
+		if sessionID != excludeSessionID {
+			total += held[productID]
+		}
+	}
+	return total, nil
+}
+
+func TestCheckoutCreateFlagsOutOfStockWhenAnotherSessionHoldsStock(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	productRepo := newFakeCheckoutProductRepo(map[string]*domain.Product{
+		"sku_1": {ID: 10, Name: "Test Item", SKU: "sku_1", StockQuantity: 1, Status: 1},
+	})
+	reservationRepo := newFakeCheckoutReservationRepo(map[int64]int{10: 1})
+	inventoryService := service.NewInventoryService(productRepo, &fakeCheckoutInventoryRepo{})
+	inventoryService.SetReservationRepo(reservationRepo)
+	services := &service.Services{
+		Checkout:  service.NewCheckoutSessionService(newFakeCheckoutRepo()),
+		Inventory: inventoryService,
+	}
+
+	handler := NewCheckoutHandler(services)
+	ids := []string{"chk_a", "chk_b"}
+	handler.idGenerator = func() string {
+		id := ids[0]
+		ids = ids[1:]
+		return id
+	}
+
+	r := gin.New()
+	r.POST("/ucp/v1/checkout-sessions", handler.Create)
+	r.DELETE("/ucp/v1/checkout-sessions/:id", handler.Cancel)
+
+	payload, err := json.Marshal(model.CheckoutCreateRequest{
+		Currency: "CNY",
+		LineItems: []model.LineItem{
+			{Item: model.Item{ID: "sku_1", Title: "Test Item", Price: 19900}, Quantity: 1},
+		},
+	})
+	if err != nil {
+		t.Fatalf("marshal create request: %v", err)
+	}
+
+	create := func() model.CheckoutSession {
+		req := httptest.NewRequest(http.MethodPost, "/ucp/v1/checkout-sessions", bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		if resp.Code != http.StatusCreated {
+			t.Fatalf("expected status 201, got %d", resp.Code)
+		}
+		var created model.CheckoutSession
+		if err := json.Unmarshal(resp.Body.Bytes(), &created); err != nil {
+			t.Fatalf("unmarshal create response: %v", err)
+		}
+		return created
+	}
+
+	first := create()
+	for _, message := range first.Messages {
+		if message.Code == "out_of_stock" {
+			t.Fatalf("expected first session to hold stock")
+		}
+	}
+
+	second := create()
+	found := false
+	for _, message := range second.Messages {
+		if message.Code == "out_of_stock" && message.Severity == "recoverable" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected out_of_stock message, got %+v", second.Messages)
+	}
+
+	cancelReq := httptest.NewRequest(http.MethodDelete, "/ucp/v1/checkout-sessions/"+first.ID, nil)
+	cancelResp := httptest.NewRecorder()
+	r.ServeHTTP(cancelResp, cancelReq)
+	if cancelResp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", cancelResp.Code)
+	}
+	if _, ok := reservationRepo.held[first.ID]; ok {
+		t.Fatalf("expected cancel to release the hold")
+	}
+}
+
+func TestCheckoutCompleteReplaysAfterStockIsConverted(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	productRepo := newFakeCheckoutProductRepo(map[string]*domain.Product{
+		"sku_1": {ID: 10, Name: "Test Item", SKU: "sku_1", StockQuantity: 5, Status: 1},
+	})
+	reservationRepo := newFakeCheckoutReservationRepo(map[int64]int{10: 5})
+	inventoryService := service.NewInventoryService(productRepo, &fakeCheckoutInventoryRepo{})
+	inventoryService.SetReservationRepo(reservationRepo)
+	orderRepo := newFakeOrderRepo()
+	services := &service.Services{
+		Checkout:  service.NewCheckoutSessionService(newFakeCheckoutRepo()),
+		Order:     service.NewOrderService(orderRepo, nil, productRepo, &fakeCheckoutInventoryRepo{}, newFakeCheckoutIdempotencyRepo()),
+		Inventory: inventoryService,
+	}
+	handler := NewCheckoutHandler(services)
+	ids := []string{"chk_a", "chk_b"}
+	handler.idGenerator = func() string {
+		id := ids[0]
+		ids = ids[1:]
+		return id
+	}
+
+	r := gin.New()
+	r.POST("/ucp/v1/checkout-sessions", handler.Create)
+	r.PUT("/ucp/v1/checkout-sessions/:id", handler.Update)
+	r.POST("/ucp/v1/checkout-sessions/:id/complete", handler.Complete)
+	r.DELETE("/ucp/v1/checkout-sessions/:id", handler.Cancel)
+
+	lineItems := []model.LineItem{{Item: model.Item{ID: "sku_1", Title: "Test Item", Price: 19900}, Quantity: 1}}
+	serve := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var reader *bytes.Reader
+		if body != nil {
+			payload, err := json.Marshal(body)
+			if err != nil {
+				t.Fatalf("marshal request: %v", err)
+			}
+			reader = bytes.NewReader(payload)
+		} else {
+			reader = bytes.NewReader(nil)
+		}
+		req := httptest.NewRequest(method, path, reader)
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+	update := model.CheckoutUpdateRequest{Currency: "CNY", LineItems: lineItems}
+
+	if resp := serve(http.MethodPost, "/ucp/v1/checkout-sessions", model.CheckoutCreateRequest{Currency: "CNY", LineItems: lineItems}); resp.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", resp.Code)
+	}
+	var first, second model.CheckoutSession
+	resp := serve(http.MethodPost, "/ucp/v1/checkout-sessions/chk_a/complete", model.CheckoutCompleteRequest{})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected first complete to succeed, got %d: %s", resp.Code, resp.Body.String())
+	}
+	_ = json.Unmarshal(resp.Body.Bytes(), &first)
+	if _, converted := reservationRepo.orderIDs["chk_a"]; !converted {
+		t.Fatalf("expected the hold to be converted to the order")
+	}
+
+	resp = serve(http.MethodPost, "/ucp/v1/checkout-sessions/chk_a/complete", model.CheckoutCompleteRequest{})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected a repeated complete to replay, got %d: %s", resp.Code, resp.Body.String())
+	}
+	_ = json.Unmarshal(resp.Body.Bytes(), &second)
+	if second.Status != "completed" || first.Order == nil || second.Order == nil || first.Order.ID != second.Order.ID {
+		t.Fatalf("expected the same completed order on replay, got %+v / %+v", first.Order, second.Order)
+	}
+	if orderRepo.createCount != 1 {
+		t.Fatalf("expected order created once, got %d", orderRepo.createCount)
+	}
+	if resp := serve(http.MethodDelete, "/ucp/v1/checkout-sessions/chk_a", nil); resp.Code != http.StatusConflict || !strings.Contains(resp.Body.String(), "checkout_completed") {
+		t.Fatalf("expected canceling a completed session to conflict, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	if resp := serve(http.MethodPut, "/ucp/v1/checkout-sessions/chk_a", update); resp.Code != http.StatusConflict || !strings.Contains(resp.Body.String(), "checkout_completed") {
+		t.Fatalf("expected updating a completed session to conflict, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	if resp := serve(http.MethodPost, "/ucp/v1/checkout-sessions", model.CheckoutCreateRequest{Currency: "CNY", LineItems: lineItems}); resp.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", resp.Code)
+	}
+	if resp := serve(http.MethodDelete, "/ucp/v1/checkout-sessions/chk_b", nil); resp.Code != http.StatusOK {
+		t.Fatalf("expected cancel to succeed, got %d", resp.Code)
+	}
+	if resp := serve(http.MethodPut, "/ucp/v1/checkout-sessions/chk_b", update); resp.Code != http.StatusConflict {
+		t.Fatalf("expected updating a canceled session to conflict, got %d", resp.Code)
+	}
+	if resp := serve(http.MethodPost, "/ucp/v1/checkout-sessions/chk_b/complete", model.CheckoutCompleteRequest{}); resp.Code != http.StatusConflict || !strings.Contains(resp.Body.String(), "checkout_canceled") {
+		t.Fatalf("expected completing a canceled session to conflict, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp := serve(http.MethodDelete, "/ucp/v1/checkout-sessions/chk_b", nil); resp.Code != http.StatusConflict || !strings.Contains(resp.Body.String(), "checkout_canceled") {
+		t.Fatalf("expected canceling a canceled session to conflict, got %d: %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestCheckoutCompleteRetriesAfterConvertedStock(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	productRepo := newFakeCheckoutProductRepo(map[string]*domain.Product{
+		"sku_1": {ID: 10, Name: "Test Item", SKU: "sku_1", StockQuantity: 5, Status: 1},
+	})
+	reservationRepo := newFakeCheckoutReservationRepo(map[int64]int{10: 5})
+	inventoryService := service.NewInventoryService(productRepo, &fakeCheckoutInventoryRepo{})
+	inventoryService.SetReservationRepo(reservationRepo)
+	checkoutRepo := newFakeCheckoutRepo()
+	orderRepo := newFakeOrderRepo()
+	services := &service.Services{
+		Checkout:  service.NewCheckoutSessionService(checkoutRepo),
+		Order:     service.NewOrderService(orderRepo, nil, productRepo, &fakeCheckoutInventoryRepo{}, newFakeCheckoutIdempotencyRepo()),
+		Inventory: inventoryService,
+	}
+	handler := NewCheckoutHandler(services)
+	handler.idGenerator = func() string { return "chk_a" }
+
+	r := gin.New()
+	r.POST("/ucp/v1/checkout-sessions", handler.Create)
+	r.POST("/ucp/v1/checkout-sessions/:id/complete", handler.Complete)
+
+	serve := func(path string, body interface{}) *httptest.ResponseRecorder {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal request: %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	lineItems := []model.LineItem{{Item: model.Item{ID: "sku_1", Title: "Test Item", Price: 19900}, Quantity: 1}}
+	if resp := serve("/ucp/v1/checkout-sessions", model.CheckoutCreateRequest{Currency: "CNY", LineItems: lineItems}); resp.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", resp.Code)
+	}
+
+	checkoutRepo.failUpdates = 1
+	if resp := serve("/ucp/v1/checkout-sessions/chk_a/complete", model.CheckoutCompleteRequest{}); resp.Code != http.StatusInternalServerError {
+		t.Fatalf("expected a failed session update to be reported, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if _, converted := reservationRepo.orderIDs["chk_a"]; !converted {
+		t.Fatalf("expected the hold to be converted before the failure")
+	}
+
+	resp := serve("/ucp/v1/checkout-sessions/chk_a/complete", model.CheckoutCompleteRequest{})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected the retry to complete, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var completed model.CheckoutSession
+	_ = json.Unmarshal(resp.Body.Bytes(), &completed)
+	if completed.Status != "completed" || orderRepo.createCount != 1 {
+		t.Fatalf("expected the retry to finish the existing order, got %s with %d orders", completed.Status, orderRepo.createCount)
+	}
+}
+
+type fakeCheckoutTaxRuleRepo struct {
+	rules map[string][]*domain.TaxRule
+}
+
+func (f *fakeCheckoutTaxRuleRepo) ListByRegion(region string) ([]*domain.TaxRule, error) {
+	return f.rules[region], nil
+}
+
+type fakeCheckoutShippingRuleRepo struct {
+	rules map[string][]*domain.ShippingRule
+}
+
+func (f *fakeCheckoutShippingRuleRepo) ListByRegion(region string) ([]*domain.ShippingRule, error) {
+	return f.rules[region], nil
+}
+
+func TestCheckoutTotalsUseFulfillmentRegionAndFlowIntoOrder(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	checkoutService := service.NewCheckoutSessionService(newFakeCheckoutRepo())
+	checkoutService.SetTaxShippingService(service.NewTaxShippingService(
+		&fakeCheckoutTaxRuleRepo{rules: map[string][]*domain.TaxRule{
+			"CN-SH": {{Region: "CN-SH", Rate: 0.06, EffectiveAt: time.Now().Add(-time.Hour)}},
+		}},
+		&fakeCheckoutShippingRuleRepo{rules: map[string][]*domain.ShippingRule{
+			"CN-SH": {{Region: "CN-SH", BaseAmount: 1000, PerItemAmount: 0}},
+		}},
+	))
+	orderRepo := newFakeOrderRepo()
+	productRepo := newFakeCheckoutProductRepo(map[string]*domain.Product{
+		"sku_1": {ID: 10, Name: "Test Item", SKU: "sku_1", StockQuantity: 5},
+	})
+	orderService := service.NewOrderService(orderRepo, nil, productRepo, &fakeCheckoutInventoryRepo{}, newFakeCheckoutIdempotencyRepo())
+	services := &service.Services{Checkout: checkoutService, Order: orderService}
+
+	handler := NewCheckoutHandler(services)
+	r := gin.New()
+	r.POST("/ucp/v1/checkout-sessions", handler.Create)
+	r.PUT("/ucp/v1/checkout-sessions/:id", handler.Update)
+	r.POST("/ucp/v1/checkout-sessions/:id/complete", handler.Complete)
+
+	lineItems := []model.LineItem{{Item: model.Item{ID: "sku_1", Title: "Test Item", Price: 10000}, Quantity: 1}}
+	payload, _ := json.Marshal(model.CheckoutCreateRequest{Currency: "CNY", LineItems: lineItems})
+	createReq := httptest.NewRequest(http.MethodPost, "/ucp/v1/checkout-sessions", bytes.NewReader(payload))
+	createReq.Header.Set("Content-Type", "application/json")
+	createResp := httptest.NewRecorder()
+	r.ServeHTTP(createResp, createReq)
+	if createResp.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", createResp.Code)
+	}
+	var created model.CheckoutSession
+	if err := json.Unmarshal(createResp.Body.Bytes(), &created); err != nil {
+		t.Fatalf("unmarshal create response: %v", err)
+	}
+	if amount := totalAmount(created.Totals, "tax"); amount != 0 {
+		t.Fatalf("expected no tax without an address, got %d", amount)
+	}
+
+	updatePayload, _ := json.Marshal(model.CheckoutUpdateRequest{
+		Currency:           "CNY",
+		LineItems:          lineItems,
+		FulfillmentAddress: &model.PostalAddress{AddressCountry: "CN", AddressRegion: "CN-SH", StreetAddress: "1 Road"},
+	})
+	updateReq := httptest.NewRequest(http.MethodPut, "/ucp/v1/checkout-sessions/"+created.ID, bytes.NewReader(updatePayload))
+	updateReq.Header.Set("Content-Type", "application/json")
+	updateResp := httptest.NewRecorder()
+	r.ServeHTTP(updateResp, updateReq)
+	if updateResp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", updateResp.Code)
+	}
+	var updated model.CheckoutSession
+	if err := json.Unmarshal(updateResp.Body.Bytes(), &updated); err != nil {
+		t.Fatalf("unmarshal update response: %v", err)
+	}
+	if totalAmount(updated.Totals, "tax") != 600 || totalAmount(updated.Totals, "shipping") != 1000 || totalAmount(updated.Totals, "total") != 11600 {
+		t.Fatalf("unexpected totals: %+v", updated.Totals)
+	}
+
+	completePayload, _ := json.Marshal(model.CheckoutCompleteRequest{})
+	completeReq := httptest.NewRequest(http.MethodPost, "/ucp/v1/checkout-sessions/"+created.ID+"/complete", bytes.NewReader(completePayload))
+	completeReq.Header.Set("Content-Type", "application/json")
+	completeResp := httptest.NewRecorder()
+	r.ServeHTTP(completeResp, completeReq)
+	if completeResp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", completeResp.Code)
+	}
+	order := orderRepo.orders[1]
+	if order == nil || order.Tax != 600 || order.ShippingFee != 1000 || order.Total != 11600 || order.ShippingAddress == "" {
+		t.Fatalf("expected order to carry the breakdown, got %+v", order)
+	}
+}
+
+func totalAmount(totals []model.Total, totalType string) int64 {
+	for _, total := range totals {
+		if total.Type == totalType {
+			return total.Amount
+		}
+	}
+	return -1
+}
+
+func TestCheckoutRegionQualifiesSubdivisions(t *testing.T) {
+	buyer := &model.Buyer{Address: &model.PostalAddress{AddressCountry: "US"}}
+	cases := []struct {
+		fulfillment *model.PostalAddress
+		want        string
+	}{
+		{&model.PostalAddress{AddressCountry: "CN", AddressRegion: "CN-SH"}, "CN-SH"},
+		{&model.PostalAddress{AddressCountry: "CN", AddressRegion: "SH"}, "CN-SH"},
+		{&model.PostalAddress{AddressCountry: "CN"}, "CN"},
+		{&model.PostalAddress{AddressRegion: "CN-SH"}, "CN-SH"},
+		{nil, "US"},
+	}
+	for _, tc := range cases {
+		if got := checkoutRegion(buyer, tc.fulfillment); got != tc.want {
+			t.Fatalf("checkoutRegion(%+v) = %q, want %q", tc.fulfillment, got, tc.want)
+		}
+	}
+}
+
+func TestCheckoutCompleteSurfacesSandboxDeclineAndEscalation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	checkoutRepo := newFakeCheckoutRepo()
+	orderRepo := newFakeOrderRepo()
+	paymentRepo := newFakePaymentRepo()
+	productRepo := newFakeCheckoutProductRepo(map[string]*domain.Product{
+		"sku_1": {ID: 10, Name: "Test Item", SKU: "sku_1", StockQuantity: 5},
+	})
+	services := &service.Services{
+		Checkout: service.NewCheckoutSessionService(checkoutRepo),
+		Order:    service.NewOrderService(orderRepo, nil, productRepo, &fakeCheckoutInventoryRepo{}, newFakeCheckoutIdempotencyRepo()),
+		Payment:  newSandboxPaymentService(paymentRepo, orderRepo),
+	}
+	handler := NewCheckoutHandler(services)
+
+	r := gin.New()
+	r.POST("/ucp/v1/checkout-sessions", handler.Create)
+	r.POST("/ucp/v1/checkout-sessions/:id/complete", handler.Complete)
+
+	payload, _ := json.Marshal(model.CheckoutCreateRequest{
+		Currency:  "CNY",
+		LineItems: []model.LineItem{{Item: model.Item{ID: "sku_1", Title: "Test Item", Price: 19900}, Quantity: 1}},
+	})
+	createResp := httptest.NewRecorder()
+	createReq := httptest.NewRequest(http.MethodPost, "/ucp/v1/checkout-sessions", bytes.NewReader(payload))
+	createReq.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(createResp, createReq)
+	var created model.CheckoutSession
+	if err := json.Unmarshal(createResp.Body.Bytes(), &created); err != nil {
+		t.Fatalf("unmarshal create response: %v", err)
+	}
+
+	complete := func(card string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(model.CheckoutCompleteRequest{PaymentData: model.PaymentInstrument{
+			HandlerID:  service.SandboxProviderName,
+			Type:       "card",
+			Credential: map[string]string{"number": card},
+		}})
+		req := httptest.NewRequest(http.MethodPost, "/ucp/v1/checkout-sessions/"+created.ID+"/complete", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	if resp := complete(service.SandboxCardDeclined); resp.Code != http.StatusPaymentRequired {
+		t.Fatalf("expected status 402, got %d", resp.Code)
+	}
+	resp := complete(service.SandboxCardRequires3DS)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	var escalated model.CheckoutSession
+	if err := json.Unmarshal(resp.Body.Bytes(), &escalated); err != nil {
+		t.Fatalf("unmarshal escalation response: %v", err)
+	}
+	if escalated.Status != "requires_escalation" || escalated.ContinueURL == "" || escalated.Order != nil {
+		t.Fatalf("expected escalation without order, got %+v", escalated)
+	}
+	if resp := complete(service.SandboxCardTimeout); resp.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected status 504, got %d", resp.Code)
+	}
+	if orderRepo.createCount != 0 || paymentRepo.createCount != 0 {
+		t.Fatalf("expected no order or payment for failed payments")
+	}
+}
+
+func TestCheckoutSessionsAreScopedToTheCreatingClient(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	checkoutRepo := newFakeCheckoutRepo()
+	services := &service.Services{Checkout: service.NewCheckoutSessionService(checkoutRepo)}
+	handler := NewCheckoutHandler(services)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set(middleware.OAuthClientKey, &domain.OAuthClient{ClientID: c.GetHeader("X-Test-Client"), Status: "active"})
+	})
+	r.POST("/ucp/v1/checkout-sessions", handler.Create)
+	r.GET("/ucp/v1/checkout-sessions/:id", handler.Get)
+	r.PUT("/ucp/v1/checkout-sessions/:id", handler.Update)
+	r.DELETE("/ucp/v1/checkout-sessions/:id", handler.Cancel)
+
+	send := func(method, path, client string, body interface{}) *httptest.ResponseRecorder {
+		var reader *bytes.Reader
+		if body != nil {
+			payload, err := json.Marshal(body)
+			if err != nil {
+				t.Fatalf("marshal request: %v", err)
+			}
+			reader = bytes.NewReader(payload)
+		} else {
+			reader = bytes.NewReader(nil)
+		}
+		req := httptest.NewRequest(method, path, reader)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Test-Client", client)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	lineItems := []model.LineItem{{Item: model.Item{ID: "sku_1", Title: "Test Item", Price: 19900}, Quantity: 1}}
+	createResp := send(http.MethodPost, "/ucp/v1/checkout-sessions", "agent-a", model.CheckoutCreateRequest{Currency: "CNY", LineItems: lineItems})
+	if createResp.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", createResp.Code)
+	}
+	var created model.CheckoutSession
+	if err := json.Unmarshal(createResp.Body.Bytes(), &created); err != nil {
+		t.Fatalf("unmarshal create response: %v", err)
+	}
+	if checkoutRepo.items[created.ID].ClientID != "agent-a" {
+		t.Fatalf("expected session to record its client, got %q", checkoutRepo.items[created.ID].ClientID)
+	}
+
+	path := "/ucp/v1/checkout-sessions/" + created.ID
+	update := model.CheckoutUpdateRequest{ID: created.ID, Currency: "CNY", LineItems: lineItems}
+	if resp := send(http.MethodGet, path, "agent-b", nil); resp.Code != http.StatusNotFound {
+		t.Fatalf("expected another client's read to be 404, got %d", resp.Code)
+	}
+	if resp := send(http.MethodPut, path, "agent-b", update); resp.Code != http.StatusNotFound {
+		t.Fatalf("expected another client's update to be 404, got %d", resp.Code)
+	}
+	if resp := send(http.MethodDelete, path, "agent-b", nil); resp.Code != http.StatusNotFound {
+		t.Fatalf("expected another client's cancel to be 404, got %d", resp.Code)
+	}
+
+	if resp := send(http.MethodPut, path, "agent-a", update); resp.Code != http.StatusOK {
+		t.Fatalf("expected the owner's update to succeed, got %d", resp.Code)
+	}
+	if checkoutRepo.items[created.ID].ClientID != "agent-a" {
+		t.Fatalf("expected update to keep the session's client")
+	}
+	if resp := send(http.MethodGet, path, "agent-a", nil); resp.Code != http.StatusOK {
+		t.Fatalf("expected the owner's read to succeed, got %d", resp.Code)
+	}
+}
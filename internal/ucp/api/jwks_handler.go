@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/meowucp/internal/ucp/model"
+	"github.com/meowucp/internal/ucp/security"
+)
+
+// SigningKeySource lists the public keys a set of signatures verifies
+// against: the webhook signing keys, or the access token keys.
+type SigningKeySource interface {
+	PublicKeys() []security.JWK
+}
+
+type JWKSHandler struct {
+	keys SigningKeySource
+}
+
+func NewJWKSHandler(keys SigningKeySource) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+// Serve publishes the source's keys as a JWK set; the same handler serves the
+// webhook keys and, at /oauth2/jwks, the access token keys.
+func (h *JWKSHandler) Serve(c *gin.Context) {
+	set := security.JWKSet{Keys: []security.JWK{}}
+	if h.keys != nil {
+		set.Keys = append(set.Keys, h.keys.PublicKeys()...)
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, set)
+}
+
+func mapSigningKeys(keys SigningKeySource) []model.SigningKey {
+	if keys == nil {
+		return nil
+	}
+	jwks := keys.PublicKeys()
+	result := make([]model.SigningKey, 0, len(jwks))
+	for _, jwk := range jwks {
+		result = append(result, model.SigningKey{
+			KID: jwk.KID,
+			KTY: jwk.KTY,
+			CRV: jwk.CRV,
+			X:   jwk.X,
+			Y:   jwk.Y,
+			Use: jwk.Use,
+			Alg: jwk.Alg,
+		})
+	}
+	return result
+}
@@ -28,6 +28,12 @@ type SignatureVerifier interface {
 	Verify(r *http.Request, body []byte) error
 }
 
+// SenderSignatureVerifier also reports which sender's keys were checked, so
+// audit rows can name the sender that failed verification.
+type SenderSignatureVerifier interface {
+	VerifySender(r *http.Request, body []byte) (string, error)
+}
+
 func NewOrderWebhookHandler(services *service.Services) *OrderWebhookHandler {
 	return &OrderWebhookHandler{services: services}
 }
@@ -46,7 +52,7 @@ func (h *OrderWebhookHandler) Receive(c *gin.Context) {
 		return
 	}
 	if h.verifier == nil {
-		_ = h.auditSignatureFailure(c, nil, "verifier_unconfigured")
+		_ = h.auditSignatureFailure(c, nil, "verifier_unconfigured", "")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "signature_verifier_unconfigured"})
 		return
 	}
@@ -57,9 +63,10 @@ func (h *OrderWebhookHandler) Receive(c *gin.Context) {
 		return
 	}
 
-	if err := h.verifier.Verify(c.Request, body); err != nil {
+	sender, err := h.verify(c.Request, body)
+	if err != nil {
 		auditEventID := extractEventID(body)
-		_ = h.auditSignatureFailure(c, body, "invalid_signature", auditEventID)
+		_ = h.auditSignatureFailure(c, body, "invalid_signature", sender, auditEventID)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_signature"})
 		return
 	}
@@ -82,7 +89,7 @@ func (h *OrderWebhookHandler) Receive(c *gin.Context) {
 
 	payloadHash := hashWebhookBody(body)
 	if seen, err := h.services.WebhookReplay.Seen(payloadHash); err == nil && seen {
-		_ = h.auditSignatureFailure(c, body, "replay_detected", payload.EventID)
+		_ = h.auditSignatureFailure(c, body, "replay_detected", sender, payload.EventID)
 		c.JSON(http.StatusConflict, gin.H{"error": "replay_detected"})
 		return
 	}
@@ -92,10 +99,9 @@ func (h *OrderWebhookHandler) Receive(c *gin.Context) {
 		EventID:     payload.EventID,
 		EventType:   payload.EventType,
 		OrderID:     payload.Order.ID,
-		Status:      "processed",
+		Status:      "received",
 		PayloadHash: payloadHash,
 		ReceivedAt:  time.Now(),
-		ProcessedAt: timePtr(time.Now()),
 	}
 
 	if err := h.services.Webhook.Create(event); err != nil {
@@ -103,7 +109,9 @@ func (h *OrderWebhookHandler) Receive(c *gin.Context) {
 		return
 	}
 
-	if err := h.services.WebhookQueue.Enqueue(payload.EventID, string(body)); err != nil {
+	// The worker applies the event to the local order and moves it to
+	// processed or failed.
+	if err := h.services.WebhookQueue.EnqueueInbound(payload.EventID, sender, string(body)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "enqueue_failed"})
 		return
 	}
@@ -111,7 +119,14 @@ func (h *OrderWebhookHandler) Receive(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
 
-func (h *OrderWebhookHandler) auditSignatureFailure(c *gin.Context, body []byte, reason string, eventID ...string) error {
+func (h *OrderWebhookHandler) verify(r *http.Request, body []byte) (string, error) {
+	if verifier, ok := h.verifier.(SenderSignatureVerifier); ok {
+		return verifier.VerifySender(r, body)
+	}
+	return "", h.verifier.Verify(r, body)
+}
+
+func (h *OrderWebhookHandler) auditSignatureFailure(c *gin.Context, body []byte, reason, sender string, eventID ...string) error {
 	if h.services == nil || h.services.WebhookAudit == nil {
 		return nil
 	}
@@ -131,6 +146,7 @@ func (h *OrderWebhookHandler) auditSignatureFailure(c *gin.Context, body []byte,
 		Reason:          reason,
 		SignatureHeader: c.GetHeader(webhookSignatureHeader),
 		KeyID:           c.GetHeader(webhookKeyIDHeader),
+		Sender:          sender,
 		PayloadHash:     payloadHash,
 		CreatedAt:       time.Now(),
 	}
@@ -149,7 +165,3 @@ func hashWebhookBody(body []byte) string {
 	sum := sha256.Sum256(body)
 	return hex.EncodeToString(sum[:])
 }
-
-func timePtr(value time.Time) *time.Time {
-	return &value
-}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/meowucp/internal/domain"
@@ -111,11 +112,18 @@ func (f *fakeWebhookQueue) Create(job *domain.UCPWebhookJob) error {
 func (f *fakeWebhookQueue) ListDue(_ int) ([]*domain.UCPWebhookJob, error) {
 	return []*domain.UCPWebhookJob{}, nil
 }
+func (f *fakeWebhookQueue) ClaimDue(owner string, limit int, lease time.Duration) ([]*domain.UCPWebhookJob, error) {
+	return f.ListDue(limit)
+}
 
 func (f *fakeWebhookQueue) Update(_ *domain.UCPWebhookJob) error {
 	return nil
 }
 
+func (f *fakeWebhookQueue) Release(_ *domain.UCPWebhookJob) (bool, error) {
+	return true, nil
+}
+
 func (f *fakeWebhookQueue) List(_ int, _ int) ([]*domain.UCPWebhookJob, error) {
 	return []*domain.UCPWebhookJob{}, nil
 }
@@ -129,13 +137,18 @@ func (f *fakeWebhookQueue) FindByID(_ int64) (*domain.UCPWebhookJob, error) {
 }
 
 type fakeSignatureVerifier struct {
-	err error
+	err    error
+	sender string
 }
 
 func (f fakeSignatureVerifier) Verify(_ *http.Request, _ []byte) error {
 	return f.err
 }
 
+func (f fakeSignatureVerifier) VerifySender(_ *http.Request, _ []byte) (string, error) {
+	return f.sender, f.err
+}
+
 func (f *fakeWebhookRepo) Create(event *domain.UCPWebhookEvent) error {
 	f.items[event.EventID] = event
 	f.createCount++
@@ -166,6 +179,14 @@ func (f *fakeWebhookRepo) MarkProcessed(eventID string) error {
 	return errors.New("not found")
 }
 
+func (f *fakeWebhookRepo) MarkFailed(eventID string) error {
+	if event, ok := f.items[eventID]; ok {
+		event.Status = "failed"
+		return nil
+	}
+	return errors.New("not found")
+}
+
 func TestOrderWebhookIdempotent(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -243,7 +264,7 @@ func TestOrderWebhookRejectsInvalidSignature(t *testing.T) {
 		WebhookReplay: service.NewWebhookReplayService(replayStore),
 		WebhookQueue:  service.NewWebhookQueueService(queue),
 	}
-	handler := NewOrderWebhookHandlerWithVerifier(services, fakeSignatureVerifier{err: errors.New("bad sig")})
+	handler := NewOrderWebhookHandlerWithVerifier(services, fakeSignatureVerifier{err: errors.New("bad sig"), sender: "oauth:agent-a"})
 
 	r := gin.New()
 	r.POST("/ucp/v1/order-webhooks", handler.Receive)
@@ -283,6 +304,9 @@ func TestOrderWebhookRejectsInvalidSignature(t *testing.T) {
 	if auditRepo.items[0].EventID != "evt_1" {
 		t.Fatalf("expected event_id to be captured")
 	}
+	if auditRepo.items[0].Sender != "oauth:agent-a" {
+		t.Fatalf("expected failing sender to be audited, got %q", auditRepo.items[0].Sender)
+	}
 }
 
 func TestOrderWebhookRejectsReplay(t *testing.T) {
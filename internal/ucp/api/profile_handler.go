@@ -28,13 +28,19 @@ const (
 )
 
 type ProfileHandler struct {
-	services *service.Services
+	services    *service.Services
+	signingKeys SigningKeySource
 }
 
 func NewProfileHandler(services *service.Services) *ProfileHandler {
 	return &ProfileHandler{services: services}
 }
 
+// SetSigningKeys publishes the webhook signing keys as signing_keys.
+func (h *ProfileHandler) SetSigningKeys(keys SigningKeySource) {
+	h.signingKeys = keys
+}
+
 func (h *ProfileHandler) GetProfile(c *gin.Context) {
 	baseURL := resolveBaseURL(c)
 
@@ -75,6 +81,7 @@ func (h *ProfileHandler) GetProfile(c *gin.Context) {
 			profile.Payment.Handlers = mapHandlers(handlers)
 		}
 	}
+	profile.Keys = mapSigningKeys(h.signingKeys)
 
 	c.JSON(http.StatusOK, profile)
 }
@@ -97,7 +104,7 @@ func mapHandlers(handlers []*domain.PaymentHandler) []model.PaymentHandler {
 	result := make([]model.PaymentHandler, 0, len(handlers))
 	for _, handler := range handlers {
 		instrumentSchemas := []string{}
-		if handler.Name == nowPaymentsName {
+		if handler.Name == nowPaymentsName || handler.Name == service.SandboxProviderName {
 			instrumentSchemas = []string{cardInstrumentSchema}
 		}
 
@@ -123,6 +130,12 @@ func parseHandlerConfig(value string) any {
 
 	var decoded map[string]interface{}
 	if err := json.Unmarshal([]byte(value), &decoded); err == nil {
+		// Callback secrets live in the same config but are never published.
+		for key := range decoded {
+			if strings.Contains(strings.ToLower(key), "secret") {
+				delete(decoded, key)
+			}
+		}
 		return decoded
 	}
 
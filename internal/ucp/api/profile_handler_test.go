@@ -12,6 +12,7 @@ import (
 	"github.com/meowucp/internal/repository"
 	"github.com/meowucp/internal/service"
 	"github.com/meowucp/internal/ucp/model"
+	"github.com/meowucp/internal/ucp/security"
 )
 
 type fakePaymentHandlerRepo struct {
@@ -144,3 +145,41 @@ func TestProfileIncludesOrderCapability(t *testing.T) {
 		t.Fatalf("expected order capability")
 	}
 }
+
+type fakeSigningKeys struct{}
+
+func (fakeSigningKeys) PublicKeys() []security.JWK {
+	return []security.JWK{{KTY: "EC", CRV: "P-256", X: "x", Y: "y", KID: "key-1", Use: "sig", Alg: "ES256"}}
+}
+
+func TestProfileAndJWKSPublishSigningKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler := NewProfileHandler(&service.Services{})
+	handler.SetSigningKeys(fakeSigningKeys{})
+	jwks := NewJWKSHandler(fakeSigningKeys{})
+
+	r := gin.New()
+	r.GET("/.well-known/ucp", handler.GetProfile)
+	r.GET("/.well-known/jwks.json", jwks.Serve)
+
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/.well-known/ucp", nil))
+	var profile model.Profile
+	if err := json.Unmarshal(resp.Body.Bytes(), &profile); err != nil {
+		t.Fatalf("unmarshal profile: %v", err)
+	}
+	if len(profile.Keys) != 1 || profile.Keys[0].KID != "key-1" || profile.Keys[0].Alg != "ES256" {
+		t.Fatalf("expected signing_keys in profile, got %+v", profile.Keys)
+	}
+
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	var set security.JWKSet
+	if err := json.Unmarshal(resp.Body.Bytes(), &set); err != nil {
+		t.Fatalf("unmarshal jwks: %v", err)
+	}
+	if resp.Code != http.StatusOK || len(set.Keys) != 1 || set.Keys[0].KID != "key-1" {
+		t.Fatalf("expected jwks with the signing key, got %d %+v", resp.Code, set)
+	}
+}
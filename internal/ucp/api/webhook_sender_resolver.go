@@ -0,0 +1,93 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/meowucp/internal/domain"
+	"github.com/meowucp/internal/ucp/security"
+)
+
+// ucpAgentHeader advertises the sender's UCP profile, e.g.
+// UCP-Agent: profile="https://platform.example/.well-known/ucp".
+const ucpAgentHeader = "UCP-Agent"
+
+// OAuthClientLookup resolves a bearer token to the client it was issued to.
+type OAuthClientLookup interface {
+	ClientForToken(token string) (*domain.OAuthClient, error)
+}
+
+type webhookSenderResolver struct {
+	clients      OAuthClientLookup
+	trustedHosts map[string]bool
+}
+
+// NewWebhookSenderResolver attributes order webhooks to the OAuth client
+// behind the bearer token when it has a registered jwk_set_url, otherwise to
+// the profile in the UCP-Agent header. Profiles are only fetched from
+// trustedProfileHosts, so a sender cannot point us at keys it hosts itself.
+func NewWebhookSenderResolver(clients OAuthClientLookup, trustedProfileHosts []string) security.SenderResolver {
+	hosts := map[string]bool{}
+	for _, host := range trustedProfileHosts {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			hosts[host] = true
+		}
+	}
+	return &webhookSenderResolver{clients: clients, trustedHosts: hosts}
+}
+
+func (r *webhookSenderResolver) ResolveSender(req *http.Request) (*security.Sender, error) {
+	if token := bearerToken(req.Header.Get("Authorization")); token != "" {
+		if r.clients == nil {
+			return nil, errors.New("sender_token_unverifiable")
+		}
+		client, err := r.clients.ClientForToken(token)
+		if err != nil {
+			return nil, errors.New("invalid_sender_token")
+		}
+		if client.JWKSetURL != "" {
+			return &security.Sender{
+				ID:        "oauth:" + client.ClientID,
+				JWKSetURL: client.JWKSetURL,
+				CacheTTL:  time.Duration(client.JWKSCacheSeconds) * time.Second,
+			}, nil
+		}
+	}
+
+	profileURL := agentProfile(req.Header.Get(ucpAgentHeader))
+	if profileURL == "" {
+		return nil, nil
+	}
+	parsed, err := url.Parse(profileURL)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return nil, errors.New("invalid_sender_profile")
+	}
+	if !r.trustedHosts[strings.ToLower(parsed.Host)] && !r.trustedHosts[strings.ToLower(parsed.Hostname())] {
+		return nil, errors.New("untrusted_sender_profile")
+	}
+	return &security.Sender{ID: "profile:" + profileURL, ProfileURL: profileURL}, nil
+}
+
+func bearerToken(header string) string {
+	token := strings.TrimPrefix(header, "Bearer ")
+	if token == header {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// agentProfile reads the profile parameter of a UCP-Agent header.
+func agentProfile(header string) string {
+	for _, part := range strings.Split(header, ";") {
+		for _, item := range strings.Split(part, ",") {
+			key, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+			if ok && strings.TrimSpace(key) == "profile" {
+				return strings.Trim(strings.TrimSpace(value), `"`)
+			}
+		}
+	}
+	return ""
+}
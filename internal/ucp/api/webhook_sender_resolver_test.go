@@ -0,0 +1,62 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/meowucp/internal/domain"
+)
+
+type fakeOAuthClientLookup map[string]*domain.OAuthClient
+
+func (f fakeOAuthClientLookup) ClientForToken(token string) (*domain.OAuthClient, error) {
+	if client, ok := f[token]; ok {
+		return client, nil
+	}
+	return nil, errors.New("invalid_token")
+}
+
+func TestWebhookSenderResolver(t *testing.T) {
+	resolver := NewWebhookSenderResolver(fakeOAuthClientLookup{
+		"tok-a": {ClientID: "agent-a", JWKSetURL: "https://a.example/jwks.json", JWKSCacheSeconds: 60},
+		"tok-b": {ClientID: "agent-b"},
+	}, []string{"platform.example"})
+
+	req := httptest.NewRequest(http.MethodPost, "/ucp/v1/order-webhooks", nil)
+	req.Header.Set("Authorization", "Bearer tok-a")
+	sender, err := resolver.ResolveSender(req)
+	if err != nil || sender == nil {
+		t.Fatalf("expected oauth sender, got %v %v", sender, err)
+	}
+	if sender.ID != "oauth:agent-a" || sender.JWKSetURL != "https://a.example/jwks.json" || sender.CacheTTL != time.Minute {
+		t.Fatalf("unexpected oauth sender: %+v", sender)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/ucp/v1/order-webhooks", nil)
+	req.Header.Set("Authorization", "Bearer tok-b")
+	req.Header.Set(ucpAgentHeader, `profile="https://platform.example/.well-known/ucp"`)
+	sender, err = resolver.ResolveSender(req)
+	if err != nil || sender == nil || sender.ProfileURL != "https://platform.example/.well-known/ucp" {
+		t.Fatalf("expected client without jwks to fall back to its profile, got %+v %v", sender, err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/ucp/v1/order-webhooks", nil)
+	req.Header.Set(ucpAgentHeader, `profile="https://evil.example/.well-known/ucp"`)
+	if _, err := resolver.ResolveSender(req); err == nil {
+		t.Fatalf("expected untrusted profile host to be rejected")
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/ucp/v1/order-webhooks", nil)
+	req.Header.Set("Authorization", "Bearer unknown")
+	if _, err := resolver.ResolveSender(req); err == nil {
+		t.Fatalf("expected unknown bearer token to be rejected")
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/ucp/v1/order-webhooks", nil)
+	if sender, err := resolver.ResolveSender(req); err != nil || sender != nil {
+		t.Fatalf("expected anonymous request to use the default sender, got %+v %v", sender, err)
+	}
+}
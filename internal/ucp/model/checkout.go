@@ -1,15 +1,21 @@
 package model
 
 type CheckoutCreateRequest struct {
-	LineItems []LineItem `json:"line_items"`
-	Currency  string     `json:"currency"`
+	LineItems          []LineItem     `json:"line_items"`
+	Currency           string         `json:"currency"`
+	Buyer              *Buyer         `json:"buyer,omitempty"`
+	FulfillmentAddress *PostalAddress `json:"fulfillment_address,omitempty"`
+	Discounts          *Discounts     `json:"discounts,omitempty"`
 }
 
 type CheckoutUpdateRequest struct {
-	ID             string     `json:"id"`
-	LineItems      []LineItem `json:"line_items"`
-	Currency       string     `json:"currency"`
-	RequiresSignIn bool       `json:"requires_sign_in"`
+	ID                 string         `json:"id"`
+	LineItems          []LineItem     `json:"line_items"`
+	Currency           string         `json:"currency"`
+	RequiresSignIn     bool           `json:"requires_sign_in"`
+	Buyer              *Buyer         `json:"buyer,omitempty"`
+	FulfillmentAddress *PostalAddress `json:"fulfillment_address,omitempty"`
+	Discounts          *Discounts     `json:"discounts,omitempty"`
 }
 
 type CheckoutCompleteRequest struct {
@@ -17,17 +23,42 @@ type CheckoutCompleteRequest struct {
 }
 
 type CheckoutSession struct {
-	UCP         *UCPMeta   `json:"ucp,omitempty"`
-	ID          string     `json:"id"`
-	LineItems   []LineItem `json:"line_items"`
-	Status      string     `json:"status"`
-	Currency    string     `json:"currency"`
-	Totals      []Total    `json:"totals"`
-	Messages    []Message  `json:"messages,omitempty"`
-	Links       []Link     `json:"links"`
-	ContinueURL string     `json:"continue_url,omitempty"`
-	Payment     Payment    `json:"payment"`
-	Order       *OrderRef  `json:"order,omitempty"`
+	UCP                *UCPMeta       `json:"ucp,omitempty"`
+	ID                 string         `json:"id"`
+	LineItems          []LineItem     `json:"line_items"`
+	Status             string         `json:"status"`
+	Currency           string         `json:"currency"`
+	Buyer              *Buyer         `json:"buyer,omitempty"`
+	FulfillmentAddress *PostalAddress `json:"fulfillment_address,omitempty"`
+	Discounts          *Discounts     `json:"discounts,omitempty"`
+	Totals             []Total        `json:"totals"`
+	Messages           []Message      `json:"messages,omitempty"`
+	Links              []Link         `json:"links"`
+	ContinueURL        string         `json:"continue_url,omitempty"`
+	Payment            Payment        `json:"payment"`
+	Order              *OrderRef      `json:"order,omitempty"`
+}
+
+type Buyer struct {
+	FirstName   string         `json:"first_name,omitempty"`
+	LastName    string         `json:"last_name,omitempty"`
+	Email       string         `json:"email,omitempty"`
+	PhoneNumber string         `json:"phone_number,omitempty"`
+	Address     *PostalAddress `json:"address,omitempty"`
+}
+
+type PostalAddress struct {
+	StreetAddress   string `json:"street_address,omitempty"`
+	ExtendedAddress string `json:"extended_address,omitempty"`
+	AddressLocality string `json:"address_locality,omitempty"`
+	AddressRegion   string `json:"address_region,omitempty"`
+	AddressCountry  string `json:"address_country,omitempty"`
+	PostalCode      string `json:"postal_code,omitempty"`
+}
+
+type Discounts struct {
+	Codes   []string `json:"codes,omitempty"`
+	Applied []string `json:"applied,omitempty"`
 }
 
 type UCPMeta struct {
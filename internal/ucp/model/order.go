@@ -1,13 +1,48 @@
 package model
 
+// OrderWebhookVersion identifies the OrderWebhookEvent schema. Bump it when a
+// field changes meaning or is removed; adding fields keeps the version.
+const OrderWebhookVersion = "1"
+
+// OrderWebhookEvent is the one payload we send for every order lifecycle
+// event. It carries a full order snapshot so receivers can reconcile without
+// calling back. EventID is stable per order and event type, so a retried or
+// re-sent delivery keeps the same ID.
 type OrderWebhookEvent struct {
+	Version   string            `json:"version,omitempty"`
 	EventID   string            `json:"event_id"`
 	EventType string            `json:"event_type"`
 	Timestamp string            `json:"timestamp"`
 	Order     OrderWebhookOrder `json:"order"`
 }
 
+// OrderWebhookOrder amounts are integer minor units of Currency.
 type OrderWebhookOrder struct {
-	ID     string `json:"id"`
-	Status string `json:"status"`
+	ID                string                   `json:"id"`
+	OrderNo           string                   `json:"order_no,omitempty"`
+	Status            string                   `json:"status"`
+	PaymentStatus     string                   `json:"payment_status,omitempty"`
+	CheckoutSessionID string                   `json:"checkout_session_id,omitempty"`
+	Currency          string                   `json:"currency,omitempty"`
+	LineItems         []OrderWebhookLineItem   `json:"line_items,omitempty"`
+	Totals            []Total                  `json:"totals,omitempty"`
+	Fulfillment       *OrderWebhookFulfillment `json:"fulfillment,omitempty"`
+	CreatedAt         string                   `json:"created_at,omitempty"`
+	UpdatedAt         string                   `json:"updated_at,omitempty"`
+}
+
+type OrderWebhookLineItem struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Quantity  int    `json:"quantity"`
+	UnitPrice int64  `json:"unit_price"`
+	Total     int64  `json:"total"`
+}
+
+type OrderWebhookFulfillment struct {
+	Status         string `json:"status"`
+	Carrier        string `json:"carrier,omitempty"`
+	TrackingNumber string `json:"tracking_number,omitempty"`
+	ShippedAt      string `json:"shipped_at,omitempty"`
+	DeliveredAt    string `json:"delivered_at,omitempty"`
 }
@@ -2,9 +2,13 @@ package security
 
 import (
 	"context"
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
+	"crypto/rsa"
 	"crypto/sha256"
+	_ "crypto/sha512"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
@@ -23,15 +27,58 @@ const (
 	keyIDHeader     = "UCP-Key-Id"
 )
 
+// SignatureHeader and KeyIDHeader carry a webhook's signature and signing key.
+const (
+	SignatureHeader = signatureHeader
+	KeyIDHeader     = keyIDHeader
+)
+
+// minJWKRefreshInterval bounds how often an unknown kid may force a JWKS
+// refetch before the cache expires.
+const minJWKRefreshInterval = 30 * time.Second
+
+// jwkFetchTimeout bounds a JWKS or profile fetch, so a slow sender cannot
+// hold up verification for long.
+const jwkFetchTimeout = 5 * time.Second
+
+// JWKVerifier checks inbound webhook signatures against the sender's keys.
+// With a SenderResolver each sender gets its own key cache; requests it does
+// not attribute fall back to the configured jwkSetURL.
 type JWKVerifier struct {
-	jwkSetURL  string
-	clockSkew  time.Duration
-	cacheTTL   time.Duration
-	mu         sync.RWMutex
-	keys       map[string]*ecdsa.PublicKey
-	fetchedAt  time.Time
-	skipVerify bool
-	nonceStore NonceStore
+	jwkSetURL       string
+	clockSkew       time.Duration
+	cacheTTL        time.Duration
+	refreshInterval time.Duration
+	mu              sync.Mutex
+	caches          map[string]*keyCache
+	skipVerify      bool
+	nonceStore      NonceStore
+	senders         SenderResolver
+	client          *http.Client
+}
+
+// keyCache holds one sender's parsed keys. An unknown kid forces a refetch,
+// but at most once per refreshInterval so unknown kids cannot hammer the
+// sender's JWKS endpoint. A failed fetch is cached the same way, keeping the
+// previous keys. Only one fetch runs at a time and the lock is not held
+// while it does; other callers wait for its result.
+type keyCache struct {
+	source      string
+	profile     bool
+	ttl         time.Duration
+	mu          sync.Mutex
+	keys        map[string]verificationKey
+	fetchedAt   time.Time
+	refreshedAt time.Time
+	fetchErr    error
+	fetching    chan struct{}
+}
+
+// verificationKey is a parsed JWKS entry pinned to the algorithm its JWK
+// declares, so a signature is only ever checked the way the key allows.
+type verificationKey struct {
+	alg string
+	key crypto.PublicKey
 }
 
 type JWKSet struct {
@@ -40,20 +87,24 @@ type JWKSet struct {
 
 type JWK struct {
 	KTY string `json:"kty"`
-	CRV string `json:"crv"`
-	X   string `json:"x"`
-	Y   string `json:"y"`
+	CRV string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
 	KID string `json:"kid"`
 	Use string `json:"use"`
 	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
 }
 
 func NewJWKVerifier(jwkSetURL string, clockSkewSeconds int) *JWKVerifier {
 	return &JWKVerifier{
-		jwkSetURL: jwkSetURL,
-		clockSkew: time.Duration(clockSkewSeconds) * time.Second,
-		cacheTTL:  10 * time.Minute,
-		keys:      map[string]*ecdsa.PublicKey{},
+		jwkSetURL:       jwkSetURL,
+		clockSkew:       time.Duration(clockSkewSeconds) * time.Second,
+		cacheTTL:        10 * time.Minute,
+		refreshInterval: minJWKRefreshInterval,
+		caches:          map[string]*keyCache{},
+		client:          &http.Client{Timeout: jwkFetchTimeout},
 	}
 }
 
@@ -70,14 +121,47 @@ func (v *JWKVerifier) SetNonceStore(store NonceStore) {
 	v.nonceStore = store
 }
 
+// SetSenderResolver lets Verify pick the key source per request.
+func (v *JWKVerifier) SetSenderResolver(resolver SenderResolver) {
+	v.senders = resolver
+}
+
 func (v *JWKVerifier) Verify(r *http.Request, body []byte) error {
+	_, err := v.VerifySender(r, body)
+	return err
+}
+
+// VerifySender verifies the request like Verify and also returns the ID of the
+// sender whose keys were used, so failures can be attributed. The ID is empty
+// when the sender could not be resolved.
+func (v *JWKVerifier) VerifySender(r *http.Request, body []byte) (string, error) {
 	if v.skipVerify {
-		return nil
+		return "", nil
+	}
+	sender, err := v.resolveSender(r)
+	if err != nil {
+		return "", err
+	}
+	return sender.ID, v.verify(r, body, sender)
+}
+
+func (v *JWKVerifier) resolveSender(r *http.Request) (*Sender, error) {
+	if v.senders != nil {
+		sender, err := v.senders.ResolveSender(r)
+		if err != nil {
+			return nil, err
+		}
+		if sender != nil {
+			return sender, nil
+		}
 	}
 	if strings.TrimSpace(v.jwkSetURL) == "" {
-		return errors.New("jwk_set_url_not_configured")
+		return nil, errors.New("jwk_set_url_not_configured")
 	}
+	return &Sender{ID: DefaultSenderID, JWKSetURL: v.jwkSetURL}, nil
+}
 
+func (v *JWKVerifier) verify(r *http.Request, body []byte, sender *Sender) error {
 	stamp, signature, err := parseSignatureHeader(r.Header.Get(signatureHeader))
 	if err != nil {
 		return err
@@ -94,14 +178,13 @@ func (v *JWKVerifier) Verify(r *http.Request, body []byte) error {
 		return errors.New("missing_key_id")
 	}
 
-	pubKey, err := v.getKey(r.Context(), kid)
+	key, err := v.cacheFor(sender).getKey(r.Context(), v.client, kid, v.refreshInterval)
 	if err != nil {
 		return err
 	}
 
 	msg := []byte(fmt.Sprintf("%d.%s", stamp.Unix(), string(body)))
-	hash := sha256.Sum256(msg)
-	if !ecdsa.VerifyASN1(pubKey, hash[:], signature) {
+	if !verifySignature(key, msg, signature) {
 		return errors.New("invalid_signature")
 	}
 
@@ -121,49 +204,103 @@ func (v *JWKVerifier) Verify(r *http.Request, body []byte) error {
 	return nil
 }
 
-func (v *JWKVerifier) getKey(ctx context.Context, kid string) (*ecdsa.PublicKey, error) {
-	v.mu.RLock()
-	if key, ok := v.keys[kid]; ok && !v.isExpired() {
-		v.mu.RUnlock()
-		return key, nil
+// cacheFor returns the sender's key cache, starting a fresh one when the
+// sender is new or its key source or TTL changed.
+func (v *JWKVerifier) cacheFor(sender *Sender) *keyCache {
+	source, profile := sender.JWKSetURL, false
+	if source == "" {
+		source, profile = sender.ProfileURL, true
+	}
+	ttl := sender.CacheTTL
+	if ttl <= 0 {
+		ttl = v.cacheTTL
 	}
-	v.mu.RUnlock()
 
 	v.mu.Lock()
 	defer v.mu.Unlock()
-	if key, ok := v.keys[kid]; ok && !v.isExpired() {
-		return key, nil
+	cache, ok := v.caches[sender.ID]
+	if !ok || cache.source != source || cache.profile != profile || cache.ttl != ttl {
+		cache = &keyCache{source: source, profile: profile, ttl: ttl, keys: map[string]verificationKey{}}
+		v.caches[sender.ID] = cache
 	}
+	return cache
+}
 
-	keys, err := fetchJWKKeys(ctx, v.jwkSetURL)
-	if err != nil {
-		return nil, err
-	}
-	if len(keys) == 0 {
-		return nil, errors.New("no_keys_available")
-	}
-	v.keys = keys
-	v.fetchedAt = time.Now()
-	key, ok := v.keys[kid]
-	if !ok {
-		return nil, errors.New("key_not_found")
+func (c *keyCache) getKey(ctx context.Context, client *http.Client, kid string, refreshInterval time.Duration) (verificationKey, error) {
+	for {
+		c.mu.Lock()
+		if key, ok := c.keys[kid]; ok && !c.isExpired() {
+			c.mu.Unlock()
+			return key, nil
+		}
+		if !c.isExpired() && time.Since(c.refreshedAt) < refreshInterval {
+			err := c.fetchErr
+			c.mu.Unlock()
+			if err == nil {
+				err = errors.New("key_not_found")
+			}
+			return verificationKey{}, err
+		}
+		if strings.TrimSpace(c.source) == "" {
+			c.mu.Unlock()
+			return verificationKey{}, errors.New("jwk_set_url_not_configured")
+		}
+		if wait := c.fetching; wait != nil {
+			c.mu.Unlock()
+			select {
+			case <-wait:
+				continue
+			case <-ctx.Done():
+				return verificationKey{}, ctx.Err()
+			}
+		}
+		done := make(chan struct{})
+		c.fetching = done
+		c.refreshedAt = time.Now()
+		c.mu.Unlock()
+
+		// The fetch serves every waiting caller, so it is bounded by the
+		// client timeout rather than this caller's request.
+		keys, err := fetchJWKKeys(context.WithoutCancel(ctx), client, c.source, c.profile)
+		if err == nil && len(keys) == 0 {
+			err = errors.New("no_keys_available")
+		}
+
+		c.mu.Lock()
+		c.fetchedAt = time.Now()
+		c.fetchErr = err
+		if err == nil {
+			c.keys = keys
+		}
+		key, ok := c.keys[kid]
+		c.fetching = nil
+		close(done)
+		c.mu.Unlock()
+		switch {
+		case ok:
+			return key, nil
+		case err != nil:
+			return verificationKey{}, err
+		}
+		return verificationKey{}, errors.New("key_not_found")
 	}
-	return key, nil
 }
 
-func (v *JWKVerifier) isExpired() bool {
-	if v.fetchedAt.IsZero() {
+func (c *keyCache) isExpired() bool {
+	if c.fetchedAt.IsZero() {
 		return true
 	}
-	return time.Since(v.fetchedAt) > v.cacheTTL
+	return time.Since(c.fetchedAt) > c.ttl
 }
 
-func fetchJWKKeys(ctx context.Context, url string) (map[string]*ecdsa.PublicKey, error) {
+// fetchJWKKeys reads a JWKS document, or with profile set a UCP profile whose
+// signing_keys carry the same JWK entries.
+func fetchJWKKeys(ctx context.Context, client *http.Client, url string, profile bool) (map[string]verificationKey, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -173,27 +310,110 @@ func fetchJWKKeys(ctx context.Context, url string) (map[string]*ecdsa.PublicKey,
 		return nil, fmt.Errorf("jwk_fetch_failed: %d", resp.StatusCode)
 	}
 
-	var set JWKSet
+	var set struct {
+		Keys        []JWK `json:"keys"`
+		SigningKeys []JWK `json:"signing_keys"`
+	}
 	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
 		return nil, err
 	}
+	entries := set.Keys
+	if profile {
+		entries = set.SigningKeys
+	}
 
-	keys := map[string]*ecdsa.PublicKey{}
-	for _, jwk := range set.Keys {
-		pubKey, err := parseECDSAKey(jwk)
+	keys := map[string]verificationKey{}
+	for _, jwk := range entries {
+		key, err := parseJWK(jwk)
 		if err != nil {
 			continue
 		}
 		if jwk.KID != "" {
-			keys[jwk.KID] = pubKey
+			keys[jwk.KID] = key
 		}
 	}
 
 	return keys, nil
 }
 
+// PublicKeyFromJWK returns the public key of a signing JWK and the algorithm
+// it verifies, under the same rules as webhook verification keys.
+func PublicKeyFromJWK(jwk JWK) (crypto.PublicKey, string, error) {
+	parsed, err := parseJWK(jwk)
+	if err != nil {
+		return nil, "", err
+	}
+	return parsed.key, parsed.alg, nil
+}
+
+// parseJWK accepts signing keys only. The algorithm comes from the JWK alg;
+// EC and OKP keys without one fall back to the algorithm their curve implies,
+// RSA keys must name theirs since RS256 and PS256 share a key shape.
+func parseJWK(jwk JWK) (verificationKey, error) {
+	if jwk.Use != "sig" {
+		return verificationKey{}, errors.New("unsupported_key_use")
+	}
+	switch jwk.KTY {
+	case "EC":
+		key, err := parseECDSAKey(jwk)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		alg := ecdsaAlgorithm(jwk.CRV)
+		if jwk.Alg != "" && jwk.Alg != alg {
+			return verificationKey{}, errors.New("unsupported_algorithm")
+		}
+		return verificationKey{alg: alg, key: key}, nil
+	case "OKP":
+		if jwk.CRV != "Ed25519" || (jwk.Alg != "" && jwk.Alg != "EdDSA") {
+			return verificationKey{}, errors.New("unsupported_key_type")
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return verificationKey{}, errors.New("invalid_key")
+		}
+		return verificationKey{alg: "EdDSA", key: ed25519.PublicKey(x)}, nil
+	case "RSA":
+		if jwk.Alg != "RS256" && jwk.Alg != "PS256" {
+			return verificationKey{}, errors.New("unsupported_algorithm")
+		}
+		key, err := parseRSAKey(jwk)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		return verificationKey{alg: jwk.Alg, key: key}, nil
+	}
+	return verificationKey{}, errors.New("unsupported_key_type")
+}
+
+func ecdsaCurve(crv string) elliptic.Curve {
+	switch crv {
+	case "P-256":
+		return elliptic.P256()
+	case "P-384":
+		return elliptic.P384()
+	case "P-521":
+		return elliptic.P521()
+	}
+	return nil
+}
+
+func ecdsaAlgorithm(crv string) string {
+	switch crv {
+	case "P-384":
+		return "ES384"
+	case "P-521":
+		return "ES512"
+	}
+	return "ES256"
+}
+
 func parseECDSAKey(jwk JWK) (*ecdsa.PublicKey, error) {
-	if jwk.KTY != "EC" || jwk.CRV != "P-256" {
+	curve := ecdsaCurve(jwk.CRV)
+	if jwk.KTY != "EC" || curve == nil {
 		return nil, errors.New("unsupported_key_type")
 	}
 
@@ -207,14 +427,72 @@ func parseECDSAKey(jwk JWK) (*ecdsa.PublicKey, error) {
 	}
 
 	key := &ecdsa.PublicKey{
-		Curve: elliptic.P256(),
+		Curve: curve,
 		X:     new(big.Int).SetBytes(xBytes),
 		Y:     new(big.Int).SetBytes(yBytes),
 	}
+	if !curve.IsOnCurve(key.X, key.Y) {
+		return nil, errors.New("invalid_key")
+	}
 
 	return key, nil
 }
 
+func parseRSAKey(jwk JWK) (*rsa.PublicKey, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, err
+	}
+	eBytes, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, err
+	}
+	e := new(big.Int).SetBytes(eBytes)
+	if len(nBytes) < 256 || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid_key")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(nBytes), E: int(e.Int64())}, nil
+}
+
+// verifySignature checks signature over msg with the key's pinned algorithm.
+// ECDSA signatures are ASN.1 DER encoded, matching WebhookSigner.
+func verifySignature(key verificationKey, msg, signature []byte) bool {
+	switch key.alg {
+	case "ES256", "ES384", "ES512":
+		pub, ok := key.key.(*ecdsa.PublicKey)
+		if !ok {
+			return false
+		}
+		return ecdsa.VerifyASN1(pub, digest(ecdsaHash(key.alg), msg), signature)
+	case "EdDSA":
+		pub, ok := key.key.(ed25519.PublicKey)
+		return ok && ed25519.Verify(pub, msg, signature)
+	case "RS256":
+		pub, ok := key.key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest(crypto.SHA256, msg), signature) == nil
+	case "PS256":
+		pub, ok := key.key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPSS(pub, crypto.SHA256, digest(crypto.SHA256, msg), signature, nil) == nil
+	}
+	return false
+}
+
+func ecdsaHash(alg string) crypto.Hash {
+	switch alg {
+	case "ES384":
+		return crypto.SHA384
+	case "ES512":
+		return crypto.SHA512
+	}
+	return crypto.SHA256
+}
+
+func digest(hash crypto.Hash, msg []byte) []byte {
+	h := hash.New()
+	h.Write(msg)
+	return h.Sum(nil)
+}
+
 func parseSignatureHeader(header string) (time.Time, []byte, error) {
 	parts := strings.Split(header, ",")
 	var ts string
@@ -1,16 +1,22 @@
 package security
 
 import (
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -139,3 +145,315 @@ func TestJWKVerifierRejectsReplayNonce(t *testing.T) {
 		t.Fatalf("expected replay detection error")
 	}
 }
+
+func serveJWKSet(t *testing.T, set JWKSet, fetches *int32) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if fetches != nil {
+			atomic.AddInt32(fetches, 1)
+		}
+		_ = json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func signedRequest(keyID string, body []byte, sign func(msg []byte) []byte) *http.Request {
+	timestamp := time.Now().Unix()
+	signature := sign([]byte(fmt.Sprintf("%d.%s", timestamp, string(body))))
+	req := httptest.NewRequest(http.MethodPost, "/ucp/v1/order-webhooks", nil)
+	req.Header.Set(signatureHeader, fmt.Sprintf("t=%d,v1=%s", timestamp, base64.RawURLEncoding.EncodeToString(signature)))
+	req.Header.Set(keyIDHeader, keyID)
+	return req
+}
+
+func TestJWKVerifierSupportedAlgorithms(t *testing.T) {
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ed25519: %v", err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa: %v", err)
+	}
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate p384: %v", err)
+	}
+	p521, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate p521: %v", err)
+	}
+	rsaJWK := func(kid, alg string) JWK {
+		return JWK{
+			KTY: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+			KID: kid,
+			Use: "sig",
+			Alg: alg,
+		}
+	}
+	ecJWK := func(key *ecdsa.PrivateKey, crv, kid, alg string) JWK {
+		return JWK{
+			KTY: "EC",
+			CRV: crv,
+			X:   base64.RawURLEncoding.EncodeToString(key.PublicKey.X.Bytes()),
+			Y:   base64.RawURLEncoding.EncodeToString(key.PublicKey.Y.Bytes()),
+			KID: kid,
+			Use: "sig",
+			Alg: alg,
+		}
+	}
+
+	set := JWKSet{Keys: []JWK{
+		{KTY: "OKP", CRV: "Ed25519", X: base64.RawURLEncoding.EncodeToString(edPublic), KID: "ed", Use: "sig", Alg: "EdDSA"},
+		rsaJWK("ps", "PS256"),
+		rsaJWK("rs", "RS256"),
+		ecJWK(p384, "P-384", "p384", "ES384"),
+		ecJWK(p521, "P-521", "p521", "ES512"),
+	}}
+	verifier := NewJWKVerifier(serveJWKSet(t, set, nil).URL, 300)
+
+	cases := []struct {
+		kid  string
+		sign func(msg []byte) []byte
+	}{
+		{"ed", func(msg []byte) []byte { return ed25519.Sign(edPrivate, msg) }},
+		{"ps", func(msg []byte) []byte {
+			hash := sha256.Sum256(msg)
+			sig, _ := rsa.SignPSS(rand.Reader, rsaKey, crypto.SHA256, hash[:], nil)
+			return sig
+		}},
+		{"rs", func(msg []byte) []byte {
+			hash := sha256.Sum256(msg)
+			sig, _ := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, hash[:])
+			return sig
+		}},
+		{"p384", func(msg []byte) []byte {
+			hash := sha512.Sum384(msg)
+			sig, _ := ecdsa.SignASN1(rand.Reader, p384, hash[:])
+			return sig
+		}},
+		{"p521", func(msg []byte) []byte {
+			hash := sha512.Sum512(msg)
+			sig, _ := ecdsa.SignASN1(rand.Reader, p521, hash[:])
+			return sig
+		}},
+	}
+	body := []byte(`{"event_id":"evt_1"}`)
+	for _, tc := range cases {
+		if err := verifier.Verify(signedRequest(tc.kid, body, tc.sign), body); err != nil {
+			t.Fatalf("%s: expected verification success, got %v", tc.kid, err)
+		}
+	}
+
+	// A PKCS#1 v1.5 signature must not pass for a key pinned to PS256.
+	req := signedRequest("ps", body, cases[2].sign)
+	if err := verifier.Verify(req, body); err == nil || err.Error() != "invalid_signature" {
+		t.Fatalf("expected invalid_signature for RS256 signature on PS256 key, got %v", err)
+	}
+}
+
+func TestJWKVerifierRejectsNonSigningKeys(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	x := base64.RawURLEncoding.EncodeToString(privateKey.PublicKey.X.Bytes())
+	y := base64.RawURLEncoding.EncodeToString(privateKey.PublicKey.Y.Bytes())
+	set := JWKSet{Keys: []JWK{
+		{KTY: "EC", CRV: "P-256", X: x, Y: y, KID: "enc", Use: "enc", Alg: "ES256"},
+		{KTY: "EC", CRV: "P-256", X: x, Y: y, KID: "mismatch", Use: "sig", Alg: "ES384"},
+		{KTY: "EC", CRV: "P-256", X: x, Y: y, KID: "sig", Use: "sig", Alg: "ES256"},
+	}}
+	verifier := NewJWKVerifier(serveJWKSet(t, set, nil).URL, 300)
+
+	body := []byte(`{"event_id":"evt_1"}`)
+	sign := func(msg []byte) []byte {
+		hash := sha256.Sum256(msg)
+		sig, _ := ecdsa.SignASN1(rand.Reader, privateKey, hash[:])
+		return sig
+	}
+	for _, kid := range []string{"enc", "mismatch"} {
+		if err := verifier.Verify(signedRequest(kid, body, sign), body); err == nil || err.Error() != "key_not_found" {
+			t.Fatalf("%s: expected key_not_found, got %v", kid, err)
+		}
+	}
+	if err := verifier.Verify(signedRequest("sig", body, sign), body); err != nil {
+		t.Fatalf("expected signing key to verify, got %v", err)
+	}
+}
+
+func TestJWKVerifierUnknownKidRefreshIsRateLimited(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	set := JWKSet{Keys: []JWK{{
+		KTY: "EC",
+		CRV: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(privateKey.PublicKey.X.Bytes()),
+		Y:   base64.RawURLEncoding.EncodeToString(privateKey.PublicKey.Y.Bytes()),
+		KID: "known",
+		Use: "sig",
+		Alg: "ES256",
+	}}}
+	var fetches int32
+	verifier := NewJWKVerifier(serveJWKSet(t, set, &fetches).URL, 300)
+
+	body := []byte(`{"event_id":"evt_1"}`)
+	sign := func(msg []byte) []byte {
+		hash := sha256.Sum256(msg)
+		sig, _ := ecdsa.SignASN1(rand.Reader, privateKey, hash[:])
+		return sig
+	}
+	if err := verifier.Verify(signedRequest("known", body, sign), body); err != nil {
+		t.Fatalf("expected verification success, got %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := verifier.Verify(signedRequest(fmt.Sprintf("unknown-%d", i), body, sign), body); err == nil {
+			t.Fatalf("expected unknown kid to fail")
+		}
+	}
+	if got := atomic.LoadInt32(&fetches); got != 1 {
+		t.Fatalf("expected unknown kids within the refresh interval to reuse the cache, got %d fetches", got)
+	}
+
+	cache := verifier.cacheFor(&Sender{ID: DefaultSenderID, JWKSetURL: verifier.jwkSetURL})
+	cache.refreshedAt = time.Now().Add(-minJWKRefreshInterval)
+	if err := verifier.Verify(signedRequest("unknown-5", body, sign), body); err == nil {
+		t.Fatalf("expected unknown kid to fail")
+	}
+	if got := atomic.LoadInt32(&fetches); got != 2 {
+		t.Fatalf("expected an unknown kid to force one refresh after the interval, got %d fetches", got)
+	}
+}
+
+func TestJWKVerifierCachesFailedFetches(t *testing.T) {
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	verifier := NewJWKVerifier(server.URL, 300)
+	body := []byte(`{"event_id":"evt_1"}`)
+	sign := func([]byte) []byte { return []byte("sig") }
+	for i := 0; i < 3; i++ {
+		if err := verifier.Verify(signedRequest("kid", body, sign), body); err == nil {
+			t.Fatalf("expected verification to fail while the JWKS is unavailable")
+		}
+	}
+	if got := atomic.LoadInt32(&fetches); got != 1 {
+		t.Fatalf("expected the failed fetch to be cached, got %d fetches", got)
+	}
+}
+
+func TestJWKVerifierSharesOneFetchAndTimesOut(t *testing.T) {
+	var fetches int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	verifier := NewJWKVerifier(server.URL, 300)
+	verifier.client = &http.Client{Timeout: 100 * time.Millisecond}
+	body := []byte(`{"event_id":"evt_1"}`)
+	sign := func([]byte) []byte { return []byte("sig") }
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = verifier.Verify(signedRequest("kid", body, sign), body)
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected the fetch to time out")
+	}
+	if got := atomic.LoadInt32(&fetches); got != 1 {
+		t.Fatalf("expected concurrent verifications to share one fetch, got %d", got)
+	}
+}
+
+type headerSenderResolver map[string]*Sender
+
+func (f headerSenderResolver) ResolveSender(r *http.Request) (*Sender, error) {
+	return f[r.Header.Get("X-Sender")], nil
+}
+
+func TestJWKVerifierUsesPerSenderKeys(t *testing.T) {
+	keyA, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	keyB, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	jwkFor := func(key *ecdsa.PrivateKey) JWK {
+		return JWK{
+			KTY: "EC",
+			CRV: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(key.PublicKey.X.Bytes()),
+			Y:   base64.RawURLEncoding.EncodeToString(key.PublicKey.Y.Bytes()),
+			KID: "shared-kid",
+			Use: "sig",
+			Alg: "ES256",
+		}
+	}
+	jwksA := serveJWKSet(t, JWKSet{Keys: []JWK{jwkFor(keyA)}}, nil)
+	profileB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"signing_keys": []JWK{jwkFor(keyB)}})
+	}))
+	defer profileB.Close()
+
+	verifier := NewJWKVerifier("", 300)
+	verifier.SetSenderResolver(headerSenderResolver{
+		"a": {ID: "oauth:a", JWKSetURL: jwksA.URL, CacheTTL: time.Minute},
+		"b": {ID: "profile:b", ProfileURL: profileB.URL},
+	})
+	signer := func(key *ecdsa.PrivateKey) func(msg []byte) []byte {
+		return func(msg []byte) []byte {
+			hash := sha256.Sum256(msg)
+			sig, _ := ecdsa.SignASN1(rand.Reader, key, hash[:])
+			return sig
+		}
+	}
+
+	body := []byte(`{"event_id":"evt_1"}`)
+	reqA := signedRequest("shared-kid", body, signer(keyA))
+	reqA.Header.Set("X-Sender", "a")
+	if sender, err := verifier.VerifySender(reqA, body); err != nil || sender != "oauth:a" {
+		t.Fatalf("expected sender a to verify, got %q %v", sender, err)
+	}
+	reqB := signedRequest("shared-kid", body, signer(keyB))
+	reqB.Header.Set("X-Sender", "b")
+	if sender, err := verifier.VerifySender(reqB, body); err != nil || sender != "profile:b" {
+		t.Fatalf("expected sender b to verify from its profile, got %q %v", sender, err)
+	}
+
+	forged := signedRequest("shared-kid", body, signer(keyB))
+	forged.Header.Set("X-Sender", "a")
+	if sender, err := verifier.VerifySender(forged, body); err == nil || sender != "oauth:a" {
+		t.Fatalf("expected b's key to fail for sender a, got %q %v", sender, err)
+	}
+
+	anonymous := signedRequest("shared-kid", body, signer(keyA))
+	if _, err := verifier.VerifySender(anonymous, body); err == nil || err.Error() != "jwk_set_url_not_configured" {
+		t.Fatalf("expected unattributed request without a default jwks to fail, got %v", err)
+	}
+}
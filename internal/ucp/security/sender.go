@@ -0,0 +1,27 @@
+package security
+
+import (
+	"net/http"
+	"time"
+)
+
+// DefaultSenderID names the sender verified against the configured
+// jwk_set_url when no SenderResolver claims the request.
+const DefaultSenderID = "default"
+
+// Sender identifies who signed an inbound webhook and where its keys live:
+// a JWKS document, or a UCP profile (/.well-known/ucp) whose signing_keys
+// are used. A zero CacheTTL uses the verifier's default.
+type Sender struct {
+	ID         string
+	JWKSetURL  string
+	ProfileURL string
+	CacheTTL   time.Duration
+}
+
+// SenderResolver attributes a request to a sender. It returns nil, nil when
+// the request carries nothing to resolve, and an error when it names a sender
+// that cannot be trusted.
+type SenderResolver interface {
+	ResolveSender(r *http.Request) (*Sender, error)
+}
@@ -0,0 +1,202 @@
+package security
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// DefaultSigningKeyFile is used when no signing key file is configured.
+const DefaultSigningKeyFile = "data/ucp_webhook_signing_key.pem"
+
+// WebhookSigner signs outbound webhook bodies with the scheme JWKVerifier
+// checks: UCP-Signature "t=<unix>,v1=<base64url ASN.1 ES256 over "t.body">"
+// and UCP-Key-Id naming the key in our published JWKS.
+type WebhookSigner struct {
+	key *ecdsa.PrivateKey
+	kid string
+}
+
+// NewWebhookSigner wraps a P-256 key. An empty kid defaults to the key's
+// RFC 7638 thumbprint.
+func NewWebhookSigner(key *ecdsa.PrivateKey, kid string) (*WebhookSigner, error) {
+	if key == nil || key.Curve != elliptic.P256() {
+		return nil, errors.New("signing_key_must_be_p256")
+	}
+	if kid == "" {
+		kid = JWKThumbprint(PublicJWK(&key.PublicKey, ""))
+	}
+	return &WebhookSigner{key: key, kid: kid}, nil
+}
+
+// LoadWebhookSigner builds the signer from the configured key file, falling
+// back to DefaultSigningKeyFile. A missing file is created.
+func LoadWebhookSigner(path, kid string) (*WebhookSigner, error) {
+	if path == "" {
+		path = DefaultSigningKeyFile
+	}
+	key, err := LoadOrCreateSigningKey(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewWebhookSigner(key, kid)
+}
+
+// OpenWebhookSigner is LoadWebhookSigner for processes that must sign with
+// the key another process publishes: a missing file is an error, never a
+// fresh key.
+func OpenWebhookSigner(path, kid string) (*WebhookSigner, error) {
+	if path == "" {
+		path = DefaultSigningKeyFile
+	}
+	key, err := LoadSigningKey(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewWebhookSigner(key, kid)
+}
+
+func (s *WebhookSigner) KeyID() string {
+	return s.kid
+}
+
+// Sign returns the UCP-Signature header value for body at the given time,
+// and the key id to send alongside it.
+func (s *WebhookSigner) Sign(body []byte, at time.Time) (string, string, error) {
+	header, err := SignWebhookPayload(s.key, body, at)
+	if err != nil {
+		return "", "", err
+	}
+	return header, s.kid, nil
+}
+
+// SignWebhookPayload signs body with key and formats the UCP-Signature value.
+func SignWebhookPayload(key *ecdsa.PrivateKey, body []byte, at time.Time) (string, error) {
+	timestamp := at.Unix()
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%d.%s", timestamp, string(body))))
+	signature, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return "t=" + strconv.FormatInt(timestamp, 10) + ",v1=" + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// PublicKeys lists the keys partners should accept, for the JWKS endpoint
+// and the profile's signing_keys.
+func (s *WebhookSigner) PublicKeys() []JWK {
+	return []JWK{PublicJWK(&s.key.PublicKey, s.kid)}
+}
+
+// LoadSigningKey reads a PEM encoded P-256 key from path. A missing file
+// comes back as an error wrapping os.ErrNotExist.
+func LoadSigningKey(path string) (*ecdsa.PrivateKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("signing_key_invalid_pem")
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		parsed, pkcs8Err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		ecKey, ok := parsed.(*ecdsa.PrivateKey)
+		if pkcs8Err != nil || !ok {
+			return nil, err
+		}
+		key = ecKey
+	}
+	return key, nil
+}
+
+// LoadOrCreateSigningKey reads a PEM encoded P-256 key from path, generating
+// and saving one (mode 0600) when the file does not exist yet.
+func LoadOrCreateSigningKey(path string) (*ecdsa.PrivateKey, error) {
+	key, err := LoadSigningKey(path)
+	if err == nil {
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, err
+		}
+	}
+	encoded := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, encoded, 0o600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// JWKThumbprint is the RFC 7638 SHA-256 thumbprint of an EC or RSA key.
+func JWKThumbprint(jwk JWK) string {
+	var canonical []byte
+	if jwk.KTY == "RSA" {
+		canonical, _ = json.Marshal(struct {
+			E   string `json:"e"`
+			KTY string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.KTY, jwk.N})
+	} else {
+		canonical, _ = json.Marshal(struct {
+			CRV string `json:"crv"`
+			KTY string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.CRV, jwk.KTY, jwk.X, jwk.Y})
+	}
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// PublicJWK describes a P-256 public key as an ES256 signing JWK.
+func PublicJWK(key *ecdsa.PublicKey, kid string) JWK {
+	size := (key.Curve.Params().BitSize + 7) / 8
+	return JWK{
+		KTY: "EC",
+		CRV: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, size))),
+		Y:   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, size))),
+		KID: kid,
+		Use: "sig",
+		Alg: "ES256",
+	}
+}
+
+// PublicRSAJWK describes an RSA public key as an RS256 signing JWK.
+func PublicRSAJWK(key *rsa.PublicKey, kid string) JWK {
+	return JWK{
+		KTY: "RSA",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		KID: kid,
+		Use: "sig",
+		Alg: "RS256",
+	}
+}
@@ -0,0 +1,52 @@
+package security
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWebhookSignerRoundTripsThroughJWKVerifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "signing.pem")
+	if _, err := OpenWebhookSigner(path, ""); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected opening a missing key file to fail, got %v", err)
+	}
+	signer, err := LoadWebhookSigner(path, "")
+	if err != nil {
+		t.Fatalf("load signer: %v", err)
+	}
+	reloaded, err := OpenWebhookSigner(path, "")
+	if err != nil {
+		t.Fatalf("reopen signer: %v", err)
+	}
+	if signer.KeyID() == "" || reloaded.KeyID() != signer.KeyID() {
+		t.Fatalf("expected the saved key to be reused, got %q and %q", signer.KeyID(), reloaded.KeyID())
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(JWKSet{Keys: signer.PublicKeys()})
+	}))
+	defer server.Close()
+
+	body := []byte(`{"event_id":"evt_1"}`)
+	header, kid, err := reloaded.Sign(body, time.Now())
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/ucp/v1/order-webhooks", nil)
+	req.Header.Set(SignatureHeader, header)
+	req.Header.Set(KeyIDHeader, kid)
+
+	verifier := NewJWKVerifier(server.URL, 300)
+	if err := verifier.Verify(req, body); err != nil {
+		t.Fatalf("expected signature to verify, got %v", err)
+	}
+	if err := verifier.Verify(req, []byte(`{"event_id":"evt_2"}`)); err == nil {
+		t.Fatalf("expected tampered body to fail verification")
+	}
+}
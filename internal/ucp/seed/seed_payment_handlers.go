@@ -5,6 +5,7 @@ import (
 
 	"github.com/meowucp/internal/domain"
 	"github.com/meowucp/internal/repository"
+	"github.com/meowucp/internal/service"
 )
 
 const nowPaymentsName = "com.nowpayments"
@@ -44,3 +45,21 @@ func SeedNowPayments(repo repository.PaymentHandlerRepository, cfg NowPaymentsSe
 
 	return repo.Create(handler)
 }
+
+// SeedSandbox publishes the in-process sandbox provider as a payment handler.
+// Only seed it in development and test environments.
+func SeedSandbox(repo repository.PaymentHandlerRepository) error {
+	if repo == nil {
+		return nil
+	}
+	if existing, err := repo.FindByName(service.SandboxProviderName); err == nil && existing != nil {
+		return nil
+	}
+	return repo.Create(&domain.PaymentHandler{
+		Name:         service.SandboxProviderName,
+		Version:      "2026-01-11",
+		Spec:         "https://sandbox.meowucp.local/spec",
+		ConfigSchema: "https://sandbox.meowucp.local/config.schema.json",
+		Config:       `{"environment":"sandbox"}`,
+	})
+}
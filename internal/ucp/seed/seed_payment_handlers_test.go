@@ -87,3 +87,16 @@ func TestSeedNowPaymentsCreatesWhenMissing(t *testing.T) {
 		t.Fatalf("expected environment to be set")
 	}
 }
+
+func TestSeedSandboxIsIdempotent(t *testing.T) {
+	repo := newFakePaymentHandlerRepo()
+	if err := SeedSandbox(repo); err != nil {
+		t.Fatalf("seed sandbox: %v", err)
+	}
+	if err := SeedSandbox(repo); err != nil {
+		t.Fatalf("seed sandbox again: %v", err)
+	}
+	if repo.createCount != 1 {
+		t.Fatalf("expected one create, got %d", repo.createCount)
+	}
+}
@@ -0,0 +1,174 @@
+package worker
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/meowucp/internal/domain"
+)
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+
+	// DefaultDestination is the breaker key for jobs without a subscription.
+	DefaultDestination = "default"
+
+	// JobKindInbound marks jobs carrying a partner event to apply locally;
+	// they share one breaker key so they never trip an outbound destination.
+	JobKindInbound = "inbound"
+)
+
+// JobDestination names the endpoint a job is delivered to, so breakers and
+// rate limits apply per partner rather than to the whole queue.
+func JobDestination(job *domain.UCPWebhookJob) string {
+	if job != nil && job.Kind == JobKindInbound {
+		return JobKindInbound
+	}
+	if job == nil || job.SubscriptionID == nil {
+		return DefaultDestination
+	}
+	return "subscription:" + strconv.FormatInt(*job.SubscriptionID, 10)
+}
+
+type BreakerConfig struct {
+	// FailureThreshold consecutive failures open the circuit.
+	FailureThreshold int
+	// OpenDuration is how long an open circuit defers jobs before letting a
+	// single probe through.
+	OpenDuration time.Duration
+}
+
+// BreakerStore persists state changes so the API can report them.
+type BreakerStore interface {
+	Save(breaker *domain.UCPWebhookBreaker) error
+}
+
+type breakerState struct {
+	state     string
+	failures  int
+	openedAt  time.Time
+	retryAt   time.Time
+	probing   bool
+	lastError string
+	updatedAt time.Time
+}
+
+// CircuitBreakers tracks a closed/open/half-open breaker per destination.
+type CircuitBreakers struct {
+	mu     sync.Mutex
+	config BreakerConfig
+	store  BreakerStore
+	states map[string]*breakerState
+}
+
+func NewCircuitBreakers(config BreakerConfig) *CircuitBreakers {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 5
+	}
+	if config.OpenDuration <= 0 {
+		config.OpenDuration = time.Minute
+	}
+	return &CircuitBreakers{config: config, states: map[string]*breakerState{}}
+}
+
+func (b *CircuitBreakers) SetStore(store BreakerStore) {
+	b.store = store
+}
+
+// Allow reports whether a delivery to destination may go ahead. When it may
+// not, the returned time is when the job should be tried again.
+func (b *CircuitBreakers) Allow(destination string, now time.Time) (bool, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state, ok := b.states[destination]
+	if !ok || state.state == BreakerClosed {
+		return true, time.Time{}
+	}
+	if state.state == BreakerOpen {
+		if now.Before(state.retryAt) {
+			return false, state.retryAt
+		}
+		state.state = BreakerHalfOpen
+		state.probing = true
+		state.updatedAt = now
+		b.save(destination, state)
+		return true, time.Time{}
+	}
+	if state.probing {
+		return false, now.Add(b.config.OpenDuration)
+	}
+	state.probing = true
+	return true, time.Time{}
+}
+
+// Record feeds a delivery result back into the destination's breaker.
+func (b *CircuitBreakers) Record(destination string, err error, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state, ok := b.states[destination]
+	if !ok {
+		state = &breakerState{state: BreakerClosed}
+		b.states[destination] = state
+	}
+	state.probing = false
+	state.updatedAt = now
+	if err == nil {
+		changed := state.state != BreakerClosed
+		state.state = BreakerClosed
+		state.failures = 0
+		state.lastError = ""
+		if changed {
+			b.save(destination, state)
+		}
+		return
+	}
+	state.failures++
+	state.lastError = err.Error()
+	if state.state == BreakerHalfOpen || state.failures >= b.config.FailureThreshold {
+		if state.state != BreakerOpen {
+			state.openedAt = now
+		}
+		state.state = BreakerOpen
+		state.retryAt = now.Add(b.config.OpenDuration)
+		b.save(destination, state)
+	}
+}
+
+// Snapshot returns the current state of every destination seen so far.
+func (b *CircuitBreakers) Snapshot() []*domain.UCPWebhookBreaker {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	result := make([]*domain.UCPWebhookBreaker, 0, len(b.states))
+	for destination, state := range b.states {
+		result = append(result, toBreakerRecord(destination, state))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Destination < result[j].Destination })
+	return result
+}
+
+func (b *CircuitBreakers) save(destination string, state *breakerState) {
+	if b.store == nil {
+		return
+	}
+	_ = b.store.Save(toBreakerRecord(destination, state))
+}
+
+func toBreakerRecord(destination string, state *breakerState) *domain.UCPWebhookBreaker {
+	record := &domain.UCPWebhookBreaker{
+		Destination:         destination,
+		State:               state.state,
+		ConsecutiveFailures: state.failures,
+		LastError:           state.lastError,
+		UpdatedAt:           state.updatedAt,
+	}
+	if state.state != BreakerClosed {
+		openedAt, retryAt := state.openedAt, state.retryAt
+		record.OpenedAt = &openedAt
+		record.RetryAt = &retryAt
+	}
+	return record
+}
@@ -0,0 +1,94 @@
+package worker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/meowucp/internal/domain"
+)
+
+type fakeBreakerStore struct {
+	saved []*domain.UCPWebhookBreaker
+}
+
+func (f *fakeBreakerStore) Save(breaker *domain.UCPWebhookBreaker) error {
+	f.saved = append(f.saved, breaker)
+	return nil
+}
+
+func TestCircuitBreakerOpensHalfOpensAndCloses(t *testing.T) {
+	now := time.Date(2026, 1, 29, 10, 0, 0, 0, time.UTC)
+	store := &fakeBreakerStore{}
+	breakers := NewCircuitBreakers(BreakerConfig{FailureThreshold: 2, OpenDuration: time.Minute})
+	breakers.SetStore(store)
+	down := errors.New("delivery_failed")
+
+	breakers.Record("a", down, now)
+	if allowed, _ := breakers.Allow("a", now); !allowed {
+		t.Fatalf("expected circuit to stay closed below the threshold")
+	}
+	breakers.Record("a", down, now)
+	allowed, retryAt := breakers.Allow("a", now.Add(time.Second))
+	if allowed || !retryAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("expected open circuit to defer until %v, got %v %v", now.Add(time.Minute), allowed, retryAt)
+	}
+	if allowed, _ := breakers.Allow("b", now); !allowed {
+		t.Fatalf("expected other destinations to be unaffected")
+	}
+
+	later := now.Add(time.Minute)
+	if allowed, _ := breakers.Allow("a", later); !allowed {
+		t.Fatalf("expected a probe once the open window passes")
+	}
+	if allowed, _ := breakers.Allow("a", later); allowed {
+		t.Fatalf("expected only one probe while half-open")
+	}
+	breakers.Record("a", down, later)
+	if allowed, _ := breakers.Allow("a", later.Add(time.Second)); allowed {
+		t.Fatalf("expected failed probe to reopen the circuit")
+	}
+
+	recovered := later.Add(time.Minute)
+	breakers.Allow("a", recovered)
+	breakers.Record("a", nil, recovered)
+	if allowed, _ := breakers.Allow("a", recovered); !allowed {
+		t.Fatalf("expected successful probe to close the circuit")
+	}
+
+	var states []string
+	for _, saved := range store.saved {
+		states = append(states, saved.State)
+	}
+	if got := len(states); got != 5 || states[0] != BreakerOpen || states[1] != BreakerHalfOpen || states[4] != BreakerClosed {
+		t.Fatalf("unexpected persisted transitions %v", states)
+	}
+	snapshot := breakers.Snapshot()
+	if len(snapshot) != 1 || snapshot[0].Destination != "a" || snapshot[0].State != BreakerClosed {
+		t.Fatalf("unexpected snapshot %+v", snapshot)
+	}
+}
+
+func TestRateLimiterPerDestination(t *testing.T) {
+	now := time.Date(2026, 1, 29, 10, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(RateLimit{PerSecond: 2, Burst: 2})
+
+	for i := 0; i < 2; i++ {
+		if allowed, _ := limiter.Allow("a", now); !allowed {
+			t.Fatalf("expected burst of 2 to be allowed")
+		}
+	}
+	allowed, wait := limiter.Allow("a", now)
+	if allowed || wait != 500*time.Millisecond {
+		t.Fatalf("expected to wait 500ms, got %v %v", allowed, wait)
+	}
+	if allowed, _ := limiter.Allow("b", now); !allowed {
+		t.Fatalf("expected separate bucket per destination")
+	}
+	if allowed, _ := limiter.Allow("a", now.Add(500*time.Millisecond)); !allowed {
+		t.Fatalf("expected bucket to refill")
+	}
+	if NewRateLimiter(RateLimit{}) != nil {
+		t.Fatalf("expected zero rate to disable limiting")
+	}
+}
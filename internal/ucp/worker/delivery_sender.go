@@ -2,7 +2,11 @@ package worker
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -10,11 +14,31 @@ import (
 	"github.com/meowucp/internal/domain"
 )
 
-var ErrDeliveryURLMissing = errors.New("delivery_url_missing")
+var (
+	ErrDeliveryURLMissing   = errors.New("delivery_url_missing")
+	ErrSubscriptionInactive = errors.New("subscription_inactive")
+)
+
+// SubscriptionSecretHeader carries an HMAC of the body when the subscription
+// has a shared secret.
+const SubscriptionSecretHeader = "UCP-Subscription-Signature"
+
+// PayloadSigner produces the UCP-Signature header for an outbound body along
+// with the id of the key it used.
+type PayloadSigner interface {
+	Sign(body []byte, at time.Time) (signature string, keyID string, err error)
+}
+
+// SubscriptionLookup resolves the endpoint of a job queued for a subscription.
+type SubscriptionLookup interface {
+	FindByID(id int64) (*domain.UCPWebhookSubscription, error)
+}
 
 type DeliverySender struct {
-	url    string
-	client *http.Client
+	url           string
+	client        *http.Client
+	signer        PayloadSigner
+	subscriptions SubscriptionLookup
 }
 
 func NewDeliverySender(url string, timeout time.Duration) *DeliverySender {
@@ -27,19 +51,46 @@ func NewDeliverySender(url string, timeout time.Duration) *DeliverySender {
 	}
 }
 
+// SetSigner signs every delivery with UCP-Signature and UCP-Key-Id.
+func (s *DeliverySender) SetSigner(signer PayloadSigner) {
+	s.signer = signer
+}
+
+// SetSubscriptions lets Send deliver subscription jobs to their own URL.
+// Jobs without a subscription still go to the configured URL.
+func (s *DeliverySender) SetSubscriptions(lookup SubscriptionLookup) {
+	s.subscriptions = lookup
+}
+
 func (s *DeliverySender) Send(job *domain.UCPWebhookJob) error {
-	if s.url == "" {
-		return ErrDeliveryURLMissing
-	}
 	if job == nil {
 		return errors.New("nil_job")
 	}
+	url, secret, err := s.destination(job)
+	if err != nil {
+		return err
+	}
+	if url == "" {
+		return ErrDeliveryURLMissing
+	}
 
-	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewBufferString(job.Payload))
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBufferString(job.Payload))
 	if err != nil {
 		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
+	now := time.Now()
+	if s.signer != nil {
+		signature, keyID, err := s.signer.Sign([]byte(job.Payload), now)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("UCP-Signature", signature)
+		req.Header.Set("UCP-Key-Id", keyID)
+	}
+	if secret != "" {
+		req.Header.Set(SubscriptionSecretHeader, signWithSecret(secret, []byte(job.Payload), now))
+	}
 
 	resp, err := s.client.Do(req)
 	if err != nil {
@@ -53,3 +104,25 @@ func (s *DeliverySender) Send(job *domain.UCPWebhookJob) error {
 
 	return nil
 }
+
+func (s *DeliverySender) destination(job *domain.UCPWebhookJob) (string, string, error) {
+	if job.SubscriptionID == nil {
+		return s.url, "", nil
+	}
+	if s.subscriptions == nil {
+		return "", "", ErrSubscriptionInactive
+	}
+	subscription, err := s.subscriptions.FindByID(*job.SubscriptionID)
+	if err != nil || subscription == nil || !subscription.Active {
+		return "", "", ErrSubscriptionInactive
+	}
+	return strings.TrimSpace(subscription.URL), subscription.Secret, nil
+}
+
+// signWithSecret computes t=<unix>,v1=<hex HMAC-SHA256 of "<t>.<body>">.
+func signWithSecret(secret string, body []byte, at time.Time) string {
+	stamp := at.Unix()
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.%s", stamp, body)
+	return fmt.Sprintf("t=%d,v1=%s", stamp, hex.EncodeToString(mac.Sum(nil)))
+}
@@ -2,6 +2,7 @@ package worker
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -50,3 +51,90 @@ func TestDeliverySenderRejectsEmptyURL(t *testing.T) {
 		t.Fatalf("expected ErrDeliveryURLMissing")
 	}
 }
+
+type fakePayloadSigner struct{}
+
+func (fakePayloadSigner) Sign(body []byte, at time.Time) (string, string, error) {
+	return "t=1,v1=" + string(body), "key-1", nil
+}
+
+func TestDeliverySenderSignsPayload(t *testing.T) {
+	var signature, keyID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get("UCP-Signature")
+		keyID = r.Header.Get("UCP-Key-Id")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sender := NewDeliverySender(server.URL, 2*time.Second)
+	sender.SetSigner(fakePayloadSigner{})
+	if err := sender.Send(&domain.UCPWebhookJob{EventID: "evt_1", Payload: "{}"}); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	if signature != "t=1,v1={}" || keyID != "key-1" {
+		t.Fatalf("expected signature headers, got %q %q", signature, keyID)
+	}
+}
+
+type fakeSubscriptionLookup map[int64]*domain.UCPWebhookSubscription
+
+func (f fakeSubscriptionLookup) FindByID(id int64) (*domain.UCPWebhookSubscription, error) {
+	if subscription, ok := f[id]; ok {
+		return subscription, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func TestDeliverySenderRoutesSubscriptionJobs(t *testing.T) {
+	var hits []string
+	newServer := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits = append(hits, name+"|"+r.Header.Get(SubscriptionSecretHeader))
+			w.WriteHeader(http.StatusOK)
+		}))
+	}
+	global, partnerA, partnerB := newServer("global"), newServer("a"), newServer("b")
+	defer global.Close()
+	defer partnerA.Close()
+	defer partnerB.Close()
+
+	sender := NewDeliverySender(global.URL, 2*time.Second)
+	sender.SetSubscriptions(fakeSubscriptionLookup{
+		1: {ID: 1, URL: partnerA.URL, Secret: "shh", Active: true},
+		2: {ID: 2, URL: partnerB.URL, Active: true},
+		3: {ID: 3, URL: partnerB.URL, Active: false},
+	})
+
+	subscription := func(id int64) *int64 { return &id }
+	for _, job := range []*domain.UCPWebhookJob{
+		{EventID: "evt_1", Payload: "{}"},
+		{EventID: "evt_1", Payload: "{}", SubscriptionID: subscription(1)},
+		{EventID: "evt_1", Payload: "{}", SubscriptionID: subscription(2)},
+	} {
+		if err := sender.Send(job); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	if len(hits) != 3 || hits[0] != "global|" || hits[2] != "b|" {
+		t.Fatalf("unexpected deliveries %v", hits)
+	}
+	if want := "a|" + signWithSecret("shh", []byte("{}"), time.Unix(parseStamp(t, hits[1][2:]), 0)); hits[1] != want {
+		t.Fatalf("expected HMAC header %q, got %q", want, hits[1])
+	}
+
+	for _, id := range []int64{3, 4} {
+		if err := sender.Send(&domain.UCPWebhookJob{EventID: "evt_1", Payload: "{}", SubscriptionID: subscription(id)}); !errors.Is(err, ErrSubscriptionInactive) {
+			t.Fatalf("expected inactive subscription %d to fail, got %v", id, err)
+		}
+	}
+}
+
+func parseStamp(t *testing.T, header string) int64 {
+	t.Helper()
+	var stamp int64
+	if _, err := fmt.Sscanf(header, "t=%d,", &stamp); err != nil {
+		t.Fatalf("parse %q: %v", header, err)
+	}
+	return stamp
+}
@@ -1,33 +1,53 @@
 package worker
 
 import (
+	"context"
+	"sync"
 	"time"
 
 	"github.com/meowucp/internal/domain"
 )
 
+// QueueStore leases due jobs to a worker. Release writes a claimed job back
+// only while the lease recorded on it is still the one stored, and reports
+// false once another worker has taken the job over.
 type QueueStore interface {
-	ListDue(limit int) ([]*domain.UCPWebhookJob, error)
+	ClaimDue(owner string, limit int, lease time.Duration) ([]*domain.UCPWebhookJob, error)
 	Update(job *domain.UCPWebhookJob) error
+	Release(job *domain.UCPWebhookJob) (bool, error)
 }
 
+// ProcessorConfig controls batching and retries. Owner names this process on
+// the leases it takes; LeaseDuration should outlast a full batch of
+// deliveries. Jobs whose lease ran out are claimed again by another worker,
+// and the late result of the first worker is dropped.
 type ProcessorConfig struct {
-	BatchSize   int
-	MaxAttempts int
-	BaseDelay   time.Duration
+	BatchSize     int
+	MaxAttempts   int
+	BaseDelay     time.Duration
+	Owner         string
+	LeaseDuration time.Duration
 }
 
 type Processor struct {
-	store     QueueStore
-	config    ProcessorConfig
-	now       func() time.Time
-	alertSink AlertSink
+	store       QueueStore
+	config      ProcessorConfig
+	now         func() time.Time
+	alertSink   AlertSink
+	breakers    *CircuitBreakers
+	limiter     *RateLimiter
+	deadLetters DeadLetterSink
 }
 
 type AlertSink interface {
 	Notify(alert *domain.UCPWebhookAlert) error
 }
 
+// DeadLetterSink receives jobs that have exhausted MaxAttempts.
+type DeadLetterSink interface {
+	MoveToDLQ(job *domain.UCPWebhookJob, reason string) error
+}
+
 func NewProcessor(store QueueStore, config ProcessorConfig) *Processor {
 	if config.BatchSize <= 0 {
 		config.BatchSize = 10
@@ -38,6 +58,9 @@ func NewProcessor(store QueueStore, config ProcessorConfig) *Processor {
 	if config.BaseDelay <= 0 {
 		config.BaseDelay = time.Minute
 	}
+	if config.LeaseDuration <= 0 {
+		config.LeaseDuration = 5 * time.Minute
+	}
 	return &Processor{
 		store:  store,
 		config: config,
@@ -49,6 +72,21 @@ func (p *Processor) SetAlertSink(sink AlertSink) {
 	p.alertSink = sink
 }
 
+// SetDeadLetterSink moves jobs marked "failed" into the dead-letter queue.
+func (p *Processor) SetDeadLetterSink(sink DeadLetterSink) {
+	p.deadLetters = sink
+}
+
+// SetCircuitBreakers defers jobs whose destination circuit is open.
+func (p *Processor) SetCircuitBreakers(breakers *CircuitBreakers) {
+	p.breakers = breakers
+}
+
+// SetRateLimiter defers jobs whose destination is over its rate limit.
+func (p *Processor) SetRateLimiter(limiter *RateLimiter) {
+	p.limiter = limiter
+}
+
 func (p *Processor) EnqueueFollowup(subject string, action string) error {
 	if p == nil || p.store == nil {
 		return nil
@@ -65,14 +103,30 @@ func (p *Processor) EnqueueFollowup(subject string, action string) error {
 }
 
 func (p *Processor) ProcessOnce(handler func(job *domain.UCPWebhookJob) error) (int, error) {
-	jobs, err := p.store.ListDue(p.config.BatchSize)
+	jobs, err := p.store.ClaimDue(p.config.Owner, p.config.BatchSize, p.config.LeaseDuration)
 	if err != nil {
 		return 0, err
 	}
 	processed := 0
 	for _, job := range jobs {
+		destination := JobDestination(job)
+		if retryAt, ok := p.admit(destination); !ok {
+			// Deferred jobs keep their attempt count; they never reached the endpoint.
+			job.Status = "retrying"
+			if job.Attempts == 0 {
+				job.Status = "pending"
+			}
+			job.NextRetryAt = retryAt
+			if _, releaseErr := p.release(job); releaseErr != nil {
+				return processed, releaseErr
+			}
+			continue
+		}
 		job.Attempts++
 		err := handler(job)
+		if p.breakers != nil {
+			p.breakers.Record(destination, err, p.now())
+		}
 		if err == nil {
 			job.Status = "processed"
 			job.NextRetryAt = p.now()
@@ -95,14 +149,78 @@ func (p *Processor) ProcessOnce(handler func(job *domain.UCPWebhookJob) error) (
 				})
 			}
 		}
-		if updateErr := p.store.Update(job); updateErr != nil {
-			return processed, updateErr
+		released, releaseErr := p.release(job)
+		if releaseErr != nil {
+			return processed, releaseErr
+		}
+		if !released {
+			continue
+		}
+		if job.Status == "failed" && p.deadLetters != nil {
+			if dlqErr := p.deadLetters.MoveToDLQ(job, "max_attempts"); dlqErr != nil {
+				return processed, dlqErr
+			}
 		}
 		processed++
 	}
 	return processed, nil
 }
 
+// Run processes jobs on concurrency goroutines until ctx is cancelled. Each
+// goroutine finishes the batch it has claimed before returning, so Run only
+// returns once every in-flight job has been written back.
+func (p *Processor) Run(ctx context.Context, concurrency int, idle time.Duration, handler func(job *domain.UCPWebhookJob) error, onError func(err error)) {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				processed, err := p.ProcessOnce(handler)
+				if err != nil && onError != nil {
+					onError(err)
+				}
+				if processed > 0 {
+					continue
+				}
+				select {
+				case <-ctx.Done():
+				case <-time.After(idle):
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// release writes job back and drops its lease. It reports false, leaving the
+// row alone, when the lease expired and another worker reclaimed the job.
+func (p *Processor) release(job *domain.UCPWebhookJob) (bool, error) {
+	released, err := p.store.Release(job)
+	if err != nil || !released {
+		return false, err
+	}
+	job.LeaseOwner = ""
+	job.LeaseExpiresAt = nil
+	return true, nil
+}
+
+func (p *Processor) admit(destination string) (time.Time, bool) {
+	now := p.now()
+	if allowed, wait := p.limiter.Allow(destination, now); !allowed {
+		return now.Add(wait), false
+	}
+	if p.breakers != nil {
+		if allowed, retryAt := p.breakers.Allow(destination, now); !allowed {
+			return retryAt, false
+		}
+	}
+	return now, true
+}
+
 func (p *Processor) retryDelay(attempt int) time.Duration {
 	if attempt <= 1 {
 		return p.config.BaseDelay
@@ -1,7 +1,9 @@
 package worker
 
 import (
+	"context"
 	"errors"
+	"sync"
 	"testing"
 	"time"
 
@@ -9,22 +11,57 @@ import (
 )
 
 type fakeQueueStore struct {
+	mu          sync.Mutex
 	jobs        []*domain.UCPWebhookJob
 	updatedJobs []*domain.UCPWebhookJob
+	// claimOnce hands each job out a single time, like a real lease.
+	claimOnce bool
+	claimed   int
+	// reclaimed jobs were taken over by another worker once their lease ran out.
+	reclaimed map[int64]bool
 }
 
-func (f *fakeQueueStore) ListDue(limit int) ([]*domain.UCPWebhookJob, error) {
-	if len(f.jobs) > limit {
-		return f.jobs[:limit], nil
+func (f *fakeQueueStore) ClaimDue(owner string, limit int, lease time.Duration) ([]*domain.UCPWebhookJob, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.claimOnce {
+		if len(f.jobs) > limit {
+			return f.jobs[:limit], nil
+		}
+		return f.jobs, nil
 	}
-	return f.jobs, nil
+	end := f.claimed + limit
+	if end > len(f.jobs) {
+		end = len(f.jobs)
+	}
+	batch := f.jobs[f.claimed:end]
+	f.claimed = end
+	expires := time.Now().Add(lease)
+	for _, job := range batch {
+		job.Status = "processing"
+		job.LeaseOwner = owner
+		job.LeaseExpiresAt = &expires
+	}
+	return batch, nil
 }
 
 func (f *fakeQueueStore) Update(job *domain.UCPWebhookJob) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	f.updatedJobs = append(f.updatedJobs, job)
 	return nil
 }
 
+func (f *fakeQueueStore) Release(job *domain.UCPWebhookJob) (bool, error) {
+	f.mu.Lock()
+	lost := f.reclaimed[job.ID]
+	f.mu.Unlock()
+	if lost {
+		return false, nil
+	}
+	return true, f.Update(job)
+}
+
 type fakeAlertSink struct {
 	count int
 	last  *domain.UCPWebhookAlert
@@ -186,6 +223,44 @@ func TestProcessorNotifiesAlertOnFailure(t *testing.T) {
 	}
 }
 
+type fakeDeadLetterSink struct {
+	jobs    []*domain.UCPWebhookJob
+	reasons []string
+}
+
+func (f *fakeDeadLetterSink) MoveToDLQ(job *domain.UCPWebhookJob, reason string) error {
+	f.jobs = append(f.jobs, job)
+	f.reasons = append(f.reasons, reason)
+	return nil
+}
+
+func TestProcessorMovesExhaustedJobsToDLQ(t *testing.T) {
+	now := time.Date(2026, 1, 29, 10, 0, 0, 0, time.UTC)
+	store := &fakeQueueStore{
+		jobs: []*domain.UCPWebhookJob{
+			{ID: 1, EventID: "evt_1", Status: "retrying", Attempts: 2, NextRetryAt: now},
+			{ID: 2, EventID: "evt_2", Status: "pending", Attempts: 0, NextRetryAt: now},
+		},
+	}
+	deadLetters := &fakeDeadLetterSink{}
+	processor := NewProcessor(store, ProcessorConfig{MaxAttempts: 3})
+	processor.now = func() time.Time { return now }
+	processor.SetDeadLetterSink(deadLetters)
+
+	_, err := processor.ProcessOnce(func(job *domain.UCPWebhookJob) error {
+		return errors.New("boom")
+	})
+	if err != nil {
+		t.Fatalf("process once: %v", err)
+	}
+	if len(deadLetters.jobs) != 1 || deadLetters.jobs[0].ID != 1 {
+		t.Fatalf("expected only the exhausted job in the DLQ, got %v", deadLetters.jobs)
+	}
+	if deadLetters.reasons[0] != "max_attempts" {
+		t.Fatalf("expected reason max_attempts, got %s", deadLetters.reasons[0])
+	}
+}
+
 func TestAsyncOrderFollowupEnqueued(t *testing.T) {
 	queue := &fakeQueueStore{}
 	processor := NewProcessor(queue, ProcessorConfig{MaxAttempts: 3})
@@ -196,3 +271,105 @@ func TestAsyncOrderFollowupEnqueued(t *testing.T) {
 		t.Fatalf("expected followup job to be queued")
 	}
 }
+
+func TestProcessorDefersOpenCircuitWithoutUsingAttempts(t *testing.T) {
+	now := time.Date(2026, 1, 29, 10, 0, 0, 0, time.UTC)
+	down, up := int64(1), int64(2)
+	store := &fakeQueueStore{
+		jobs: []*domain.UCPWebhookJob{
+			{ID: 1, EventID: "evt_1", SubscriptionID: &down, Status: "pending", NextRetryAt: now},
+			{ID: 2, EventID: "evt_2", SubscriptionID: &down, Status: "pending", NextRetryAt: now},
+			{ID: 3, EventID: "evt_3", SubscriptionID: &up, Status: "pending", NextRetryAt: now},
+		},
+	}
+	processor := NewProcessor(store, ProcessorConfig{MaxAttempts: 3, BaseDelay: time.Second})
+	processor.now = func() time.Time { return now }
+	processor.SetCircuitBreakers(NewCircuitBreakers(BreakerConfig{FailureThreshold: 1, OpenDuration: time.Minute}))
+
+	var delivered []int64
+	processed, err := processor.ProcessOnce(func(job *domain.UCPWebhookJob) error {
+		delivered = append(delivered, job.ID)
+		if *job.SubscriptionID == down {
+			return errors.New("delivery_failed")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("process once: %v", err)
+	}
+	if processed != 2 || len(delivered) != 2 || delivered[1] != 3 {
+		t.Fatalf("expected the open circuit to skip job 2, delivered %v", delivered)
+	}
+	deferred := store.jobs[1]
+	if deferred.Attempts != 0 || deferred.Status != "pending" || !deferred.NextRetryAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("expected job 2 deferred without an attempt, got %+v", deferred)
+	}
+}
+
+func TestProcessorRunDeliversEachJobOnceAndDrains(t *testing.T) {
+	store := &fakeQueueStore{claimOnce: true}
+	for i := 1; i <= 20; i++ {
+		store.jobs = append(store.jobs, &domain.UCPWebhookJob{ID: int64(i), EventID: "evt", Status: "pending"})
+	}
+	processor := NewProcessor(store, ProcessorConfig{BatchSize: 3, MaxAttempts: 3, Owner: "worker-a"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var mu sync.Mutex
+	deliveries := map[int64]int{}
+	processor.Run(ctx, 4, time.Millisecond, func(job *domain.UCPWebhookJob) error {
+		mu.Lock()
+		deliveries[job.ID]++
+		if len(deliveries) == len(store.jobs) {
+			cancel()
+		}
+		mu.Unlock()
+		return nil
+	}, nil)
+	cancel()
+
+	if len(deliveries) != 20 {
+		t.Fatalf("expected 20 delivered jobs, got %d", len(deliveries))
+	}
+	for id, count := range deliveries {
+		if count != 1 {
+			t.Fatalf("expected job %d delivered once, got %d", id, count)
+		}
+	}
+	for _, job := range store.jobs {
+		if job.Status != "processed" || job.LeaseOwner != "" || job.LeaseExpiresAt != nil {
+			t.Fatalf("expected job %d processed with its lease released, got %+v", job.ID, job)
+		}
+	}
+}
+
+func TestProcessorDropsResultsAfterLosingTheLease(t *testing.T) {
+	now := time.Date(2026, 1, 29, 10, 0, 0, 0, time.UTC)
+	store := &fakeQueueStore{
+		jobs: []*domain.UCPWebhookJob{
+			{ID: 1, EventID: "evt_1", Status: "pending", NextRetryAt: now},
+			{ID: 2, EventID: "evt_2", Status: "pending", NextRetryAt: now},
+		},
+		claimOnce: true,
+		reclaimed: map[int64]bool{1: true},
+	}
+	deadLetters := &fakeDeadLetterSink{}
+	processor := NewProcessor(store, ProcessorConfig{MaxAttempts: 1, Owner: "worker-a"})
+	processor.SetDeadLetterSink(deadLetters)
+	processor.now = func() time.Time { return now }
+
+	processed, err := processor.ProcessOnce(func(job *domain.UCPWebhookJob) error {
+		return errors.New("boom")
+	})
+	if err != nil {
+		t.Fatalf("process once: %v", err)
+	}
+	if processed != 1 || len(store.updatedJobs) != 1 || store.updatedJobs[0].ID != 2 {
+		t.Fatalf("expected only the job still leased to be written back, got %d processed", processed)
+	}
+	if len(deadLetters.jobs) != 1 || deadLetters.jobs[0].ID != 2 {
+		t.Fatalf("expected the reclaimed job not to be dead-lettered")
+	}
+	if store.jobs[0].LeaseOwner != "worker-a" {
+		t.Fatalf("expected the lost lease to be left alone")
+	}
+}
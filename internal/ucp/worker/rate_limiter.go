@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"sync"
+	"time"
+)
+
+type RateLimit struct {
+	PerSecond float64
+	Burst     int
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter is a token bucket per destination.
+type RateLimiter struct {
+	mu      sync.Mutex
+	limit   RateLimit
+	buckets map[string]*tokenBucket
+}
+
+// NewRateLimiter returns nil when PerSecond is not positive, which disables
+// rate limiting.
+func NewRateLimiter(limit RateLimit) *RateLimiter {
+	if limit.PerSecond <= 0 {
+		return nil
+	}
+	if limit.Burst <= 0 {
+		limit.Burst = 1
+	}
+	return &RateLimiter{limit: limit, buckets: map[string]*tokenBucket{}}
+}
+
+// Allow takes a token for destination. When none is left it reports how long
+// until the next one.
+func (l *RateLimiter) Allow(destination string, now time.Time) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	bucket, ok := l.buckets[destination]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(l.limit.Burst), last: now}
+		l.buckets[destination] = bucket
+	}
+	if elapsed := now.Sub(bucket.last).Seconds(); elapsed > 0 {
+		bucket.tokens += elapsed * l.limit.PerSecond
+		if bucket.tokens > float64(l.limit.Burst) {
+			bucket.tokens = float64(l.limit.Burst)
+		}
+		bucket.last = now
+	}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - bucket.tokens) / l.limit.PerSecond * float64(time.Second))
+	return false, wait
+}
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS stock_reservations (
+  id BIGSERIAL PRIMARY KEY,
+  checkout_session_id TEXT NOT NULL,
+  product_id BIGINT NOT NULL REFERENCES products(id),
+  sku TEXT NOT NULL,
+  quantity INT NOT NULL CHECK (quantity > 0),
+  status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'released', 'converted')),
+  order_id BIGINT,
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS stock_reservations_session_sku_idx
+  ON stock_reservations (checkout_session_id, sku);
+
+CREATE INDEX IF NOT EXISTS stock_reservations_active_product_idx
+  ON stock_reservations (product_id) WHERE status = 'active';
+
+CREATE INDEX IF NOT EXISTS stock_reservations_active_expires_idx
+  ON stock_reservations (expires_at) WHERE status = 'active';
@@ -0,0 +1,3 @@
+ALTER TABLE checkout_sessions
+  ADD COLUMN IF NOT EXISTS fulfillment JSONB,
+  ADD COLUMN IF NOT EXISTS discounts JSONB;
@@ -0,0 +1,89 @@
+-- Store money as BIGINT minor units (fen, cents, yen) instead of decimals.
+-- Conversion rounds half to even and honours the order currency's exponent.
+
+CREATE OR REPLACE FUNCTION money_exponent(currency TEXT) RETURNS INT AS $$
+  SELECT CASE UPPER(COALESCE(currency, 'CNY'))
+    WHEN 'BIF' THEN 0 WHEN 'CLP' THEN 0 WHEN 'DJF' THEN 0 WHEN 'GNF' THEN 0
+    WHEN 'ISK' THEN 0 WHEN 'JPY' THEN 0 WHEN 'KMF' THEN 0 WHEN 'KRW' THEN 0
+    WHEN 'PYG' THEN 0 WHEN 'RWF' THEN 0 WHEN 'UGX' THEN 0 WHEN 'VND' THEN 0
+    WHEN 'VUV' THEN 0 WHEN 'XAF' THEN 0 WHEN 'XOF' THEN 0 WHEN 'XPF' THEN 0
+    WHEN 'BHD' THEN 3 WHEN 'IQD' THEN 3 WHEN 'JOD' THEN 3 WHEN 'KWD' THEN 3
+    WHEN 'LYD' THEN 3 WHEN 'OMR' THEN 3 WHEN 'TND' THEN 3
+    ELSE 2
+  END
+$$ LANGUAGE SQL IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION to_minor_units(amount NUMERIC, currency TEXT) RETURNS BIGINT AS $$
+  SELECT CASE
+    WHEN scaled IS NULL THEN NULL
+    WHEN scaled - FLOOR(scaled) > 0.5 THEN FLOOR(scaled) + 1
+    WHEN scaled - FLOOR(scaled) < 0.5 THEN FLOOR(scaled)
+    ELSE FLOOR(scaled) + ABS(FLOOR(scaled)::BIGINT % 2)
+  END::BIGINT
+  FROM (SELECT amount * POWER(10::NUMERIC, money_exponent(currency)) AS scaled) s
+$$ LANGUAGE SQL IMMUTABLE;
+
+ALTER TABLE orders
+  ALTER COLUMN subtotal TYPE BIGINT USING to_minor_units(subtotal, currency),
+  ALTER COLUMN shipping_fee TYPE BIGINT USING to_minor_units(shipping_fee, currency),
+  ALTER COLUMN tax TYPE BIGINT USING to_minor_units(tax, currency),
+  ALTER COLUMN discount TYPE BIGINT USING to_minor_units(discount, currency),
+  ALTER COLUMN total TYPE BIGINT USING to_minor_units(total, currency);
+
+ALTER TABLE orders
+  ALTER COLUMN shipping_fee SET DEFAULT 0,
+  ALTER COLUMN tax SET DEFAULT 0,
+  ALTER COLUMN discount SET DEFAULT 0;
+
+-- Child tables take the currency from their order, so convert through a
+-- scratch column.
+ALTER TABLE order_items
+  ADD COLUMN unit_price_minor BIGINT,
+  ADD COLUMN total_price_minor BIGINT;
+UPDATE order_items oi
+SET unit_price_minor = to_minor_units(oi.unit_price, o.currency),
+    total_price_minor = to_minor_units(oi.total_price, o.currency)
+FROM orders o
+WHERE o.id = oi.order_id;
+UPDATE order_items
+SET unit_price_minor = to_minor_units(unit_price, NULL),
+    total_price_minor = to_minor_units(total_price, NULL)
+WHERE unit_price_minor IS NULL;
+ALTER TABLE order_items DROP COLUMN unit_price, DROP COLUMN total_price;
+ALTER TABLE order_items RENAME COLUMN unit_price_minor TO unit_price;
+ALTER TABLE order_items RENAME COLUMN total_price_minor TO total_price;
+ALTER TABLE order_items
+  ALTER COLUMN unit_price SET NOT NULL,
+  ALTER COLUMN total_price SET NOT NULL;
+
+ALTER TABLE payments ADD COLUMN amount_minor BIGINT;
+UPDATE payments p
+SET amount_minor = to_minor_units(p.amount, o.currency)
+FROM orders o
+WHERE o.id = p.order_id;
+UPDATE payments SET amount_minor = to_minor_units(amount, NULL) WHERE amount_minor IS NULL;
+ALTER TABLE payments DROP COLUMN amount;
+ALTER TABLE payments RENAME COLUMN amount_minor TO amount;
+ALTER TABLE payments ALTER COLUMN amount SET NOT NULL;
+
+ALTER TABLE payment_refunds ADD COLUMN amount_minor BIGINT;
+UPDATE payment_refunds r
+SET amount_minor = to_minor_units(r.amount, o.currency)
+FROM payments p
+JOIN orders o ON o.id = p.order_id
+WHERE p.id = r.payment_id;
+UPDATE payment_refunds SET amount_minor = to_minor_units(amount, NULL) WHERE amount_minor IS NULL;
+ALTER TABLE payment_refunds DROP COLUMN amount;
+ALTER TABLE payment_refunds RENAME COLUMN amount_minor TO amount;
+ALTER TABLE payment_refunds ALTER COLUMN amount SET NOT NULL;
+
+-- Shipping rules and coupons are priced in the store's default currency.
+ALTER TABLE shipping_rules
+  ALTER COLUMN base_amount TYPE BIGINT USING to_minor_units(base_amount, NULL),
+  ALTER COLUMN per_item_amount TYPE BIGINT USING to_minor_units(per_item_amount, NULL);
+
+-- Fixed coupons become minor units; percent coupons become basis points
+-- (10.00% -> 1000), which is the same scaling.
+ALTER TABLE coupons
+  ALTER COLUMN value TYPE BIGINT USING to_minor_units(value, NULL),
+  ALTER COLUMN min_spend TYPE BIGINT USING to_minor_units(min_spend, NULL);
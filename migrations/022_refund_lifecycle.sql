@@ -0,0 +1,35 @@
+ALTER TABLE payment_refunds
+  ADD COLUMN IF NOT EXISTS order_id BIGINT,
+  ADD COLUMN IF NOT EXISTS failure_reason TEXT,
+  ADD COLUMN IF NOT EXISTS completed_at TIMESTAMPTZ;
+
+UPDATE payment_refunds r
+SET order_id = p.order_id
+FROM payments p
+WHERE r.payment_id = p.id AND r.order_id IS NULL;
+
+-- Refunds were recorded as completed as soon as they were created.
+UPDATE payment_refunds
+SET status = 'succeeded', completed_at = COALESCE(completed_at, updated_at)
+WHERE status = 'completed';
+
+ALTER TABLE payment_refunds
+  ADD CONSTRAINT payment_refunds_status_check
+  CHECK (status IN ('pending', 'succeeded', 'failed'));
+
+CREATE INDEX IF NOT EXISTS payment_refunds_order_id_idx
+  ON payment_refunds (order_id);
+
+CREATE TABLE IF NOT EXISTS payment_refund_items (
+  id BIGSERIAL PRIMARY KEY,
+  refund_id BIGINT NOT NULL REFERENCES payment_refunds(id) ON DELETE CASCADE,
+  order_item_id BIGINT NOT NULL REFERENCES order_items(id),
+  product_id BIGINT,
+  quantity INT NOT NULL CHECK (quantity > 0),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS payment_refund_items_refund_id_idx
+  ON payment_refund_items (refund_id);
+CREATE INDEX IF NOT EXISTS payment_refund_items_order_item_id_idx
+  ON payment_refund_items (order_item_id);
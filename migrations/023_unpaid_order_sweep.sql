@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS orders_unpaid_created_at_idx
+  ON orders (created_at)
+  WHERE status = 'pending' AND payment_status = 'unpaid';
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS ucp_signing_keys (
+  id BIGSERIAL PRIMARY KEY,
+  kid TEXT NOT NULL UNIQUE,
+  algorithm TEXT NOT NULL,
+  public_key JSONB NOT NULL,
+  encrypted_private_key TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'retired')),
+  expires_at TIMESTAMPTZ,
+  retired_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS ucp_signing_keys_status_created_at_idx
+  ON ucp_signing_keys (status, created_at DESC);
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS ucp_webhook_subscriptions (
+  id BIGSERIAL PRIMARY KEY,
+  client_id TEXT NOT NULL,
+  url TEXT NOT NULL,
+  secret TEXT,
+  event_types TEXT,
+  active BOOLEAN NOT NULL DEFAULT TRUE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS ucp_webhook_subscriptions_client_id_idx
+  ON ucp_webhook_subscriptions (client_id);
+
+ALTER TABLE ucp_webhook_jobs ADD COLUMN IF NOT EXISTS subscription_id BIGINT;
+
+CREATE INDEX IF NOT EXISTS ucp_webhook_jobs_subscription_id_idx
+  ON ucp_webhook_jobs (subscription_id);
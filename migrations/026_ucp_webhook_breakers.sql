@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS ucp_webhook_breakers (
+  id BIGSERIAL PRIMARY KEY,
+  destination TEXT NOT NULL UNIQUE,
+  state TEXT NOT NULL CHECK (state IN ('closed', 'open', 'half_open')),
+  consecutive_failures INT NOT NULL DEFAULT 0,
+  opened_at TIMESTAMPTZ,
+  retry_at TIMESTAMPTZ,
+  last_error TEXT,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
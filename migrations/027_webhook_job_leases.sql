@@ -0,0 +1,6 @@
+ALTER TABLE ucp_webhook_jobs ADD COLUMN IF NOT EXISTS lease_owner TEXT;
+ALTER TABLE ucp_webhook_jobs ADD COLUMN IF NOT EXISTS lease_expires_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_ucp_webhook_jobs_lease
+  ON ucp_webhook_jobs (lease_expires_at)
+  WHERE status = 'processing';
@@ -0,0 +1,6 @@
+ALTER TABLE webhook_dlq ADD COLUMN IF NOT EXISTS event_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE webhook_dlq ADD COLUMN IF NOT EXISTS event_type TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_webhook_dlq_created_at ON webhook_dlq (created_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_dlq_reason ON webhook_dlq (reason);
+CREATE INDEX IF NOT EXISTS idx_webhook_replay_logs_job_id ON webhook_replay_logs (job_id);
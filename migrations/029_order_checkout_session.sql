@@ -0,0 +1,6 @@
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS checkout_session_id TEXT;
+
+UPDATE orders SET checkout_session_id = substring(order_no FROM 5)
+WHERE checkout_session_id IS NULL AND order_no LIKE 'ORD-%';
+
+CREATE INDEX IF NOT EXISTS idx_orders_checkout_session_id ON orders (checkout_session_id);
@@ -0,0 +1 @@
+ALTER TABLE ucp_webhook_jobs ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS jwk_set_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS jwks_cache_seconds INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE ucp_webhook_audit ADD COLUMN IF NOT EXISTS sender VARCHAR(255) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_ucp_webhook_audit_sender ON ucp_webhook_audit (sender);
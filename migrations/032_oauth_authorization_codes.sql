@@ -0,0 +1,17 @@
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS redirect_uris TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes (
+  id BIGSERIAL PRIMARY KEY,
+  code TEXT NOT NULL UNIQUE,
+  client_id TEXT NOT NULL,
+  user_id BIGINT NOT NULL,
+  redirect_uri TEXT NOT NULL,
+  scopes TEXT NOT NULL DEFAULT '',
+  code_challenge TEXT NOT NULL,
+  code_challenge_method TEXT NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_oauth_authorization_codes_expires_at ON oauth_authorization_codes (expires_at);
@@ -0,0 +1,17 @@
+ALTER TABLE oauth_tokens ADD COLUMN IF NOT EXISTS family_id TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_oauth_tokens_family_id ON oauth_tokens (family_id);
+
+CREATE TABLE IF NOT EXISTS oauth_refresh_tokens (
+  id BIGSERIAL PRIMARY KEY,
+  token_hash TEXT NOT NULL UNIQUE,
+  family_id TEXT NOT NULL,
+  client_id TEXT NOT NULL,
+  user_id BIGINT,
+  scopes TEXT NOT NULL DEFAULT '',
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ,
+  revoked_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_oauth_refresh_tokens_family_id ON oauth_refresh_tokens (family_id);
@@ -0,0 +1,4 @@
+ALTER TABLE checkout_sessions
+  ADD COLUMN IF NOT EXISTS client_id TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_checkout_sessions_client_id ON checkout_sessions (client_id);
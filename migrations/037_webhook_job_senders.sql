@@ -0,0 +1,2 @@
+ALTER TABLE ucp_webhook_jobs
+  ADD COLUMN IF NOT EXISTS sender TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+ALTER TABLE webhook_dlq ADD COLUMN IF NOT EXISTS replayed_at TIMESTAMPTZ NULL;
+
+CREATE INDEX IF NOT EXISTS idx_webhook_dlq_replayed_at ON webhook_dlq (replayed_at);
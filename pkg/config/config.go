@@ -14,6 +14,7 @@ type Config struct {
 	Log      LogConfig
 	Cache    CacheConfig
 	Queue    QueueConfig
+	Order    OrderConfig
 	UCP      UCPConfig
 }
 
@@ -46,6 +47,16 @@ type RedisConfig struct {
 type JWTConfig struct {
 	Secret     string
 	ExpireHour int
+	// SigningAlgorithm RS256 or ES256 signs access tokens with database keys,
+	// published at /oauth2/jwks; empty or HS256 keeps the shared secret.
+	SigningAlgorithm string `mapstructure:"signing_algorithm"`
+	// SigningKeyEncryptionKey (base64, 32 bytes) seals the stored private keys.
+	SigningKeyEncryptionKey string `mapstructure:"signing_key_encryption_key"`
+	KeyRotationHours        int    `mapstructure:"key_rotation_hours"`
+	KeyOverlapHours         int    `mapstructure:"key_overlap_hours"`
+	// AcceptHS256 keeps secret-signed tokens valid after switching, until
+	// those already issued have expired.
+	AcceptHS256 bool `mapstructure:"accept_hs256"`
 }
 
 type LogConfig struct {
@@ -63,10 +74,24 @@ type QueueConfig struct {
 	ConsumerGroup string
 }
 
+type OrderConfig struct {
+	// PaymentWindowMinutes is how long an order may stay unpaid before the
+	// worker cancels it; 0 disables the sweep.
+	PaymentWindowMinutes int `mapstructure:"payment_window_minutes"`
+	CancelBatchSize      int `mapstructure:"cancel_batch_size"`
+}
+
 type UCPConfig struct {
-	Links           []UCPLinkConfig  `mapstructure:"links"`
-	ContinueURLBase string           `mapstructure:"continue_url_base"`
-	Webhook         UCPWebhookConfig `mapstructure:"webhook"`
+	Links                 []UCPLinkConfig  `mapstructure:"links"`
+	ContinueURLBase       string           `mapstructure:"continue_url_base"`
+	ReservationTTLMinutes int              `mapstructure:"reservation_ttl_minutes"`
+	Webhook               UCPWebhookConfig `mapstructure:"webhook"`
+	// OAuthConsentURL is the storefront page that asks the logged-in shopper
+	// to approve an agent; /oauth2/authorize forwards its query there.
+	OAuthConsentURL string `mapstructure:"oauth_consent_url"`
+	// PaymentEnvironment is "test" in development; only then is the sandbox
+	// payment provider registered and seeded.
+	PaymentEnvironment string `mapstructure:"payment_environment"`
 }
 
 type UCPLinkConfig struct {
@@ -83,6 +108,27 @@ type UCPWebhookConfig struct {
 	SkipSignatureVerify bool   `mapstructure:"skip_signature_verify"`
 	AlertMinAttempts    int    `mapstructure:"alert_min_attempts"`
 	AlertDedupeSeconds  int    `mapstructure:"alert_dedupe_seconds"`
+	// SigningKeyFile holds the P-256 key outbound webhooks are signed with;
+	// it is generated on first start when missing.
+	SigningKeyFile string `mapstructure:"signing_key_file"`
+	SigningKeyID   string `mapstructure:"signing_key_id"`
+	// SigningKeyEncryptionKey (base64, 32 bytes) switches signing to the
+	// database key store and seals the stored private keys.
+	SigningKeyEncryptionKey string `mapstructure:"signing_key_encryption_key"`
+	SigningKeyOverlapHours  int    `mapstructure:"signing_key_overlap_hours"`
+	// Per-destination delivery protection in the worker. A zero rate limit
+	// leaves deliveries unthrottled.
+	BreakerFailureThreshold int     `mapstructure:"breaker_failure_threshold"`
+	BreakerOpenSeconds      int     `mapstructure:"breaker_open_seconds"`
+	RateLimitPerSecond      float64 `mapstructure:"rate_limit_per_second"`
+	RateLimitBurst          int     `mapstructure:"rate_limit_burst"`
+	// WorkerConcurrency goroutines deliver in parallel; claimed jobs are
+	// leased for WorkerLeaseSeconds before another worker may take them.
+	WorkerConcurrency  int `mapstructure:"worker_concurrency"`
+	WorkerLeaseSeconds int `mapstructure:"worker_lease_seconds"`
+	// TrustedProfileHosts may be named in a sender's UCP-Agent profile; the
+	// profile's signing_keys then verify that sender's order webhooks.
+	TrustedProfileHosts []string `mapstructure:"trusted_profile_hosts"`
 }
 
 func Load(configPath string) (*Config, error) {
@@ -122,6 +122,10 @@ func (db *DB) Exec(sql string, values ...interface{}) *gorm.DB {
 	return db.conn.Exec(sql, values...)
 }
 
+func (db *DB) Raw(sql string, values ...interface{}) *gorm.DB {
+	return db.conn.Raw(sql, values...)
+}
+
 func (db *DB) Update(attrs ...interface{}) *gorm.DB {
 	return db.conn.Update(attrs...)
 }
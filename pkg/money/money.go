@@ -0,0 +1,163 @@
+// Package money represents monetary amounts as integer minor units (cents,
+// fen, yen) so that totals, refunds and comparisons never go through float
+// arithmetic. Whenever a value has to be rounded, it is rounded half to even
+// (banker's rounding).
+package money
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Amount is a quantity of money in the minor unit of its currency. It
+// marshals to JSON as a plain integer, matching UCP totals.
+type Amount int64
+
+// DefaultCurrency is the currency assumed when none is recorded.
+const DefaultCurrency = "CNY"
+
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// exponents lists ISO 4217 currencies whose minor unit is not 1/100.
+var exponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0,
+	"KRW": 0, "PYG": 0, "RWF": 0, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0,
+	"XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// Exponent returns the number of decimal places in the currency's minor unit.
+func Exponent(currency string) int {
+	if exp, ok := exponents[strings.ToUpper(strings.TrimSpace(currency))]; ok {
+		return exp
+	}
+	return 2
+}
+
+// Parse reads a decimal major-unit string such as "12.345" and rounds it to
+// the currency's minor unit.
+func Parse(value, currency string) (Amount, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, ErrInvalidAmount
+	}
+	rat, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return 0, ErrInvalidAmount
+	}
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(Exponent(currency))), nil)
+	rat.Mul(rat, new(big.Rat).SetInt(scale))
+	minor, ok := roundRatHalfEven(rat)
+	if !ok {
+		return 0, ErrInvalidAmount
+	}
+	return Amount(minor), nil
+}
+
+// FromMajor converts a major-unit float such as a catalog price. The float is
+// read through its shortest decimal representation, so 12.345 rounds as the
+// decimal 12.345 rather than its binary approximation.
+func FromMajor(value float64, currency string) Amount {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0
+	}
+	amount, err := Parse(strconv.FormatFloat(value, 'f', -1, 64), currency)
+	if err != nil {
+		return 0
+	}
+	return amount
+}
+
+// Major returns the amount in major units. It is meant for display and for
+// legacy float fields only; do not feed the result back into arithmetic.
+func (a Amount) Major(currency string) float64 {
+	return float64(a) / math.Pow10(Exponent(currency))
+}
+
+// Decimal formats the amount in major units with the currency's precision,
+// e.g. "12.30" for CNY or "1230" for JPY.
+func (a Amount) Decimal(currency string) string {
+	exp := Exponent(currency)
+	sign := ""
+	value := int64(a)
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+	digits := strconv.FormatInt(value, 10)
+	if exp == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exp {
+		digits = strings.Repeat("0", exp-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exp] + "." + digits[len(digits)-exp:]
+}
+
+// Mul multiplies the amount by a whole quantity.
+func (a Amount) Mul(quantity int) Amount {
+	return a * Amount(quantity)
+}
+
+// MulRate applies a fractional rate such as a tax rate of 0.0825.
+func (a Amount) MulRate(rate float64) Amount {
+	if math.IsNaN(rate) || math.IsInf(rate, 0) {
+		return 0
+	}
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(rate, 'f', -1, 64))
+	if !ok {
+		return 0
+	}
+	r.Mul(r, new(big.Rat).SetInt64(int64(a)))
+	minor, _ := roundRatHalfEven(r)
+	return Amount(minor)
+}
+
+// Percent applies a percentage expressed in basis points (1000 = 10%).
+func (a Amount) Percent(basisPoints int64) Amount {
+	return a.Scale(basisPoints, 10000)
+}
+
+// Scale returns a*numerator/denominator, used to spread an amount across
+// lines in proportion to their share.
+func (a Amount) Scale(numerator, denominator int64) Amount {
+	if denominator == 0 {
+		return 0
+	}
+	r := new(big.Rat).SetFrac(big.NewInt(numerator), big.NewInt(denominator))
+	r.Mul(r, new(big.Rat).SetInt64(int64(a)))
+	minor, _ := roundRatHalfEven(r)
+	return Amount(minor)
+}
+
+// Min returns the smaller of two amounts.
+func Min(a, b Amount) Amount {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func roundRatHalfEven(r *big.Rat) (int64, bool) {
+	num := new(big.Int).Set(r.Num())
+	den := r.Denom()
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Sign() != 0 {
+		twice := new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2))
+		cmp := twice.Cmp(den)
+		if cmp > 0 || (cmp == 0 && quo.Bit(0) == 1) {
+			if num.Sign() < 0 {
+				quo.Sub(quo, big.NewInt(1))
+			} else {
+				quo.Add(quo, big.NewInt(1))
+			}
+		}
+	}
+	if !quo.IsInt64() {
+		return 0, false
+	}
+	return quo.Int64(), true
+}
@@ -0,0 +1,76 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseRoundsHalfToEven(t *testing.T) {
+	cases := []struct {
+		value    string
+		currency string
+		want     Amount
+	}{
+		{"12.345", "CNY", 1234},
+		{"12.355", "CNY", 1236},
+		{"-0.125", "USD", -12},
+		{"1200.5", "JPY", 1200},
+		{"1201.5", "JPY", 1202},
+		{"1.2345", "KWD", 1234},
+		{"19.99", "", 1999},
+	}
+	for _, tc := range cases {
+		got, err := Parse(tc.value, tc.currency)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tc.value, err)
+		}
+		if got != tc.want {
+			t.Fatalf("parse %q %s: expected %d, got %d", tc.value, tc.currency, tc.want, got)
+		}
+	}
+	if _, err := Parse("abc", "CNY"); err != ErrInvalidAmount {
+		t.Fatalf("expected invalid amount, got %v", err)
+	}
+}
+
+func TestFromMajorUsesDecimalValue(t *testing.T) {
+	if got := FromMajor(0.1+0.2, "CNY"); got != 30 {
+		t.Fatalf("expected 30, got %d", got)
+	}
+	if got := FromMajor(2.675, "USD"); got != 268 {
+		t.Fatalf("expected 268, got %d", got)
+	}
+}
+
+func TestMulRateAndPercent(t *testing.T) {
+	if got := Amount(250).MulRate(0.1); got != 25 {
+		t.Fatalf("expected 25, got %d", got)
+	}
+	if got := Amount(125).MulRate(0.1); got != 12 {
+		t.Fatalf("expected 12, got %d", got)
+	}
+	if got := Amount(135).MulRate(0.1); got != 14 {
+		t.Fatalf("expected 14, got %d", got)
+	}
+	if got := Amount(1999).Percent(1500); got != 300 {
+		t.Fatalf("expected 300, got %d", got)
+	}
+}
+
+func TestDecimalAndJSON(t *testing.T) {
+	if got := Amount(5).Decimal("CNY"); got != "0.05" {
+		t.Fatalf("expected 0.05, got %s", got)
+	}
+	if got := Amount(-1234).Decimal("KWD"); got != "-1.234" {
+		t.Fatalf("expected -1.234, got %s", got)
+	}
+	if got := Amount(1200).Decimal("JPY"); got != "1200" {
+		t.Fatalf("expected 1200, got %s", got)
+	}
+	raw, _ := json.Marshal(struct {
+		Total Amount `json:"total"`
+	}{Total: 1999})
+	if string(raw) != `{"total":1999}` {
+		t.Fatalf("unexpected json %s", raw)
+	}
+}
@@ -39,12 +39,17 @@ func main() {
 		Spec:         "https://nowpayments.io",
 		ConfigSchema: "https://nowpayments.io",
 		APIBase:      "https://api.nowpayments.io",
-		Environment:  "test",
+		Environment:  cfg.UCP.PaymentEnvironment,
 	}
 
 	if err := seed.SeedNowPayments(repo, seedConfig); err != nil {
 		log.Fatalf("Failed to seed payment handlers: %v", err)
 	}
+	if seedConfig.Environment == "test" {
+		if err := seed.SeedSandbox(repo); err != nil {
+			log.Fatalf("Failed to seed sandbox payment handler: %v", err)
+		}
+	}
 
 	log.Println("Payment handlers seeded successfully")
 }